@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// siteCookies 页面、图片和接口请求共用的 Cookie，保存站点在确认年龄等操作后设置的 Cookie
+// 配置方案 headers 中的 Cookie 仍然附加在每个请求上
+var siteCookies, _ = cookiejar.New(nil)
+
+// ageGateEnabled 自动确认成人内容的年龄确认页面，--no-age-gate 关闭
+var ageGateEnabled = true
+
+// errAgeGate 自动确认后仍然是年龄确认页面
+var errAgeGate = errors.New("页面需要确认年龄")
+
+// ageGateMarkers 年龄确认页面上的提示文字
+var ageGateMarkers = []string{
+	"未满18", "年满18", "已满18", "18岁以上", "18歲以上", "成人内容", "成人內容", "限制级内容",
+	"adult content", "are you 18", "over 18", "18 or older", "age verification", "confirm your age",
+}
+
+// ageConfirmPattern 确认按钮或链接的文字
+var ageConfirmPattern = regexp.MustCompile(`(?i)(已满|年满|我已|確認|确认|同意|进入|進入|继续|繼續|是的|enter|yes|i am|agree|continue|confirm)`)
+
+// ageCookiePattern 页面脚本中设置 Cookie 的语句，如 document.cookie = "isAdult=1; path=/"
+var ageCookiePattern = regexp.MustCompile(`document\.cookie\s*=\s*["'\x60]([\w.\-]+)=([^;"'\x60]*)`)
+
+// ageGateCookies 页面中找不到确认表单、链接和脚本时尝试的常见 Cookie
+var ageGateCookies = []*http.Cookie{
+	{Name: "isAdult", Value: "1"},
+	{Name: "adult", Value: "1"},
+	{Name: "age_verified", Value: "1"},
+	{Name: "over18", Value: "1"},
+	{Name: "agreed", Value: "true"},
+}
+
+// ageGate 识别出的年龄确认方式，按 form、link、cookies 的顺序使用
+type ageGate struct {
+	form    *goquery.Selection
+	link    string
+	cookies []*http.Cookie
+}
+
+// detectAgeGate 检查页面是否为年龄确认页面：有年龄提示并且几乎没有图片（确认前不显示漫画），
+// 避免简介或标签中的提示被误判。不是年龄确认页面时返回nil
+func detectAgeGate(doc *goquery.Document) *ageGate {
+	if doc.Find("img").Length() > lockedMaxImages {
+		return nil
+	}
+	text := strings.ToLower(doc.Find("body").Text())
+	matched := false
+	for _, marker := range ageGateMarkers {
+		if strings.Contains(text, strings.ToLower(marker)) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil
+	}
+
+	gate := &ageGate{}
+	doc.Find("form").EachWithBreak(func(i int, form *goquery.Selection) bool {
+		if ageConfirmPattern.MatchString(form.Find("button, input[type=submit]").Text() + form.Find("input[type=submit]").AttrOr("value", "")) {
+			gate.form = form
+			return false
+		}
+		return true
+	})
+	doc.Find("a[href]").EachWithBreak(func(i int, a *goquery.Selection) bool {
+		href := strings.TrimSpace(a.AttrOr("href", ""))
+		if href == "" || href == "#" || strings.HasPrefix(href, "javascript:") {
+			return true
+		}
+		if ageConfirmPattern.MatchString(strings.TrimSpace(a.Text())) {
+			gate.link = href
+			return false
+		}
+		return true
+	})
+	doc.Find("script").Each(func(i int, script *goquery.Selection) {
+		for _, m := range ageCookiePattern.FindAllStringSubmatch(script.Text(), -1) {
+			gate.cookies = append(gate.cookies, &http.Cookie{Name: m[1], Value: m[2]})
+		}
+	})
+	return gate
+}
+
+// pass 确认年龄：提交确认表单、打开确认链接，或者设置 Cookie，之后重新请求原页面即可
+func (g *ageGate) pass(ctx context.Context, page *url.URL) error {
+	switch {
+	case g.form != nil:
+		action, _ := url.Parse(strings.TrimSpace(g.form.AttrOr("action", "")))
+		target := page.ResolveReference(action)
+		values := url.Values{}
+		g.form.Find("input[name]").Each(func(i int, input *goquery.Selection) {
+			name := input.AttrOr("name", "")
+			switch strings.ToLower(input.AttrOr("type", "text")) {
+			case "checkbox", "radio":
+				values.Set(name, input.AttrOr("value", "on"))
+			case "hidden", "submit":
+				values.Set(name, input.AttrOr("value", ""))
+			}
+		})
+		if button := g.form.Find("button[name]").First(); button.Length() > 0 {
+			values.Set(button.AttrOr("name", ""), button.AttrOr("value", ""))
+		}
+		verbosef("提交年龄确认表单: %s\n", target)
+		return ageGateRequest(ctx, strings.ToUpper(g.form.AttrOr("method", "GET")), target, values, page)
+	case g.link != "":
+		ref, err := url.Parse(g.link)
+		if err != nil {
+			return err
+		}
+		target := page.ResolveReference(ref)
+		verbosef("打开年龄确认链接: %s\n", target)
+		return ageGateRequest(ctx, "GET", target, nil, page)
+	}
+
+	cookies := g.cookies
+	if len(cookies) == 0 {
+		cookies = ageGateCookies
+	}
+	root := &url.URL{Scheme: page.Scheme, Host: page.Host, Path: "/"}
+	for _, c := range cookies {
+		verbosef("设置年龄确认 Cookie: %s=%s\n", c.Name, c.Value)
+		siteCookies.SetCookies(root, []*http.Cookie{{Name: c.Name, Value: c.Value, Path: "/"}})
+	}
+	return nil
+}
+
+// ageGateRequest 发送确认请求，站点返回的 Cookie 保存在 siteCookies 中
+func ageGateRequest(ctx context.Context, method string, target *url.URL, values url.Values, referer *url.URL) error {
+	if err := politeMode.check(ctx, target.String()); err != nil {
+		return err
+	}
+	siteBreaker.wait()
+
+	ctx, cancel := context.WithTimeout(ctx, pageTimeout)
+	defer cancel()
+	var body io.Reader
+	if method == http.MethodPost {
+		body = strings.NewReader(values.Encode())
+	} else if len(values) > 0 {
+		query := target.Query()
+		for key, v := range values {
+			query[key] = v
+		}
+		u := *target
+		u.RawQuery = query.Encode()
+		target = &u
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", siteBreaker.userAgent())
+	req.Header.Set("Referer", referer.String())
+	if method == http.MethodPost {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	setExtraHeaders(req)
+
+	client := &http.Client{Transport: pageTransport(), Jar: siteCookies, CheckRedirect: checkRedirect}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+	siteBreaker.record(resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		return &httpStatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+// fetchPage 获取并解析网页内容，遇到年龄确认页面时自动确认后重新请求一次
+func fetchPage(ctx context.Context, pageURL string) (*goquery.Document, error) {
+	doc, err := fetchPageOnce(ctx, pageURL)
+	if err != nil || !ageGateEnabled {
+		return doc, err
+	}
+	gate := detectAgeGate(doc)
+	if gate == nil {
+		return doc, nil
+	}
+
+	infof("检测到年龄确认页面，自动确认后重新请求\n")
+	if err := gate.pass(ctx, doc.Url); err != nil {
+		return nil, fmt.Errorf("%w，自动确认失败: %v", errAgeGate, err)
+	}
+	doc, err = fetchPageOnce(ctx, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if detectAgeGate(doc) != nil {
+		return nil, fmt.Errorf("%w，自动确认未成功，请在浏览器中确认后将 Cookie 写入配置方案的 headers", errAgeGate)
+	}
+	return doc, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// titleOverride 命令行 --title 指定的漫画名称，覆盖网站上的标题并记入漫画库
+var titleOverride string
+
+// resolveTitle 确定漫画保存使用的名称，优先级: --title、该漫画固定的名称、标题别名、网站上的标题
+// 指定 --title 时记住该名称，以后更新同一部漫画或在其他镜像站遇到同一标题时都保存到同一目录
+func (db *libraryDB) resolveTitle(s *seriesRecord, scraped string) string {
+	if titleOverride != "" {
+		title := sanitizeFileName(titleOverride)
+		if s != nil {
+			s.TitleOverride = title
+		}
+		if scraped != "" && scraped != title {
+			db.setAlias(scraped, title)
+		}
+		return title
+	}
+	if s != nil && s.TitleOverride != "" {
+		return s.TitleOverride
+	}
+	if title, ok := db.Aliases[scraped]; ok {
+		return title
+	}
+	return scraped
+}
+
+// setAlias 记录标题别名：网站上的标题为 from 的漫画保存为 to
+func (db *libraryDB) setAlias(from, to string) {
+	if db.Aliases == nil {
+		db.Aliases = make(map[string]string)
+	}
+	db.Aliases[from] = to
+}
+
+// localTitle 本地文件或目录的漫画名称，同样遵循 --title 和标题别名
+func localTitle(scraped string) string {
+	db, err := loadLibrary()
+	if err != nil {
+		if titleOverride != "" {
+			return sanitizeFileName(titleOverride)
+		}
+		return scraped
+	}
+	title := db.resolveTitle(nil, scraped)
+	if titleOverride != "" {
+		if err := db.save(); err != nil {
+			fmt.Printf("保存漫画库失败: %v\n", err)
+		}
+	}
+	return title
+}
+
+// runAliasCommand 管理标题别名
+func runAliasCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("用法: ./comicbox alias list|add|remove [<网站上的标题>|<漫画ID> [<保存使用的名称>]]")
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		if len(db.Aliases) == 0 {
+			fmt.Println("没有标题别名")
+		}
+		var names []string
+		for from := range db.Aliases {
+			names = append(names, from)
+		}
+		sort.Strings(names)
+		for _, from := range names {
+			fmt.Printf("%s -> %s\n", from, db.Aliases[from])
+		}
+		for _, s := range db.Series {
+			if s.TitleOverride != "" {
+				fmt.Printf("漫画 %s 固定保存为: %s\n", s.ID, s.TitleOverride)
+			}
+		}
+		return
+	case "add":
+		if len(args) < 3 {
+			fmt.Println("请指定网站上的标题和保存使用的名称")
+			return
+		}
+		db.setAlias(args[1], sanitizeFileName(args[2]))
+	case "remove":
+		if len(args) < 2 {
+			fmt.Println("请指定要移除的标题")
+			return
+		}
+		// 参数为漫画ID时取消该漫画固定的名称
+		if s := db.findSeries(args[1]); s != nil && s.TitleOverride != "" {
+			s.TitleOverride = ""
+		} else if _, ok := db.Aliases[args[1]]; ok {
+			delete(db.Aliases, args[1])
+		} else {
+			fmt.Printf("没有标题别名 %s\n", args[1])
+			return
+		}
+	default:
+		fmt.Printf("未知的操作: %s\n", args[0])
+		return
+	}
+
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+		return
+	}
+	fmt.Println("已更新标题别名")
+}
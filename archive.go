@@ -0,0 +1,167 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// archiveMode 存档模式，由 --archive 或配置文件的 archive 开启：关注的漫画每下载完一个新章节，
+// 立即打包为CBZ并校验，保存章节页面的原始HTML和元数据，记录校验和，适合存档可能被站点删除的内容
+var archiveMode bool
+
+// archiveDirName 漫画目录中保存原始网页和元数据的目录，清理原始图片时不会删除
+const archiveDirName = ".archive"
+
+// archiveSumsFile 漫画目录中的校验和文件，格式与 sha256sum 相同，在漫画目录中运行 sha256sum -c SHA256SUMS 校验
+const archiveSumsFile = "SHA256SUMS"
+
+// rawPages 存档模式下获取的页面原始内容，按请求地址保存，章节存档后删除
+var rawPages = struct {
+	sync.Mutex
+	pages map[string][]byte
+}{pages: map[string][]byte{}}
+
+// rememberRawPage 保存页面的原始内容，只在存档模式下调用
+func rememberRawPage(pageURL string, content []byte) {
+	rawPages.Lock()
+	rawPages.pages[pageURL] = content
+	rawPages.Unlock()
+}
+
+// takeRawPage 取出并删除页面的原始内容，没有时返回nil（如通过接口获取的章节）
+func takeRawPage(pageURL string) []byte {
+	rawPages.Lock()
+	defer rawPages.Unlock()
+	content := rawPages.pages[pageURL]
+	delete(rawPages.pages, pageURL)
+	return content
+}
+
+// clearRawPages 删除保存的页面内容，一部漫画下载结束时调用，未存档的章节页面不再保留
+func clearRawPages() {
+	rawPages.Lock()
+	rawPages.pages = map[string][]byte{}
+	rawPages.Unlock()
+}
+
+var packWarning sync.Once
+
+// archiveChapter 存档一个下载完成的章节：保存原始HTML、chapter.json 和 series.json，打包为CBZ并校验，
+// 最后把这些文件的校验和写入漫画目录的 SHA256SUMS
+func archiveChapter(seriesDir, chapterDir, sourceURL string) error {
+	dir := filepath.Join(seriesDir, archiveDirName, filepath.Base(chapterDir))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var files []string
+	if content := takeRawPage(sourceURL); content != nil {
+		if err := writeFileAtomic(filepath.Join(dir, "page.html"), content); err != nil {
+			return fmt.Errorf("保存原始网页失败: %v", err)
+		}
+		files = append(files, filepath.Join(dir, "page.html"))
+	}
+	for _, meta := range []string{filepath.Join(chapterDir, chapterMetaFile), filepath.Join(seriesDir, seriesMetaFile)} {
+		if fileSize(meta) == 0 {
+			continue
+		}
+		dst := filepath.Join(dir, filepath.Base(meta))
+		if err := copyFile(meta, dst); err != nil {
+			return fmt.Errorf("保存 %s 失败: %v", filepath.Base(meta), err)
+		}
+		files = append(files, dst)
+	}
+
+	if packPath := findPackTool(); packPath == "" {
+		packWarning.Do(func() {
+			fmt.Println("警告: 未找到 pack 工具，存档模式下只保存原始网页和元数据，不打包章节")
+		})
+	} else {
+		cmd := exec.Command(packPath, "-o", seriesDir, chapterDir)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("打包失败: %v\n%s", err, output)
+		}
+		cbz := chapterDir + ".cbz"
+		if err := verifyZip(cbz); err != nil {
+			return fmt.Errorf("校验 %s 失败: %v", filepath.Base(cbz), err)
+		}
+		files = append(files, cbz)
+		runPlugins(pluginEvent{Event: pluginChapterPacked, Dir: chapterDir, Archive: cbz})
+	}
+
+	sums := make(map[string]string, len(files))
+	for _, file := range files {
+		sum, err := fileSHA256(file)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(seriesDir, file)
+		if err != nil {
+			return err
+		}
+		sums[filepath.ToSlash(rel)] = sum
+	}
+	if err := updateSumsFile(filepath.Join(seriesDir, archiveSumsFile), sums); err != nil {
+		return fmt.Errorf("写入 %s 失败: %v", archiveSumsFile, err)
+	}
+	verbosef("已存档章节 %s（%d 个文件）\n", filepath.Base(chapterDir), len(files))
+	return nil
+}
+
+// verifyZip 读取压缩包中的每个文件，检查 CRC 是否一致
+func verifyZip(path string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name, err)
+		}
+	}
+	return nil
+}
+
+// updateSumsFile 更新 sha256sum 格式的校验和文件，同名的记录替换为新的值，按路径排序
+func updateSumsFile(path string, sums map[string]string) error {
+	merged := map[string]string{}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			sum, name, ok := strings.Cut(scanner.Text(), "  ")
+			if ok {
+				merged[name] = sum
+			}
+		}
+		f.Close()
+	}
+	for name, sum := range sums {
+		merged[name] = sum
+	}
+
+	names := make([]string, 0, len(merged))
+	for name := range merged {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", merged[name], name)
+	}
+	return writeFileAtomic(path, []byte(b.String()))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// asciiNames 目录和文件名只使用 ASCII 字符：汉字转为拼音，由 --ascii-names 或配置文件的 ascii_names 开启
+// 只影响保存的路径，元数据中仍记录原来的标题
+var asciiNames bool
+
+// pinyinData 常用汉字（U+4E00–U+9FFF）的拼音表，每行为一个不带声调的拼音及读这个音的汉字，多音字取最常用的读音
+//
+//go:embed pinyin.txt
+var pinyinData string
+
+// pinyinTable 汉字 -> 拼音，第一次使用时从 pinyinData 建立
+var pinyinTable map[rune]string
+
+// asciiPunctuation 标题中常见的全角标点对应的 ASCII 字符
+var asciiPunctuation = map[rune]string{
+	'，': ",", '。': ".", '、': ",", '！': "!", '？': "?", '：': "-", '；': ";",
+	'（': "(", '）': ")", '【': "[", '】': "]", '《': "", '》': "", '「': "", '」': "", '『': "", '』': "",
+	'〈': "", '〉': "", '“': "", '”': "", '‘': "'", '’': "'", '～': "~", '—': "-", '…': "...", '·': " ", '　': " ",
+}
+
+// loadPinyinTable 解析拼音表
+func loadPinyinTable() {
+	pinyinTable = make(map[rune]string, 21000)
+	for _, line := range strings.Split(pinyinData, "\n") {
+		syllable, chars, ok := strings.Cut(line, " ")
+		if !ok {
+			continue
+		}
+		for _, r := range chars {
+			pinyinTable[r] = syllable
+		}
+	}
+}
+
+// pathName 标题对应的目录名或文件名，开启 --ascii-names 时转为 ASCII
+func pathName(title string) string {
+	if !asciiNames {
+		return title
+	}
+	return asciiName(title)
+}
+
+// asciiName 把标题转为只含 ASCII 字符的文件名：汉字转为拼音并用空格分隔，全角字母数字和常见标点转为半角，
+// 其他无法转换的字符（如日文假名）替换为下划线
+func asciiName(title string) string {
+	if pinyinTable == nil {
+		loadPinyinTable()
+	}
+	var b strings.Builder
+	// afterPinyin 上一个字符是否为汉字：拼音与前后的字母数字之间用空格分开
+	afterPinyin := false
+	for _, r := range title {
+		if syllable, ok := pinyinTable[r]; ok {
+			if s := b.String(); afterPinyin || s != "" && isAlnum(rune(s[len(s)-1])) {
+				b.WriteByte(' ')
+			}
+			b.WriteString(syllable)
+			afterPinyin = true
+			continue
+		}
+		punct, ok := asciiPunctuation[r]
+		if !ok && r >= '！' && r <= '～' {
+			// 全角字母、数字和符号
+			r -= 0xFEE0
+		}
+		switch {
+		case ok:
+			b.WriteString(punct)
+		case r < utf8.RuneSelf:
+			if afterPinyin && isAlnum(r) {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+		afterPinyin = false
+	}
+	name := strings.Join(strings.Fields(b.String()), " ")
+	for strings.Contains(name, "__") {
+		name = strings.ReplaceAll(name, "__", "_")
+	}
+	name = sanitizeFileName(name)
+	if strings.Trim(name, "_ .") == "" {
+		return "untitled"
+	}
+	return name
+}
+
+func isAlnum(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
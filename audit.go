@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// auditPage 修复计划中需要重新下载的一页
+type auditPage struct {
+	Page   int    `json:"page"` // 页码，从1开始
+	Reason string `json:"reason"`
+}
+
+// auditAction 修复计划中的一个章节
+type auditAction struct {
+	Dir         string      `json:"dir"`
+	Title       string      `json:"title"`
+	LocalPages  int         `json:"local_pages"`  // chapter.json 中记录的图片数
+	SourcePages int         `json:"source_pages"` // 重新获取的章节页面中的图片数
+	Pages       []auditPage `json:"pages"`        // 需要重新下载的页
+	Note        string      `json:"note,omitempty"`
+}
+
+// runAuditCommand 重新获取漫画每个章节的页面，与本地的 chapter.json、文件和校验和比较，
+// 列出修复计划（缺少的页、损坏的页、来源中已更换的图片），--plan 时写入文件，--apply 时执行
+func runAuditCommand(args []string) {
+	apply := false
+	planFile := ""
+	var targets []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--apply":
+			apply = true
+		case "--plan":
+			if i+1 < len(args) {
+				planFile = args[i+1]
+				i++
+			}
+		default:
+			targets = append(targets, args[i])
+		}
+	}
+	if len(targets) == 0 {
+		fmt.Println("用法: ./comicbox audit <漫画目录|漫画ID>... [--plan <计划文件.json>] [--apply]")
+		return
+	}
+
+	dirs, err := verifyTargets(targets)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if len(dirs) == 0 {
+		fmt.Printf("没有找到带 %s 的章节目录\n", chapterMetaFile)
+		return
+	}
+
+	var plan []*auditAction
+	unreachable := 0
+	for i, dir := range dirs {
+		infof("[%d/%d] 检查 %s\n", i+1, len(dirs), filepath.Base(dir))
+		meta, err := loadChapterMeta(dir)
+		if err != nil {
+			fmt.Printf("%s: %v\n", dir, err)
+			continue
+		}
+		action, err := auditChapter(runContext, dir, meta)
+		if err != nil {
+			fmt.Printf("%s: 无法获取章节页面: %v\n", dir, err)
+			unreachable++
+			continue
+		}
+		if action == nil {
+			verbosef("%s: %d 页与来源一致\n", dir, len(meta.Images))
+			continue
+		}
+		printAuditAction(action)
+		plan = append(plan, action)
+	}
+
+	fmt.Printf("检查完成: 共 %d 个章节，%d 个需要修复，%d 个无法获取章节页面\n", len(dirs), len(plan), unreachable)
+	if planFile != "" {
+		data, err := json.MarshalIndent(plan, "", "  ")
+		if err == nil {
+			err = writeFileAtomic(planFile, data)
+		}
+		if err != nil {
+			fmt.Printf("写入修复计划失败: %v\n", err)
+		} else {
+			fmt.Printf("修复计划已写入 %s\n", planFile)
+		}
+	}
+	if !apply || len(plan) == 0 {
+		if len(plan) > 0 {
+			fmt.Println("使用 --apply 执行修复计划")
+		}
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	failed := 0
+	for _, action := range plan {
+		if len(action.Pages) == 0 {
+			continue
+		}
+		fmt.Printf("正在修复 %s\n", action.Title)
+		// 与下载这部漫画互斥
+		lock, err := lockSeriesDir(db, filepath.Dir(action.Dir))
+		if err == nil {
+			err = applyAuditAction(runContext, action)
+			lock.unlock()
+		}
+		if err != nil {
+			fmt.Printf("  修复失败: %v\n", err)
+			failed++
+		}
+	}
+	fmt.Printf("修复完成，%d 个章节失败\n", failed)
+}
+
+// auditChapter 重新获取章节页面并与本地记录比较，没有问题时返回nil
+func auditChapter(ctx context.Context, dir string, meta *chapterMeta) (*auditAction, error) {
+	fetched, err := fetchChapterFromMeta(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	filterChapterImages(ctx, fetched)
+
+	action := &auditAction{Dir: dir, Title: meta.Title, LocalPages: len(meta.Images), SourcePages: len(fetched.images)}
+	if len(fetched.images) < len(meta.Images) {
+		// 来源中的页变少可能是站点删除了内容，保留本地的文件，不自动修复
+		action.Note = fmt.Sprintf("来源中只有 %d 页，本地有 %d 页，可能删除了内容，不自动修复", len(fetched.images), len(meta.Images))
+		return action, nil
+	}
+
+	reasons := make(map[int]string)
+	for index, problem := range verifyChapter(dir, meta) {
+		if index < len(fetched.images) {
+			reasons[index] = problem
+		}
+	}
+	for i, img := range fetched.images {
+		if _, ok := reasons[i]; ok {
+			continue
+		}
+		switch {
+		case i >= len(meta.Images):
+			reasons[i] = "来源中新增的页"
+		case imagePath(img) != imagePath(meta.Images[i]):
+			reasons[i] = "来源中的图片已更换"
+		}
+	}
+	if len(reasons) == 0 {
+		return nil, nil
+	}
+	for index, reason := range reasons {
+		action.Pages = append(action.Pages, auditPage{Page: index + 1, Reason: reason})
+	}
+	sort.Slice(action.Pages, func(i, j int) bool { return action.Pages[i].Page < action.Pages[j].Page })
+	return action, nil
+}
+
+// imagePath 去掉图片链接的查询参数，签名或过期时间变化的链接视为同一张图片
+func imagePath(imgURL string) string {
+	return strings.SplitN(imgURL, "?", 2)[0]
+}
+
+// printAuditAction 输出一个章节的修复计划
+func printAuditAction(action *auditAction) {
+	if action.Note != "" {
+		fmt.Printf("%s: %s\n", action.Dir, action.Note)
+		return
+	}
+	fmt.Printf("%s: %d 页需要重新下载\n", action.Dir, len(action.Pages))
+	for _, p := range action.Pages {
+		fmt.Printf("  第 %d 页: %s\n", p.Page, p.Reason)
+	}
+}
+
+// fetchChapterFromMeta 按 chapter.json 中的来源链接重新获取章节页面
+func fetchChapterFromMeta(ctx context.Context, meta *chapterMeta) (*chapterPage, error) {
+	u, err := url.Parse(meta.SourceURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("章节来源不是网页链接: %s", meta.SourceURL)
+	}
+	siteBaseURL = u.Scheme + "://" + u.Host
+	return siteFor(siteBaseURL).fetchChapter(ctx, siteBaseURL, meta.ID)
+}
+
+// applyAuditAction 执行一个章节的修复计划：重新获取章节页面（链接可能已经过期），
+// 删除计划中的页后按新的图片链接下载，其余的页沿用，并更新 chapter.json
+func applyAuditAction(ctx context.Context, action *auditAction) error {
+	meta, err := loadChapterMeta(action.Dir)
+	if err != nil {
+		return err
+	}
+	fetched, err := fetchChapterFromMeta(ctx, meta)
+	if err != nil {
+		return err
+	}
+	filterChapterImages(ctx, fetched)
+	if len(fetched.images) != action.SourcePages {
+		return fmt.Errorf("章节页数在检查后又发生了变化（%d，检查时为 %d），请重新检查", len(fetched.images), action.SourcePages)
+	}
+
+	redo := make(map[int]bool)
+	for _, p := range action.Pages {
+		redo[p.Page-1] = true
+	}
+	for _, p := range meta.Pages {
+		if redo[p.Index] {
+			os.Remove(filepath.Join(action.Dir, p.File))
+			for _, part := range p.Parts {
+				os.Remove(filepath.Join(action.Dir, part))
+			}
+		}
+	}
+	meta.Images = fetched.images
+	if err := writeChapterMeta(action.Dir, meta, chapterResult{files: pageFiles(action.Dir, meta), parts: pageParts(action.Dir, meta)}); err != nil {
+		return err
+	}
+
+	result := downloadChapterImages(ctx, fetched.images, action.Dir, nil, fetched.fixup)
+	meta.ScrapedAt = time.Now()
+	meta.DeclaredPages = fetched.declared
+	if err := writeChapterMeta(action.Dir, meta, result); err != nil {
+		return err
+	}
+	if result.failed > 0 {
+		return fmt.Errorf("仍有 %d 页下载失败", result.failed)
+	}
+	fmt.Printf("  已修复 %d 页\n", len(action.Pages))
+	return nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// daemonUser daemon 服务的用户，由配置文件的 users、--user 或环境变量 COMICBOX_USERS 设置
+// 设置了任何用户后，网页、API 和 OPDS 都需要登录（Basic 认证）或携带令牌（Authorization: Bearer）
+type daemonUser struct {
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`  // 明文，或 passwd 命令生成的 pbkdf2-sha256:... 哈希
+	Token    string `json:"token,omitempty"`     // API 令牌，也可以作为 Basic 认证的密码使用
+	ReadOnly bool   `json:"read_only,omitempty"` // 只能浏览和阅读，不能提交下载或触发检查
+	SafeOnly bool   `json:"safe_only,omitempty"` // 只能看到分级为全年龄或青少年的漫画，适合家庭共用的服务
+}
+
+// daemonUserKey 请求上下文中保存登录用户的键
+type daemonUserKey struct{}
+
+// requestUser 请求的登录用户，未设置用户时为nil
+func requestUser(r *http.Request) *daemonUser {
+	user, _ := r.Context().Value(daemonUserKey{}).(*daemonUser)
+	return user
+}
+
+// daemonUsers 当前的用户列表，为空时不做访问控制
+var daemonUsers []daemonUser
+
+// daemonTLS daemon 服务使用的证书和私钥，都设置时以 HTTPS 提供服务
+var daemonTLS struct {
+	cert string
+	key  string
+}
+
+// passwordIterations 生成密码哈希时 PBKDF2 的迭代次数
+const passwordIterations = 210000
+
+// hashPassword 生成加盐的密码哈希，格式为 pbkdf2-sha256:<迭代次数>:<盐>:<哈希>
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, 32)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("pbkdf2-sha256:%d:%s:%s", passwordIterations, enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// checkPassword 校验密码，支持明文和 hashPassword 生成的哈希
+func (u daemonUser) checkPassword(password string) bool {
+	if u.Token != "" && subtle.ConstantTimeCompare([]byte(password), []byte(u.Token)) == 1 {
+		return true
+	}
+	if u.Password == "" {
+		return false
+	}
+	if !strings.HasPrefix(u.Password, "pbkdf2-sha256:") {
+		return subtle.ConstantTimeCompare([]byte(password), []byte(u.Password)) == 1
+	}
+
+	parts := strings.Split(u.Password, ":")
+	if len(parts) != 4 {
+		return false
+	}
+	iterations, err := strconv.Atoi(parts[1])
+	enc := base64.RawStdEncoding
+	salt, err1 := enc.DecodeString(parts[2])
+	want, err2 := enc.DecodeString(parts[3])
+	if err != nil || err1 != nil || err2 != nil || iterations < 1 {
+		return false
+	}
+	// 浏览器每个请求都带上 Basic 认证，每次都计算 PBKDF2 会让每个请求（包括阅读器翻页）多花几十到几百毫秒，
+	// 因此缓存最近校验通过的密码；缓存的是密码和哈希一起的 SHA-256，不保存密码本身
+	key := sha256.Sum256([]byte(u.Password + "\x00" + password))
+	if verifiedPasswordCached(key) {
+		return true
+	}
+	got, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(want))
+	if err != nil || subtle.ConstantTimeCompare(got, want) != 1 {
+		return false
+	}
+	cacheVerifiedPassword(key)
+	return true
+}
+
+// verifiedPasswordTTL 校验通过的密码的缓存时间
+const verifiedPasswordTTL = 5 * time.Minute
+
+// verifiedPasswords 最近校验通过的密码，值为过期时间
+var verifiedPasswords = struct {
+	sync.Mutex
+	m map[[sha256.Size]byte]time.Time
+}{m: make(map[[sha256.Size]byte]time.Time)}
+
+// verifiedPasswordCached 密码是否在缓存中且未过期
+func verifiedPasswordCached(key [sha256.Size]byte) bool {
+	verifiedPasswords.Lock()
+	defer verifiedPasswords.Unlock()
+	expires, ok := verifiedPasswords.m[key]
+	return ok && time.Now().Before(expires)
+}
+
+// cacheVerifiedPassword 缓存校验通过的密码，同时清理过期的记录
+func cacheVerifiedPassword(key [sha256.Size]byte) {
+	verifiedPasswords.Lock()
+	defer verifiedPasswords.Unlock()
+	now := time.Now()
+	for k, expires := range verifiedPasswords.m {
+		if !now.Before(expires) {
+			delete(verifiedPasswords.m, k)
+		}
+	}
+	verifiedPasswords.m[key] = now.Add(verifiedPasswordTTL)
+}
+
+// parseUserFlag 解析 名称:密码 格式的用户，--user 和 COMICBOX_USERS 使用
+func parseUserFlag(s string) (daemonUser, error) {
+	name, password, ok := strings.Cut(s, ":")
+	if !ok || name == "" || password == "" {
+		return daemonUser{}, fmt.Errorf("用户格式应为 名称:密码: %s", s)
+	}
+	return daemonUser{Name: name, Password: password}, nil
+}
+
+// authenticate 按 Authorization 请求头查找用户
+func authenticate(r *http.Request) (*daemonUser, bool) {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := strings.TrimPrefix(auth, "Bearer ")
+		for i := range daemonUsers {
+			u := &daemonUsers[i]
+			if u.Token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(u.Token)) == 1 {
+				return u, true
+			}
+		}
+		return nil, false
+	}
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, false
+	}
+	for i := range daemonUsers {
+		u := &daemonUsers[i]
+		if u.Name == name && u.checkPassword(password) {
+			return u, true
+		}
+	}
+	return nil, false
+}
+
+// requireAuth 设置了用户时要求认证，只读用户不能调用修改状态的接口；/healthz 不需要认证，供容器健康检查使用
+// 修改状态的请求还需要来自同一站点（见 sameOriginRequest），防止其他网站借浏览器保存的登录提交表单
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !sameOriginRequest(r) {
+			http.Error(w, "拒绝来自其他网站的请求", http.StatusForbidden)
+			return
+		}
+		if len(daemonUsers) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		user, ok := authenticate(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="comicbox", charset="UTF-8"`)
+			http.Error(w, "需要登录", http.StatusUnauthorized)
+			return
+		}
+		if user.ReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "只读用户不能执行该操作", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), daemonUserKey{}, user)))
+	})
+}
+
+// sameOriginRequest 请求是否来自本服务的页面：Origin（没有时为 Referer）的主机与请求的主机相同
+// 浏览器会自动带上 Basic 认证，其他网站的表单也能以登录用户的身份提交，因此按来源拒绝跨站请求；
+// 使用令牌（Authorization: Bearer）的请求和不带 Origin、Referer 的请求（curl 等客户端）不是浏览器自动发出的，不检查
+func sameOriginRequest(r *http.Request) bool {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return true
+	}
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		// 包括沙盒页面等发出的 Origin: null
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// isLoopback 监听地址是否只在本机可以访问
+func isLoopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// runPasswdCommand 生成密码哈希，写入配置文件的 users 中，避免保存明文密码
+func runPasswdCommand(args []string) {
+	password := ""
+	if len(args) > 0 {
+		password = args[0]
+	} else {
+		fmt.Print("密码: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Printf("读取密码失败: %v\n", err)
+			return
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		fmt.Println("密码不能为空")
+		return
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		fmt.Printf("生成密码哈希失败: %v\n", err)
+		return
+	}
+	fmt.Println(hash)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// backgroundURLPattern CSS 中 background/background-image 属性的 url(...)
+var backgroundURLPattern = regexp.MustCompile(`(?i)background(?:-image)?\s*:[^;{}]*?url\(\s*['"]?([^'")]+?)['"]?\s*\)`)
+
+// styleBackgroundURL 返回 style 属性中的背景图片链接，没有时返回空字符串
+func styleBackgroundURL(style string) string {
+	if m := backgroundURLPattern.FindStringSubmatch(style); m != nil {
+		return strings.TrimSpace(m[1])
+	}
+	return ""
+}
+
+// backgroundImageUrls 提取以背景图片显示的漫画页面：先按页面顺序查找元素 style 属性中的背景图片，
+// 没有时查找页面内 <style> 样式表中的背景图片，作为找不到 <img> 时的最后手段
+func backgroundImageUrls(doc *goquery.Document, base *url.URL, policy queryPolicy) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	add := func(src string) {
+		if abs, ok := resolveImageURL(base, src, policy); ok && !seen[abs] {
+			seen[abs] = true
+			urls = append(urls, abs)
+		}
+	}
+
+	doc.Find("[style]").Each(func(i int, sel *goquery.Selection) {
+		if src := styleBackgroundURL(sel.AttrOr("style", "")); src != "" {
+			add(src)
+		}
+	})
+	if len(urls) == 0 {
+		doc.Find("style").Each(func(i int, sel *goquery.Selection) {
+			for _, m := range backgroundURLPattern.FindAllStringSubmatch(sel.Text(), -1) {
+				add(m[1])
+			}
+		})
+	}
+
+	if len(urls) > 0 {
+		verbosef("从背景图片中找到 %d 张图片\n", len(urls))
+	}
+	return urls
+}
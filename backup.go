@@ -0,0 +1,234 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// metadataDir 存放漫画库数据库、状态等元数据的目录
+const metadataDir = ".comicbox"
+
+// metadataPath 元数据目录下的路径。元数据目录位于漫画库根目录（--out）中，与漫画放在一起，未指定根目录时位于当前目录
+func metadataPath(name ...string) string {
+	return filepath.Join(append([]string{outputRoot, metadataDir}, name...)...)
+}
+
+// backupSkipDirs 备份时跳过的元数据子目录（内容数据而非元数据）
+var backupSkipDirs = map[string]bool{
+	"objects": true,
+}
+
+// runBackupCommand 将漫画库元数据备份为 tar.gz 文件
+func runBackupCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("用法: ./comicbox backup <备份文件.tar.gz>")
+		return
+	}
+
+	files, err := collectMetadataFiles()
+	if err != nil {
+		fmt.Printf("收集元数据失败: %v\n", err)
+		return
+	}
+	if len(files) == 0 {
+		fmt.Println("没有需要备份的元数据")
+		return
+	}
+
+	if err := writeTarGz(args[0], files); err != nil {
+		fmt.Printf("创建备份失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已备份 %d 个文件到 %s\n", len(files), args[0])
+}
+
+// collectMetadataFiles 列出需要备份的元数据文件：元数据目录、漫画和章节的元数据文件
+func collectMetadataFiles() ([]string, error) {
+	var files []string
+
+	err := filepath.WalkDir(metadataPath(), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			if backupSkipDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range db.Series {
+		if s.Dir == "" {
+			continue
+		}
+		candidates := []string{filepath.Join(s.Dir, "series.json")}
+		for _, c := range s.Chapters {
+			candidates = append(candidates, filepath.Join(s.Dir, c.Dir, "chapter.json"))
+		}
+		for _, candidate := range candidates {
+			if fileSize(candidate) > 0 {
+				files = append(files, candidate)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// writeTarGz 将文件列表写入 tar.gz 归档
+func writeTarGz(output string, files []string) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	for _, path := range files {
+		if err := addFileToTar(tw, path); err != nil {
+			return fmt.Errorf("添加文件 %s 失败: %v", path, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// addFileToTar 将单个文件添加到 tar 归档
+func addFileToTar(tw *tar.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	// 漫画库根目录中的文件按相对路径保存，恢复时放回根目录
+	name := path
+	if outputRoot != "" {
+		if rel, err := filepath.Rel(outputRoot, path); err == nil && !strings.HasPrefix(rel, "..") {
+			name = rel
+		}
+	}
+	header.Name = filepath.ToSlash(name)
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, file)
+	return err
+}
+
+// runRestoreCommand 从备份文件恢复漫画库元数据
+func runRestoreCommand(args []string) {
+	input := ""
+	force := false
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
+		} else if input == "" {
+			input = arg
+		}
+	}
+	if input == "" {
+		fmt.Println("用法: ./comicbox restore <备份文件.tar.gz> [--force]")
+		return
+	}
+
+	restored, skipped, err := extractTarGz(input, force)
+	if err != nil {
+		fmt.Printf("恢复失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已恢复 %d 个文件\n", restored)
+	if skipped > 0 {
+		fmt.Printf("%d 个文件已存在未覆盖，使用 --force 强制覆盖\n", skipped)
+	}
+}
+
+// extractTarGz 解压备份到漫画库根目录（未指定时为当前目录），force 为false时不覆盖已有文件
+func extractTarGz(input string, force bool) (int, int, error) {
+	in, err := os.Open(input)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer in.Close()
+
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer gz.Close()
+
+	restored, skipped := 0, 0
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return restored, skipped, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// 拒绝指向当前目录之外的路径
+		path := filepath.FromSlash(header.Name)
+		if filepath.IsAbs(path) || strings.HasPrefix(filepath.Clean(path), "..") {
+			return restored, skipped, fmt.Errorf("备份中包含不安全的路径: %s", header.Name)
+		}
+		path = filepath.Join(outputRoot, path)
+
+		if _, err := os.Stat(path); err == nil && !force {
+			skipped++
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return restored, skipped, err
+		}
+		out, err := os.Create(path)
+		if err != nil {
+			return restored, skipped, err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return restored, skipped, err
+		}
+		restored++
+	}
+	return restored, skipped, nil
+}
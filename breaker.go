@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// userAgents 触发熔断后轮换使用的浏览器标识，第一个为默认值
+var userAgents = []string{
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+}
+
+// httpStatusError 服务器返回了非200状态码
+type httpStatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // 服务器在 Retry-After 中要求的等待时间，没有时为0
+}
+
+func (e *httpStatusError) Error() string {
+	if e.Body != "" {
+		return fmt.Sprintf("状态码错误: %d, 响应: %s", e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("状态码错误: %d", e.StatusCode)
+}
+
+// circuitBreaker 连续被站点拒绝（403/429）时暂停所有请求，冷却后再恢复
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int           // 连续失败多少次后熔断
+	cooldown  time.Duration // 熔断后的冷却时间
+	rotate    bool          // 熔断时是否轮换浏览器标识和代理
+	proxies   []*url.URL
+
+	failures   int
+	openUntil  time.Time
+	uaIndex    int
+	proxyIndex int
+}
+
+// siteBreaker 所有页面和图片请求共用的熔断器
+var siteBreaker = &circuitBreaker{
+	threshold: 5,
+	cooldown:  5 * time.Minute,
+}
+
+// wait 熔断期间阻塞调用者，直到冷却结束
+func (b *circuitBreaker) wait() {
+	b.mu.Lock()
+	until := b.openUntil
+	b.mu.Unlock()
+
+	if d := time.Until(until); d > 0 {
+		sleepContext(runContext, d)
+	}
+}
+
+// record 记录一次请求结果，连续被拒绝达到阈值时熔断
+func (b *circuitBreaker) record(statusCode int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if statusCode != http.StatusForbidden && statusCode != http.StatusTooManyRequests {
+		if statusCode < 400 {
+			b.failures = 0
+		}
+		return
+	}
+
+	b.failures++
+	if b.threshold <= 0 || b.failures < b.threshold || time.Now().Before(b.openUntil) {
+		return
+	}
+
+	b.failures = 0
+	b.openUntil = time.Now().Add(b.cooldown)
+	fmt.Printf("\n检测到连续 %d 次请求被拒绝（%d），可能已被站点限制，暂停所有下载 %v（至 %s）\n",
+		b.threshold, statusCode, b.cooldown, b.openUntil.Format("15:04:05"))
+
+	if b.rotate {
+		b.rotateLocked()
+	}
+}
+
+// rotateIdentity 开启 --rotate 时切换到下一个浏览器标识和代理，在被拒绝的请求重试前调用
+func (b *circuitBreaker) rotateIdentity() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.rotate {
+		b.rotateLocked()
+	}
+}
+
+// rotateLocked 切换浏览器标识和代理，调用时需持有 b.mu
+func (b *circuitBreaker) rotateLocked() {
+	b.uaIndex = (b.uaIndex + 1) % len(userAgents)
+	fmt.Printf("已切换浏览器标识: %s\n", userAgents[b.uaIndex])
+	if len(b.proxies) > 0 {
+		b.proxyIndex = (b.proxyIndex + 1) % len(b.proxies)
+		fmt.Printf("已切换代理: %s\n", b.proxies[b.proxyIndex].Redacted())
+	}
+}
+
+// userAgent 返回当前使用的浏览器标识
+func (b *circuitBreaker) userAgent() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return userAgents[b.uaIndex]
+}
+
+// proxy 返回当前使用的代理，未配置代理列表时使用环境变量中的代理
+func (b *circuitBreaker) proxy(req *http.Request) (*url.URL, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.proxies) > 0 {
+		return b.proxies[b.proxyIndex], nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+// loadProxyList 读取代理列表文件，每行一个代理地址
+func loadProxyList(filePath string) ([]*url.URL, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var proxies []*url.URL
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxyURL, err := url.Parse(line)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("无效的代理地址: %s", line)
+		}
+		proxies = append(proxies, proxyURL)
+	}
+	return proxies, scanner.Err()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// runCalibreCommand 将打包好的电子书添加到 Calibre 书库，并附带漫画库中记录的元数据
+func runCalibreCommand(args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("读取配置文件失败: %v\n", err)
+		return
+	}
+	calibre := cfg.Calibre
+
+	var files []string
+	seriesID := ""
+	validate := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--validate":
+			validate = true
+		case "--library":
+			if i+1 < len(args) {
+				calibre.Library = args[i+1]
+				i++
+			}
+		case "--series":
+			if i+1 < len(args) {
+				seriesID = args[i+1]
+				i++
+			}
+		default:
+			files = append(files, args[i])
+		}
+	}
+	if len(files) == 0 {
+		fmt.Println("使用方法: ./comicbox calibre <电子书.cbz|.epub>... [--library <书库路径或内容服务器地址>] [--series <漫画ID>] [--validate]")
+		return
+	}
+	if calibre.Library == "" {
+		fmt.Printf("请通过 --library 或配置文件 %s 中的 calibre.library 指定 Calibre 书库\n", configPath)
+		return
+	}
+	if calibre.Calibredb == "" {
+		calibre.Calibredb = "calibredb"
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+
+	for _, file := range files {
+		if validate {
+			if err := validateEPUB(file); err != nil {
+				fmt.Printf("%s: %v\n", file, err)
+				continue
+			}
+		}
+		var record *seriesRecord
+		if seriesID != "" {
+			record = db.findSeries(seriesID)
+		} else {
+			record = findSeriesForFile(db, file)
+		}
+
+		err := addToCalibre(calibre, file, record)
+		if err != nil {
+			fmt.Printf("添加 %s 到 Calibre 失败: %v\n", file, err)
+			continue
+		}
+		fmt.Printf("已添加到 Calibre: %s\n", file)
+	}
+}
+
+// findSeriesForFile 按文件名查找对应的漫画记录，文件名与漫画标题或目录名相同
+func findSeriesForFile(db *libraryDB, file string) *seriesRecord {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	for _, s := range db.Series {
+		if s.Title == name || (s.Dir != "" && filepath.Base(s.Dir) == name) {
+			return s
+		}
+	}
+	return nil
+}
+
+// addToCalibre 调用 calibredb 添加电子书
+func addToCalibre(calibre calibreConfig, file string, record *seriesRecord) error {
+	args := []string{"add", "--with-library", calibre.Library}
+	if calibre.Username != "" {
+		args = append(args, "--username", calibre.Username, "--password", calibre.Password)
+	}
+
+	if record != nil {
+		if record.Title != "" {
+			args = append(args, "--title", record.Title, "--series", record.Title)
+		}
+		if record.BaseURL != "" && record.ID != "" {
+			args = append(args, "--identifier", "url:"+siteFor(record.BaseURL).seriesURL(record.BaseURL, record.ID))
+		}
+		if cover := seriesCover(record); cover != "" {
+			args = append(args, "--cover", cover)
+		}
+	} else {
+		fmt.Printf("漫画库中没有 %s 的记录，使用 Calibre 从文件中读取的元数据\n", file)
+	}
+	args = append(args, "--tags", "漫画", file)
+
+	debugf("%s %s\n", calibre.Calibredb, strings.Join(args, " "))
+	cmd := exec.Command(calibre.Calibredb, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("calibredb 执行失败: %v", err)
+	}
+	return nil
+}
+
+// seriesCover 返回漫画第一个已下载章节的封面，跳过开头的空白页和广告页
+func seriesCover(record *seriesRecord) string {
+	for _, c := range record.Chapters {
+		if c.Pruned || c.Dir == "" {
+			continue
+		}
+		if page := coverPageFile(filepath.Join(record.Dir, c.Dir), false); page != "" {
+			return page
+		}
+	}
+	return ""
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// cbzPage CBZ中的一页图片
+type cbzPage struct {
+	name          string
+	size          int64
+	sum           string
+	width, height int // 无法读取尺寸时为0
+}
+
+// cbzContents diff 命令读取的CBZ内容
+type cbzContents struct {
+	pages []cbzPage
+	bytes int64
+	meta  map[string]string // ComicInfo.xml 中的字段
+}
+
+// runDiffCommand 比较同一章节或漫画的两个CBZ（如从不同镜像站下载的）：页数、每页的校验和与分辨率、ComicInfo.xml，
+// 并指出哪个页数更多、哪个的页面质量更好
+func runDiffCommand(args []string) {
+	if len(args) != 2 {
+		fmt.Println("用法: ./comicbox diff <a.cbz> <b.cbz>")
+		return
+	}
+	a, err := readCBZContents(args[0])
+	if err != nil {
+		fmt.Printf("读取 %s 失败: %v\n", args[0], err)
+		return
+	}
+	b, err := readCBZContents(args[1])
+	if err != nil {
+		fmt.Printf("读取 %s 失败: %v\n", args[1], err)
+		return
+	}
+	nameA, nameB := path.Base(args[0]), path.Base(args[1])
+	if nameA == nameB {
+		nameA, nameB = args[0], args[1]
+	}
+	fmt.Printf("A %s: %d 页，%s\n", nameA, len(a.pages), formatBytes(a.bytes))
+	fmt.Printf("B %s: %d 页，%s\n", nameB, len(b.pages), formatBytes(b.bytes))
+
+	// 内容相同的页按校验和匹配，不要求位置相同
+	inA, inB := map[string]bool{}, map[string]bool{}
+	for _, p := range a.pages {
+		inA[p.sum] = true
+	}
+	for _, p := range b.pages {
+		inB[p.sum] = true
+	}
+	same := 0
+	for _, p := range a.pages {
+		if inB[p.sum] {
+			same++
+		}
+	}
+	fmt.Printf("内容相同的页: %d\n", same)
+
+	// 其余的页按位置对应比较质量，没有对应页的只在一边存在
+	var onlyA, onlyB []int
+	betterA, betterB := 0, 0
+	var changes []string
+	for i := 0; i < len(a.pages) || i < len(b.pages); i++ {
+		var pa, pb *cbzPage
+		if i < len(a.pages) && !inB[a.pages[i].sum] {
+			pa = &a.pages[i]
+		}
+		if i < len(b.pages) && !inA[b.pages[i].sum] {
+			pb = &b.pages[i]
+		}
+		switch {
+		case pa != nil && pb != nil:
+			verdict := ""
+			switch comparePageQuality(*pa, *pb) {
+			case 1:
+				betterA++
+				verdict = "A 更好"
+			case -1:
+				betterB++
+				verdict = "B 更好"
+			default:
+				verdict = "质量相近"
+			}
+			changes = append(changes, fmt.Sprintf("  第 %d 页: A %s，B %s，%s", i+1, describeCBZPage(*pa), describeCBZPage(*pb), verdict))
+		case pa != nil:
+			onlyA = append(onlyA, i+1)
+		case pb != nil:
+			onlyB = append(onlyB, i+1)
+		}
+	}
+	if len(changes) > 0 {
+		fmt.Printf("内容不同的页: %d\n", len(changes))
+		for _, line := range changes {
+			fmt.Println(line)
+		}
+	}
+	if len(onlyA) > 0 {
+		fmt.Printf("只在 A 中的页: %s\n", formatPageList(onlyA))
+	}
+	if len(onlyB) > 0 {
+		fmt.Printf("只在 B 中的页: %s\n", formatPageList(onlyB))
+	}
+
+	if diffs := diffComicInfo(a.meta, b.meta); len(diffs) > 0 {
+		fmt.Println("ComicInfo.xml 的差异:")
+		for _, line := range diffs {
+			fmt.Println(line)
+		}
+	}
+
+	var verdicts []string
+	switch {
+	case len(a.pages) > len(b.pages):
+		verdicts = append(verdicts, fmt.Sprintf("A 多 %d 页", len(a.pages)-len(b.pages)))
+	case len(b.pages) > len(a.pages):
+		verdicts = append(verdicts, fmt.Sprintf("B 多 %d 页", len(b.pages)-len(a.pages)))
+	}
+	if betterA > 0 {
+		verdicts = append(verdicts, fmt.Sprintf("A 有 %d 页质量更好", betterA))
+	}
+	if betterB > 0 {
+		verdicts = append(verdicts, fmt.Sprintf("B 有 %d 页质量更好", betterB))
+	}
+	if len(verdicts) == 0 {
+		if same == len(a.pages) && same == len(b.pages) {
+			fmt.Println("结论: 两个CBZ的页面完全相同")
+		} else {
+			fmt.Println("结论: 页数相同，质量相近")
+		}
+		return
+	}
+	fmt.Printf("结论: %s\n", strings.Join(verdicts, "，"))
+}
+
+// readCBZContents 读取CBZ中的图片（按文件名排序，不包括 thumbs 中的缩略图）和 ComicInfo.xml
+func readCBZContents(file string) (*cbzContents, error) {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	contents := &cbzContents{}
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if strings.EqualFold(path.Base(f.Name), "ComicInfo.xml") {
+			data, err := readZipFile(f)
+			if err != nil {
+				return nil, err
+			}
+			contents.meta = parseComicInfoFields(data)
+			continue
+		}
+		if !isImageFile(f.Name) || path.Dir(f.Name) == "thumbs" {
+			continue
+		}
+		page, err := readCBZPage(f)
+		if err != nil {
+			return nil, err
+		}
+		contents.pages = append(contents.pages, page)
+		contents.bytes += page.size
+	}
+	sort.Slice(contents.pages, func(i, j int) bool { return contents.pages[i].name < contents.pages[j].name })
+	return contents, nil
+}
+
+// readCBZPage 计算一页的校验和，并从图片头部读取尺寸
+func readCBZPage(f *zip.File) (cbzPage, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return cbzPage{}, err
+	}
+	defer rc.Close()
+	hash := sha256.New()
+	var head bytes.Buffer
+	n, err := io.Copy(hash, io.TeeReader(rc, &limitedBuffer{buf: &head, limit: imageProbeBytes}))
+	if err != nil {
+		return cbzPage{}, fmt.Errorf("%s: %v", f.Name, err)
+	}
+	page := cbzPage{name: f.Name, size: n, sum: hex.EncodeToString(hash.Sum(nil))}
+	page.width, page.height, _ = imageDimensions(head.Bytes())
+	return page, nil
+}
+
+// limitedBuffer 只保留写入的前 limit 个字节
+type limitedBuffer struct {
+	buf   *bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if left := b.limit - b.buf.Len(); left > 0 {
+		b.buf.Write(p[:min(left, len(p))])
+	}
+	return len(p), nil
+}
+
+// readZipFile 读取压缩包中的一个文件
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// parseComicInfoFields 读取 ComicInfo.xml 根元素下只有文字的字段，如 Title、Number、Web，忽略 Pages 等嵌套的元素
+func parseComicInfoFields(data []byte) map[string]string {
+	fields := map[string]string{}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	var name string
+	var text strings.Builder
+	nested := false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return fields
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				name, nested = t.Name.Local, false
+				text.Reset()
+			} else if depth > 2 {
+				nested = true
+			}
+		case xml.CharData:
+			if depth == 2 {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if depth == 2 && !nested {
+				fields[name] = strings.TrimSpace(text.String())
+			}
+			depth--
+		}
+	}
+}
+
+// diffComicInfo 列出两个 ComicInfo.xml 中值不同的字段
+func diffComicInfo(a, b map[string]string) []string {
+	keys := map[string]bool{}
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	names := make([]string, 0, len(keys))
+	for key := range keys {
+		names = append(names, key)
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, key := range names {
+		va, okA := a[key]
+		vb, okB := b[key]
+		if okA && okB && va == vb {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("  %s: A %s，B %s", key, quoteField(va, okA), quoteField(vb, okB)))
+	}
+	return lines
+}
+
+// quoteField 输出 ComicInfo.xml 的字段值，没有该字段时输出（无）
+func quoteField(value string, ok bool) string {
+	if !ok {
+		return "（无）"
+	}
+	return fmt.Sprintf("%q", value)
+}
+
+// comparePageQuality 比较两张图片的质量：分辨率高的更好，分辨率相同（或无法读取）时文件大的更好（压缩损失少）
+// A 更好返回1，B 更好返回-1，相近返回0
+func comparePageQuality(a, b cbzPage) int {
+	areaA, areaB := a.width*a.height, b.width*b.height
+	if areaA > 0 && areaB > 0 && areaA != areaB {
+		if areaA > areaB {
+			return 1
+		}
+		return -1
+	}
+	// 大小相差不到 5% 视为相近
+	switch {
+	case float64(a.size) > float64(b.size)*1.05:
+		return 1
+	case float64(b.size) > float64(a.size)*1.05:
+		return -1
+	}
+	return 0
+}
+
+// describeCBZPage 描述一页的尺寸和大小，如 800x1200（120.0 KB）
+func describeCBZPage(p cbzPage) string {
+	if p.width == 0 || p.height == 0 {
+		return formatBytes(p.size)
+	}
+	return fmt.Sprintf("%dx%d（%s）", p.width, p.height, formatBytes(p.size))
+}
+
+// formatPageList 输出页码列表，连续的页码合并为范围，如 3、5-7
+func formatPageList(pages []int) string {
+	var parts []string
+	for i := 0; i < len(pages); {
+		j := i
+		for j+1 < len(pages) && pages[j+1] == pages[j]+1 {
+			j++
+		}
+		if j > i {
+			parts = append(parts, fmt.Sprintf("%d-%d", pages[i], pages[j]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d", pages[i]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, "、")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// imageHostMap 图片服务器的替换表，由配置文件的 image_hosts 或 --image-host 设置：
+// 站点更换了图片服务器，但旧的章节页面仍引用已失效的地址时，把旧的主机名替换为新的
+// 键为旧的主机名，"*.example.com" 匹配所有子域名；值为新的主机名（可带端口），或带协议的 https://host
+var imageHostMap = map[string]string{}
+
+// parseImageHost 解析 --image-host 的 旧主机名=新主机名
+func parseImageHost(value string) (string, string, error) {
+	from, to, ok := strings.Cut(value, "=")
+	from, to = strings.ToLower(strings.TrimSpace(from)), strings.TrimSpace(to)
+	if !ok || from == "" || to == "" {
+		return "", "", fmt.Errorf("无效的图片服务器映射: %s（格式为 旧主机名=新主机名）", value)
+	}
+	if _, _, err := imageHostTarget(to); err != nil {
+		return "", "", err
+	}
+	return from, to, nil
+}
+
+// imageHostTarget 拆分替换目标中的协议和主机名，没有协议时 scheme 为空（沿用原来的协议）
+func imageHostTarget(to string) (scheme, host string, err error) {
+	if !strings.Contains(to, "://") {
+		return "", to, nil
+	}
+	u, err := url.Parse(to)
+	if err != nil || u.Host == "" || (u.Path != "" && u.Path != "/") {
+		return "", "", fmt.Errorf("无效的图片服务器地址: %s（只能包含协议和主机名）", to)
+	}
+	return u.Scheme, u.Host, nil
+}
+
+// lookupImageHost 查找主机名的替换目标，完全匹配优先，其次是最长的 *. 后缀
+func lookupImageHost(host string) (string, bool) {
+	host = strings.ToLower(host)
+	if to, ok := imageHostMap[host]; ok {
+		return to, true
+	}
+	best := ""
+	for from := range imageHostMap {
+		suffix, ok := strings.CutPrefix(from, "*")
+		if ok && strings.HasSuffix(host, suffix) && len(from) > len(best) {
+			best = from
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return imageHostMap[best], true
+}
+
+// rewriteImageHost 按替换表替换图片链接的主机名，不需要替换时原样返回
+func rewriteImageHost(imgURL string) string {
+	u, err := url.Parse(imgURL)
+	if err != nil || u.Host == "" {
+		return imgURL
+	}
+	to, ok := lookupImageHost(u.Hostname())
+	if !ok {
+		return imgURL
+	}
+	scheme, host, err := imageHostTarget(to)
+	if err != nil {
+		return imgURL
+	}
+	if scheme != "" {
+		u.Scheme = scheme
+	}
+	u.Host = host
+	return u.String()
+}
+
+// rewriteImageHosts 替换章节中失效的图片服务器，在提取图片链接之后、探测和下载之前调用
+func rewriteImageHosts(page *chapterPage) {
+	if len(imageHostMap) == 0 {
+		return
+	}
+	changed := 0
+	for i, img := range page.images {
+		if rewritten := rewriteImageHost(img); rewritten != img {
+			page.images[i] = rewritten
+			changed++
+		}
+	}
+	if changed > 0 {
+		verbosef("按图片服务器映射替换了 %d 个图片链接\n", changed)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// titleVariants 常见的繁简和异体字对照，用于跨来源比较章节标题
+var titleVariants = strings.NewReplacer(
+	"話", "话", "迴", "回", "後", "后", "編", "编", "結", "结", "終", "终",
+	"…", "", "&hellip;", "",
+)
+
+// normalizeChapterTitle 规范化章节标题：全角转半角、统一繁简常用字、去掉空白和标点并转为小写
+func normalizeChapterTitle(title string) string {
+	title = titleVariants.Replace(title)
+
+	var b strings.Builder
+	for _, r := range title {
+		// 全角字符转半角
+		if r == 0x3000 {
+			r = ' '
+		} else if r >= 0xFF01 && r <= 0xFF5E {
+			r -= 0xFEE0
+		}
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// sameChapter 判断两个来源中的章节是否为同一章节：规范化标题相同，
+// 或 matchNumber 为true（话数在两边都唯一）时话数相同
+func sameChapter(a, b string, matchNumber bool) bool {
+	if normalizeChapterTitle(a) == normalizeChapterTitle(b) {
+		return true
+	}
+	if !matchNumber {
+		return false
+	}
+	na, okA := parseChapterNumber(a)
+	nb, okB := parseChapterNumber(b)
+	return okA && okB && na == nb
+}
+
+// chapterNumberCounts 统计每个话数出现的次数，话数重复（如上/下篇）时不能只按话数匹配
+func chapterNumberCounts(titles []string) map[float64]int {
+	counts := make(map[float64]int)
+	for _, title := range titles {
+		if n, ok := parseChapterNumber(title); ok {
+			counts[n]++
+		}
+	}
+	return counts
+}
+
+// findDownloaded 查找与章节对应的已下载记录：
+// 同一来源的章节ID相同，或规范化标题相同且在下载记录中唯一，或话数相同且在目录和下载记录中都唯一
+func (s *seriesRecord) findDownloaded(chapter ChapterInfo, tocCounts map[float64]int) *chapterRecord {
+	source := chapter.baseURL
+	if source == "" {
+		source = s.BaseURL
+	}
+
+	var recordTitles []string
+	for _, c := range s.Chapters {
+		recordSource := c.Source
+		if recordSource == "" {
+			recordSource = s.BaseURL
+		}
+		if c.ID == chapter.id && recordSource == source {
+			return c
+		}
+		recordTitles = append(recordTitles, c.Title)
+	}
+
+	// 与话数一样，规范化标题只在下载记录中唯一时才能匹配；标题全是标点或空白时规范化后为空，不参与匹配
+	if normalized := normalizeChapterTitle(chapter.title); normalized != "" {
+		var match *chapterRecord
+		for _, c := range s.Chapters {
+			if normalizeChapterTitle(c.Title) == normalized {
+				if match != nil {
+					return nil
+				}
+				match = c
+			}
+		}
+		if match != nil {
+			return match
+		}
+	}
+
+	number, ok := parseChapterNumber(chapter.title)
+	if !ok || tocCounts[number] != 1 {
+		return nil
+	}
+	recordCounts := chapterNumberCounts(recordTitles)
+	if recordCounts[number] != 1 {
+		return nil
+	}
+	for _, c := range s.Chapters {
+		if n, ok := parseChapterNumber(c.Title); ok && n == number {
+			return c
+		}
+	}
+	return nil
+}
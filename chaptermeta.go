@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// chapterMetaFile 每个章节目录中记录章节信息的文件
+const chapterMetaFile = "chapter.json"
+
+// chapterMeta 章节信息：来源、抓取时间、图片链接和每页的校验和
+// 用于中断后继续下载、校验图片完整性、重新获取损坏的页面，以及打包时生成 ComicInfo.xml
+type chapterMeta struct {
+	ID            string         `json:"id"`
+	Title         string         `json:"title"`
+	OriginalTitle string         `json:"original_title,omitempty"` // 开启标题翻译时网站上的原标题
+	Number        int            `json:"number,omitempty"`         // 章节在目录中的序号，从1开始
+	SeriesID      string         `json:"series_id,omitempty"`
+	SeriesTitle   string         `json:"series_title,omitempty"`
+	SourceURL     string         `json:"source_url"` // 章节页面链接，从本地文件解析时为文件路径
+	ScrapedAt     time.Time      `json:"scraped_at"`
+	Images        []string       `json:"images"`
+	DeclaredPages int            `json:"declared_pages,omitempty"` // 页面上标明的总页数
+	Strategy      string         `json:"strategy,omitempty"`       // 提取图片链接的方式，如 lazy-attr、script-json
+	Published     string         `json:"published,omitempty"`      // 页面上的更新日期，如 2023-05-01，--extras 时记录
+	Notes         string         `json:"notes,omitempty"`          // 页面上的作者的话，--extras 时记录
+	Versions      []versionScore `json:"versions,omitempty"`       // 比较过的各来源版本，chosen 为下载的版本
+	Pages         []pageMeta     `json:"pages"`
+	Recap         []int          `json:"recap,omitempty"`   // 与上一章结尾重复、已删除的开头几页的页码
+	Missing       []missingPage  `json:"missing,omitempty"` // 下载失败、插入了占位图的页
+	Cover         string         `json:"cover,omitempty"`   // 作为章节封面的页的文件名，跳过了开头的空白页和广告页
+}
+
+// seriesMetaFile 每个漫画目录中记录漫画信息的文件
+const seriesMetaFile = "series.json"
+
+// seriesMeta 漫画信息，打包工具据此生成 ComicInfo.xml
+type seriesMeta struct {
+	ID            string    `json:"id"`
+	Title         string    `json:"title"`
+	OriginalTitle string    `json:"original_title,omitempty"` // 开启标题翻译时网站上的原标题
+	URL           string    `json:"url"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Rating        string    `json:"rating,omitempty"` // 漫画库中的内容分级，未指定 age_rating 时据此生成
+	bookMetadata
+}
+
+// bookMetadata 网页上通常没有的出版信息，由命令行参数或配置文件指定
+type bookMetadata struct {
+	Language  string `json:"language,omitempty"`   // 语言代码，如 zh、ja、en
+	Writer    string `json:"writer,omitempty"`     // 作者
+	Publisher string `json:"publisher,omitempty"`  // 出版社
+	AgeRating string `json:"age_rating,omitempty"` // 年龄分级，如 "Adults Only 18+"
+}
+
+var (
+	// metadataFlags 命令行指定的出版信息，覆盖 series.json 中已有的值
+	metadataFlags bookMetadata
+	// metadataDefaults 配置文件中的出版信息，只用于 series.json 中没有的字段
+	metadataDefaults bookMetadata
+)
+
+// fillFrom 用 other 中的值补充空字段
+func (m *bookMetadata) fillFrom(other bookMetadata) {
+	if m.Language == "" {
+		m.Language = other.Language
+	}
+	if m.Writer == "" {
+		m.Writer = other.Writer
+	}
+	if m.Publisher == "" {
+		m.Publisher = other.Publisher
+	}
+	if m.AgeRating == "" {
+		m.AgeRating = other.AgeRating
+	}
+}
+
+// writeSeriesMeta 写入漫画目录中的 series.json，出版信息按命令行、已有文件、配置文件的优先级合并
+func writeSeriesMeta(dirName string, meta seriesMeta) error {
+	path := filepath.Join(dirName, seriesMetaFile)
+	meta.bookMetadata = metadataFlags
+	var old seriesMeta
+	if data, err := os.ReadFile(path); err == nil && json.Unmarshal(data, &old) == nil {
+		// 分级变化时按新的分级生成 age_rating，不沿用旧分级生成的值
+		if meta.Rating != old.Rating && old.AgeRating == ratingAgeRatings[old.Rating] {
+			old.AgeRating = ""
+		}
+		meta.fillFrom(old.bookMetadata)
+	}
+	if meta.AgeRating == "" {
+		meta.AgeRating = ratingAgeRatings[meta.Rating]
+	}
+	meta.fillFrom(metadataDefaults)
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// updateSeriesRating 修改 series.json 中的分级，目录中没有 series.json 时不处理
+func updateSeriesRating(dirName, rating string) error {
+	data, err := os.ReadFile(filepath.Join(dirName, seriesMetaFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var meta seriesMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return err
+	}
+	meta.Rating = rating
+	return writeSeriesMeta(dirName, meta)
+}
+
+// pageMeta 已保存的一页图片
+type pageMeta struct {
+	Index  int      `json:"index"` // 页码，从0开始
+	File   string   `json:"file"`  // 章节目录中的文件名
+	URL    string   `json:"url"`
+	Size   int64    `json:"size"`
+	SHA256 string   `json:"sha256"`
+	Parts  []string `json:"parts,omitempty"` // 后处理拆分出的附加部分的文件名
+}
+
+// writeChapterMeta 根据下载结果计算每页的校验和，写入章节目录中的 chapter.json
+func writeChapterMeta(dirName string, meta *chapterMeta, result chapterResult) error {
+	meta.Pages = nil
+	for i, file := range result.files {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		sum, err := fileSHA256(file)
+		if err != nil {
+			return err
+		}
+		meta.Pages = append(meta.Pages, pageMeta{
+			Index:  i,
+			File:   filepath.Base(file),
+			URL:    meta.Images[i],
+			Size:   info.Size(),
+			SHA256: sum,
+			Parts:  baseNames(result.parts[i]),
+		})
+	}
+	meta.Cover = chapterCover(dirName, meta)
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dirName, chapterMetaFile), data)
+}
+
+// loadChapterMeta 读取章节目录中的 chapter.json
+func loadChapterMeta(dirName string) (*chapterMeta, error) {
+	data, err := os.ReadFile(filepath.Join(dirName, chapterMetaFile))
+	if err != nil {
+		return nil, err
+	}
+	meta := &chapterMeta{}
+	if err := json.Unmarshal(data, meta); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", chapterMetaFile, err)
+	}
+	return meta, nil
+}
+
+// uniqueChapterDir 返回章节保存的目录：dir 已被另一个章节使用时，在目录名后加上章节ID区分，
+// 避免标题相同的章节（如多个"番外"）或目录变化后序号错位的章节写入同一目录、互相覆盖。ids 为该章节可能记录的ID
+func uniqueChapterDir(dir string, ids ...string) string {
+	if !chapterDirTaken(dir, ids) {
+		return dir
+	}
+	base := dir + "_" + pathName(sanitizeFileName(ids[0]))
+	candidate := base
+	for n := 2; chapterDirTaken(candidate, ids); n++ {
+		candidate = fmt.Sprintf("%s_%d", base, n)
+	}
+	fmt.Printf("目录 %s 已被另一个章节使用，章节 %s 保存到 %s\n", filepath.Base(dir), ids[0], filepath.Base(candidate))
+	return candidate
+}
+
+// chapterDirTaken 目录是否已被其他章节使用：chapter.json 中的ID不是 ids 之一，
+// 或没有可读的 chapter.json 却已经有图片（旧版本下载的章节，无法确认是哪一章）
+func chapterDirTaken(dir string, ids []string) bool {
+	meta, err := loadChapterMeta(dir)
+	if err == nil {
+		if meta.ID == "" {
+			return false
+		}
+		for _, id := range ids {
+			if meta.ID == id {
+				return false
+			}
+		}
+		return true
+	}
+	if fileSize(filepath.Join(dir, chapterMetaFile)) > 0 {
+		return true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && isImageFile(entry.Name()) {
+			return true
+		}
+	}
+	return false
+}
+
+// completedPages 返回目录中已经完整下载的页：链接与本次相同，文件存在且校验和一致
+func completedPages(dirName string, imageUrls []string) map[int]pageMeta {
+	done := make(map[int]pageMeta)
+	meta, err := loadChapterMeta(dirName)
+	if err != nil {
+		return done
+	}
+	for _, p := range meta.Pages {
+		if p.Index < 0 || p.Index >= len(imageUrls) || imageUrls[p.Index] != p.URL {
+			continue
+		}
+		if checkPage(dirName, p) == "" {
+			done[p.Index] = p
+		}
+	}
+	return done
+}
+
+// checkPage 校验一页图片，正常时返回空字符串，否则返回问题描述
+func checkPage(dirName string, p pageMeta) string {
+	path := filepath.Join(dirName, p.File)
+	info, err := os.Stat(path)
+	if err != nil {
+		return "文件不存在"
+	}
+	if info.Size() != p.Size {
+		return fmt.Sprintf("大小不符（%d，应为 %d）", info.Size(), p.Size)
+	}
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return fmt.Sprintf("读取失败: %v", err)
+	}
+	if sum != p.SHA256 {
+		return "校验和不符"
+	}
+	for _, part := range p.Parts {
+		if fileSize(filepath.Join(dirName, part)) == 0 {
+			return fmt.Sprintf("拆分出的 %s 不存在", part)
+		}
+	}
+	return ""
+}
+
+// runVerifyCommand 按 chapter.json 校验章节图片，--repair 时重新获取章节页面并下载有问题的页
+func runVerifyCommand(args []string) {
+	repair := false
+	var targets []string
+	for _, arg := range args {
+		if arg == "--repair" {
+			repair = true
+		} else {
+			targets = append(targets, arg)
+		}
+	}
+
+	dirs, err := verifyTargets(targets)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	if len(dirs) == 0 {
+		fmt.Printf("没有找到带 %s 的章节目录\n", chapterMetaFile)
+		return
+	}
+
+	var db *libraryDB
+	if repair {
+		if db, err = loadLibrary(); err != nil {
+			fmt.Printf("读取漫画库失败: %v\n", err)
+			return
+		}
+	}
+	bad := 0
+	for _, dir := range dirs {
+		meta, err := loadChapterMeta(dir)
+		if err != nil {
+			fmt.Printf("%s: %v\n", dir, err)
+			bad++
+			continue
+		}
+		problems := verifyChapter(dir, meta)
+		if len(problems) == 0 {
+			verbosef("%s: %d 页正常\n", dir, len(meta.Pages))
+			continue
+		}
+
+		bad++
+		fmt.Printf("%s: %d 页有问题\n", dir, len(problems))
+		for index, problem := range problems {
+			fmt.Printf("  第 %d 页: %s\n", index+1, problem)
+		}
+		if repair {
+			// 与下载这部漫画互斥
+			lock, err := lockSeriesDir(db, filepath.Dir(dir))
+			if err == nil {
+				err = repairChapter(runContext, dir, meta)
+				lock.unlock()
+			}
+			if err != nil {
+				fmt.Printf("  修复失败: %v\n", err)
+			}
+		}
+	}
+
+	fmt.Printf("校验完成: 共 %d 个章节，%d 个有问题\n", len(dirs), bad)
+}
+
+// verifyTargets 确定要校验的章节目录：参数可以是漫画ID、漫画目录或章节目录，未指定时校验整个漫画库
+func verifyTargets(targets []string) ([]string, error) {
+	db, err := loadLibrary()
+	if err != nil {
+		return nil, fmt.Errorf("读取漫画库失败: %v", err)
+	}
+
+	var seriesDirs, dirs []string
+	if len(targets) == 0 {
+		for _, s := range db.Series {
+			if s.Dir != "" {
+				seriesDirs = append(seriesDirs, s.Dir)
+			}
+		}
+	}
+	for _, target := range targets {
+		if s := db.findSeries(target); s != nil && s.Dir != "" {
+			seriesDirs = append(seriesDirs, s.Dir)
+		} else if fileSize(filepath.Join(target, chapterMetaFile)) > 0 {
+			dirs = append(dirs, target)
+		} else {
+			seriesDirs = append(seriesDirs, target)
+		}
+	}
+
+	for _, seriesDir := range seriesDirs {
+		entries, err := os.ReadDir(seriesDir)
+		if err != nil {
+			fmt.Printf("读取目录 %s 失败: %v\n", seriesDir, err)
+			continue
+		}
+		for _, entry := range entries {
+			dir := filepath.Join(seriesDir, entry.Name())
+			if entry.IsDir() && fileSize(filepath.Join(dir, chapterMetaFile)) > 0 {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// verifyChapter 校验章节中的每一页，返回按页码索引的问题，包括从未下载成功的页
+func verifyChapter(dir string, meta *chapterMeta) map[int]string {
+	problems := make(map[int]string)
+	saved := make(map[int]bool)
+	for _, index := range meta.Recap {
+		saved[index] = true
+	}
+	for _, p := range meta.Pages {
+		saved[p.Index] = true
+		if problem := checkPage(dir, p); problem != "" {
+			problems[p.Index] = problem
+		}
+	}
+	for i := range meta.Images {
+		if !saved[i] {
+			problems[i] = "未下载"
+		}
+	}
+	for _, m := range meta.Missing {
+		problems[m.Index] = fmt.Sprintf("下载失败，已插入占位图（%s）", m.Reason)
+	}
+	for i := len(meta.Images); i < meta.DeclaredPages; i++ {
+		problems[i] = fmt.Sprintf("页面标明共 %d 页，未提取到该页", meta.DeclaredPages)
+	}
+	return problems
+}
+
+// repairChapter 重新获取章节页面（图片链接可能已过期），只下载缺少或损坏的页，并更新 chapter.json
+func repairChapter(ctx context.Context, dir string, meta *chapterMeta) error {
+	fetched, err := fetchChapterFromMeta(ctx, meta)
+	if err != nil {
+		return err
+	}
+	filterChapterImages(ctx, fetched)
+	if len(fetched.images) != len(meta.Images) {
+		return fmt.Errorf("章节页数已变化（%d，原为 %d），请重新下载整个章节", len(fetched.images), len(meta.Images))
+	}
+
+	// 删除有问题的页，downloadChapterImages 会沿用其余校验通过的页
+	for index := range verifyChapter(dir, meta) {
+		for _, p := range meta.Pages {
+			if p.Index == index {
+				os.Remove(filepath.Join(dir, p.File))
+				for _, part := range p.Parts {
+					os.Remove(filepath.Join(dir, part))
+				}
+			}
+		}
+	}
+	meta.Images = fetched.images
+	if err := writeChapterMeta(dir, meta, chapterResult{files: pageFiles(dir, meta), parts: pageParts(dir, meta)}); err != nil {
+		return err
+	}
+
+	clearPlaceholders(dir)
+	result := downloadChapterImages(ctx, fetched.images, dir, nil, fetched.fixup)
+	dropRecapFiles(meta, &result)
+	meta.Missing = insertPlaceholders(ctx, dir, fetched.images, &result)
+	meta.ScrapedAt = time.Now()
+	if err := writeChapterMeta(dir, meta, result); err != nil {
+		return err
+	}
+	if result.failed > 0 {
+		return fmt.Errorf("仍有 %d 页下载失败", result.failed)
+	}
+	if len(meta.Missing) > 0 {
+		return fmt.Errorf("仍有 %d 页下载失败，已插入占位图", len(meta.Missing))
+	}
+	fmt.Printf("  已修复\n")
+	return nil
+}
+
+// pageFiles 按页码列出 chapter.json 中记录且文件仍然存在的页
+func pageFiles(dir string, meta *chapterMeta) []string {
+	files := make([]string, len(meta.Images))
+	for _, p := range meta.Pages {
+		path := filepath.Join(dir, p.File)
+		if p.Index >= 0 && p.Index < len(files) && fileSize(path) > 0 {
+			files[p.Index] = path
+		}
+	}
+	return files
+}
+
+// pageParts 按页码列出 chapter.json 中记录的后处理拆分出的部分
+func pageParts(dir string, meta *chapterMeta) map[int][]string {
+	parts := make(map[int][]string)
+	for _, p := range meta.Pages {
+		for _, part := range p.Parts {
+			parts[p.Index] = append(parts[p.Index], filepath.Join(dir, part))
+		}
+	}
+	return parts
+}
+
+// baseNames 返回路径中的文件名
+func baseNames(paths []string) []string {
+	var names []string
+	for _, path := range paths {
+		names = append(names, filepath.Base(path))
+	}
+	return names
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUniqueChapterDir(t *testing.T) {
+	meta := func(id string) string { return `{"id":"` + id + `","title":"番外"}` }
+	tests := []struct {
+		name  string
+		files map[string]string // 相对于漫画目录的文件 -> 内容
+		ids   []string
+		want  string
+	}{
+		{"新目录", nil, []string{"200"}, "001_番外"},
+		{"同一章节", map[string]string{"001_番外/chapter.json": meta("200")}, []string{"200"}, "001_番外"},
+		{"备用来源的ID", map[string]string{"001_番外/chapter.json": meta("100")}, []string{"200", "100"}, "001_番外"},
+		{"没有ID的 chapter.json", map[string]string{"001_番外/chapter.json": `{"title":"番外"}`}, []string{"200"}, "001_番外"},
+		{"标题相同的另一章", map[string]string{"001_番外/chapter.json": meta("100")}, []string{"200"}, "001_番外_200"},
+		{"无法解析的 chapter.json", map[string]string{"001_番外/chapter.json": "{"}, []string{"200"}, "001_番外_200"},
+		{"旧版本下载的章节", map[string]string{"001_番外/0001.jpg": "jpg"}, []string{"200"}, "001_番外_200"},
+		{"只有非图片文件", map[string]string{"001_番外/notes.txt": "txt"}, []string{"200"}, "001_番外"},
+		{"后缀目录也被占用", map[string]string{
+			"001_番外/chapter.json":     meta("100"),
+			"001_番外_200/chapter.json": meta("300"),
+		}, []string{"200"}, "001_番外_200_2"},
+		{"沿用上次的后缀目录", map[string]string{
+			"001_番外/chapter.json":       meta("100"),
+			"001_番外_200/0001.jpg":       "jpg",
+			"001_番外_200_2/chapter.json": meta("200"),
+		}, []string{"200"}, "001_番外_200_2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(root, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := uniqueChapterDir(filepath.Join(root, "001_番外"), tt.ids...)
+			if want := filepath.Join(root, tt.want); got != want {
+				t.Errorf("uniqueChapterDir = %s, want %s", filepath.Base(got), tt.want)
+			}
+		})
+	}
+}
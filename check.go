@@ -0,0 +1,208 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// seriesCheck 一部订阅漫画的检查结果
+type seriesCheck struct {
+	record  *seriesRecord
+	baseURL string
+	sources []*seriesSource
+	updates int // 目录中还没有下载的章节数
+}
+
+// runCheckCommand 同时获取所有订阅漫画的目录，列出有新章节的漫画；--download 时下载新章节
+// 下载时不同漫画的章节同时进行（最多 -j 个），共用 --workers 个图片下载名额和带宽上限，
+// 不会因为某部漫画新章节很多而让其他漫画一直等待
+func runCheckCommand(args []string) {
+	download := false
+	jobs := 4
+	for i := 0; i < len(args); i++ {
+		n, err := parseGlobalFlag(args, i)
+		if err != nil {
+			fmt.Printf("参数错误: %v\n", err)
+			return
+		}
+		if n > 0 {
+			i += n - 1
+			continue
+		}
+		switch args[i] {
+		case "--download", "-d":
+			download = true
+		case "-j", "--jobs":
+			if i+1 >= len(args) {
+				fmt.Printf("%s 需要一个数值\n", args[i])
+				return
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				fmt.Printf("无效的并发数: %s\n", args[i+1])
+				return
+			}
+			jobs = n
+			i++
+		default:
+			fmt.Printf("未知参数: %s\n", args[i])
+			return
+		}
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	var checks []*seriesCheck
+	for _, record := range db.Series {
+		if record.Followed {
+			baseURL := record.BaseURL
+			if baseURL == "" {
+				baseURL = siteBaseURL
+			}
+			checks = append(checks, &seriesCheck{record: record, baseURL: baseURL})
+		}
+	}
+	if len(checks) == 0 {
+		fmt.Println("没有订阅的漫画，可以用 ./comicbox follow <漫画ID> 订阅")
+		return
+	}
+
+	now := time.Now()
+	fmt.Printf("正在检查 %d 部订阅漫画的更新...\n", len(checks))
+	fetchSeriesChecks(checks, jobs)
+
+	withUpdates, total, failed := 0, 0, 0
+	for _, c := range checks {
+		switch {
+		case len(c.sources) == 0:
+			failed++
+			fmt.Printf("%-10s 未能获取章节列表 %s\n", c.record.ID, c.record.Title)
+		case c.updates > 0:
+			withUpdates++
+			total += c.updates
+			fmt.Printf("%-10s %d 个新章节 %s\n", c.record.ID, c.updates, c.record.Title)
+		}
+	}
+	fmt.Printf("共检查 %d 部漫画，%d 部有更新（%d 个新章节）", len(checks), withUpdates, total)
+	if failed > 0 {
+		fmt.Printf("，%d 部获取失败", failed)
+	}
+	fmt.Println()
+	if !download {
+		if total > 0 {
+			fmt.Println("加上 --download 下载新章节")
+		}
+		return
+	}
+	downloadSeriesChecks(db, checks, jobs, now)
+}
+
+// fetchSeriesChecks 用 jobs 个 worker 同时获取各漫画的目录，并统计未下载的章节数
+func fetchSeriesChecks(checks []*seriesCheck, jobs int) {
+	var wg sync.WaitGroup
+	queue := make(chan *seriesCheck)
+	for w := 0; w < min(jobs, len(checks)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range queue {
+				c.sources = fetchSeriesSources(runContext, c.baseURL, c.record.ID, c.record.Sources)
+				if len(c.sources) > 0 {
+					c.updates = countUpdates(c.record, mergeSourceChapters(c.sources))
+				}
+			}
+		}()
+	}
+	for _, c := range checks {
+		if runContext.Err() != nil {
+			break
+		}
+		queue <- c
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// countUpdates 目录中需要下载的章节数：未下载、未完整下载，且不是之前未解锁的章节
+func countUpdates(record *seriesRecord, chapters []ChapterInfo) int {
+	counts := chapterNumberCounts(chapterTitles(chapters))
+	n := 0
+	for _, chapter := range chapters {
+		if c := record.findDownloaded(chapter, counts); c != nil && !c.Incomplete {
+			continue
+		}
+		if !retryLocked && record.findLocked(chapter.id) != nil {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// downloadSeriesChecks 更新获取到目录的漫画，不同漫画的章节同时下载，同一部漫画的章节按顺序下载
+// 同时下载的章节最多 jobs 个，按轮转的顺序分配给各部漫画；所有章节共用 --workers 个图片下载名额
+func downloadSeriesChecks(db *libraryDB, checks []*seriesCheck, jobs int, now time.Time) {
+	if archiveMode {
+		defer clearRawPages()
+	}
+	var updates []*seriesUpdate
+	for _, c := range checks {
+		if len(c.sources) == 0 {
+			continue
+		}
+		lock, err := lockSeries(c.baseURL, c.record.ID)
+		if errors.Is(err, errSeriesLocked) && lockPolicy == "skip" {
+			fmt.Printf("漫画 %s 正在被另一个进程下载，跳过\n", c.record.ID)
+			continue
+		}
+		if err != nil {
+			fmt.Printf("无法开始下载 %s: %v\n", c.record.ID, err)
+			continue
+		}
+		defer lock.unlock()
+		if u := newSeriesUpdate(db, c.baseURL, c.record, c.sources, ""); u != nil {
+			c.record.LastChecked = now
+			updates = append(updates, u)
+		}
+	}
+
+	// 每部漫画一个线程，下载每个章节前领取一个名额；等待中的线程按先后顺序领到名额，
+	// 某部漫画积压了很多章节时，其他漫画不必等它下载完
+	parallelChapters = true
+	imageSlots = make(chan struct{}, max(imageWorkers, 1))
+	defer func() {
+		parallelChapters = false
+		imageSlots = nil
+	}()
+	slots := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for _, u := range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, i := range u.pending {
+				slots <- struct{}{}
+				if runContext.Err() != nil {
+					<-slots
+					return
+				}
+				u.downloadChapter(runContext, i)
+				<-slots
+			}
+		}()
+	}
+	wg.Wait()
+	if runContext.Err() != nil {
+		fmt.Printf("下载已中断，其余章节将在下次运行时继续下载\n")
+	}
+
+	for _, u := range updates {
+		u.finish(runContext)
+	}
+}
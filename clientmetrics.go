@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// latencyBuckets 请求延迟直方图的上界（秒），与 Prometheus 的 le 标签对应
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// hostMetrics 一个主机的请求统计：请求数、失败数（网络错误和 4xx/5xx）和延迟直方图
+// 延迟为发出请求到收到响应头的时间，不包括读取响应体，反映的是站点的响应速度而不是带宽
+type hostMetrics struct {
+	requests int64
+	errors   int64
+	buckets  []int64 // 落在每个区间的请求数，最后一个为超过最大上界的
+	sum      float64 // 延迟总和（秒）
+}
+
+// hostSummary 运行汇总中一个主机的请求统计
+type hostSummary struct {
+	Requests   int64   `json:"requests"`
+	Errors     int64   `json:"errors"`
+	ErrorRate  float64 `json:"error_rate"`
+	AvgSeconds float64 `json:"avg_seconds"`
+	P50Seconds float64 `json:"p50_seconds"` // 按直方图估算，取所在区间的上界，超过最大上界时为 -1
+	P90Seconds float64 `json:"p90_seconds"`
+}
+
+// observe 记录一次请求
+func (h *hostMetrics) observe(latency time.Duration, failed bool) {
+	if h.buckets == nil {
+		h.buckets = make([]int64, len(latencyBuckets)+1)
+	}
+	seconds := latency.Seconds()
+	h.requests++
+	if failed {
+		h.errors++
+	}
+	h.sum += seconds
+	i := 0
+	for i < len(latencyBuckets) && seconds > latencyBuckets[i] {
+		i++
+	}
+	h.buckets[i]++
+}
+
+// quantile 按直方图估算延迟的分位数，返回所在区间的上界，超过最大上界时返回 +Inf
+func (h *hostMetrics) quantile(q float64) float64 {
+	if h.requests == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(h.requests)))
+	var count int64
+	for i, n := range h.buckets {
+		count += n
+		if count >= target {
+			if i < len(latencyBuckets) {
+				return latencyBuckets[i]
+			}
+			break
+		}
+	}
+	return math.Inf(1)
+}
+
+// summary 汇总中的统计
+func (h *hostMetrics) summary() hostSummary {
+	s := hostSummary{Requests: h.requests, Errors: h.errors}
+	if h.requests > 0 {
+		s.ErrorRate = float64(h.errors) / float64(h.requests)
+		s.AvgSeconds = h.sum / float64(h.requests)
+	}
+	s.P50Seconds, s.P90Seconds = h.quantile(0.5), h.quantile(0.9)
+	if math.IsInf(s.P50Seconds, 1) {
+		s.P50Seconds = -1
+	}
+	if math.IsInf(s.P90Seconds, 1) {
+		s.P90Seconds = -1
+	}
+	return s
+}
+
+// recordRequest 记录一个主机的一次请求
+func (m *metricsRegistry) recordRequest(host string, latency time.Duration, failed bool) {
+	m.mu.Lock()
+	h := m.hosts[host]
+	if h == nil {
+		h = &hostMetrics{}
+		m.hosts[host] = h
+	}
+	h.observe(latency, failed)
+	m.mu.Unlock()
+}
+
+// hostSummaries 按主机汇总的请求统计
+func (m *metricsRegistry) hostSummaries() map[string]hostSummary {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	result := make(map[string]hostSummary, len(m.hosts))
+	for host, h := range m.hosts {
+		result[host] = h.summary()
+	}
+	return result
+}
+
+// metricsTransport 统计经过的每个请求（包括重定向的每一跳），位于 HAR 和 WARC 记录器之下
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+// meteredTransport 页面和图片请求最终经过的 Transport
+var meteredTransport http.RoundTripper = &metricsTransport{next: sharedTransport}
+
+// RoundTrip 发送请求，记录主机、是否失败和收到响应头的用时
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+	host := req.URL.Hostname()
+	if err != nil {
+		metrics.recordRequest(host, latency, true)
+		debugf("%s %s 失败，用时 %v: %v\n", req.Method, host, latency.Round(time.Millisecond), err)
+		return nil, err
+	}
+	metrics.recordRequest(host, latency, resp.StatusCode >= 400)
+	debugf("%s %s -> %d，用时 %v\n", req.Method, host, resp.StatusCode, latency.Round(time.Millisecond))
+	return resp, nil
+}
+
+// printHostMetrics 按主机输出请求数、失败率和延迟，用于判断慢的是站点还是本程序，只在 --verbose 或 --debug 时输出
+func printHostMetrics() {
+	summaries := metrics.hostSummaries()
+	if len(summaries) == 0 {
+		return
+	}
+	verbosef("各主机的请求（延迟为收到响应头的时间）:\n")
+	for _, host := range sortedHosts(summaries) {
+		s := summaries[host]
+		verbosef("  %s: %d 个请求，失败 %d 个（%.1f%%），平均 %s，P50 %s，P90 %s\n", host, s.Requests, s.Errors,
+			s.ErrorRate*100, formatLatency(s.AvgSeconds), formatQuantile(s.P50Seconds), formatQuantile(s.P90Seconds))
+	}
+}
+
+// sortedHosts 按请求数从多到少排列的主机
+func sortedHosts(summaries map[string]hostSummary) []string {
+	counts := make(map[string]int64, len(summaries))
+	for host, s := range summaries {
+		counts[host] = s.Requests
+	}
+	hosts := sortedKeys(counts)
+	sort.SliceStable(hosts, func(i, j int) bool { return counts[hosts[i]] > counts[hosts[j]] })
+	return hosts
+}
+
+// formatLatency 格式化延迟，精确到毫秒
+func formatLatency(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	if d < time.Millisecond {
+		return "<1ms"
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// formatQuantile 格式化按直方图估算的分位数（所在区间的上界），超过最大上界（-1）时显示为 >60s
+func formatQuantile(seconds float64) string {
+	if seconds < 0 {
+		return fmt.Sprintf(">%gs", latencyBuckets[len(latencyBuckets)-1])
+	}
+	return "≤" + formatLatency(seconds)
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// configPath 配置文件，保存不适合每次在命令行中指定的设置
+var configPath = filepath.Join(metadataDir, "config.json")
+
+// comicConfig 配置文件内容
+type comicConfig struct {
+	Output      string        `json:"output"`       // 漫画库根目录，与 --out 相同
+	Scratch     string        `json:"scratch"`      // 下载中章节的临时目录，与 --scratch 相同
+	AsciiNames  bool          `json:"ascii_names"`  // 目录和文件名中的汉字转为拼音，与 --ascii-names 相同
+	SummaryFile string        `json:"summary_file"` // 运行汇总 JSON 的路径，与 --summary-file 相同
+	Polite      bool          `json:"polite"`       // 默认开启礼貌抓取模式
+	PoliteDelay string        `json:"polite_delay"` // 礼貌抓取的默认请求间隔，如 "3s"
+	Calibre     calibreConfig `json:"calibre"`
+	Kindle      kindleConfig  `json:"kindle"`
+	Metadata    bookMetadata  `json:"metadata"` // 默认的语言、作者、出版社和年龄分级
+
+	ImageFilter  imageFilterSettings `json:"image_filter"`  // 丢弃图标、横幅等非漫画页面图片的条件
+	PostProcess  []string            `json:"post_process"`  // 图片后处理步骤，与 --post 相同，如 ["split:rtl", "convert:jpeg:85"]
+	LowMemory    bool                `json:"low_memory"`    // 默认开启低内存模式，与 --low-memory 相同
+	ImageMemory  string              `json:"image_memory"`  // 同时解码的图片最多占用的内存，如 "256M"，与 --image-memory 相同
+	ImageBackend string              `json:"image_backend"` // 图片后处理的实现: auto、vips、go，与 --image-backend 相同
+
+	Windows   []string `json:"windows"`    // 允许下载的时间段，如 ["01:00-07:00", "12:00-13:00@500K"]，与 --window 相同
+	LimitRate string   `json:"limit_rate"` // 默认的带宽上限，如 "1M"，与 --limit-rate 相同
+	Progress  string   `json:"progress"`   // 下载进度的显示方式，与 --progress 相同
+
+	ImageHosts    map[string]string `json:"image_hosts"`    // 图片服务器的替换表，旧主机名 -> 新主机名，与 --image-host 相同
+	MaxRedirects  *int              `json:"max_redirects"`  // 一个请求最多跟随的重定向次数，0 为不跟随，与 --max-redirects 相同
+	Redirects     string            `json:"redirects"`      // 跟随到其他主机的重定向的方式: follow、allowlist、same-host，与 --redirects 相同
+	RedirectAllow []string          `json:"redirect_allow"` // 允许重定向到的主机，如 ["*.example-cdn.com"]，与 --redirect-allow 相同
+	Fetcher       string            `json:"fetcher"`        // 获取网页的方式: http、browser、fixture:<目录>，与 --fetcher 相同
+	IPFamily      string            `json:"ip_family"`      // 只使用 IPv4 或 IPv6 建立连接: ipv4、ipv6、auto，与 --ipv4-only、--ipv6-only 相同
+	PageTimeout   string            `json:"page_timeout"`   // 请求页面和接口的超时时间，如 "90s"，与 --page-timeout 相同
+	ImageTimeout  string            `json:"image_timeout"`  // 下载一张图片的超时时间，如 "3m"，与 --image-timeout 相同
+
+	RetryLocked   bool                  `json:"retry_locked"`   // 更新时重新检查之前未解锁的章节，与 --retry-locked 相同
+	Extras        bool                  `json:"extras"`         // 记录章节页面上的更新日期和作者的话，与 --extras 相同
+	Archive       bool                  `json:"archive"`        // 开启存档模式，与 --archive 相同
+	ProbeSequence bool                  `json:"probe_sequence"` // 每个章节都探测按编号排列的图片，与 --probe-sequence 相同
+	SequenceProbe sequenceProbeSettings `json:"sequence_probe"` // 探测的并发数、连续不存在时停止的数量和上限
+	BestVersion   bool                  `json:"best_version"`   // 比较所有来源的章节版本，下载评分最高的，与 --best-version 相同
+	TrimRecap     bool                  `json:"trim_recap"`     // 删除章节开头与上一章结尾重复的页，与 --trim-recap 相同
+	FinalizePrune bool                  `json:"finalize_prune"` // 完结的漫画生成最终电子书后删除原始图片，与 --finalize-prune 相同
+	Placeholders  bool                  `json:"placeholders"`   // 下载失败的页插入占位图，与 --placeholders 相同
+	OCR           bool                  `json:"ocr"`            // 下载完漫画后识别新章节中的文字，与 --ocr 相同
+	OCRLang       string                `json:"ocr_lang"`       // tesseract 使用的语言，与 --ocr-lang 相同
+	Plugins       []pluginConfig        `json:"plugins"`        // 在发现章节、下载完一页、打包章节时调用的外部程序
+	Translate     translateConfig       `json:"translate"`      // 翻译漫画和章节标题的接口和目标语言
+
+	Users   []daemonUser `json:"users"`    // daemon 服务的用户，设置后需要登录
+	TLSCert string       `json:"tls_cert"` // daemon 服务的 HTTPS 证书，与 --tls-cert 相同
+	TLSKey  string       `json:"tls_key"`  // daemon 服务的 HTTPS 私钥，与 --tls-key 相同
+
+	DefaultProfile string                  `json:"default_profile"` // 未指定 --profile 时使用的配置方案
+	Profiles       map[string]comicProfile `json:"profiles"`
+}
+
+// comicProfile 配置方案：针对不同站点、账号或网络环境的一组设置，用 --profile 选择
+type comicProfile struct {
+	BaseURL     string            `json:"base_url"`     // 只输入ID时使用的站点地址
+	Output      string            `json:"output"`       // 漫画库根目录
+	Scratch     string            `json:"scratch"`      // 下载中章节的临时目录
+	Headers     map[string]string `json:"headers"`      // 附加到所有请求的请求头，如 Cookie
+	Proxies     []string          `json:"proxies"`      // 代理地址，配合 --rotate 轮换
+	ProxyList   string            `json:"proxy_list"`   // 代理列表文件，与 --proxy-list 相同
+	CACert      string            `json:"ca_cert"`      // 额外信任的 CA 证书（如 mitmproxy 的根证书），与 --ca-cert 相同
+	InsecureTLS bool              `json:"insecure_tls"` // 不校验站点的证书，与 --insecure-tls 相同
+	Rules       string            `json:"rules"`        // 自定义站点规则文件，与 --rules 相同
+	Polite      bool              `json:"polite"`       // 开启礼貌抓取模式
+	PoliteDelay string            `json:"polite_delay"` // 礼貌抓取的请求间隔
+}
+
+// extraHeaders 配置方案中附加到所有请求的请求头
+var extraHeaders map[string]string
+
+// setExtraHeaders 设置配置方案中的请求头，覆盖默认的同名请求头
+func setExtraHeaders(req *http.Request) {
+	for key, value := range extraHeaders {
+		req.Header.Set(key, value)
+	}
+}
+
+// calibreConfig Calibre 书库设置
+type calibreConfig struct {
+	Library   string `json:"library"`             // 书库路径或内容服务器地址，如 http://localhost:8080/#comics
+	Username  string `json:"username,omitempty"`  // 内容服务器用户名
+	Password  string `json:"password,omitempty"`  // 内容服务器密码
+	Calibredb string `json:"calibredb,omitempty"` // calibredb 程序路径，默认从 PATH 中查找
+}
+
+// kindleConfig Send-to-Kindle 邮件发送设置
+type kindleConfig struct {
+	To        string `json:"to"`          // Send-to-Kindle 邮箱地址
+	From      string `json:"from"`        // 发件人，需要在亚马逊账户中加入已认可的发件人列表
+	SMTPHost  string `json:"smtp_host"`   // SMTP 服务器
+	SMTPPort  int    `json:"smtp_port"`   // 端口，465 使用 TLS，其他端口使用 STARTTLS，默认 587
+	Username  string `json:"username"`    // SMTP 用户名，默认与发件人相同
+	Password  string `json:"password"`    // SMTP 密码或授权码
+	MaxSizeMB int    `json:"max_size_mb"` // 每封邮件的附件大小上限，默认 50
+}
+
+// loadConfig 读取配置文件，文件不存在时返回空配置
+func loadConfig() (*comicConfig, error) {
+	cfg := &comicConfig{}
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %v", err)
+	}
+	return cfg, nil
+}
+
+// applyConfig 将配置文件中的默认设置应用到全局设置，命令行参数随后解析，可以覆盖这些设置
+func applyConfig(cfg *comicConfig) {
+	if cfg.Output != "" {
+		if err := setOutputRoot(cfg.Output); err != nil {
+			fmt.Printf("配置文件中的 output 无效: %v\n", err)
+		}
+	}
+	if cfg.AsciiNames {
+		asciiNames = true
+	}
+	if cfg.Scratch != "" {
+		if err := setScratchRoot(cfg.Scratch); err != nil {
+			fmt.Printf("配置文件中的 scratch 无效: %v\n", err)
+		}
+	}
+	metadataDefaults = cfg.Metadata
+	if cfg.ImageFilter.enabled() {
+		imageFilters = cfg.ImageFilter
+	}
+	if cfg.ImageBackend != "" {
+		if backend, err := parseImageBackend(cfg.ImageBackend); err != nil {
+			fmt.Printf("配置文件中的 image_backend 无效: %v\n", err)
+		} else {
+			imageBackend = backend
+		}
+	}
+	daemonUsers = append(daemonUsers, cfg.Users...)
+	if cfg.TLSCert != "" {
+		daemonTLS.cert = cfg.TLSCert
+	}
+	if cfg.TLSKey != "" {
+		daemonTLS.key = cfg.TLSKey
+	}
+	if cfg.RetryLocked {
+		retryLocked = true
+	}
+	if cfg.Extras {
+		chapterExtras = true
+	}
+	if cfg.Archive {
+		archiveMode = true
+	}
+	if cfg.ProbeSequence {
+		probeSequence = true
+	}
+	if cfg.BestVersion {
+		bestVersion = true
+	}
+	if cfg.TrimRecap {
+		trimRecap = true
+	}
+	if cfg.Placeholders {
+		placeholderPages = true
+	}
+	if cfg.OCR {
+		ocrAfterDownload = true
+	}
+	if cfg.OCRLang != "" {
+		ocrLang = cfg.OCRLang
+	}
+	if len(cfg.Plugins) > 0 {
+		setPlugins(cfg.Plugins)
+	}
+	if cfg.Translate != (translateConfig{}) {
+		translateSettings = cfg.Translate
+	}
+	if cfg.FinalizePrune {
+		finalizePrune = true
+	}
+	if cfg.SequenceProbe.Workers > 0 {
+		sequenceProbe.Workers = cfg.SequenceProbe.Workers
+	}
+	if cfg.SequenceProbe.MaxMisses > 0 {
+		sequenceProbe.MaxMisses = cfg.SequenceProbe.MaxMisses
+	}
+	if cfg.SequenceProbe.Limit > 0 {
+		sequenceProbe.Limit = cfg.SequenceProbe.Limit
+	}
+	if cfg.LowMemory {
+		enableLowMemory()
+	}
+	if cfg.ImageMemory != "" {
+		if n, err := parseByteSize(cfg.ImageMemory); err != nil {
+			fmt.Printf("配置文件中的 image_memory 无效: %v\n", err)
+		} else {
+			imageMemoryLimit = n
+		}
+	}
+	if len(cfg.Windows) > 0 {
+		if windows, err := parseWindows(cfg.Windows); err != nil {
+			fmt.Printf("配置文件中的 windows 无效: %v\n", err)
+		} else {
+			bandwidth.setWindows(windows)
+		}
+	}
+	for from, to := range cfg.ImageHosts {
+		if from, to, err := parseImageHost(from + "=" + to); err != nil {
+			fmt.Printf("配置文件中的 image_hosts 无效: %v\n", err)
+		} else {
+			imageHostMap[from] = to
+		}
+	}
+	if cfg.MaxRedirects != nil {
+		if *cfg.MaxRedirects < 0 {
+			fmt.Printf("配置文件中的 max_redirects 无效: %d\n", *cfg.MaxRedirects)
+		} else {
+			maxRedirects = *cfg.MaxRedirects
+		}
+	}
+	if cfg.Redirects != "" {
+		if policy, err := parseRedirectPolicy(cfg.Redirects); err != nil {
+			fmt.Printf("配置文件中的 redirects 无效: %v\n", err)
+		} else {
+			redirectPolicy = policy
+		}
+	}
+	redirectAllow = append(redirectAllow, cfg.RedirectAllow...)
+	if cfg.Fetcher != "" {
+		if fetcher, err := parseFetcher(cfg.Fetcher); err != nil {
+			fmt.Printf("配置文件中的 fetcher 无效: %v\n", err)
+		} else {
+			siteFetcher = fetcher
+		}
+	}
+	if cfg.IPFamily != "" {
+		if family, err := parseIPFamily(cfg.IPFamily); err != nil {
+			fmt.Printf("配置文件中的 ip_family 无效: %v\n", err)
+		} else {
+			ipFamily = family
+		}
+	}
+	if cfg.PageTimeout != "" {
+		if d, err := parseTimeout(cfg.PageTimeout); err != nil {
+			fmt.Printf("配置文件中的 page_timeout 无效: %v\n", err)
+		} else {
+			pageTimeout = d
+		}
+	}
+	if cfg.ImageTimeout != "" {
+		if d, err := parseTimeout(cfg.ImageTimeout); err != nil {
+			fmt.Printf("配置文件中的 image_timeout 无效: %v\n", err)
+		} else {
+			imageTimeout = d
+		}
+	}
+	if cfg.Progress != "" {
+		if mode, err := parseProgressMode(cfg.Progress); err != nil {
+			fmt.Printf("配置文件中的 progress 无效: %v\n", err)
+		} else {
+			progressMode = mode
+		}
+	}
+	if cfg.LimitRate != "" {
+		if n, err := parseByteSize(cfg.LimitRate); err != nil {
+			fmt.Printf("配置文件中的 limit_rate 无效: %v\n", err)
+		} else {
+			bandwidth.setRate(n)
+		}
+	}
+	for _, step := range cfg.PostProcess {
+		if err := postSteps.parsePostStep(step); err != nil {
+			fmt.Printf("配置文件中的 post_process 无效: %v\n", err)
+		}
+	}
+	if cfg.SummaryFile != "" && summaryFile == "" {
+		summaryFile = cfg.SummaryFile
+	}
+	if cfg.Polite {
+		politeMode.enabled = true
+	}
+	if cfg.PoliteDelay != "" {
+		d, err := time.ParseDuration(cfg.PoliteDelay)
+		if err != nil || d < 0 {
+			fmt.Printf("配置文件中的 polite_delay 无效: %s\n", cfg.PoliteDelay)
+		} else {
+			politeMode.delay = d
+		}
+	}
+}
+
+// takeProfileFlag 从命令行参数中取出 --profile，返回方案名和其余参数
+func takeProfileFlag(args []string) (string, []string) {
+	profile := ""
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--profile" && i+1 < len(args) {
+			profile = args[i+1]
+			i++
+			continue
+		}
+		if strings.HasPrefix(args[i], "--profile=") {
+			profile = strings.TrimPrefix(args[i], "--profile=")
+			continue
+		}
+		rest = append(rest, args[i])
+	}
+	return profile, rest
+}
+
+// applyProfile 应用指定的配置方案，name 为空时使用 default_profile
+func applyProfile(cfg *comicConfig, name string) error {
+	if name == "" {
+		name = cfg.DefaultProfile
+	}
+	if name == "" {
+		return nil
+	}
+	profile, ok := cfg.Profiles[name]
+	if !ok {
+		var names []string
+		for n := range cfg.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("配置文件中没有配置方案 %s（可用: %s）", name, strings.Join(names, ", "))
+	}
+
+	if profile.BaseURL != "" {
+		u, err := url.Parse(strings.TrimSuffix(profile.BaseURL, "/"))
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("配置方案 %s 的 base_url 无效: %s", name, profile.BaseURL)
+		}
+		defaultBaseURL = u.String()
+		siteBaseURL = defaultBaseURL
+	}
+	if len(profile.Headers) > 0 {
+		extraHeaders = profile.Headers
+	}
+	for _, raw := range profile.Proxies {
+		proxyURL, err := url.Parse(raw)
+		if err != nil || proxyURL.Host == "" {
+			return fmt.Errorf("配置方案 %s 中的代理地址无效: %s", name, raw)
+		}
+		siteBreaker.proxies = append(siteBreaker.proxies, proxyURL)
+	}
+	if profile.ProxyList != "" {
+		proxies, err := loadProxyList(profile.ProxyList)
+		if err != nil {
+			return fmt.Errorf("读取代理列表失败: %v", err)
+		}
+		siteBreaker.proxies = append(siteBreaker.proxies, proxies...)
+	}
+	if profile.CACert != "" {
+		if err := addCACert(profile.CACert); err != nil {
+			return fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+	}
+	if profile.InsecureTLS {
+		setInsecureTLS()
+	}
+	if profile.Rules != "" {
+		if err := useRules(profile.Rules); err != nil {
+			return fmt.Errorf("读取规则文件失败: %v", err)
+		}
+	}
+	applyConfig(&comicConfig{Output: profile.Output, Scratch: profile.Scratch, Polite: profile.Polite, PoliteDelay: profile.PoliteDelay})
+
+	debugf("使用配置方案 %s\n", name)
+	return nil
+}
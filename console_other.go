@@ -0,0 +1,6 @@
+//go:build !windows
+
+package main
+
+// setupConsole 其他系统的终端默认使用 UTF-8，无需设置
+func setupConsole() {}
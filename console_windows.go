@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// enableVirtualTerminalProcessing 让控制台解释 ANSI 转义序列，进度条的清行和光标移动依赖它
+const enableVirtualTerminalProcessing = 0x0004
+
+// setupConsole 把控制台的输入输出编码设为 UTF-8（代码页 65001），
+// 否则中文系统默认的 GBK 控制台会把程序输出的 UTF-8 标题显示为乱码
+func setupConsole() {
+	kernel32 := syscall.NewLazyDLL("kernel32.dll")
+	kernel32.NewProc("SetConsoleOutputCP").Call(65001)
+	kernel32.NewProc("SetConsoleCP").Call(65001)
+
+	getMode := kernel32.NewProc("GetConsoleMode")
+	setMode := kernel32.NewProc("SetConsoleMode")
+	for _, f := range []*os.File{os.Stdout, os.Stderr} {
+		var mode uint32
+		if r, _, _ := getMode.Call(f.Fd(), uintptr(unsafe.Pointer(&mode))); r == 0 {
+			// 输出被重定向到文件或管道
+			continue
+		}
+		setMode.Call(f.Fd(), uintptr(mode|enableVirtualTerminalProcessing))
+	}
+}
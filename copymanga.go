@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// copySite 拷贝漫画（copymanga/mangacopy）及其镜像站
+// 网页由脚本渲染，目录和图片列表通过 JSON 接口获取；接口不可用时改为读取网页版的加密内容
+// 漫画ID为链接中的 path_word，章节ID为 "<path_word>/<章节uuid>"
+type copySite struct{}
+
+// copyKeyPattern 网页脚本中解密用的密钥：16 个字符的字符串变量，变量名随网站更新变化
+var copyKeyPattern = regexp.MustCompile(`var\s+\w+\s*=\s*['"]([0-9A-Za-z]{16})['"]`)
+
+// copyResponse 接口响应的通用结构
+type copyResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (copySite) name() string { return "copymanga" }
+
+func (copySite) matchHost(host string) bool {
+	return strings.Contains(host, "copymanga") || strings.Contains(host, "mangacopy")
+}
+
+func (copySite) parsePath(u *url.URL) (targetKind, string, bool) {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if segments[i] != "comic" {
+			continue
+		}
+		if i+3 < len(segments) && segments[i+2] == "chapter" {
+			return targetChapter, segments[i+1] + "/" + segments[i+3], true
+		}
+		return targetSeries, segments[i+1], true
+	}
+	return 0, "", false
+}
+
+func (copySite) seriesURL(baseURL, seriesID string) string {
+	return baseURL + "/comic/" + seriesID
+}
+
+// apiBase 由网站地址推导接口地址，如 https://www.mangacopy.com -> https://api.mangacopy.com
+func (copySite) apiBase(baseURL string) string {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return baseURL
+	}
+	return u.Scheme + "://api." + strings.TrimPrefix(u.Host, "www.")
+}
+
+// get 请求接口，检查响应中的业务状态码后把 results 解析到 v
+// 出错时 results 是一段说明文字而不是对象，先检查状态码，不把它当作格式错误重试
+func (s copySite) get(ctx context.Context, baseURL, endpoint string, v interface{}) error {
+	var resp struct {
+		copyResponse
+		Results json.RawMessage `json:"results"`
+	}
+	headers := map[string]string{"platform": "3", "Referer": baseURL + "/"}
+	err := fetchJSON(ctx, s.apiBase(baseURL)+endpoint, headers, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Code != 200 {
+		return fmt.Errorf("接口返回错误 %d: %s", resp.Code, resp.Message)
+	}
+	if err := json.Unmarshal(resp.Results, v); err != nil {
+		return fmt.Errorf("解析接口响应失败: %v", err)
+	}
+	return nil
+}
+
+func (s copySite) fetchSeries(ctx context.Context, baseURL, seriesID string) (*seriesPage, error) {
+	page, err := s.fetchSeriesAPI(ctx, baseURL, seriesID)
+	if err == nil || ctx.Err() != nil {
+		return page, err
+	}
+	infof("接口请求失败（%v），改为从网页获取目录\n", err)
+	page, webErr := s.fetchSeriesWeb(ctx, baseURL, seriesID)
+	if webErr != nil {
+		return nil, fmt.Errorf("%w；网页: %v", err, webErr)
+	}
+	return page, nil
+}
+
+// fetchSeriesAPI 通过接口获取漫画信息和章节列表
+func (s copySite) fetchSeriesAPI(ctx context.Context, baseURL, seriesID string) (*seriesPage, error) {
+	var comic struct {
+		Results struct {
+			Comic struct {
+				Name   string `json:"name"`
+				Status struct {
+					Value   int    `json:"value"`
+					Display string `json:"display"`
+				} `json:"status"`
+			} `json:"comic"`
+		} `json:"results"`
+	}
+	err := s.get(ctx, baseURL, "/api/v3/comic2/"+url.PathEscape(seriesID)+"?platform=3", &comic.Results)
+	if err != nil {
+		return nil, err
+	}
+
+	// 章节列表分页返回，只获取默认分组（话），单行本等其他分组不包含在内
+	var chapters []ChapterInfo
+	for offset := 0; ; {
+		var page struct {
+			Results struct {
+				Total int `json:"total"`
+				Limit int `json:"limit"`
+				List  []struct {
+					UUID string `json:"uuid"`
+					Name string `json:"name"`
+				} `json:"list"`
+			} `json:"results"`
+		}
+		endpoint := fmt.Sprintf("/api/v3/comic/%s/group/default/chapters?limit=500&offset=%d&platform=3", url.PathEscape(seriesID), offset)
+		if err := s.get(ctx, baseURL, endpoint, &page.Results); err != nil {
+			return nil, err
+		}
+		for _, c := range page.Results.List {
+			chapters = append(chapters, ChapterInfo{id: seriesID + "/" + c.UUID, title: c.Name})
+		}
+		offset += len(page.Results.List)
+		if len(page.Results.List) == 0 || offset >= page.Results.Total {
+			break
+		}
+	}
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("未找到任何章节")
+	}
+
+	status := comic.Results.Comic.Status
+	return &seriesPage{
+		title:     sanitizeFileName(comic.Results.Comic.Name),
+		chapters:  chapters,
+		completed: status.Value == 1 || completedText(status.Display), // 0 连载中，1 已完结
+	}, nil
+}
+
+// fetchSeriesWeb 从网页获取目录：章节列表由 /comicdetail/<漫画>/chapters 加密返回，密钥在漫画页面的脚本中
+func (s copySite) fetchSeriesWeb(ctx context.Context, baseURL, seriesID string) (*seriesPage, error) {
+	pageURL := s.seriesURL(baseURL, seriesID)
+	doc, err := fetchPageWithRetry(ctx, pageURL, 3)
+	if err != nil {
+		return nil, err
+	}
+	title := strings.TrimSpace(doc.Find(".comicParticulars-title-right h6").First().AttrOr("title", ""))
+	if title == "" {
+		title = extractComicTitle(doc)
+	}
+
+	var detail struct {
+		copyResponse
+		Results string `json:"results"`
+	}
+	endpoint := baseURL + "/comicdetail/" + url.PathEscape(seriesID) + "/chapters"
+	if err := fetchJSON(ctx, endpoint, map[string]string{"Referer": pageURL}, &detail); err != nil {
+		return nil, err
+	}
+	if detail.Code != 200 {
+		return nil, fmt.Errorf("网页接口返回错误 %d: %s", detail.Code, detail.Message)
+	}
+	var results struct {
+		Groups map[string]struct {
+			Chapters []struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"chapters"`
+		} `json:"groups"`
+	}
+	if err := copyDecrypt(copyPageKeys(doc), detail.Results, &results); err != nil {
+		return nil, fmt.Errorf("解密章节列表失败: %v", err)
+	}
+
+	// 与接口一样只取默认分组（话）
+	var chapters []ChapterInfo
+	for _, c := range results.Groups["default"].Chapters {
+		chapters = append(chapters, ChapterInfo{id: seriesID + "/" + c.ID, title: c.Name})
+	}
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("未找到任何章节")
+	}
+	return &seriesPage{
+		title:     sanitizeFileName(title),
+		chapters:  chapters,
+		rating:    detectRating(doc),
+		completed: detectCompleted(doc),
+	}, nil
+}
+
+func (s copySite) fetchChapter(ctx context.Context, baseURL, chapterID string) (*chapterPage, error) {
+	seriesID, uuid, ok := strings.Cut(chapterID, "/")
+	if !ok {
+		return nil, fmt.Errorf("无效的章节ID: %s（应为 <漫画>/<章节uuid>）", chapterID)
+	}
+	page, err := s.fetchChapterAPI(ctx, baseURL, seriesID, uuid)
+	if err == nil || ctx.Err() != nil {
+		return page, err
+	}
+	infof("接口请求失败（%v），改为从网页获取图片列表\n", err)
+	page, webErr := s.fetchChapterWeb(ctx, baseURL, seriesID, uuid)
+	if webErr != nil {
+		return nil, fmt.Errorf("%w；网页: %v", err, webErr)
+	}
+	return page, nil
+}
+
+// fetchChapterAPI 通过接口获取章节的图片列表
+func (s copySite) fetchChapterAPI(ctx context.Context, baseURL, seriesID, uuid string) (*chapterPage, error) {
+	var chapter struct {
+		Results struct {
+			Chapter struct {
+				Name     string `json:"name"`
+				Contents []struct {
+					URL string `json:"url"`
+				} `json:"contents"`
+				Words           []int  `json:"words"`
+				DatetimeCreated string `json:"datetime_created"`
+			} `json:"chapter"`
+		} `json:"results"`
+	}
+	endpoint := "/api/v3/comic/" + url.PathEscape(seriesID) + "/chapter2/" + url.PathEscape(uuid) + "?platform=3"
+	if err := s.get(ctx, baseURL, endpoint, &chapter.Results); err != nil {
+		return nil, err
+	}
+
+	contents := chapter.Results.Chapter.Contents
+	words := chapter.Results.Chapter.Words
+	if len(contents) == 0 {
+		return nil, fmt.Errorf("未找到任何图片链接")
+	}
+
+	// contents 不按页码排列，words[i] 为第 i 张图片的页码
+	order := make([]int, len(contents))
+	for i := range order {
+		order[i] = i
+	}
+	if len(words) == len(contents) {
+		sort.SliceStable(order, func(a, b int) bool { return words[order[a]] < words[order[b]] })
+	}
+
+	images := make([]string, 0, len(contents))
+	for _, i := range order {
+		images = append(images, copyImageURL(contents[i].URL))
+	}
+
+	page := &chapterPage{title: sanitizeFileName(chapter.Results.Chapter.Name), url: s.chapterURL(baseURL, seriesID, uuid), images: images, strategy: "api"}
+	if chapterExtras {
+		page.published = parsePublishedDate(chapter.Results.Chapter.DatetimeCreated)
+	}
+	rewriteImageHosts(page)
+	return page, nil
+}
+
+// fetchChapterWeb 从章节网页获取图片列表：按页码排列的图片链接加密保存在 .imageData 的 contentKey 属性中
+func (s copySite) fetchChapterWeb(ctx context.Context, baseURL, seriesID, uuid string) (*chapterPage, error) {
+	pageURL := s.chapterURL(baseURL, seriesID, uuid)
+	doc, err := fetchPageWithRetry(ctx, pageURL, 3)
+	if err != nil {
+		return nil, err
+	}
+	// 解析 HTML 时属性名转为小写
+	data := doc.Find(".imageData").First().AttrOr("contentkey", "")
+	if data == "" {
+		if reason := detectLocked(doc, nil, ""); reason != "" {
+			return nil, lockedError(reason)
+		}
+		return nil, fmt.Errorf("页面中没有图片数据")
+	}
+	var contents []struct {
+		URL string `json:"url"`
+	}
+	if err := copyDecrypt(copyPageKeys(doc), data, &contents); err != nil {
+		return nil, fmt.Errorf("解密图片列表失败: %v", err)
+	}
+	var images []string
+	for _, c := range contents {
+		if c.URL != "" {
+			images = append(images, copyImageURL(c.URL))
+		}
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("未找到任何图片链接")
+	}
+
+	title := strings.TrimSpace(doc.Find("h4.header").First().Text())
+	if title == "" {
+		title = extractChapterTitle(doc)
+	}
+	page := &chapterPage{title: sanitizeFileName(title), url: pageURL, images: images, strategy: "web"}
+	rewriteImageHosts(page)
+	return page, nil
+}
+
+func (copySite) chapterURL(baseURL, seriesID, uuid string) string {
+	return baseURL + "/comic/" + seriesID + "/chapter/" + uuid
+}
+
+// copyImageURL 默认返回 800 像素宽的图片，换成 1500 像素的版本
+func copyImageURL(src string) string {
+	return strings.Replace(src, ".c800x.", ".c1500x.", 1)
+}
+
+// copyPageKeys 网页脚本中可能是解密密钥的字符串
+func copyPageKeys(doc *goquery.Document) []string {
+	var keys []string
+	doc.Find("script").Each(func(i int, sel *goquery.Selection) {
+		for _, m := range copyKeyPattern.FindAllStringSubmatch(sel.Text(), -1) {
+			keys = append(keys, m[1])
+		}
+	})
+	return keys
+}
+
+// copyDecrypt 解密网页版的加密内容：前 16 个字符为 AES-CBC 的 IV，其余为十六进制的密文，PKCS#7 填充
+// 依次尝试各个密钥，解密结果能解析为 JSON 时写入 v
+func copyDecrypt(keys []string, data string, v interface{}) error {
+	data = strings.TrimSpace(data)
+	if len(data) <= aes.BlockSize {
+		return errors.New("加密内容过短")
+	}
+	iv := []byte(data[:aes.BlockSize])
+	ciphertext, err := hex.DecodeString(data[aes.BlockSize:])
+	if err != nil || len(ciphertext)%aes.BlockSize != 0 {
+		return errors.New("加密内容格式不正确")
+	}
+	if len(keys) == 0 {
+		return errors.New("页面中没有找到密钥")
+	}
+	for _, key := range keys {
+		block, err := aes.NewCipher([]byte(key))
+		if err != nil {
+			continue
+		}
+		plain := make([]byte, len(ciphertext))
+		cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+		if plain, ok := unpadPKCS7(plain); ok && json.Unmarshal(plain, v) == nil {
+			return nil
+		}
+	}
+	return errors.New("页面中的密钥都无法解密")
+}
+
+// unpadPKCS7 去掉 PKCS#7 填充，填充不正确时 ok 为false
+func unpadPKCS7(data []byte) ([]byte, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	n := int(data[len(data)-1])
+	if n == 0 || n > aes.BlockSize || n > len(data) {
+		return nil, false
+	}
+	for _, b := range data[len(data)-n:] {
+		if int(b) != n {
+			return nil, false
+		}
+	}
+	return data[:len(data)-n], true
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestCopyParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		kind targetKind
+		id   string
+		ok   bool
+	}{
+		{"/comic/testcomic", targetSeries, "testcomic", true},
+		{"/comic/testcomic/", targetSeries, "testcomic", true},
+		{"/comic/testcomic/chapter/uuid-1", targetChapter, "testcomic/uuid-1", true},
+		{"/h5/comic/testcomic", targetSeries, "testcomic", true},
+		{"/comics", 0, "", false},
+	}
+	for _, tt := range tests {
+		kind, id, ok := copySite{}.parsePath(&url.URL{Path: tt.path})
+		if kind != tt.kind || id != tt.id || ok != tt.ok {
+			t.Errorf("parsePath(%q) = %v, %q, %v, want %v, %q, %v", tt.path, kind, id, ok, tt.kind, tt.id, tt.ok)
+		}
+	}
+}
+
+func TestCopyFetchSeries(t *testing.T) {
+	useFixtures(t)
+	page, err := copySite{}.fetchSeries(context.Background(), "https://www.mangacopy.com", "testcomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.title != "测试漫画" || !page.completed {
+		t.Errorf("title, completed = %q, %v, want 测试漫画, true", page.title, page.completed)
+	}
+	// 章节列表分两页返回
+	want := []ChapterInfo{
+		{id: "testcomic/uuid-1", title: "第01话"},
+		{id: "testcomic/uuid-2", title: "第02话"},
+		{id: "testcomic/uuid-3", title: "第03话"},
+	}
+	if !reflect.DeepEqual(page.chapters, want) {
+		t.Errorf("chapters = %+v, want %+v", page.chapters, want)
+	}
+}
+
+func TestCopyFetchChapter(t *testing.T) {
+	useFixtures(t)
+	saved := chapterExtras
+	chapterExtras = true
+	defer func() { chapterExtras = saved }()
+
+	page, err := copySite{}.fetchChapter(context.Background(), "https://www.mangacopy.com", "testcomic/uuid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.title != "第01话" || page.url != "https://www.mangacopy.com/comic/testcomic/chapter/uuid-1" || page.published != "2023-05-01" {
+		t.Errorf("title, url, published = %q, %q, %q", page.title, page.url, page.published)
+	}
+	// 按 words 中的页码排列，并换成 1500 像素宽的版本
+	want := []string{
+		"https://hi77-overseas.mangafuna.xyz/testcomic/uuid-1/a.jpg.c1500x.jpg",
+		"https://hi77-overseas.mangafuna.xyz/testcomic/uuid-1/b.jpg.c1500x.jpg",
+		"https://hi77-overseas.mangafuna.xyz/testcomic/uuid-1/c.jpg.c1500x.jpg",
+	}
+	if !reflect.DeepEqual(page.images, want) {
+		t.Errorf("images = %q, want %q", page.images, want)
+	}
+
+	if _, err := (copySite{}).fetchChapter(context.Background(), "https://www.mangacopy.com", "testcomic"); err == nil {
+		t.Error("chapter ID without a UUID succeeded")
+	}
+	if _, err := (copySite{}).fetchChapter(context.Background(), "https://www.mangacopy.com", "testcomic/uuid-404"); err == nil {
+		t.Error("chapter with an API error succeeded")
+	}
+}
+
+func TestCopyFetchSeriesWeb(t *testing.T) {
+	useFixtures(t)
+	// 没有保存接口的响应，改为从网页获取并解密章节列表
+	page, err := copySite{}.fetchSeries(context.Background(), "https://www.mangacopy.com", "webcomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.title != "网页漫画" || page.completed {
+		t.Errorf("title, completed = %q, %v, want 网页漫画, false", page.title, page.completed)
+	}
+	want := []ChapterInfo{
+		{id: "webcomic/uuid-w1", title: "第1话"},
+		{id: "webcomic/uuid-w2", title: "第2话"},
+	}
+	if !reflect.DeepEqual(page.chapters, want) {
+		t.Errorf("chapters = %+v, want %+v", page.chapters, want)
+	}
+}
+
+func TestCopyFetchChapterWeb(t *testing.T) {
+	useFixtures(t)
+	page, err := copySite{}.fetchChapter(context.Background(), "https://www.mangacopy.com", "webcomic/uuid-w1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"https://hi77-overseas.mangafuna.xyz/webcomic/uuid-w1/1.jpg.c1500x.jpg",
+		"https://hi77-overseas.mangafuna.xyz/webcomic/uuid-w1/2.jpg.c1500x.jpg",
+	}
+	if !reflect.DeepEqual(page.images, want) || page.strategy != "web" {
+		t.Errorf("images, strategy = %q, %q, want %q, web", page.images, page.strategy, want)
+	}
+
+	// 页面中的密钥无法解密时失败，不返回错误的图片列表
+	if _, err := (copySite{}).fetchChapter(context.Background(), "https://www.mangacopy.com", "webcomic/uuid-w2"); err == nil {
+		t.Error("chapter encrypted with another key succeeded")
+	}
+}
+
+func TestCopyDecrypt(t *testing.T) {
+	// 用 x2Kq9LmP4vT7wB1z 以 AES-128-CBC 加密的 {"ok":true}，IV 为 0123456789abcdef
+	data := "0123456789abcdef" + "39aedecea9cbf66edb5cd1377c913a57"
+	var v struct {
+		OK bool `json:"ok"`
+	}
+	if err := copyDecrypt([]string{"wrongwrongwrong1", "x2Kq9LmP4vT7wB1z"}, data, &v); err != nil || !v.OK {
+		t.Errorf("copyDecrypt = %v, ok = %v", err, v.OK)
+	}
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"过短", "0123456789abcdef"},
+		{"不是十六进制", "0123456789abcdefxyz"},
+		{"长度不是块大小的整数倍", "0123456789abcdef" + "abcd"},
+		{"密钥不对", data},
+	}
+	for _, tt := range tests {
+		if err := copyDecrypt([]string{"wrongwrongwrong1"}, tt.data, &v); err == nil {
+			t.Errorf("%s: copyDecrypt succeeded", tt.name)
+		}
+	}
+	if err := copyDecrypt(nil, data, &v); err == nil {
+		t.Error("copyDecrypt without keys succeeded")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"image"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxCoverCandidates 挑选章节封面时最多检查开头的几页，都不合适时使用第一页
+const maxCoverCandidates = 6
+
+// coverAdPattern 不适合作封面的图片文件名，如广告、横幅、二维码、水印页
+var coverAdPattern = regexp.MustCompile(`(?i)(^|[_\-.])(ad|ads|advert|banner|promo|qrcode|qr|logo|notice|credit|credits)([_\-.\d]|$)`)
+
+// chapterCover 从章节开头几页中挑选有代表性的一页作为封面，返回文件名
+// 跳过接近纯色的空白页、过宽的横幅广告，以及文件名像广告或付费占位图的页；都不合适时返回第一页
+func chapterCover(dir string, meta *chapterMeta) string {
+	pages := append([]pageMeta(nil), meta.Pages...)
+	sort.Slice(pages, func(i, j int) bool { return pages[i].Index < pages[j].Index })
+	if len(pages) == 0 {
+		return ""
+	}
+	for _, p := range pages[:min(maxCoverCandidates, len(pages))] {
+		if coverCandidate(filepath.Join(dir, p.File), p.URL) {
+			return p.File
+		}
+	}
+	return pages[0].File
+}
+
+// coverCandidate 一页是否适合作封面，无法解码的页不作判断，只看文件名
+func coverCandidate(file, imgURL string) bool {
+	for _, name := range []string{path.Base(strings.SplitN(imgURL, "?", 2)[0]), filepath.Base(file)} {
+		stem := strings.TrimSuffix(name, path.Ext(name))
+		if coverAdPattern.MatchString(stem) || lockedImagePattern.MatchString(stem) {
+			return false
+		}
+	}
+	release, err := reserveImageMemory(file)
+	if err != nil {
+		return true
+	}
+	defer release()
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return true
+	}
+	b := img.Bounds()
+	// 宽度超过高度 2.5 倍的通常是横幅广告，跨页的对开图约为 1.4 倍
+	if b.Dx() > b.Dy()*5/2 {
+		return false
+	}
+	return !blankImage(img)
+}
+
+// blankImage 图片是否接近纯色（空白页、全黑的过渡页），按 32x32 的网格取样计算亮度的标准差
+func blankImage(img image.Image) bool {
+	b := img.Bounds()
+	if b.Empty() {
+		return true
+	}
+	var sum, sumSq, n float64
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 32; x++ {
+			px := b.Min.X + (2*x+1)*b.Dx()/64
+			py := b.Min.Y + (2*y+1)*b.Dy()/64
+			r, g, bl, _ := img.At(px, py).RGBA()
+			lum := float64(299*r+587*g+114*bl) / 1000 / 257
+			sum += lum
+			sumSq += lum * lum
+			n++
+		}
+	}
+	mean := sum / n
+	return math.Sqrt(max(sumSq/n-mean*mean, 0)) < 8
+}
+
+// coverPageFile 章节封面图片的路径：优先使用 chapter.json 中记录的封面，
+// 旧版本下载的章节没有记录时挑选一页，record 时写回 chapter.json；没有 chapter.json 时使用第一页
+func coverPageFile(chapterDir string, record bool) string {
+	meta, err := loadChapterMeta(chapterDir)
+	if err != nil || len(meta.Pages) == 0 {
+		return firstPageFile(chapterDir)
+	}
+	if meta.Cover != "" && fileSize(filepath.Join(chapterDir, meta.Cover)) > 0 {
+		return filepath.Join(chapterDir, meta.Cover)
+	}
+	meta.Cover = chapterCover(chapterDir, meta)
+	if meta.Cover == "" || fileSize(filepath.Join(chapterDir, meta.Cover)) <= 0 {
+		return firstPageFile(chapterDir)
+	}
+	if !record {
+		return filepath.Join(chapterDir, meta.Cover)
+	}
+	if data, err := json.MarshalIndent(meta, "", "  "); err == nil {
+		if err := writeFileAtomic(filepath.Join(chapterDir, chapterMetaFile), data); err != nil {
+			verbosef("记录 %s 的封面失败: %v\n", filepath.Base(chapterDir), err)
+		}
+	}
+	return filepath.Join(chapterDir, meta.Cover)
+}
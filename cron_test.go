@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	date := func(s string) time.Time {
+		v, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	tests := []struct {
+		expr, after, want string
+	}{
+		{"@hourly", "2024-01-01 10:30", "2024-01-01 11:00"},
+		{"*/15 9-17 * * 1-5", "2024-03-01 17:50", "2024-03-04 09:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 29 2 *", "2096-03-01 00:00", "2104-02-29 00:00"},
+		{"0 0 31 * *", "2024-04-01 00:00", "2024-05-31 00:00"},
+		{"0 12 13 * 5", "2024-09-01 00:00", "2024-09-06 12:00"},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := s.next(date(tt.after)); !got.Equal(date(tt.want)) {
+			t.Errorf("%q next(%s) = %s, want %s", tt.expr, tt.after, got.Format("2006-01-02 15:04"), tt.want)
+		}
+	}
+
+	for _, expr := range []string{"0 0 30 2 *", "0 0 31 4,6 *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) accepted an expression that never matches", expr)
+		}
+	}
+}
+
+func TestSeriesDueNeverChecked(t *testing.T) {
+	record := &seriesRecord{ID: "1", Schedule: "0 0 29 2 *"}
+	if !seriesDue(record, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), time.Hour) {
+		t.Error("series that was never checked is not due")
+	}
+}
@@ -0,0 +1,964 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// daemonEnvFlags 从环境变量读取的设置，对应的命令行参数（容器中通常不方便修改启动命令）
+var daemonEnvFlags = []struct{ env, flag string }{
+	{"COMICBOX_LIBRARY", "--out"},
+	{"COMICBOX_WORKERS", "--workers"},
+	{"COMICBOX_RULES", "--rules"},
+	{"COMICBOX_PROXY_LIST", "--proxy-list"},
+	{"COMICBOX_TLS_CERT", "--tls-cert"},
+	{"COMICBOX_TLS_KEY", "--tls-key"},
+	{"COMICBOX_TOKEN", "--token"},
+}
+
+// daemonSettings daemon 模式的设置
+type daemonSettings struct {
+	listen   string        // 监听地址，COMICBOX_LISTEN 或 --listen，默认 :8080
+	interval time.Duration // 未设置检查计划的订阅的检查间隔，COMICBOX_INTERVAL 或 --interval
+	shutdown time.Duration // 收到退出信号后等待当前下载完成的最长时间，COMICBOX_SHUTDOWN_TIMEOUT
+	backfill []string      // 低优先级（补档）任务默认的时间段，COMICBOX_BACKFILL_WINDOW 或 --backfill-window
+	policy   retentionPolicy
+}
+
+// daemonEnvArgs 将环境变量转换为命令行参数，COMICBOX_ARGS 中可以写任意其他参数（按空格分隔）
+func daemonEnvArgs() []string {
+	var args []string
+	for _, e := range daemonEnvFlags {
+		if v := os.Getenv(e.env); v != "" {
+			args = append(args, e.flag, v)
+		}
+	}
+	// COMICBOX_USERS 可以设置多个用户，如 alice:密码1,bob:密码2
+	for _, user := range strings.Split(os.Getenv("COMICBOX_USERS"), ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			args = append(args, "--user", user)
+		}
+	}
+	if v := os.Getenv("COMICBOX_LOW_MEMORY"); v == "1" || v == "true" {
+		args = append(args, "--low-memory")
+	}
+	if v := os.Getenv("COMICBOX_LISTEN"); v != "" {
+		args = append(args, "--listen", v)
+	}
+	if v := os.Getenv("COMICBOX_INTERVAL"); v != "" {
+		args = append(args, "--interval", v)
+	}
+	if v := os.Getenv("COMICBOX_SHUTDOWN_TIMEOUT"); v != "" {
+		args = append(args, "--shutdown-timeout", v)
+	}
+	// COMICBOX_WINDOW 和 COMICBOX_BACKFILL_WINDOW 可以设置多个时间段，用逗号分隔
+	for _, e := range []struct{ env, flag string }{{"COMICBOX_WINDOW", "--window"}, {"COMICBOX_BACKFILL_WINDOW", "--backfill-window"}} {
+		for _, w := range strings.Split(os.Getenv(e.env), ",") {
+			if w = strings.TrimSpace(w); w != "" {
+				args = append(args, e.flag, w)
+			}
+		}
+	}
+	return append(args, strings.Fields(os.Getenv("COMICBOX_ARGS"))...)
+}
+
+// parseDaemonArgs 解析环境变量和命令行参数，命令行参数在后，可以覆盖环境变量
+func parseDaemonArgs(args []string) (*daemonSettings, error) {
+	settings := &daemonSettings{listen: ":8080", interval: 6 * time.Hour, shutdown: 25 * time.Second}
+	args = append(daemonEnvArgs(), args...)
+	for i := 0; i < len(args); i++ {
+		n, err := parseGlobalFlag(args, i)
+		if err == nil && n == 0 {
+			n, err = parseRetentionFlag(args, i, &settings.policy)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if n > 0 {
+			i += n - 1
+			continue
+		}
+
+		if args[i] == "--debug" {
+			// 已在 main 中处理
+			continue
+		}
+		if i+1 >= len(args) {
+			return nil, fmt.Errorf("未知的参数: %s", args[i])
+		}
+		value := args[i+1]
+		switch args[i] {
+		case "--listen":
+			settings.listen = value
+		case "--interval":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < time.Minute {
+				return nil, fmt.Errorf("无效的检查间隔: %s", value)
+			}
+			settings.interval = d
+		case "--shutdown-timeout":
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("无效的退出等待时间: %s", value)
+			}
+			settings.shutdown = d
+		case "--backfill-window":
+			if _, err := parseDownloadWindow(value); err != nil {
+				return nil, err
+			}
+			settings.backfill = append(settings.backfill, value)
+		case "--user":
+			user, err := parseUserFlag(value)
+			if err != nil {
+				return nil, err
+			}
+			daemonUsers = append(daemonUsers, user)
+		case "--token":
+			daemonUsers = append(daemonUsers, daemonUser{Name: "token", Token: value})
+		case "--tls-cert":
+			daemonTLS.cert = value
+		case "--tls-key":
+			daemonTLS.key = value
+		default:
+			return nil, fmt.Errorf("未知的参数: %s", args[i])
+		}
+		i++
+	}
+	return settings, nil
+}
+
+// daemon 长期运行的服务：按计划检查订阅，处理通过 API 提交的下载，并在同一端口提供网页、API、OPDS 和健康检查
+// 下载依次在一个 goroutine 中进行（站点地址等是全局设置），网页请求只读取漫画库
+type daemon struct {
+	settings *daemonSettings
+	jobs     *jobQueue        // 订阅更新和提交的下载都作为任务排队，保存在 .comicbox/jobs.json
+	schedule downloadSchedule // 全局的时间段和带宽上限，任务设置了时间段时临时替换
+
+	mu        sync.Mutex
+	current   string    // 正在进行的任务
+	lastCheck time.Time // 上次检查订阅的时间
+	forced    bool      // 下次循环立即检查所有订阅
+	stopping  bool
+	wake      chan struct{}
+	books     map[string]*daemonBook
+}
+
+// daemonBook 缓存的阅读器，漫画目录有变化（如下载了新章节）时重新打开
+type daemonBook struct {
+	book    *readerBook
+	modTime time.Time
+}
+
+// runDaemonCommand 以服务方式运行，适合在容器中部署，收到 SIGTERM 或 Ctrl+C 时等待当前下载完成后退出
+func runDaemonCommand(args []string) {
+	settings, err := parseDaemonArgs(args)
+	if err != nil {
+		fmt.Printf("参数错误: %v\n", err)
+		return
+	}
+	jobs, err := loadJobQueue()
+	if err != nil {
+		fmt.Printf("读取任务队列失败: %v\n", err)
+		return
+	}
+	d := &daemon{settings: settings, jobs: jobs, schedule: bandwidth.current(), wake: make(chan struct{}, 1),
+		books: make(map[string]*daemonBook)}
+
+	useTLS := daemonTLS.cert != "" || daemonTLS.key != ""
+	if useTLS && (daemonTLS.cert == "" || daemonTLS.key == "") {
+		fmt.Println("参数错误: --tls-cert 和 --tls-key 需要同时指定")
+		return
+	}
+	switch {
+	case len(daemonUsers) == 0 && !isLoopback(settings.listen):
+		fmt.Println("警告: 未设置用户（--user 或 COMICBOX_USERS），局域网中的任何人都可以访问和提交下载")
+	case len(daemonUsers) > 0 && !useTLS && !isLoopback(settings.listen):
+		fmt.Println("警告: 未配置 TLS，密码和令牌以明文传输，建议使用 --tls-cert 和 --tls-key")
+	}
+
+	listener, err := net.Listen("tcp", settings.listen)
+	if err != nil {
+		fmt.Printf("启动服务失败: %v\n", err)
+		return
+	}
+	server := &http.Server{Handler: requireAuth(d.handler()), ReadHeaderTimeout: 10 * time.Second}
+	scheme := "http"
+	if useTLS {
+		scheme = "https"
+	}
+	go func() {
+		var err error
+		if useTLS {
+			err = server.ServeTLS(listener, daemonTLS.cert, daemonTLS.key)
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			fmt.Printf("服务已停止: %v\n", err)
+		}
+	}()
+	fmt.Printf("服务已启动: %s://%s/ （OPDS: /opds，健康检查: /healthz），未设置检查计划的漫画每 %v 检查一次\n",
+		scheme, listener.Addr(), settings.interval)
+
+	releaseRunSignals()
+	ctx, stop := signal.NotifyContext(runContext, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	done := make(chan struct{})
+	go func() {
+		d.run(ctx)
+		close(done)
+	}()
+
+	<-ctx.Done()
+	fmt.Println("\n收到退出信号，停止接受新的任务...")
+	d.mu.Lock()
+	d.stopping = true
+	current := d.current
+	d.mu.Unlock()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	server.Shutdown(shutdownCtx)
+	cancel()
+
+	if current != "" {
+		fmt.Printf("等待当前任务完成（最多 %v）: %s\n", settings.shutdown, current)
+	}
+	select {
+	case <-done:
+	case <-time.After(settings.shutdown):
+		fmt.Println("当前任务未能及时完成，未完成的章节保留在临时目录中，下次启动时继续下载")
+	}
+	d.mu.Lock()
+	for _, cached := range d.books {
+		cached.book.close()
+	}
+	d.mu.Unlock()
+}
+
+// run 任务循环：依次执行队列中的任务，每分钟将到期的订阅作为更新任务加入队列
+func (d *daemon) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if j := d.next(); j != nil {
+			d.runJob(j)
+			continue
+		}
+
+		d.mu.Lock()
+		forced := d.forced
+		// 每分钟最多检查一次，被新任务唤醒时不重复检查
+		due := forced || time.Now().Truncate(time.Minute).After(d.lastCheck)
+		d.forced = false
+		d.mu.Unlock()
+		if due {
+			interval := d.settings.interval
+			if forced {
+				// 立即检查时未设置计划的订阅都视为到期
+				interval = 0
+			}
+			started := time.Now()
+			added := 0
+			for _, record := range dueSeries(started, interval) {
+				if _, err := d.jobs.add(jobUpdate, record.ID, record.BaseURL, record.Title, "high", nil); err == nil {
+					added++
+				}
+			}
+			d.mu.Lock()
+			d.lastCheck = started
+			d.mu.Unlock()
+			if added > 0 {
+				continue
+			}
+		}
+
+		// 对齐到下一分钟，保证 cron 计划按分钟触发
+		now := time.Now()
+		select {
+		case <-ctx.Done():
+		case <-d.wake:
+		case <-time.After(now.Truncate(time.Minute).Add(time.Minute).Sub(now)):
+		}
+	}
+}
+
+// next 取出下一个任务，正在退出或队列已暂停时返回nil
+func (d *daemon) next() *job {
+	d.mu.Lock()
+	stopping := d.stopping
+	d.mu.Unlock()
+	if stopping {
+		return nil
+	}
+	now := time.Now()
+	j := d.jobs.next(func(j *job) bool {
+		ok, _ := d.scheduleFor(j).at(now)
+		return ok
+	})
+	if j != nil {
+		d.setCurrent(j.describe())
+	}
+	return j
+}
+
+// scheduleFor 任务的时间段和带宽上限：任务设置了时间段时使用任务的，带宽上限仍为全局的 --limit-rate
+func (d *daemon) scheduleFor(j *job) downloadSchedule {
+	if len(j.Windows) == 0 {
+		return d.schedule
+	}
+	windows, err := parseWindows(j.Windows)
+	if err != nil {
+		return d.schedule
+	}
+	return downloadSchedule{windows: windows, rate: d.schedule.rate}
+}
+
+// runJob 执行一个任务，任务期间有章节失败时记为失败
+func (d *daemon) runJob(j *job) {
+	fmt.Printf("\n===== 任务 %d: %s =====\n", j.ID, j.describe())
+	bandwidth.setSchedule(d.scheduleFor(j))
+	defer bandwidth.setSchedule(d.schedule)
+	before := runStats.failures()
+	if j.Kind == jobUpdate {
+		checkSeries(j.Target, j.BaseURL, j.Added)
+		if d.settings.policy.enabled() {
+			if db, err := loadLibrary(); err == nil {
+				pruneLibrary(db, d.settings.policy, false)
+			}
+		}
+	} else {
+		downloadTarget(j.Target)
+	}
+	d.jobs.finish(j, runStats.failures() > before)
+	d.finish()
+}
+
+// setCurrent 记录正在进行的任务
+func (d *daemon) setCurrent(task string) {
+	d.mu.Lock()
+	d.current = task
+	d.mu.Unlock()
+}
+
+// finish 当前任务结束
+func (d *daemon) finish() {
+	d.setCurrent("")
+}
+
+// enqueue 将链接加入下载队列并唤醒任务循环，未指定优先级时单个章节为 normal，整部漫画（补档）为 low
+// 未指定时间段的低优先级任务使用 --backfill-window
+func (d *daemon) enqueue(target, priority string, windows []string) (*job, error) {
+	t, err := parseTarget(target)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseWindows(windows); err != nil {
+		return nil, err
+	}
+	if priority == "" {
+		priority = "normal"
+		if t.kind == targetSeries {
+			priority = "low"
+		}
+	}
+	if len(windows) == 0 && priority == "low" {
+		windows = d.settings.backfill
+	}
+	d.mu.Lock()
+	stopping := d.stopping
+	d.mu.Unlock()
+	if stopping {
+		return nil, fmt.Errorf("服务正在退出")
+	}
+	j, err := d.jobs.add(jobDownload, target, "", "", priority, windows)
+	if err != nil {
+		return nil, err
+	}
+	d.notify()
+	return j, nil
+}
+
+// notify 唤醒任务循环，已有未处理的唤醒时忽略
+func (d *daemon) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// daemonStatus /api/status 和 /healthz 返回的状态
+type daemonStatus struct {
+	Status    string    `json:"status"` // ok，正在退出时为 stopping
+	Current   string    `json:"current,omitempty"`
+	Queue     []string  `json:"queue"`  // 等待执行的任务，按执行顺序
+	Paused    bool      `json:"paused"` // 任务队列已暂停
+	LastCheck time.Time `json:"last_check,omitempty"`
+}
+
+// status 返回请求可以看到的当前状态，只能看到安全漫画的请求只显示 visibleJobs 中的任务
+func (d *daemon) status(r *http.Request) daemonStatus {
+	jobs := d.visibleJobs(r)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := daemonStatus{Status: "ok", Current: d.current, Queue: []string{}, Paused: jobs.Paused, LastCheck: d.lastCheck}
+	if safeView(r) {
+		s.Current = ""
+	}
+	for _, j := range jobs.Jobs {
+		switch j.State {
+		case jobQueued:
+			s.Queue = append(s.Queue, j.describe())
+		case jobRunning:
+			s.Current = j.describe()
+		}
+	}
+	if d.stopping {
+		s.Status = "stopping"
+	}
+	return s
+}
+
+// visibleJobs 请求可以看到的任务列表
+// 只能看到安全漫画的请求只列出对应漫画在漫画库中且分级安全的任务，还未下载过的漫画链接和章节链接不知道分级，不列出
+func (d *daemon) visibleJobs(r *http.Request) jobList {
+	jobs := d.jobs.list()
+	if !safeView(r) {
+		return jobs
+	}
+	db, err := loadLibrary()
+	if err != nil {
+		return jobList{Paused: jobs.Paused}
+	}
+	visible := jobList{Paused: jobs.Paused}
+	for _, j := range jobs.Jobs {
+		id := j.Target
+		if j.Kind != jobUpdate {
+			t, err := parseTarget(j.Target)
+			if err != nil || t.kind != targetSeries {
+				continue
+			}
+			id = t.id
+		}
+		if s := db.findSeries(id); s != nil && visibleSeries(r, s) {
+			visible.Jobs = append(visible.Jobs, j)
+		}
+	}
+	return visible
+}
+
+// daemonSeries 网页和 /api/series 中的一部漫画
+type daemonSeries struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Followed    bool      `json:"followed"`
+	Schedule    string    `json:"schedule,omitempty"`
+	Chapters    int       `json:"chapters"`
+	Unread      int       `json:"unread"`
+	LastChecked time.Time `json:"last_checked,omitempty"`
+	Updated     time.Time `json:"updated,omitempty"` // 最近一个章节的下载时间
+	Rating      string    `json:"rating,omitempty"`
+}
+
+// listSeries 读取漫画库中的所有漫画，按最近更新排序，safe 时只列出分级为全年龄或青少年的漫画
+func listSeries(safe bool) ([]daemonSeries, error) {
+	db, err := loadLibrary()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]daemonSeries, 0, len(db.Series))
+	for _, s := range db.Series {
+		if safe && !isSafeRating(s.Rating) {
+			continue
+		}
+		item := daemonSeries{ID: s.ID, Title: s.Title, Followed: s.Followed, Schedule: s.Schedule,
+			Chapters: len(s.Chapters), Unread: s.unreadCount(), LastChecked: s.LastChecked, Rating: s.Rating}
+		for _, c := range s.Chapters {
+			if c.DownloadedAt.After(item.Updated) {
+				item.Updated = c.DownloadedAt
+			}
+		}
+		list = append(list, item)
+	}
+	sort.SliceStable(list, func(i, j int) bool { return list[i].Updated.After(list[j].Updated) })
+	return list, nil
+}
+
+// seriesDir 返回漫画在漫画库中的目录
+func seriesDir(id string) (*seriesRecord, error) {
+	db, err := loadLibrary()
+	if err != nil {
+		return nil, err
+	}
+	s := db.findSeries(id)
+	if s == nil || s.Dir == "" {
+		return nil, fmt.Errorf("漫画库中没有漫画 %s", id)
+	}
+	return s, nil
+}
+
+// handler 服务的所有路由
+//
+//	/                 漫画库网页，可以提交下载链接
+//	/read/<ID>/       阅读器
+//	/opds             OPDS 目录，供阅读器 App 浏览和下载已打包的CBZ
+//	/opds/safe        只包含全年龄和青少年分级漫画的 OPDS 目录
+//	/files/<ID>/<文件> 漫画目录中的CBZ和缩略图
+//	/api/series       漫画列表（JSON），safe=1 时只列出安全的漫画
+//	/api/status       当前任务和队列（JSON）
+//	/api/jobs         GET 任务列表，POST url=<链接> [priority=high|normal|low] [window=01:00-07:00@1M] 加入下载队列
+//	/api/jobs/<ID>/<操作> POST 暂停（pause）、继续（resume）、取消（cancel）、置顶（top）、上移（up）、
+//	                  下移（down）一个任务，或修改优先级（priority，value=high|normal|low）
+//	/api/queue/pause  POST 暂停整个队列，当前任务完成后不再开始新任务；/api/queue/resume 恢复
+//	/api/download     同 POST /api/jobs
+//	/api/check        POST 立即检查所有订阅
+//	/healthz          健康检查，正在退出时返回 503
+//	/metrics          Prometheus 监控指标
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		list, err := listSeries(safeView(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data := struct {
+			Series  []daemonSeries
+			Status  daemonStatus
+			Jobs    jobList
+			Message string
+		}{list, d.status(r), d.visibleJobs(r), r.URL.Query().Get("msg")}
+		if err := daemonIndexTemplate.Execute(w, data); err != nil {
+			debugf("渲染漫画库页面失败: %v\n", err)
+		}
+	})
+	mux.HandleFunc("/read/", d.serveReader)
+	mux.HandleFunc("/files/", serveSeriesFile)
+	mux.HandleFunc("/opds", serveOPDSRoot)
+	mux.HandleFunc("/opds/", serveOPDSSeries)
+	mux.HandleFunc("/opds/safe", serveOPDSRoot)
+	mux.HandleFunc("/opds/safe/", serveOPDSSeries)
+	mux.HandleFunc("/api/series", func(w http.ResponseWriter, r *http.Request) {
+		list, err := listSeries(safeView(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+	mux.HandleFunc("/api/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, d.status(r))
+	})
+	mux.HandleFunc("/api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			writeJSON(w, http.StatusOK, d.visibleJobs(r))
+			return
+		}
+		d.serveAddJob(w, r)
+	})
+	mux.HandleFunc("/api/jobs/", d.serveJobAction)
+	mux.HandleFunc("/api/download", d.serveAddJob)
+	mux.HandleFunc("/api/queue/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "需要 POST", http.StatusMethodNotAllowed)
+			return
+		}
+		msg := ""
+		switch strings.TrimPrefix(r.URL.Path, "/api/queue/") {
+		case "pause":
+			d.jobs.setPaused(true)
+			msg = "任务队列已暂停，当前任务完成后不再开始新任务"
+		case "resume":
+			d.jobs.setPaused(false)
+			d.notify()
+			msg = "任务队列已恢复"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("form") != "" {
+			http.Redirect(w, r, "/?msg="+url.QueryEscape(msg), http.StatusSeeOther)
+			return
+		}
+		writeJSON(w, http.StatusOK, d.status(r))
+	})
+	mux.HandleFunc("/api/check", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "需要 POST", http.StatusMethodNotAllowed)
+			return
+		}
+		d.mu.Lock()
+		d.forced = true
+		d.mu.Unlock()
+		d.notify()
+		if r.FormValue("form") != "" {
+			http.Redirect(w, r, "/?msg="+url.QueryEscape("将立即检查所有订阅"), http.StatusSeeOther)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, d.status(r))
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status := d.status(r)
+		code := http.StatusOK
+		if status.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, status)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.writePrometheus(w)
+	})
+	return mux
+}
+
+// serveAddJob POST url=<链接> [priority=...] [window=...] 加入下载队列，网页表单提交（form=1）后回到首页
+func (d *daemon) serveAddJob(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "需要 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	target := strings.TrimSpace(r.FormValue("url"))
+	// window 可以指定多次，也可以在一个值中用逗号分隔
+	var windows []string
+	for _, value := range r.Form["window"] {
+		for _, w := range strings.Split(value, ",") {
+			if w = strings.TrimSpace(w); w != "" {
+				windows = append(windows, w)
+			}
+		}
+	}
+	j, err := d.enqueue(target, r.FormValue("priority"), windows)
+	if r.FormValue("form") != "" {
+		msg := "已加入下载队列: " + target
+		if err != nil {
+			msg = err.Error()
+		}
+		http.Redirect(w, r, "/?msg="+url.QueryEscape(msg), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusAccepted, j)
+}
+
+// serveJobAction POST /api/jobs/<ID>/<操作> 修改一个任务
+func (d *daemon) serveJobAction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "需要 POST", http.StatusMethodNotAllowed)
+		return
+	}
+	idText, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/jobs/"), "/")
+	id, err := strconv.Atoi(idText)
+	if err != nil || (safeView(r) && !jobInList(d.visibleJobs(r), id)) {
+		http.NotFound(w, r)
+		return
+	}
+	err = d.jobs.update(id, action, r.FormValue("value"))
+	if err == nil {
+		d.notify()
+	}
+	if r.FormValue("form") != "" {
+		msg := fmt.Sprintf("已更新任务 %d", id)
+		if err != nil {
+			msg = err.Error()
+		}
+		http.Redirect(w, r, "/?msg="+url.QueryEscape(msg), http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, d.visibleJobs(r))
+}
+
+// jobInList 任务列表中是否有该任务
+func jobInList(jobs jobList, id int) bool {
+	for _, j := range jobs.Jobs {
+		if j.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSON 输出 JSON 响应
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// serveReader 阅读器：/read/<ID>/ 之后的路径交给 read 命令的阅读器处理
+func (d *daemon) serveReader(w http.ResponseWriter, r *http.Request) {
+	id, _, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/read/"), "/")
+	if !found {
+		http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+		return
+	}
+	if s, err := seriesDir(id); err == nil && !visibleSeries(r, s) {
+		http.NotFound(w, r)
+		return
+	}
+	book, err := d.book(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.StripPrefix(book.prefix, book.handler()).ServeHTTP(w, r)
+}
+
+// book 返回漫画的阅读器，漫画目录的修改时间变化时重新打开
+func (d *daemon) book(id string) (*readerBook, error) {
+	s, err := seriesDir(id)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cached, ok := d.books[id]; ok {
+		if cached.modTime.Equal(info.ModTime()) {
+			return cached.book, nil
+		}
+		cached.book.close()
+		delete(d.books, id)
+	}
+	book, err := openReaderBook(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(book.chapters) == 0 {
+		book.close()
+		return nil, fmt.Errorf("漫画 %s 中没有图片", id)
+	}
+	book.title = s.Title
+	book.prefix = "/read/" + url.PathEscape(id)
+	d.books[id] = &daemonBook{book: book, modTime: info.ModTime()}
+	return book, nil
+}
+
+// serveSeriesFile 输出漫画目录中的CBZ或 .thumbs 中的缩略图，不允许访问其他文件
+func serveSeriesFile(w http.ResponseWriter, r *http.Request) {
+	id, name, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/files/"), "/")
+	s, err := seriesDir(id)
+	if err != nil || !visibleSeries(r, s) {
+		http.NotFound(w, r)
+		return
+	}
+	dir, file := filepath.Split(filepath.FromSlash(name))
+	dir = filepath.Clean(dir)
+	allowed := (dir == "." && strings.EqualFold(filepath.Ext(file), ".cbz")) ||
+		(dir == thumbDirName && strings.EqualFold(filepath.Ext(file), ".jpg"))
+	if !allowed || file == "" || strings.Contains(file, "..") {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, filepath.Join(s.Dir, dir, file))
+}
+
+// opdsFeed OPDS 1.2 目录（Atom）
+type opdsFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []opdsLink  `xml:"link"`
+	Entries []opdsEntry `xml:"entry"`
+}
+
+// opdsEntry 目录中的一项：导航目录中是一部漫画，下载目录中是一个CBZ
+type opdsEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Updated string     `xml:"updated"`
+	Content string     `xml:"content,omitempty"`
+	Links   []opdsLink `xml:"link"`
+}
+
+type opdsLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+const (
+	opdsNavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	opdsAcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+)
+
+// opdsRoot 请求所在的 OPDS 目录：/opds 或 /opds/safe
+func opdsRoot(r *http.Request) string {
+	if r.URL.Path == "/opds/safe" || strings.HasPrefix(r.URL.Path, "/opds/safe/") {
+		return "/opds/safe"
+	}
+	return "/opds"
+}
+
+// writeOPDS 输出 OPDS 目录
+func writeOPDS(w http.ResponseWriter, feed opdsFeed, kind string) {
+	feed.Xmlns = "http://www.w3.org/2005/Atom"
+	w.Header().Set("Content-Type", kind+";charset=utf-8")
+	w.Write([]byte(xml.Header))
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	enc.Encode(feed)
+}
+
+// serveOPDSRoot OPDS 根目录：每部漫画一项，指向该漫画的下载目录
+// 通过 /opds/safe 访问或用户设置了 safe_only 时只列出安全的漫画，链接都留在安全目录中
+func serveOPDSRoot(w http.ResponseWriter, r *http.Request) {
+	safe := safeView(r)
+	list, err := listSeries(safe)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	root, feedID, title := opdsRoot(r), "comicbox:library", "漫画库"
+	if safe {
+		feedID, title = "comicbox:library:safe", "漫画库（安全）"
+	}
+	feed := opdsFeed{ID: feedID, Title: title, Updated: time.Now().Format(time.RFC3339),
+		Links: []opdsLink{{Rel: "self", Href: root, Type: opdsNavigationType}, {Rel: "start", Href: root, Type: opdsNavigationType}}}
+	for _, s := range list {
+		feed.Entries = append(feed.Entries, opdsEntry{
+			ID:      "comicbox:series:" + s.ID,
+			Title:   s.Title,
+			Updated: s.Updated.Format(time.RFC3339),
+			Content: fmt.Sprintf("%d 个章节", s.Chapters),
+			Links:   []opdsLink{{Rel: "subsection", Href: root + "/" + url.PathEscape(s.ID), Type: opdsAcquisitionType}},
+		})
+	}
+	writeOPDS(w, feed, opdsNavigationType)
+}
+
+// serveOPDSSeries 一部漫画的下载目录：漫画目录中已打包的每个CBZ一项
+func serveOPDSSeries(w http.ResponseWriter, r *http.Request) {
+	root := opdsRoot(r)
+	id := strings.TrimPrefix(r.URL.Path, root+"/")
+	s, err := seriesDir(id)
+	if err != nil || !visibleSeries(r, s) {
+		http.NotFound(w, r)
+		return
+	}
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	files := "/files/" + url.PathEscape(id) + "/"
+	feed := opdsFeed{ID: "comicbox:series:" + id, Title: s.Title, Updated: time.Now().Format(time.RFC3339),
+		Links: []opdsLink{{Rel: "start", Href: root, Type: opdsNavigationType}, {Rel: "up", Href: root, Type: opdsNavigationType}}}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(name), ".cbz") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		e := opdsEntry{
+			ID:      "comicbox:cbz:" + id + ":" + stem,
+			Title:   chapterPrefixPattern.ReplaceAllString(stem, ""),
+			Updated: info.ModTime().Format(time.RFC3339),
+			Links:   []opdsLink{{Rel: "http://opds-spec.org/acquisition", Href: files + url.PathEscape(name), Type: "application/vnd.comicbook+zip"}},
+		}
+		if fileSize(filepath.Join(s.Dir, thumbDirName, stem+".jpg")) > 0 {
+			thumb := files + thumbDirName + "/" + url.PathEscape(stem+".jpg")
+			e.Links = append(e.Links,
+				opdsLink{Rel: "http://opds-spec.org/image", Href: thumb, Type: "image/jpeg"},
+				opdsLink{Rel: "http://opds-spec.org/image/thumbnail", Href: thumb, Type: "image/jpeg"})
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	writeOPDS(w, feed, opdsAcquisitionType)
+}
+
+// daemonIndexTemplate 漫画库网页
+var daemonIndexTemplate = template.Must(template.New("daemon").Funcs(template.FuncMap{
+	"jobState":         func(state string) string { return jobStateNames[state] },
+	"jobPriorityNames": func() []string { return []string{"high", "normal", "low"} },
+	"ratingLabel":      ratingLabel,
+}).Parse(`<!DOCTYPE html>
+<html lang="zh">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>漫画库</title>
+<style>
+body { margin: 0; padding: 16px; background: #111; color: #ddd; font-family: sans-serif; }
+a { color: #9cf; text-decoration: none; }
+form { display: inline-flex; gap: 8px; margin: 0 8px 8px 0; }
+td form { margin: 0 4px 0 0; }
+input { background: #222; color: #ddd; border: 1px solid #444; padding: 4px; }
+input[type=url] { width: 420px; max-width: 60vw; background: #222; color: #ddd; border: 1px solid #444; padding: 4px; }
+table { border-collapse: collapse; width: 100%; }
+td, th { padding: 6px 8px; border-bottom: 1px solid #333; text-align: left; }
+.msg { color: #fc6; }
+</style>
+</head>
+<body>
+<h1>漫画库</h1>
+{{if .Message}}<p class="msg">{{.Message}}</p>{{end}}
+<form method="post" action="/api/download"><input type="hidden" name="form" value="1">
+<input type="url" name="url" placeholder="章节或漫画链接" required>
+<input type="text" name="window" placeholder="时间段，如 01:00-07:00@1M" size="22">
+<select name="priority"><option value="">默认优先级</option><option value="high">高</option><option value="normal">普通</option><option value="low">低</option></select>
+<button>下载</button></form>
+<form method="post" action="/api/check"><input type="hidden" name="form" value="1"><button>立即检查订阅</button></form>
+{{if .Jobs.Paused}}<form method="post" action="/api/queue/resume"><input type="hidden" name="form" value="1"><button>恢复队列</button></form>
+{{else}}<form method="post" action="/api/queue/pause"><input type="hidden" name="form" value="1"><button>暂停队列</button></form>{{end}}
+<p>{{if .Status.Current}}正在进行: {{.Status.Current}}{{else}}空闲{{end}}{{if .Status.Queue}}，队列中还有 {{len .Status.Queue}} 个任务{{end}}{{if .Jobs.Paused}}（队列已暂停）{{end}}</p>
+{{if .Jobs.Jobs}}<h2>任务</h2>
+<table>
+<tr><th>#</th><th>任务</th><th>优先级</th><th>时间段</th><th>状态</th><th>操作</th></tr>
+{{range .Jobs.Jobs}}<tr><td>{{.ID}}</td><td>{{if eq .Kind "update"}}检查更新: {{.Title}}{{else}}{{.Target}}{{end}}</td><td>{{.Priority}}</td><td>{{range .Windows}}{{.}} {{end}}</td><td>{{jobState .State}}</td><td>
+{{if or (eq .State "queued") (eq .State "paused")}}{{$action := printf "/api/jobs/%d/" .ID}}
+{{if eq .State "queued"}}<form method="post" action="{{$action}}pause"><input type="hidden" name="form" value="1"><button>暂停</button></form>
+{{else}}<form method="post" action="{{$action}}resume"><input type="hidden" name="form" value="1"><button>继续</button></form>{{end}}
+<form method="post" action="{{$action}}top"><input type="hidden" name="form" value="1"><button>置顶</button></form>
+<form method="post" action="{{$action}}up"><input type="hidden" name="form" value="1"><button>↑</button></form>
+<form method="post" action="{{$action}}down"><input type="hidden" name="form" value="1"><button>↓</button></form>
+<form method="post" action="{{$action}}priority"><input type="hidden" name="form" value="1">
+<select name="value">{{$p := .Priority}}{{range $name := jobPriorityNames}}<option{{if eq $name $p}} selected{{end}}>{{$name}}</option>{{end}}</select><button>修改</button></form>
+<form method="post" action="{{$action}}cancel"><input type="hidden" name="form" value="1"><button>取消</button></form>
+{{end}}</td></tr>
+{{end}}</table>
+<h2>漫画</h2>{{end}}
+<table>
+<tr><th>漫画</th><th>分级</th><th>章节</th><th>未读</th><th>订阅</th><th>更新</th></tr>
+{{range .Series}}<tr><td><a href="/read/{{.ID}}/chapters">{{.Title}}</a></td><td>{{ratingLabel .Rating}}</td><td>{{.Chapters}}</td><td>{{.Unread}}</td>
+<td>{{if .Followed}}{{if .Schedule}}{{.Schedule}}{{else}}是{{end}}{{end}}</td><td>{{if not .Updated.IsZero}}{{.Updated.Format "2006-01-02 15:04"}}{{end}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
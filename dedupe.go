@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dedupeEnabled 下载后是否将内容相同的图片硬链接到同一份数据
+var dedupeEnabled = false
+
+// objectStoreDir 按内容哈希存放图片的目录
+func objectStoreDir() string {
+	return metadataPath("objects")
+}
+
+// dedupeFile 将文件与内容存储中相同内容的文件硬链接，返回是否复用了已有数据
+// 文件系统不支持硬链接时保持原文件不变
+func dedupeFile(path string) (bool, error) {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return false, err
+	}
+
+	objectPath := filepath.Join(objectStoreDir(), sum[:2], sum)
+	objectInfo, err := os.Stat(objectPath)
+	if os.IsNotExist(err) {
+		// 第一次出现的内容，加入内容存储
+		if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+			return false, err
+		}
+		if err := os.Link(path, objectPath); err != nil {
+			return false, nil
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	if os.SameFile(objectInfo, fileInfo) {
+		return false, nil
+	}
+
+	// 先创建临时链接再替换，避免中途失败丢失文件
+	tmpPath := path + ".link"
+	if err := os.Link(objectPath, tmpPath); err != nil {
+		return false, nil
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return false, err
+	}
+	return true, nil
+}
+
+// fileSHA256 计算文件内容的SHA-256
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// runDedupeCommand 对已下载的图片进行去重
+func runDedupeCommand(args []string) {
+	root := "."
+	if len(args) > 0 {
+		root = args[0]
+	}
+
+	linked := 0
+	var saved int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == metadataDir || d.Name() == thumbDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isImageFile(d.Name()) {
+			return nil
+		}
+
+		ok, err := dedupeFile(path)
+		if err != nil {
+			fmt.Printf("处理 %s 失败: %v\n", path, err)
+			return nil
+		}
+		if ok {
+			linked++
+			saved += fileSize(path)
+			debugf("已链接重复图片: %s\n", path)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("扫描目录失败: %v\n", err)
+		return
+	}
+
+	fmt.Printf("去重完成，%d 个重复图片已链接到同一份数据，节省 %s\n", linked, formatBytes(saved))
+}
+
+// isImageFile 根据扩展名判断是否为图片文件
+func isImageFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return true
+	}
+	return false
+}
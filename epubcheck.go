@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// validateEPUB 用 epubcheck 检查EPUB文件，有错误时返回 epubcheck 的输出；其他格式的文件不检查
+// 检查的是 ebook --epub 生成或 Calibre 等工具转换出的文件，Send-to-Kindle 会拒收无法通过检查的EPUB
+func validateEPUB(file string) error {
+	if !strings.EqualFold(filepath.Ext(file), ".epub") {
+		return nil
+	}
+	tool := findTool("epubcheck")
+	if tool == "" {
+		return fmt.Errorf("未找到 epubcheck 程序，请将其放在 PATH 中或与本程序相同的目录")
+	}
+	output, err := exec.CommandContext(runContext, tool, file).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("epubcheck 检查未通过: %v\n%s", err, strings.TrimSpace(string(output)))
+	}
+	verbosef("%s 通过 epubcheck 检查\n", file)
+	return nil
+}
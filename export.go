@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// catalogEntry 导出目录中的一部漫画
+type catalogEntry struct {
+	ID           string `json:"id"`
+	Title        string `json:"title"`
+	SourceURL    string `json:"source_url"`
+	Status       string `json:"status"`
+	Chapters     int    `json:"chapters"`
+	FirstChapter string `json:"first_chapter"`
+	LastChapter  string `json:"last_chapter"`
+	Unread       int    `json:"unread"`
+	Path         string `json:"path"`
+}
+
+// runExportCommand 导出漫画库目录
+func runExportCommand(args []string) {
+	format := "md"
+	output := ""
+	for i := 0; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "--format":
+			format = args[i+1]
+		case "--output", "-o":
+			output = args[i+1]
+		}
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			fmt.Printf("创建输出文件失败: %v\n", err)
+			return
+		}
+		defer file.Close()
+		w = file
+	}
+
+	entries := buildCatalog(db)
+	switch format {
+	case "md", "markdown":
+		err = writeCatalogMarkdown(w, entries)
+	case "csv":
+		err = writeCatalogCSV(w, entries)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(entries)
+	default:
+		fmt.Printf("不支持的导出格式: %s（可选 md、csv、json）\n", format)
+		return
+	}
+	if err != nil {
+		fmt.Printf("导出失败: %v\n", err)
+		return
+	}
+
+	if output != "" {
+		fmt.Printf("已导出 %d 部漫画到 %s\n", len(entries), output)
+	}
+}
+
+// buildCatalog 从漫画库生成导出条目
+func buildCatalog(db *libraryDB) []catalogEntry {
+	var entries []catalogEntry
+	for _, s := range db.Series {
+		entry := catalogEntry{
+			ID:        s.ID,
+			Title:     s.Title,
+			SourceURL: siteFor(s.BaseURL).seriesURL(s.BaseURL, s.ID),
+			Status:    "已下载",
+			Chapters:  len(s.Chapters),
+			Unread:    s.unreadCount(),
+			Path:      s.Dir,
+		}
+		if s.Followed {
+			entry.Status = "已订阅"
+		}
+		if abs, err := filepath.Abs(s.Dir); err == nil && s.Dir != "" {
+			entry.Path = abs
+		}
+		if len(s.Chapters) > 0 {
+			entry.FirstChapter = s.Chapters[0].Title
+			entry.LastChapter = s.Chapters[len(s.Chapters)-1].Title
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// writeCatalogMarkdown 以Markdown表格输出目录
+func writeCatalogMarkdown(w io.Writer, entries []catalogEntry) error {
+	fmt.Fprintln(w, "# 漫画库目录")
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "共 %d 部漫画\n\n", len(entries))
+	fmt.Fprintln(w, "| 漫画 | 状态 | 章节数 | 章节范围 | 未读 | 来源 | 路径 |")
+	fmt.Fprintln(w, "| --- | --- | ---: | --- | ---: | --- | --- |")
+	for _, e := range entries {
+		chapterRange := e.FirstChapter
+		if e.LastChapter != e.FirstChapter {
+			chapterRange += " ~ " + e.LastChapter
+		}
+		_, err := fmt.Fprintf(w, "| %s | %s | %d | %s | %d | %s | `%s` |\n",
+			markdownCell(e.Title), e.Status, e.Chapters, markdownCell(chapterRange), e.Unread, e.SourceURL, e.Path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownCell 转义表格单元格中的竖线
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
+
+// writeCatalogCSV 以CSV输出目录
+func writeCatalogCSV(w io.Writer, entries []catalogEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "title", "status", "chapters", "first_chapter", "last_chapter", "unread", "source_url", "path"})
+	for _, e := range entries {
+		cw.Write([]string{
+			e.ID, e.Title, e.Status, strconv.Itoa(e.Chapters), e.FirstChapter, e.LastChapter,
+			strconv.Itoa(e.Unread), e.SourceURL, e.Path,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
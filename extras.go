@@ -0,0 +1,111 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// chapterExtras 下载章节时同时记录页面上的更新日期和作者的话，由 --extras 或配置文件的 extras 开启
+var chapterExtras bool
+
+// maxNotesLength 作者的话最多保留的字数，过长的通常是误匹配了评论区或正文
+const maxNotesLength = 2000
+
+// publishedMetaSelectors 记录发布或更新时间的 meta 标签，按顺序尝试
+const publishedMetaSelectors = `meta[property="article:published_time"], meta[property="og:updated_time"], meta[property="article:modified_time"], meta[itemprop="datePublished"], meta[itemprop="dateModified"], meta[name="pubdate"]`
+
+// defaultNotesSelectors 常见的作者的话、章节备注所在的元素
+const defaultNotesSelectors = ".author-notes, .author-note, .author_note, .author-say, .author_say, .chapter-notes, .chapter-note, #author-notes, #author_note"
+
+// publishedTextPattern 页面文字中的更新日期，如“更新时间：2023-05-01”、“發布於 2023/5/1”、“上架日期：2023年5月1日”
+var publishedTextPattern = regexp.MustCompile(`(?:更新|發佈|发布|發布|上架|日期)[^0-9\n]{0,8}(\d{4})\s*[-/.年]\s*(\d{1,2})\s*[-/.月]\s*(\d{1,2})`)
+
+// publishedDatePattern 日期字符串开头的年月日
+var publishedDatePattern = regexp.MustCompile(`^(\d{4})\s*[-/.年]\s*(\d{1,2})\s*[-/.月]\s*(\d{1,2})`)
+
+// addChapterExtras 开启了 --extras 时从章节页面提取更新日期和作者的话，记入章节
+// published、notes 为规则文件中的选择器，为空时使用常见的 meta 标签、time 元素和类名
+func addChapterExtras(page *chapterPage, doc *goquery.Document, published, notes string) {
+	if !chapterExtras {
+		return
+	}
+	page.published, page.notes = extractChapterExtras(doc, published, notes)
+}
+
+// extractChapterExtras 提取章节页面上的更新日期（2006-01-02）和作者的话，没有时为空
+func extractChapterExtras(doc *goquery.Document, publishedSelector, notesSelector string) (string, string) {
+	var published string
+	if publishedSelector != "" {
+		sel := doc.Find(publishedSelector).First()
+		if value, ok := sel.Attr("datetime"); ok {
+			published = parsePublishedDate(value)
+		}
+		if published == "" {
+			published = parsePublishedDate(strings.TrimSpace(sel.Text()))
+		}
+	}
+	if published == "" {
+		doc.Find(publishedMetaSelectors).EachWithBreak(func(i int, sel *goquery.Selection) bool {
+			content, _ := sel.Attr("content")
+			published = parsePublishedDate(content)
+			return published == ""
+		})
+	}
+	if published == "" {
+		doc.Find("time[datetime]").EachWithBreak(func(i int, sel *goquery.Selection) bool {
+			value, _ := sel.Attr("datetime")
+			published = parsePublishedDate(value)
+			return published == ""
+		})
+	}
+	if published == "" {
+		if m := publishedTextPattern.FindStringSubmatch(doc.Find("body").Text()); m != nil {
+			published = formatPublishedDate(m[1], m[2], m[3])
+		}
+	}
+
+	if notesSelector == "" {
+		notesSelector = defaultNotesSelectors
+	}
+	return published, cleanNotes(doc.Find(notesSelector).First().Text())
+}
+
+// parsePublishedDate 解析页面上的日期，支持 RFC 3339 和“2023-05-01”“2023/5/1”“2023年5月1日”等写法
+func parsePublishedDate(value string) string {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.Format("2006-01-02")
+	}
+	if m := publishedDatePattern.FindStringSubmatch(value); m != nil {
+		return formatPublishedDate(m[1], m[2], m[3])
+	}
+	return ""
+}
+
+// formatPublishedDate 将年月日格式化为 2006-01-02，日期无效时返回空
+func formatPublishedDate(year, month, day string) string {
+	t, err := time.Parse("2006-1-2", year+"-"+month+"-"+day)
+	if err != nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
+// cleanNotes 去掉每行首尾的空白和空行，过长时截断
+func cleanNotes(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	notes := strings.Join(lines, "\n")
+	if utf8.RuneCountInString(notes) > maxNotesLength {
+		notes = string([]rune(notes)[:maxNotesLength]) + "…"
+	}
+	return notes
+}
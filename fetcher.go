@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Fetcher 获取网页和图片、接口内容的方式，所有站点的抓取都通过 siteFetcher 进行
+// 新的传输方式（如其他浏览器、远程抓取服务）实现该接口并加入 parseFetcher
+type Fetcher interface {
+	// GetDocument 获取并解析网页，doc.Url 为跟随重定向后的地址
+	GetDocument(ctx context.Context, pageURL string) (*goquery.Document, error)
+	// GetBytes 获取图片或接口的内容写入 w，返回写入的字节数；非200响应返回 *httpStatusError
+	GetBytes(ctx context.Context, r fetchRequest, w io.Writer) (int64, error)
+}
+
+// fetchRequest GetBytes 的请求
+type fetchRequest struct {
+	URL     string
+	Image   bool              // 图片请求：使用图片的请求头、超时时间，受带宽限制和下载时间段约束
+	Headers map[string]string // 附加的请求头，如接口的 Accept 和 Referer
+}
+
+// siteFetcher 当前使用的 Fetcher，由 --fetcher 或配置文件的 fetcher 设置
+var siteFetcher Fetcher = httpFetcher{}
+
+// httpFetcher 默认的方式：直接发送 HTTP 请求，模拟浏览器的请求头
+type httpFetcher struct{}
+
+// browserFetcher 用无界面浏览器打开网页，执行页面脚本后取渲染后的 DOM，用于内容由脚本生成的站点
+// 图片和接口仍直接请求
+type browserFetcher struct {
+	httpFetcher
+	browser string
+}
+
+// GetDocument 用浏览器渲染网页
+func (f browserFetcher) GetDocument(ctx context.Context, pageURL string) (*goquery.Document, error) {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	return renderPage(ctx, f.browser, u)
+}
+
+// fixtureFetcher 从目录中读取预先保存的网页和图片，不访问网络，用于测试和离线重现站点问题
+// 链接 https://host/path?query 对应 <目录>/host/path，有查询参数时文件名后加上 %3F 和转义后的参数，
+// 以 / 结尾的路径和对应目录的路径（如同时保存了 /comic/x 和 /comic/x/chapter/y）对应其中的 index.html；
+// 文件不存在时按 404 处理
+type fixtureFetcher struct {
+	dir string
+}
+
+// path 链接对应的文件路径
+func (f fixtureFetcher) path(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || strings.Contains(u.Host, "..") {
+		return "", fmt.Errorf("无效的URL: %s", rawURL)
+	}
+	name := u.Path
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+	if u.RawQuery != "" {
+		name += url.PathEscape("?" + u.RawQuery)
+	}
+	// 清理 .. 等路径，不读取目录之外的文件
+	return filepath.Join(f.dir, u.Host, filepath.FromSlash(filepath.Clean("/"+name))), nil
+}
+
+func (f fixtureFetcher) open(rawURL string) (*os.File, error) {
+	path, err := f.path(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "index.html")
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		debugf("没有 %s 对应的文件 %s\n", rawURL, path)
+		return nil, &httpStatusError{StatusCode: http.StatusNotFound}
+	}
+	return file, err
+}
+
+// GetDocument 读取链接对应的网页文件
+func (f fixtureFetcher) GetDocument(ctx context.Context, pageURL string) (*goquery.Document, error) {
+	file, err := f.open(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	doc, err := goquery.NewDocumentFromReader(file)
+	if err != nil {
+		return nil, err
+	}
+	doc.Url, _ = url.Parse(pageURL)
+	return doc, nil
+}
+
+// GetBytes 读取链接对应的文件
+func (f fixtureFetcher) GetBytes(ctx context.Context, r fetchRequest, w io.Writer) (int64, error) {
+	file, err := f.open(r.URL)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return io.Copy(w, file)
+}
+
+// parseFetcher 解析 --fetcher 的值: http（默认）、browser、fixture:<目录>
+func parseFetcher(value string) (Fetcher, error) {
+	switch {
+	case value == "http":
+		return httpFetcher{}, nil
+	case value == "browser":
+		browser := findBrowser()
+		if browser == "" {
+			return nil, fmt.Errorf("未找到 Chromium 或 Chrome（%s）", strings.Join(browserNames, "、"))
+		}
+		return browserFetcher{browser: browser}, nil
+	case strings.HasPrefix(value, "fixture:"):
+		dir := strings.TrimPrefix(value, "fixture:")
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("样本目录不存在: %s", dir)
+		}
+		return fixtureFetcher{dir: dir}, nil
+	}
+	return nil, fmt.Errorf("未知的抓取方式: %s（可用 http、browser、fixture:<目录>）", value)
+}
+
+// fetchBytes 通过 siteFetcher 获取全部内容，供需要整个响应的调用方使用
+func fetchBytes(ctx context.Context, r fetchRequest) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := siteFetcher.GetBytes(ctx, r, &buf)
+	return buf.Bytes(), err
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// useFixtures 让页面和图片请求读取 testdata/fixtures 中保存的文件，与 --fetcher fixture:<目录> 相同
+func useFixtures(t *testing.T) {
+	saved := siteFetcher
+	siteFetcher = fixtureFetcher{dir: filepath.Join("testdata", "fixtures")}
+	t.Cleanup(func() { siteFetcher = saved })
+}
+
+func TestFixturePath(t *testing.T) {
+	f := fixtureFetcher{dir: "fixtures"}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://18comic.vip/album/123456/", "fixtures/18comic.vip/album/123456/index.html"},
+		{"https://18comic.vip/photo/654321", "fixtures/18comic.vip/photo/654321"},
+		{"https://api.example.com/api/v3/comic/x?platform=3", "fixtures/api.example.com/api/v3/comic/x%3Fplatform=3"},
+		{"https://example.com/../../etc/passwd", "fixtures/example.com/etc/passwd"},
+	}
+	for _, tt := range tests {
+		got, err := f.path(tt.url)
+		if err != nil || got != filepath.FromSlash(tt.want) {
+			t.Errorf("path(%q) = %q, %v, want %q", tt.url, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// finalizePrune 完结的漫画生成最终电子书后删除章节的原始图片，由 --finalize-prune 或配置文件的 finalize_prune 开启
+var finalizePrune bool
+
+// completedMarkers 漫画页面上表示已完结的文字
+var completedMarkers = []string{"已完结", "已完結", "完结", "完結", "completed", "finished"}
+
+// ongoingMarkers 表示连载中的文字，与完结的文字同时出现时（如"连载中/已完结"的筛选项）不算完结
+var ongoingMarkers = []string{"连载中", "連載中", "未完结", "未完結", "ongoing"}
+
+// statusLabels 状态文字前可能没有分隔的标签，如"状态已完结"
+var statusLabels = []string{"连载状态", "連載狀態", "状态", "狀態", "status"}
+
+// detectCompleted 从漫画目录页面的连载状态中识别是否已完结，识别不出时当作连载中
+func detectCompleted(doc *goquery.Document) bool {
+	var texts []string
+	doc.Find("meta[property='og:novel:status'], meta[property='og:comic:status'], meta[name=status]").Each(func(i int, s *goquery.Selection) {
+		texts = append(texts, s.AttrOr("content", ""))
+	})
+	doc.Find(".status, .state, .book-status, .comic-status, [class*='serial']").Each(func(i int, s *goquery.Selection) {
+		texts = append(texts, s.Text())
+	})
+	for _, text := range texts {
+		if completedText(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// completedText 一段状态文字是否表示已完结
+// 按空白和标点分成词后整个词比较，不按包含关系匹配，否则"未完结"会因为包含"完结"被当作已完结
+func completedText(text string) bool {
+	tokens := statusTokens(text)
+	for _, token := range tokens {
+		if slices.Contains(ongoingMarkers, token) {
+			return false
+		}
+	}
+	for _, token := range tokens {
+		if slices.Contains(completedMarkers, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// statusTokens 将状态文字按空白和标点分成小写的词，去掉词前面的状态标签
+func statusTokens(text string) []string {
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	for i, token := range tokens {
+		for _, label := range statusLabels {
+			if rest := strings.TrimPrefix(token, label); rest != token && rest != "" {
+				tokens[i] = rest
+				break
+			}
+		}
+	}
+	return tokens
+}
+
+// seriesFullyDownloaded 目录中的章节是否都已完整下载，且没有未解锁的章节
+func seriesFullyDownloaded(s *seriesRecord, chapters []ChapterInfo) bool {
+	if len(chapters) == 0 || len(s.Locked) > 0 {
+		return false
+	}
+	counts := chapterNumberCounts(chapterTitles(chapters))
+	for _, chapter := range chapters {
+		if c := s.findDownloaded(chapter, counts); c == nil || c.Incomplete {
+			return false
+		}
+	}
+	return true
+}
+
+// needsFinalize 订阅的漫画已完结并全部下载，且从未生成过最终电子书或之后又下载了新章节
+func needsFinalize(s *seriesRecord, chapters []ChapterInfo) bool {
+	if !s.Followed || !s.Completed || !seriesFullyDownloaded(s, chapters) {
+		return false
+	}
+	if s.FinalizedAt.IsZero() {
+		return true
+	}
+	for _, c := range s.Chapters {
+		if c.DownloadedAt.After(s.FinalizedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// finalizeSeries 完结的漫画下载完所有章节后，校验章节、生成整部漫画的电子书并校验压缩包，
+// 按 --finalize-prune 删除原始图片，然后取消订阅，不再检查更新
+func finalizeSeries(db *libraryDB, s *seriesRecord, chapters []ChapterInfo) {
+	if !needsFinalize(s, chapters) {
+		return
+	}
+	fmt.Printf("\n漫画《%s》已完结且全部章节已下载，正在生成最终的电子书...\n", s.Title)
+	if err := finalizeArchive(s); err != nil {
+		fmt.Printf("生成最终的电子书失败，下次检查时重试: %v\n", err)
+		return
+	}
+	if finalizePrune {
+		if freed := pruneRawChapters(s, 0, false); freed > 0 {
+			fmt.Printf("已删除原始图片，释放 %s\n", formatBytes(freed))
+		}
+	}
+	s.Followed = false
+	s.FinalizedAt = time.Now()
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已取消订阅《%s》，如需继续检查更新可以再次 follow\n", s.Title)
+}
+
+// finalizeArchive 校验章节图片，用 ebook 工具生成整部漫画的CBZ并逐个读取其中的文件校验
+func finalizeArchive(s *seriesRecord) error {
+	for _, c := range s.Chapters {
+		if c.Pruned {
+			continue
+		}
+		dir := filepath.Join(s.Dir, c.Dir)
+		meta, err := loadChapterMeta(dir)
+		if err != nil {
+			return fmt.Errorf("读取 %s 的 %s 失败: %v", c.Title, chapterMetaFile, err)
+		}
+		if problems := verifyChapter(dir, meta); len(problems) > 0 {
+			return fmt.Errorf("章节 %s 有 %d 页校验失败，可以用 verify --repair 修复", c.Title, len(problems))
+		}
+	}
+
+	tool := findTool("ebook")
+	if tool == "" {
+		return fmt.Errorf("未找到 ebook 工具，请将其放在 PATH 中或与本程序相同的目录")
+	}
+	seriesDir := s.Dir
+	// 工具在设置了 COMICBOX_OUT 时按漫画库根目录解析相对路径，传入绝对路径
+	if abs, err := filepath.Abs(seriesDir); err == nil {
+		seriesDir = abs
+	}
+	if output, err := exec.CommandContext(runContext, tool, "--update", seriesDir).CombinedOutput(); err != nil {
+		return fmt.Errorf("%v\n%s", err, output)
+	}
+	archive := filepath.Clean(seriesDir) + ".cbz"
+	if err := verifyZip(archive); err != nil {
+		return fmt.Errorf("校验 %s 失败: %v", archive, err)
+	}
+	infof("已生成 %s，校验通过\n", archive)
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatusTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"状态：已完结", []string{"状态", "已完结"}},
+		{"状态已完结", []string{"已完结"}},
+		{"连载中/已完结", []string{"连载中", "已完结"}},
+		{" Status: Completed ", []string{"status", "completed"}},
+		{"状态", []string{"状态"}},
+		{"", []string{}},
+	}
+	for _, tt := range tests {
+		if got := statusTokens(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("statusTokens(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCompletedText(t *testing.T) {
+	tests := []struct {
+		text string
+		want bool
+	}{
+		{"已完结", true},
+		{"已完結", true},
+		{"状态：已完结", true},
+		{"连载状态已完結", true},
+		{"Status: Completed", true},
+		{"未完结", false},
+		{"未完結", false},
+		{"连载中", false},
+		{"状态：连载中", false},
+		{"连载中/已完结", false},
+		{"已完结 | 连载中", false},
+		{"完结篇即将到来", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := completedText(tt.text); got != tt.want {
+			t.Errorf("completedText(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+}
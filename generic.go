@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// genericSite 未适配站点的通用提取：按图片特征打分，猜测章节页面中的漫画图片
+// 只支持单个章节页面，章节ID为链接中的路径和查询参数
+type genericSite struct{}
+
+// assumeYes 通用提取时不询问，直接下载猜测出的图片
+var assumeYes bool
+
+// genericMinScore 图片被当作漫画页面的最低得分
+const genericMinScore = 3
+
+var (
+	genericDigitsPattern = regexp.MustCompile(`\d+`)
+	genericSizePattern   = regexp.MustCompile(`(?i)(\d{3,4})x(\d{3,4})`)
+)
+
+// genericLazyAttrs 懒加载图片常用的属性，按优先级排列
+var genericLazyAttrs = []string{"data-original", "data-src", "data-lazy-src", "data-url", "data-echo"}
+
+// genericContainerWords 漫画阅读区域常用的 class/id 关键词
+var genericContainerWords = []string{"reader", "comic", "manga", "chapter", "viewer", "page", "content", "scroll", "gallery"}
+
+// genericJunkWords 图标、广告、头像等非漫画图片的链接关键词
+var genericJunkWords = []string{"logo", "icon", "avatar", "banner", "ads", "advert", "emoji", "sprite", "thumb", "loading", "blank", "qrcode"}
+
+func (genericSite) name() string { return "generic" }
+
+// matchHost 通用提取只用于无法被其他站点识别的链接，不按域名匹配
+func (genericSite) matchHost(host string) bool { return false }
+
+func (genericSite) parsePath(u *url.URL) (targetKind, string, bool) {
+	// 只接受带域名和路径的完整链接，避免把拼错的参数当作链接
+	id := strings.TrimPrefix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		id += "?" + u.RawQuery
+	}
+	if id == "" || !strings.Contains(u.Host, ".") {
+		return 0, "", false
+	}
+	return targetChapter, id, true
+}
+
+func (genericSite) seriesURL(baseURL, seriesID string) string {
+	return baseURL + "/" + seriesID
+}
+
+func (genericSite) fetchSeries(ctx context.Context, baseURL, seriesID string) (*seriesPage, error) {
+	return nil, fmt.Errorf("未适配的站点只支持下载单个章节页面")
+}
+
+func (genericSite) fetchChapter(ctx context.Context, baseURL, chapterID string) (*chapterPage, error) {
+	pageURL := baseURL + "/" + chapterID
+	doc, err := fetchPageWithRetry(ctx, pageURL, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	fallback, _ := url.Parse(pageURL)
+	base := documentBase(doc, fallback)
+	images, strategy := guessPageImages(doc, base), "guess"
+	if len(images) == 0 {
+		images, strategy = backgroundImageUrls(doc, base, queryDropTracking), "background-css"
+	}
+	if reason := detectLocked(doc, images, ""); reason != "" {
+		return nil, lockedError(reason)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("未能猜测出漫画图片，该站点可能需要专门适配")
+	}
+	if !confirmGuessedImages(images) {
+		return nil, fmt.Errorf("已取消下载")
+	}
+
+	title := extractChapterTitle(doc)
+	if title == "" {
+		title = sanitizeFileName(path.Base(base.Path))
+	}
+	page := &chapterPage{title: title, url: pageURL, images: images, strategy: strategy}
+	addChapterExtras(page, doc, "", "")
+	checkPageCount(page, doc, base)
+	return page, nil
+}
+
+// imageCandidate 页面中的一张图片及其得分
+type imageCandidate struct {
+	url   string
+	score int
+}
+
+// guessPageImages 按分辨率、懒加载属性、所在容器和连续编号为页面中的图片打分，
+// 按页面顺序返回得分达标的图片链接
+func guessPageImages(doc *goquery.Document, base *url.URL) []string {
+	var candidates []*imageCandidate
+	seen := make(map[string]bool)
+
+	doc.Find("img").Each(func(i int, sel *goquery.Selection) {
+		score := 0
+		src := ""
+		for _, attr := range genericLazyAttrs {
+			if v, ok := sel.Attr(attr); ok && strings.TrimSpace(v) != "" {
+				src = v
+				score += 2
+				break
+			}
+		}
+		if src == "" {
+			src, _ = sel.Attr("src")
+		}
+		if best := largestSrcset(sel); best != "" {
+			src = best
+		}
+		// 通用提取不了解站点的 CDN，只去掉跟踪参数
+		abs, ok := resolveImageURL(base, src, queryDropTracking)
+		if !ok || seen[abs] {
+			return
+		}
+		seen[abs] = true
+
+		score += scoreImageHints(sel, abs)
+		candidates = append(candidates, &imageCandidate{url: abs, score: score})
+	})
+
+	// 漫画页面通常按连续编号命名，同一模板下的图片越多越可能是漫画页面
+	groups := make(map[string][]*imageCandidate)
+	for _, c := range candidates {
+		key := genericDigitsPattern.ReplaceAllString(c.url, "#")
+		groups[key] = append(groups[key], c)
+	}
+	for _, group := range groups {
+		if len(group) < 3 {
+			continue
+		}
+		bonus := 2
+		if isSequential(group) {
+			bonus = 4
+		}
+		for _, c := range group {
+			c.score += bonus
+		}
+	}
+
+	var urls []string
+	for _, c := range candidates {
+		debugf("图片得分 %d: %s\n", c.score, c.url)
+		if c.score >= genericMinScore {
+			urls = append(urls, c.url)
+		}
+	}
+	return urls
+}
+
+// scoreImageHints 根据尺寸、扩展名、链接关键词和所在容器为单张图片打分
+func scoreImageHints(sel *goquery.Selection, imgURL string) int {
+	score := 0
+	lower := strings.ToLower(imgURL)
+
+	width, _ := strconv.Atoi(strings.TrimSuffix(sel.AttrOr("width", ""), "px"))
+	height, _ := strconv.Atoi(strings.TrimSuffix(sel.AttrOr("height", ""), "px"))
+	if m := genericSizePattern.FindStringSubmatch(lower); m != nil && width == 0 {
+		width, _ = strconv.Atoi(m[1])
+		height, _ = strconv.Atoi(m[2])
+	}
+	switch {
+	case width >= 600 || height >= 800:
+		score += 2
+	case (width > 0 && width < 200) || (height > 0 && height < 200):
+		score -= 3
+	}
+
+	switch strings.ToLower(path.Ext(strings.SplitN(lower, "?", 2)[0])) {
+	case ".jpg", ".jpeg", ".png", ".webp":
+		score++
+	case ".gif", ".svg", ".ico":
+		score -= 2
+	}
+
+	for _, word := range genericJunkWords {
+		if strings.Contains(lower, word) {
+			score -= 3
+			break
+		}
+	}
+
+	// 只看最近的几层容器，避免 body 上的 class 让所有图片都加分
+	parents := sel.Parents()
+	for i := 0; i < parents.Length() && i < 4; i++ {
+		node := parents.Eq(i)
+		attrs := strings.ToLower(node.AttrOr("class", "") + " " + node.AttrOr("id", ""))
+		matched := false
+		for _, word := range genericContainerWords {
+			if strings.Contains(attrs, word) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			score += 2
+			break
+		}
+	}
+	return score
+}
+
+// isSequential 检查同一模板下的图片编号是否基本连续
+func isSequential(group []*imageCandidate) bool {
+	var numbers []int
+	for _, c := range group {
+		all := genericDigitsPattern.FindAllString(c.url, -1)
+		if len(all) == 0 {
+			return false
+		}
+		n, err := strconv.Atoi(all[len(all)-1])
+		if err != nil {
+			return false
+		}
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	gaps := 0
+	for i := 1; i < len(numbers); i++ {
+		if numbers[i]-numbers[i-1] != 1 {
+			gaps++
+		}
+	}
+	return gaps*4 <= len(numbers)
+}
+
+// confirmGuessedImages 交互模式下列出猜测结果并请用户确认，非交互模式或指定 --yes 时直接通过
+func confirmGuessedImages(images []string) bool {
+	fmt.Printf("该站点未适配，按图片特征猜测出 %d 张漫画图片:\n", len(images))
+	for i, img := range images {
+		if i >= 3 && i < len(images)-2 {
+			if i == 3 {
+				fmt.Printf("  ...（省略 %d 张）\n", len(images)-5)
+			}
+			continue
+		}
+		fmt.Printf("  [%d] %s\n", i+1, img)
+	}
+
+	if assumeYes || !isInteractive() {
+		return true
+	}
+	fmt.Print("是否下载这些图片? [Y/n] ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "" || answer == "y" || answer == "yes"
+}
+
+// isInteractive 检查标准输入是否为终端
+func isInteractive() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -2,10 +2,10 @@ module comicbox
 
 go 1.25.3
 
-require github.com/PuerkitoBio/goquery v1.11.0
-
 require (
-	github.com/andybalholm/brotli v1.2.0 // indirect
-	github.com/andybalholm/cascadia v1.3.3 // indirect
-	golang.org/x/net v0.47.0 // indirect
+	github.com/PuerkitoBio/goquery v1.11.0
+	github.com/andybalholm/brotli v1.2.0
+	golang.org/x/net v0.47.0
 )
+
+require github.com/andybalholm/cascadia v1.3.3 // indirect
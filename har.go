@@ -0,0 +1,386 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// harBodyLimit 每个请求和响应最多记录的内容长度，超出部分截断（图片通常只需要开头确认格式）
+const harBodyLimit = 64 << 10
+
+// harRedacted 记录时隐藏值的请求头和响应头，HAR 文件通常要附到问题报告中
+var harRedacted = map[string]bool{"Cookie": true, "Set-Cookie": true, "Authorization": true, "Proxy-Authorization": true}
+
+// harRecorder 调试时记录所有页面、接口和图片请求的请求头、响应头、耗时和截断的内容，
+// 运行结束时写入 HAR 文件，可以在浏览器开发者工具的网络面板中导入查看
+type harRecorder struct {
+	mu      sync.Mutex
+	path    string
+	entries []*harEntry
+}
+
+// har 当前的 HAR 记录器，为nil时不记录，由 --har 设置（需要同时指定 --debug）
+var har *harRecorder
+
+type harLog struct {
+	Log struct {
+		Version string      `json:"version"`
+		Creator harCreator  `json:"creator"`
+		Entries []*harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harNameVal struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	ServerIPAddress string      `json:"serverIPAddress,omitempty"`
+	Comment         string      `json:"comment,omitempty"`
+
+	started time.Time
+}
+
+type harRequest struct {
+	Method      string       `json:"method"`
+	URL         string       `json:"url"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNameVal `json:"cookies"`
+	Headers     []harNameVal `json:"headers"`
+	QueryString []harNameVal `json:"queryString"`
+	PostData    *harPostData `json:"postData,omitempty"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harResponse struct {
+	Status      int          `json:"status"`
+	StatusText  string       `json:"statusText"`
+	HTTPVersion string       `json:"httpVersion"`
+	Cookies     []harNameVal `json:"cookies"`
+	Headers     []harNameVal `json:"headers"`
+	Content     harContent   `json:"content"`
+	RedirectURL string       `json:"redirectURL"`
+	HeadersSize int          `json:"headersSize"`
+	BodySize    int64        `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// harTimings 各阶段的耗时（毫秒），没有经过的阶段（如复用连接时的 DNS 和连接）为 -1
+type harTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// openHar 创建 HAR 记录器，文件在运行结束时写入
+func openHar(path string) *harRecorder {
+	return &harRecorder{path: path}
+}
+
+// RoundTrip 发送请求并记录，响应体在调用方读取时记录开头的部分，读完或关闭时这一条记录才完整
+func (h *harRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	entry := &harEntry{started: time.Now(), Request: harRequestOf(req)}
+	entry.StartedDateTime = entry.started.Format(time.RFC3339Nano)
+	trace := &harTrace{start: entry.started}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace.clientTrace()))
+
+	var next http.RoundTripper = meteredTransport
+	if warc != nil {
+		next = warc
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		trace.mu.Lock()
+		entry.Timings = trace.timings(time.Now(), time.Now())
+		entry.ServerIPAddress = trace.remoteIP
+		trace.mu.Unlock()
+		entry.Time = msSince(entry.started, time.Now())
+		entry.Response = harResponse{Cookies: []harNameVal{}, Headers: []harNameVal{}, HeadersSize: -1, BodySize: -1}
+		entry.Comment = err.Error()
+		h.add(entry)
+		return nil, err
+	}
+
+	entry.Response = harResponse{
+		Status:      resp.StatusCode,
+		StatusText:  strings.TrimSpace(strings.TrimPrefix(resp.Status, fmt.Sprint(resp.StatusCode))),
+		HTTPVersion: resp.Proto,
+		Cookies:     []harNameVal{},
+		Headers:     harHeaders(resp.Header),
+		Content:     harContent{MimeType: resp.Header.Get("Content-Type")},
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+	}
+	resp.Body = &harBody{body: resp.Body, entry: entry, trace: trace, headersAt: time.Now(), recorder: h,
+		encoding: resp.Header.Get("Content-Encoding")}
+	h.add(entry)
+	return resp, nil
+}
+
+func (h *harRecorder) add(entry *harEntry) {
+	h.mu.Lock()
+	h.entries = append(h.entries, entry)
+	h.mu.Unlock()
+}
+
+// harRequestOf 记录请求头、查询参数和请求体的开头部分
+func harRequestOf(req *http.Request) harRequest {
+	r := harRequest{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		HTTPVersion: "HTTP/1.1",
+		Cookies:     []harNameVal{},
+		Headers:     harHeaders(req.Header),
+		QueryString: []harNameVal{},
+		HeadersSize: -1,
+		BodySize:    req.ContentLength,
+	}
+	for key, values := range req.URL.Query() {
+		for _, value := range values {
+			r.QueryString = append(r.QueryString, harNameVal{Name: key, Value: value})
+		}
+	}
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(body, harBodyLimit))
+			body.Close()
+			r.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(data)}
+		}
+	}
+	return r
+}
+
+// harHeaders 按名称排序的请求头或响应头，隐藏 Cookie 等敏感的值
+func harHeaders(header http.Header) []harNameVal {
+	list := []harNameVal{}
+	for key, values := range header {
+		for _, value := range values {
+			if harRedacted[key] {
+				value = "(已隐藏)"
+			}
+			list = append(list, harNameVal{Name: key, Value: value})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// harBody 包装响应体，记录开头的内容和读取完成的时间
+type harBody struct {
+	body      io.ReadCloser
+	entry     *harEntry
+	trace     *harTrace
+	headersAt time.Time
+	recorder  *harRecorder
+	encoding  string // 响应的 Content-Encoding，记录时解压开头的部分
+	head      []byte
+	size      int64
+	once      sync.Once
+}
+
+func (b *harBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.size += int64(n)
+	if room := harBodyLimit - len(b.head); room > 0 {
+		b.head = append(b.head, p[:min(n, room)]...)
+	}
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *harBody) Close() error {
+	b.finish()
+	return b.body.Close()
+}
+
+// finish 补全这一条记录的耗时和内容，响应体读完或关闭时调用一次
+func (b *harBody) finish() {
+	b.once.Do(func() {
+		now := time.Now()
+		b.recorder.mu.Lock()
+		defer b.recorder.mu.Unlock()
+		e := b.entry
+		b.trace.mu.Lock()
+		e.Timings = b.trace.timings(b.headersAt, now)
+		e.ServerIPAddress = b.trace.remoteIP
+		b.trace.mu.Unlock()
+		e.Time = msSince(e.started, now)
+		e.Response.BodySize = b.size
+		e.Response.Content.Size = b.size
+		head := harDecode(b.head, b.encoding)
+		if isTextContent(e.Response.Content.MimeType) {
+			e.Response.Content.Text = strings.ToValidUTF8(string(head), "")
+		} else if len(head) > 0 {
+			e.Response.Content.Text = base64.StdEncoding.EncodeToString(head)
+			e.Response.Content.Encoding = "base64"
+		}
+		if b.size > int64(len(b.head)) {
+			e.Response.Content.Comment = fmt.Sprintf("只记录了前 %d 字节", len(b.head))
+		}
+	})
+}
+
+// harDecode 解压压缩过的响应内容的开头部分，内容被截断时尽量解压出前面的部分，无法解压时原样返回
+func harDecode(head []byte, encoding string) []byte {
+	var r io.Reader
+	switch strings.ToLower(encoding) {
+	case "gzip":
+		zr, err := gzip.NewReader(bytes.NewReader(head))
+		if err != nil {
+			return head
+		}
+		r = zr
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(head))
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(head))
+	default:
+		return head
+	}
+	decoded, _ := io.ReadAll(io.LimitReader(r, harBodyLimit))
+	if len(decoded) == 0 {
+		return head
+	}
+	return decoded
+}
+
+// isTextContent 是否按文本记录响应内容
+func isTextContent(mimeType string) bool {
+	return strings.HasPrefix(mimeType, "text/") || strings.Contains(mimeType, "json") ||
+		strings.Contains(mimeType, "javascript") || strings.Contains(mimeType, "xml")
+}
+
+// harTrace 通过 httptrace 记录连接各阶段的时间
+type harTrace struct {
+	mu                     sync.Mutex
+	start                  time.Time
+	dnsStart, dnsDone      time.Time
+	connectStart, connDone time.Time
+	tlsStart, tlsDone      time.Time
+	gotConn, wroteRequest  time.Time
+	remoteIP               string
+}
+
+func (t *harTrace) clientTrace() *httptrace.ClientTrace {
+	mark := func(field *time.Time) {
+		t.mu.Lock()
+		*field = time.Now()
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { mark(&t.dnsStart) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { mark(&t.dnsDone) },
+		ConnectStart:      func(string, string) { mark(&t.connectStart) },
+		ConnectDone:       func(string, string, error) { mark(&t.connDone) },
+		TLSHandshakeStart: func() { mark(&t.tlsStart) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { mark(&t.tlsDone) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.gotConn = time.Now()
+			if info.Conn != nil {
+				t.remoteIP = info.Conn.RemoteAddr().String()
+			}
+			t.mu.Unlock()
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { mark(&t.wroteRequest) },
+	}
+}
+
+// timings 按 HAR 的规则计算各阶段耗时，headersAt 为收到响应头的时间，done 为读完响应体的时间
+func (t *harTrace) timings(headersAt, done time.Time) harTimings {
+	span := func(from, to time.Time) float64 {
+		if from.IsZero() || to.IsZero() {
+			return -1
+		}
+		return msSince(from, to)
+	}
+	timings := harTimings{
+		DNS:     span(t.dnsStart, t.dnsDone),
+		Connect: span(t.connectStart, t.connDone),
+		SSL:     span(t.tlsStart, t.tlsDone),
+		Send:    max(span(t.gotConn, t.wroteRequest), 0),
+		Wait:    max(span(t.wroteRequest, headersAt), 0),
+		Receive: max(span(headersAt, done), 0),
+	}
+	// HAR 中 connect 包括 TLS 握手
+	if timings.Connect >= 0 && timings.SSL >= 0 {
+		timings.Connect += timings.SSL
+	}
+	// 从开始到建立连接之前（等待空闲连接、DNS 之前）的时间
+	first := t.gotConn
+	for _, at := range []time.Time{t.dnsStart, t.connectStart} {
+		if !at.IsZero() && (first.IsZero() || at.Before(first)) {
+			first = at
+		}
+	}
+	timings.Blocked = max(span(t.start, first), 0)
+	return timings
+}
+
+// msSince from 到 to 的毫秒数
+func msSince(from, to time.Time) float64 {
+	return float64(to.Sub(from).Microseconds()) / 1000
+}
+
+// close 按开始时间排序后写入 HAR 文件
+func (h *harRecorder) close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var doc harLog
+	doc.Log.Version = "1.2"
+	doc.Log.Creator = harCreator{Name: "comicbox", Version: "1"}
+	doc.Log.Entries = h.entries
+	sort.SliceStable(doc.Log.Entries, func(i, j int) bool {
+		return doc.Log.Entries[i].started.Before(doc.Log.Entries[j].started)
+	})
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(h.path, data)
+}
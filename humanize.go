@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// browsingSimulation 模拟浏览器阅读时的图片请求顺序和节奏，避免被按请求模式识别为爬虫
+// 只改变请求的顺序和时间，文件仍按页码命名
+type browsingSimulation struct {
+	enabled bool
+	window  int           // 在多少张图片的窗口内打乱顺序
+	minGap  time.Duration // 相邻图片请求之间的最短间隔
+	maxGap  time.Duration // 相邻图片请求之间的最长间隔
+	refetch float64       // 每次请求图片前重新请求章节页面的概率
+
+	mu       sync.Mutex
+	lastPage string // 最近一次请求的页面，用于模拟刷新
+}
+
+// browseSim 图片下载共用的浏览模拟设置
+var browseSim = &browsingSimulation{
+	window:  4,
+	minGap:  300 * time.Millisecond,
+	maxGap:  1500 * time.Millisecond,
+	refetch: 0.03,
+}
+
+// order 返回图片的请求顺序：每个窗口内随机打乱，整体仍从前往后，与浏览器懒加载相似
+func (b *browsingSimulation) order(n int) []int {
+	indexes := make([]int, n)
+	for i := range indexes {
+		indexes[i] = i
+	}
+	if !b.enabled || b.window < 2 {
+		return indexes
+	}
+	for start := 0; start < n; start += b.window {
+		end := start + b.window
+		if end > n {
+			end = n
+		}
+		part := indexes[start:end]
+		rand.Shuffle(len(part), func(i, j int) { part[i], part[j] = part[j], part[i] })
+	}
+	return indexes
+}
+
+// notePage 记录最近请求的页面
+func (b *browsingSimulation) notePage(url string) {
+	if !b.enabled {
+		return
+	}
+	b.mu.Lock()
+	b.lastPage = url
+	b.mu.Unlock()
+}
+
+// beforeImage 在请求图片前随机等待，偶尔重新请求章节页面
+func (b *browsingSimulation) beforeImage(ctx context.Context) {
+	if !b.enabled {
+		return
+	}
+
+	if rand.Float64() < b.refetch {
+		b.mu.Lock()
+		page := b.lastPage
+		b.mu.Unlock()
+		if page != "" {
+			debugf("模拟刷新页面: %s\n", page)
+			if _, err := fetchPage(ctx, page); err != nil {
+				debugf("刷新页面失败: %v\n", err)
+			}
+		}
+	}
+
+	gap := b.minGap
+	if b.maxGap > b.minGap {
+		gap += time.Duration(rand.Int63n(int64(b.maxGap - b.minGap)))
+	}
+	sleepContext(ctx, gap)
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageFilterSettings 丢弃图标、横幅等非漫画页面图片的条件，全部为零时不过滤
+type imageFilterSettings struct {
+	MinBytes  int64   `json:"min_bytes"`  // 最小字节数，按 HEAD 请求的 Content-Length 判断
+	MinWidth  int     `json:"min_width"`  // 最小宽度（像素）
+	MinHeight int     `json:"min_height"` // 最小高度（像素）
+	MinAspect float64 `json:"min_aspect"` // 高宽比下限，如 0.5
+	MaxAspect float64 `json:"max_aspect"` // 高宽比上限，如 4，长条漫可以设得更大
+}
+
+// imageFilters 当前的图片过滤条件，由 --min-bytes、--min-size、--aspect 或配置文件设置
+var imageFilters imageFilterSettings
+
+// imageProbeBytes 读取图片尺寸时请求的字节数，图片头部通常在最前面
+const imageProbeBytes = 64 * 1024
+
+// enabled 是否设置了任何过滤条件
+func (f imageFilterSettings) enabled() bool {
+	return f.MinBytes > 0 || f.needsDimensions()
+}
+
+// needsDimensions 是否需要读取图片尺寸
+func (f imageFilterSettings) needsDimensions() bool {
+	return f.MinWidth > 0 || f.MinHeight > 0 || f.MinAspect > 0 || f.MaxAspect > 0
+}
+
+// filterChapterImages 在编号之前按过滤条件丢弃章节中的非漫画页面图片
+// 无法获取大小或尺寸的图片保留，避免因网络问题误删漫画页面
+func filterChapterImages(ctx context.Context, page *chapterPage) {
+	if !imageFilters.enabled() || len(page.images) == 0 {
+		return
+	}
+
+	keep := make([]bool, len(page.images))
+	reasons := make([]string, len(page.images))
+	workers := imageWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				reasons[i] = imageFilters.check(ctx, page.images[i])
+				keep[i] = reasons[i] == ""
+			}
+		}()
+	}
+	for i := range page.images {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var kept []string
+	for i, img := range page.images {
+		if keep[i] {
+			kept = append(kept, img)
+			continue
+		}
+		verbosef("丢弃图片 %s: %s\n", img, reasons[i])
+	}
+	if len(kept) == 0 {
+		fmt.Println("警告: 所有图片都不符合过滤条件，忽略过滤条件")
+		return
+	}
+	if dropped := len(page.images) - len(kept); dropped > 0 {
+		infof("按过滤条件丢弃了 %d 张非漫画页面的图片\n", dropped)
+	}
+	page.images = kept
+}
+
+// check 检查一张图片，符合条件时返回空字符串，否则返回丢弃的原因
+func (f imageFilterSettings) check(ctx context.Context, imgURL string) string {
+	if f.MinBytes > 0 {
+		if size, ok := probeImageSize(ctx, imgURL); ok && size < f.MinBytes {
+			return fmt.Sprintf("大小 %s 小于 %s", formatBytes(size), formatBytes(f.MinBytes))
+		}
+	}
+	if !f.needsDimensions() {
+		return ""
+	}
+
+	width, height, ok := probeImageDimensions(ctx, imgURL)
+	if !ok || width == 0 || height == 0 {
+		return ""
+	}
+	if width < f.MinWidth || height < f.MinHeight {
+		return fmt.Sprintf("尺寸 %dx%d 小于 %dx%d", width, height, f.MinWidth, f.MinHeight)
+	}
+	aspect := float64(height) / float64(width)
+	if (f.MinAspect > 0 && aspect < f.MinAspect) || (f.MaxAspect > 0 && aspect > f.MaxAspect) {
+		return fmt.Sprintf("高宽比 %.2f 超出范围", aspect)
+	}
+	return ""
+}
+
+// newImageProbe 创建探测图片的请求，请求头与下载图片时相同
+// 探测依赖响应头和状态码，直接发送 HTTP 请求；使用 fixture 时不访问网络，探测结果均为未知
+func newImageProbe(ctx context.Context, method, imgURL string) (*http.Request, error) {
+	if _, ok := siteFetcher.(fixtureFetcher); ok {
+		return nil, errors.New("fixture 模式下不探测图片")
+	}
+	req, err := http.NewRequestWithContext(ctx, method, imgURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", siteBreaker.userAgent())
+	req.Header.Set("Accept", "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8")
+	req.Header.Set("Referer", contextBaseURL(ctx)+"/")
+	setExtraHeaders(req)
+	return req, nil
+}
+
+// probeImageSize 用 HEAD 请求获取图片大小，服务器未返回 Content-Length 时 ok 为false
+func probeImageSize(ctx context.Context, imgURL string) (int64, bool) {
+	if err := politeMode.check(ctx, imgURL); err != nil {
+		return 0, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	req, err := newImageProbe(ctx, "HEAD", imgURL)
+	if err != nil {
+		return 0, false
+	}
+	resp, err := (&http.Client{Transport: pageTransport(), CheckRedirect: checkRedirect}).Do(req)
+	if err != nil {
+		return 0, false
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.ContentLength < 0 {
+		return 0, false
+	}
+	return resp.ContentLength, true
+}
+
+// probeImageDimensions 只请求图片开头的部分内容，从图片头部读取宽高
+func probeImageDimensions(ctx context.Context, imgURL string) (int, int, bool) {
+	if err := politeMode.check(ctx, imgURL); err != nil {
+		return 0, 0, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := newImageProbe(ctx, "GET", imgURL)
+	if err != nil {
+		return 0, 0, false
+	}
+	req.Header.Set("Range", "bytes=0-"+strconv.Itoa(imageProbeBytes-1))
+	resp, err := (&http.Client{Transport: pageTransport(), CheckRedirect: checkRedirect}).Do(req)
+	if err != nil {
+		return 0, 0, false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 && resp.StatusCode != 206 {
+		return 0, 0, false
+	}
+	// 服务器不支持 Range 时也只读取开头部分
+	head, err := io.ReadAll(io.LimitReader(resp.Body, imageProbeBytes))
+	if err != nil && len(head) == 0 {
+		return 0, 0, false
+	}
+	return imageDimensions(head)
+}
+
+// imageDimensions 从图片开头的数据中读取宽高，支持 JPEG、PNG、GIF 和 WebP
+func imageDimensions(head []byte) (int, int, bool) {
+	if w, h, ok := webpDimensions(head); ok {
+		return w, h, true
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(head))
+	if err != nil {
+		return 0, 0, false
+	}
+	return cfg.Width, cfg.Height, true
+}
+
+// webpDimensions 解析 WebP 文件头中的宽高（VP8、VP8L 和 VP8X 三种格式）
+func webpDimensions(b []byte) (int, int, bool) {
+	if len(b) < 30 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	switch string(b[12:16]) {
+	case "VP8 ":
+		// 关键帧起始码之后是 14 位的宽和高
+		w := int(binary.LittleEndian.Uint16(b[26:28]) & 0x3fff)
+		h := int(binary.LittleEndian.Uint16(b[28:30]) & 0x3fff)
+		return w, h, true
+	case "VP8L":
+		bits := binary.LittleEndian.Uint32(b[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+	case "VP8X":
+		w := int(b[24]) | int(b[25])<<8 | int(b[26])<<16
+		h := int(b[27]) | int(b[28])<<8 | int(b[29])<<16
+		return w + 1, h + 1, true
+	}
+	return 0, 0, false
+}
+
+// parseByteSize 解析字节数，支持 K、M、G 后缀，如 20K
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(s), "B"))
+	unit := int64(1)
+	switch {
+	case strings.HasSuffix(s, "K"):
+		unit, s = 1024, strings.TrimSuffix(s, "K")
+	case strings.HasSuffix(s, "M"):
+		unit, s = 1024*1024, strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "G"):
+		unit, s = 1024*1024*1024, strings.TrimSuffix(s, "G")
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的大小: %s", s)
+	}
+	return n * unit, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// imageMemoryLimit 同时解码的图片最多占用的内存（字节），由 --image-memory 或配置文件设置，0 为不限制
+// 标准库只能把整张图片解码到内存中，20000 像素高的长条漫一张就要几十到上百 MB，
+// 多个 worker 同时处理时在内存较小的设备上容易耗尽内存
+var imageMemoryLimit int64 = 1 << 30
+
+// imageMemory 所有 worker 共用的解码内存预算
+var imageMemory = &memoryBudget{}
+
+// memoryBudget 按预估的解码内存限制同时处理的图片，超出预算时等待其他图片处理完成
+type memoryBudget struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	used int64
+}
+
+// acquire 预留 n 字节，没有其他图片在处理时总是立即返回，避免单张接近上限的图片一直等待
+func (b *memoryBudget) acquire(n int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cond == nil {
+		b.cond = sync.NewCond(&b.mu)
+	}
+	for b.used > 0 && b.used+n > imageMemoryLimit {
+		b.cond.Wait()
+	}
+	b.used += n
+}
+
+// release 释放预留的 n 字节
+func (b *memoryBudget) release(n int64) {
+	b.mu.Lock()
+	b.used -= n
+	if b.cond != nil {
+		b.cond.Broadcast()
+	}
+	b.mu.Unlock()
+}
+
+// decodedImageBytes 只读取图片头部，按每像素 4 字节预估解码后占用的内存
+func decodedImageBytes(file string) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	head, err := io.ReadAll(io.LimitReader(f, imageProbeBytes))
+	if err != nil {
+		return 0, err
+	}
+	width, height, ok := imageDimensions(head)
+	if !ok {
+		return 0, fmt.Errorf("无法读取图片尺寸")
+	}
+	return int64(width) * int64(height) * 4, nil
+}
+
+// reserveImageMemory 解码图片之前预留内存，返回释放预留的函数
+// 单张图片就超过上限时返回错误，调用方应保留原图而不是解码
+func reserveImageMemory(file string) (func(), error) {
+	if imageMemoryLimit <= 0 {
+		return func() {}, nil
+	}
+	need, err := decodedImageBytes(file)
+	if err != nil {
+		// 无法预估时按未知处理，由解码器自己报告错误
+		return func() {}, nil
+	}
+	if need > imageMemoryLimit {
+		return nil, fmt.Errorf("解码约需 %s 内存，超过上限 %s（可用 --image-memory 调整，或安装 vips 处理大图）",
+			formatBytes(need), formatBytes(imageMemoryLimit))
+	}
+	imageMemory.acquire(need)
+	return func() { imageMemory.release(need) }, nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+)
+
+// imageWorkers 同时下载图片的数量
+var imageWorkers = 1
+
+// imageSlots 不为nil时同时下载的多个章节共用的图片下载名额，总数为 imageWorkers
+var imageSlots chan struct{}
+
+// parallelChapters 同时下载多个章节（check --download）时为 true，不显示单个章节的进度
+var parallelChapters bool
+
+// chapterResult 章节图片的下载结果
+type chapterResult struct {
+	saved  int
+	failed int
+	bytes  int64
+	files  []string         // 每页保存的文件路径，下载失败的页为空
+	parts  map[int][]string // 后处理拆分出的附加部分，按页码索引
+	errs   map[int]error    // 下载失败的页的错误，按页码索引
+}
+
+// downloadChapterImages 下载章节的所有图片到指定目录，文件按页码编号
+// page 不为nil时，优先复制页面保存在本地的图片而不是重新下载；fixup 不为nil时在下载后处理图片
+// 目录中的 chapter.json 记录了链接相同且校验和一致的图片时直接沿用，中断后再次下载只补齐缺少的页
+func downloadChapterImages(ctx context.Context, imageUrls []string, dirName string, page *localPage, fixup imageFixup) chapterResult {
+	workers := imageWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	result := chapterResult{files: make([]string, len(imageUrls)), parts: make(map[int][]string), errs: make(map[int]error)}
+	var mu sync.Mutex
+
+	var pending []int
+	done := completedPages(dirName, imageUrls)
+	for _, j := range browseSim.order(len(imageUrls)) {
+		if p, ok := done[j]; ok {
+			result.saved++
+			result.bytes += p.Size
+			result.files[j] = filepath.Join(dirName, p.File)
+			for _, part := range p.Parts {
+				result.parts[j] = append(result.parts[j], filepath.Join(dirName, part))
+			}
+			continue
+		}
+		pending = append(pending, j)
+	}
+	if len(done) > 0 {
+		infof("已有 %d 张图片下载完成，继续下载其余 %d 张\n", len(done), len(pending))
+	}
+	runStats.startChapter(len(pending))
+	startChapterProgress(dirName, pending)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if imageSlots != nil {
+					imageSlots <- struct{}{}
+				}
+				pageStarted(j)
+				files, size, err := saveChapterImage(ctx, imageUrls[j], dirName, j, len(imageUrls), page, fixup)
+				if imageSlots != nil {
+					<-imageSlots
+				}
+				mu.Lock()
+				if err != nil {
+					result.failed++
+					result.errs[j] = err
+				} else {
+					result.saved++
+					result.bytes += size
+					result.files[j] = files[0]
+					if len(files) > 1 {
+						result.parts[j] = files[1:]
+					}
+				}
+				mu.Unlock()
+				runStats.imageDone(size, err == nil)
+				pageFinished(j, size, err == nil)
+				if err == nil {
+					runPlugins(pluginEvent{Event: pluginPageDownloaded, Dir: dirName, Page: j + 1, Total: len(imageUrls), URL: imageUrls[j], Files: files})
+				}
+			}
+		}()
+	}
+
+	// 按模拟浏览的顺序请求图片，未开启时按页码顺序
+	for n, j := range pending {
+		if ctx.Err() != nil {
+			// 中断后不再开始新的图片，未下载的页计为失败，下次运行时继续
+			mu.Lock()
+			result.failed += len(pending) - n
+			mu.Unlock()
+			break
+		}
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+	endChapterProgress()
+
+	runStats.finishChapter(result)
+	return result
+}
+
+// saveChapterImage 保存章节中的第 index 张图片（从0开始），返回保存的文件路径和总大小
+// 后处理拆分出多张图片时第一个文件为该页，其余为附加部分
+func saveChapterImage(ctx context.Context, imgUrl, dirName string, index, total int, page *localPage, fixup imageFixup) ([]string, int64, error) {
+	// 按命名规则编号，默认为 0001.jpg, 0002.jpg 等
+	filename := pageNames.pageFilename(dirName, index, imgUrl)
+
+	var files []string
+	if data, ok := page.imageData(imgUrl); ok {
+		err := writeFileAtomic(filename, data)
+		if err != nil {
+			pageErrorf(index, "复制本地图片 %d 失败: %v\n", index+1, err)
+			return nil, 0, err
+		}
+		filename = pageNames.fixExtension(filename)
+		pageInfof(index, "已复制本地图片 %d/%d: %s\n", index+1, total, filename)
+		files = postProcessPage(filename, index)
+	} else {
+		// 同一链接在本次运行中已下载过（如各章节共用的横幅）时复制已保存的文件
+		saved, shared, err := sharedImages.do(imgUrl, func() ([]string, error) {
+			return fetchChapterImage(ctx, imgUrl, filename, index, total, fixup)
+		})
+		if shared {
+			// 已保存的文件就是这一页时说明需要重新下载（如修复损坏的页）
+			if saved[0] == filename {
+				err = errors.New("需要重新下载")
+			} else {
+				saved, err = copySharedPage(saved, filename)
+			}
+			if err != nil {
+				debugf("复用已下载的图片失败，重新下载: %v\n", err)
+				sharedImages.forget(imgUrl)
+				saved, err = fetchChapterImage(ctx, imgUrl, filename, index, total, fixup)
+			} else {
+				pageInfof(index, "图片 %d/%d 与已下载的图片链接相同，已复制: %s\n", index+1, total, saved[0])
+			}
+		}
+		if err != nil {
+			pageErrorf(index, "下载图片 %d 失败: %v\n", index+1, err)
+			return nil, 0, err
+		}
+		files = saved
+	}
+
+	var size int64
+	for _, file := range files {
+		if dedupeEnabled {
+			if _, err := dedupeFile(file); err != nil {
+				debugf("图片去重失败: %v\n", err)
+			}
+		}
+		size += fileSize(file)
+	}
+	return files, size, nil
+}
+
+// copySharedPage 将同一链接已保存的图片（及拆分出的部分）复制为这一页，已经过后处理，不再重复处理
+func copySharedPage(saved []string, filename string) ([]string, error) {
+	if err := copyFile(saved[0], filename); err != nil {
+		return nil, err
+	}
+	filename = pageNames.fixExtension(filename)
+	files := []string{filename}
+	for i, part := range saved[1:] {
+		name := pagePartName(filename, i+2)
+		if err := copyFile(part, name); err != nil {
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+// fetchChapterImage 下载第 index 张图片（从0开始）并处理，返回按内容修正扩展名并经过后处理的文件
+func fetchChapterImage(ctx context.Context, imgUrl, filename string, index, total int, fixup imageFixup) ([]string, error) {
+	browseSim.beforeImage(ctx)
+	if err := downloadImageWithRetry(ctx, imgUrl, filename, 3); err != nil {
+		return nil, err
+	}
+	if fixup != nil {
+		if err := fixup(index, imgUrl, filename); err != nil {
+			pageErrorf(index, "处理图片 %d 失败: %v\n", index+1, err)
+		}
+	}
+	filename = pageNames.fixExtension(filename)
+	pageInfof(index, "已下载图片 %d/%d: %s\n", index+1, total, filename)
+	return postProcessPage(filename, index), nil
+}
+
+// postProcessPage 对一页执行 --post 指定的后处理，失败时保留原图
+func postProcessPage(filename string, index int) []string {
+	if !postSteps.enabled() {
+		return []string{filename}
+	}
+	files, err := postSteps.apply(filename)
+	if err != nil {
+		pageErrorf(index, "后处理图片 %d 失败: %v\n", index+1, err)
+	}
+	return files
+}
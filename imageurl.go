@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// queryPolicy 图片链接中查询参数的处理方式，不同站点的 CDN 要求不同
+type queryPolicy int
+
+const (
+	queryKeep         queryPolicy = iota // 原样保留，签名、过期时间等令牌缺少时 CDN 会拒绝请求
+	queryStrip                           // 全部去掉，用于带上缩放、裁剪等参数时返回缩略图或报错的 CDN
+	queryDropTracking                    // 只去掉 utm_ 等跟踪参数
+)
+
+// trackingParams 跟踪参数，与图片内容无关，会使同一张图片出现多个链接；另外所有 utm_ 开头的参数也是跟踪参数
+var trackingParams = map[string]bool{"spm": true, "fbclid": true, "gclid": true}
+
+// parseQueryPolicy 解析规则文件中的 image_query: keep、strip 或 tracking
+func parseQueryPolicy(s string) (queryPolicy, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "keep":
+		return queryKeep, nil
+	case "strip":
+		return queryStrip, nil
+	case "tracking":
+		return queryDropTracking, nil
+	}
+	return queryKeep, fmt.Errorf("无效的查询参数处理方式: %s（可选 keep、strip、tracking）", s)
+}
+
+// documentBase 返回页面中相对链接的基准地址：页面的实际地址（跟随重定向后），
+// 页面中有 <base href> 时以它为准；本地文件等没有地址的页面使用 fallback
+func documentBase(doc *goquery.Document, fallback *url.URL) *url.URL {
+	base := fallback
+	if doc.Url != nil {
+		base = doc.Url
+	}
+	href, ok := doc.Find("base[href]").First().Attr("href")
+	if !ok || strings.TrimSpace(href) == "" {
+		return base
+	}
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return base
+	}
+	if base == nil {
+		return ref
+	}
+	return base.ResolveReference(ref)
+}
+
+// localPageBase 本地页面（没有页面地址和 <base> 标签）的基准地址标记：./、../ 等相对路径原样保留，
+// 由 localPage.imageData 在页面所在目录中查找；/ 开头的路径按站点地址解析
+var localPageBase = &url.URL{Scheme: "local"}
+
+// siteBase siteBaseURL 对应的基准地址，用于没有页面地址的本地文件
+func siteBase() *url.URL {
+	u, err := url.Parse(siteBaseURL + "/")
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// resolveImageURL 将页面中的图片链接解析为绝对地址，支持 //、/、./、../ 等相对形式，
+// 去掉 # 之后的部分并按 policy 处理查询参数；不是 http(s) 图片链接时 ok 为false
+func resolveImageURL(base *url.URL, src string, policy queryPolicy) (string, bool) {
+	src = strings.TrimSpace(src)
+	if src == "" || strings.HasPrefix(src, "data:") || strings.HasPrefix(src, "javascript:") {
+		return "", false
+	}
+	ref, err := url.Parse(src)
+	if err != nil {
+		return "", false
+	}
+	if base == localPageBase {
+		if ref.Scheme == "" && ref.Host == "" && !strings.HasPrefix(ref.Path, "/") {
+			ref.Fragment = ""
+			return ref.String(), true
+		}
+		base = siteBase()
+	}
+	if base != nil {
+		ref = base.ResolveReference(ref)
+	} else if strings.HasPrefix(src, "//") {
+		ref.Scheme = "https"
+	}
+	if (ref.Scheme != "http" && ref.Scheme != "https") || ref.Host == "" {
+		return "", false
+	}
+
+	ref.Fragment = ""
+	switch policy {
+	case queryStrip:
+		ref.RawQuery = ""
+	case queryDropTracking:
+		ref.RawQuery = dropTrackingParams(ref.RawQuery)
+	}
+	return ref.String(), true
+}
+
+// dropTrackingParams 去掉查询参数中的跟踪参数，其余参数保持原有顺序和编码
+func dropTrackingParams(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var kept []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		key = strings.ToLower(key)
+		if pair != "" && !trackingParams[key] && !strings.HasPrefix(key, "utm_") {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// srcsetAttrs 响应式图片的候选列表属性，懒加载的 data-srcset 优先
+var srcsetAttrs = []string{"data-srcset", "srcset"}
+
+// largestSrcset 返回图片 srcset/data-srcset 中分辨率最高的链接，没有时返回空字符串
+func largestSrcset(sel *goquery.Selection) string {
+	for _, attr := range srcsetAttrs {
+		if v, ok := sel.Attr(attr); ok {
+			if best := parseSrcset(v); best != "" {
+				return best
+			}
+		}
+	}
+	return ""
+}
+
+// parseSrcset 解析 srcset 属性，如 "a.jpg 480w, b.jpg 1080w" 或 "a.jpg 1x, b.jpg 2x"，
+// 返回宽度（w）最大的链接，没有宽度描述时返回像素密度（x）最大的链接
+func parseSrcset(srcset string) string {
+	bestURL, bestWidth, bestDensity := "", 0.0, 0.0
+	for _, candidate := range splitSrcset(srcset) {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "data:") {
+			continue
+		}
+		width, density := 0.0, 1.0
+		if len(fields) > 1 {
+			desc := strings.ToLower(fields[1])
+			value, err := strconv.ParseFloat(desc[:len(desc)-1], 64)
+			if err != nil {
+				continue
+			}
+			switch desc[len(desc)-1] {
+			case 'w':
+				width = value
+			case 'x':
+				density = value
+			default:
+				continue
+			}
+		}
+		if width > bestWidth || (bestWidth == 0 && width == 0 && density > bestDensity) {
+			bestURL, bestWidth, bestDensity = fields[0], width, density
+		}
+	}
+	return bestURL
+}
+
+// splitSrcset 按逗号拆分 srcset 的候选项，链接中的逗号（后面没有空白）不拆分
+func splitSrcset(srcset string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(srcset); i++ {
+		if srcset[i] != ',' {
+			continue
+		}
+		if i+1 < len(srcset) && srcset[i+1] != ' ' && srcset[i+1] != '\t' && srcset[i+1] != '\n' {
+			// 逗号后没有空白时，前面已有描述（如 "a.jpg 2x,b.jpg 3x"）才是分隔符，否则是链接的一部分
+			if strings.ContainsAny(strings.TrimSpace(srcset[start:i]), " \t\n") {
+				parts = append(parts, srcset[start:i])
+				start = i + 1
+			}
+			continue
+		}
+		parts = append(parts, srcset[start:i])
+		start = i + 1
+	}
+	return append(parts, srcset[start:])
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// candidateURLPattern 匹配文本中的链接，只包含链接中允许的 ASCII 字符，紧跟在链接后的中文不会被当作路径
+var candidateURLPattern = regexp.MustCompile(`https?://[A-Za-z0-9\-._~:/?#\[\]@!$&()*+,;=%]+`)
+
+// clipboardPollInterval 剪贴板轮询间隔
+const clipboardPollInterval = time.Second
+
+// runDownloadCommand 处理 download 子命令
+func runDownloadCommand(args []string) {
+	var targets []string
+	watchClipboard := false
+	readStdin := false
+
+	for i := 0; i < len(args); i++ {
+		n, err := parseGlobalFlag(args, i)
+		if err != nil {
+			fmt.Printf("参数错误: %v\n", err)
+			return
+		}
+		if n > 0 {
+			i += n - 1
+			continue
+		}
+
+		switch args[i] {
+		case "--debug":
+			// 已在 main 中处理
+		case "--clipboard":
+			watchClipboard = true
+		case "-":
+			readStdin = true
+		default:
+			targets = append(targets, args[i])
+		}
+	}
+
+	if readStdin {
+		lines, err := readTargets(os.Stdin)
+		if err != nil {
+			fmt.Printf("读取标准输入失败: %v\n", err)
+			return
+		}
+		targets = append(targets, lines...)
+	}
+
+	if watchClipboard {
+		// 先处理已给出的链接，再开始监视剪贴板
+		queue := make(chan string, 100)
+		for _, target := range targets {
+			queue <- target
+		}
+		go watchClipboardURLs(queue)
+		for target := range queue {
+			if runContext.Err() != nil {
+				return
+			}
+			downloadTarget(target)
+			fmt.Println("\n继续监视剪贴板，按 Ctrl+C 退出...")
+		}
+		return
+	}
+
+	if len(targets) == 0 {
+		fmt.Println("没有需要下载的链接")
+		return
+	}
+
+	fmt.Printf("共 %d 个下载任务\n", len(targets))
+	for i, target := range targets {
+		if runContext.Err() != nil {
+			fmt.Printf("已中断，剩余 %d 个任务未下载\n", len(targets)-i)
+			return
+		}
+		fmt.Printf("\n===== 任务 [%d/%d]: %s =====\n", i+1, len(targets), target)
+		downloadTarget(target)
+	}
+}
+
+// readTargets 读取每行一个的链接列表，忽略空行和 # 开头的注释
+func readTargets(r io.Reader) ([]string, error) {
+	var targets []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	return targets, scanner.Err()
+}
+
+// downloadTarget 根据链接类型下载单个章节或整个漫画
+func downloadTarget(input string) {
+	t, err := parseTarget(input)
+	if err != nil {
+		fmt.Printf("跳过无法识别的链接: %v\n", err)
+		return
+	}
+	siteBaseURL = t.baseURL
+
+	if t.kind == targetSeries {
+		downloadSeries(runContext, t.id, "")
+		return
+	}
+	downloadChapter(t.id, false)
+}
+
+// watchClipboardURLs 轮询剪贴板，将新出现的漫画链接加入下载队列
+func watchClipboardURLs(queue chan<- string) {
+	fmt.Println("正在监视剪贴板，复制章节或漫画链接即可自动加入下载队列，按 Ctrl+C 退出...")
+
+	seen := make(map[string]bool)
+	warned := false
+	for {
+		text, err := readClipboard()
+		if err != nil {
+			if !warned {
+				fmt.Printf("读取剪贴板失败: %v\n", err)
+				warned = true
+			}
+		} else {
+			for _, link := range comicLinks(text) {
+				if seen[link] {
+					continue
+				}
+				seen[link] = true
+				fmt.Printf("已加入下载队列: %s\n", link)
+				queue <- link
+			}
+		}
+		if sleepContext(runContext, clipboardPollInterval) != nil {
+			close(queue)
+			return
+		}
+	}
+}
+
+// comicLinks 提取文本中的漫画链接：先找出所有链接，再保留能被站点适配器（包括自定义规则）识别为章节或漫画目录的，
+// 如 /book/418、/album/123、/comic/xxx；通用提取能接受任何链接，不参与判断，避免把复制的普通网页加入下载队列
+func comicLinks(text string) []string {
+	var links []string
+	for _, link := range candidateURLPattern.FindAllString(text, -1) {
+		link = strings.TrimRight(link, ".,;:!?)]")
+		u, err := url.Parse(link)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		for _, site := range siteAdapters {
+			if _, ok := site.(genericSite); ok {
+				continue
+			}
+			if _, _, ok := site.parsePath(u); ok {
+				links = append(links, link)
+				break
+			}
+		}
+	}
+	return links
+}
+
+// readClipboard 调用系统命令读取剪贴板文本
+func readClipboard() (string, error) {
+	var candidates [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbpaste"}}
+	case "windows":
+		candidates = [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}}
+	default:
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			candidates = append(candidates, []string{"wl-paste", "--no-newline"})
+		}
+		candidates = append(candidates,
+			[]string{"xclip", "-selection", "clipboard", "-o"},
+			[]string{"xsel", "--clipboard", "--output"})
+	}
+
+	var lastErr error
+	for _, cmd := range candidates {
+		if _, err := exec.LookPath(cmd[0]); err != nil {
+			lastErr = err
+			continue
+		}
+		out, err := exec.Command(cmd[0], cmd[1:]...).Output()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return string(out), nil
+	}
+
+	return "", fmt.Errorf("没有可用的剪贴板工具: %v", lastErr)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestComicLinks(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"https://www.92hm.life/book/418", []string{"https://www.92hm.life/book/418"}},
+		{"看这个 https://www.92hm.life/chapter/1234，很好看", []string{"https://www.92hm.life/chapter/1234"}},
+		{"https://18comic.vip/album/12345/title 和 https://18comic.vip/photo/67890/", []string{
+			"https://18comic.vip/album/12345/title", "https://18comic.vip/photo/67890/",
+		}},
+		{"(https://www.mangacopy.com/comic/yiquanchaoren/chapter/abc-123).", []string{
+			"https://www.mangacopy.com/comic/yiquanchaoren/chapter/abc-123",
+		}},
+		{"https://www.mangacopy.com/comic/yiquanchaoren第二季", []string{"https://www.mangacopy.com/comic/yiquanchaoren"}},
+		{"https://example.com/news/2024 https://18comic.vip/album/abc", nil},
+		{"没有链接", nil},
+	}
+	for _, tt := range tests {
+		if got := comicLinks(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("comicLinks(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
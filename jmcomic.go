@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// jmSite 18comic（禁漫天堂）及其镜像站，漫画为 /album/<ID>，章节为 /photo/<ID>
+// 较新的章节图片被横向切成若干条并倒序排列，下载后需要还原
+type jmSite struct{}
+
+// jmDefaultScrambleID 页面中没有 scramble_id 时使用的默认值，小于该值的章节图片未被打乱
+const jmDefaultScrambleID = 220980
+
+var (
+	jmScrambleIDPattern = regexp.MustCompile(`var\s+scramble_id\s*=\s*(\d+)`)
+	jmAidPattern        = regexp.MustCompile(`var\s+aid\s*=\s*(\d+)`)
+	jmSpacePattern      = regexp.MustCompile(`\s+`)
+)
+
+func (jmSite) name() string { return "18comic" }
+
+func (jmSite) matchHost(host string) bool {
+	return strings.Contains(host, "18comic") || strings.Contains(host, "jmcomic")
+}
+
+func (jmSite) parsePath(u *url.URL) (targetKind, string, bool) {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		if !isNumeric(segments[i+1]) {
+			continue
+		}
+		switch segments[i] {
+		case "photo":
+			return targetChapter, segments[i+1], true
+		case "album":
+			return targetSeries, segments[i+1], true
+		}
+	}
+	return 0, "", false
+}
+
+func (jmSite) seriesURL(baseURL, seriesID string) string {
+	return baseURL + "/album/" + seriesID + "/"
+}
+
+func (s jmSite) fetchSeries(ctx context.Context, baseURL, seriesID string) (*seriesPage, error) {
+	doc, err := fetchPageWithRetry(ctx, s.seriesURL(baseURL, seriesID), 3)
+	if err != nil {
+		return nil, err
+	}
+
+	title := sanitizeFileName(strings.TrimSpace(doc.Find("h1#book-name").First().Text()))
+	if title == "" {
+		title = extractComicTitle(doc)
+	}
+
+	// 多章节的漫画在 .episode 中列出章节，单章节的漫画本身就是唯一的章节
+	var chapters []ChapterInfo
+	seen := make(map[string]bool)
+	doc.Find(".episode a[href*='/photo/']").Each(func(i int, sel *goquery.Selection) {
+		href, _ := sel.Attr("href")
+		link, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		_, id, ok := s.parsePath(link)
+		if !ok || seen[id] {
+			return
+		}
+		seen[id] = true
+
+		// 去掉章节列表中的发布日期
+		sel.Find(".hidden-xs").Remove()
+		chapterTitle := strings.TrimSpace(jmSpacePattern.ReplaceAllString(sel.Text(), " "))
+		if chapterTitle == "" {
+			chapterTitle = "Chapter " + id
+		}
+		chapters = append(chapters, ChapterInfo{id: id, title: chapterTitle})
+	})
+	if len(chapters) == 0 {
+		chapters = []ChapterInfo{{id: seriesID, title: title}}
+	}
+
+	return &seriesPage{title: title, chapters: chapters, rating: detectRating(doc), completed: detectCompleted(doc)}, nil
+}
+
+func (jmSite) fetchChapter(ctx context.Context, baseURL, chapterID string) (*chapterPage, error) {
+	pageURL := baseURL + "/photo/" + chapterID
+	doc, err := fetchPageWithRetry(ctx, pageURL, 3)
+	if err != nil {
+		return nil, err
+	}
+	fallback, _ := url.Parse(pageURL)
+	base := documentBase(doc, fallback)
+
+	var images []string
+	doc.Find(".scramble-page img").Each(func(i int, sel *goquery.Selection) {
+		src, ok := sel.Attr("data-original")
+		if !ok || strings.TrimSpace(src) == "" {
+			src, _ = sel.Attr("src")
+		}
+		if strings.Contains(src, "blank.jpg") {
+			return
+		}
+		if src, ok = resolveImageURL(base, src, queryKeep); ok {
+			images = append(images, src)
+		}
+	})
+	if reason := detectLocked(doc, images, ""); reason != "" {
+		return nil, lockedError(reason)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("未找到任何图片链接")
+	}
+
+	// 打乱方式由页面脚本中的 scramble_id 和章节ID（aid）决定
+	html, _ := doc.Html()
+	scrambleID := jmDefaultScrambleID
+	if m := jmScrambleIDPattern.FindStringSubmatch(html); m != nil {
+		scrambleID, _ = strconv.Atoi(m[1])
+	}
+	aid, _ := strconv.Atoi(chapterID)
+	if m := jmAidPattern.FindStringSubmatch(html); m != nil {
+		aid, _ = strconv.Atoi(m[1])
+	}
+
+	fixup := func(index int, imgUrl, filename string) error {
+		name := path.Base(imgUrl)
+		if i := strings.IndexAny(name, "?#"); i >= 0 {
+			name = name[:i]
+		}
+		if strings.HasSuffix(strings.ToLower(name), ".gif") {
+			return nil
+		}
+		strips := jmStripCount(scrambleID, aid, strings.TrimSuffix(name, path.Ext(name)))
+		if strips == 0 {
+			return nil
+		}
+		return descrambleStrips(filename, strips)
+	}
+
+	page := &chapterPage{title: extractChapterTitle(doc), url: pageURL, images: images, fixup: fixup, strategy: "site"}
+	addChapterExtras(page, doc, "", "")
+	checkPageCount(page, doc, base)
+	return page, nil
+}
+
+// jmStripCount 计算图片被切成的条数，0 表示未打乱
+func jmStripCount(scrambleID, aid int, name string) int {
+	if aid < scrambleID {
+		return 0
+	}
+	if aid < 268850 {
+		return 10
+	}
+	mod := 10
+	if aid >= 421926 {
+		mod = 8
+	}
+	sum := fmt.Sprintf("%x", md5.Sum([]byte(strconv.Itoa(aid)+name)))
+	return int(sum[len(sum)-1])%mod*2 + 2
+}
+
+// descrambleStrips 还原被横向切成 strips 条并倒序排列的图片，按原格式写回文件
+// Go 无法解码的格式（如 WebP）用 vips 还原，未安装 vips 时保留打乱的原图
+func descrambleStrips(filename string, strips int) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		if vips := findVips(); imageBackend != "go" && vips != "" {
+			return descrambleStripsVips(vips, filename, strips)
+		}
+		return fmt.Errorf("无法解码图片（WebP 等格式需要安装 vips），保留打乱的原图: %v", err)
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for _, s := range jmStrips(height, strips) {
+		draw.Draw(dst, image.Rect(0, s.dst, width, s.dst+s.height), img, image.Pt(bounds.Min.X, bounds.Min.Y+s.src), draw.Src)
+	}
+
+	var buf bytes.Buffer
+	if format == "png" {
+		err = png.Encode(&buf, dst)
+	} else {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 95})
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, buf.Bytes())
+}
+
+// jmStrip 还原时的一条：从原图 src 处取 height 像素高，放到 dst 处
+type jmStrip struct {
+	src, dst, height int
+}
+
+// jmStrips 按还原后从上到下的顺序列出每一条的位置
+// 原图最底部的一条包含无法整除的多余像素，还原后位于顶部
+func jmStrips(height, strips int) []jmStrip {
+	over := height % strips
+	move := height / strips
+	result := make([]jmStrip, strips)
+	for i := range result {
+		s := jmStrip{src: height - move*(i+1) - over, dst: move * i, height: move}
+		if i == 0 {
+			s.height += over
+		} else {
+			s.dst += over
+		}
+		result[i] = s
+	}
+	return result
+}
+
+// descrambleStripsVips 用 vips 裁出每一条后按还原的顺序竖向拼接，按原扩展名的格式写回文件
+func descrambleStripsVips(vips, filename string, strips int) error {
+	width, height, err := vipsImageSize(vips, filename)
+	if err != nil {
+		return err
+	}
+	// 临时目录与图片在同一目录下，完成后可以直接改名
+	tmpDir, err := os.MkdirTemp(filepath.Dir(filename), ".vips-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var parts []string
+	for i, s := range jmStrips(height, strips) {
+		op := cropOp(0, s.src, width, s.height)
+		if op == nil {
+			continue
+		}
+		part := fmt.Sprintf("%d.v", i)
+		if err := runVips(vips, op[0], filename, filepath.Join(tmpDir, part), op[1:]...); err != nil {
+			return err
+		}
+		parts = append(parts, part)
+	}
+
+	// arrayjoin 的输入是以空格分隔的文件名，在临时目录中执行，避免路径中的空格
+	out := "out" + strings.ToLower(filepath.Ext(filename))
+	target := out
+	if out == "out.jpg" || out == "out.jpeg" {
+		target += "[Q=95]"
+	}
+	cmd := exec.Command(vips, "arrayjoin", strings.Join(parts, " "), target, "--across", "1")
+	cmd.Dir = tmpDir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("vips arrayjoin 失败: %v: %s", err, strings.TrimSpace(string(output)))
+	}
+	return os.Rename(filepath.Join(tmpDir, out), filename)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestJmParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		kind targetKind
+		id   string
+		ok   bool
+	}{
+		{"/album/123456/", targetSeries, "123456", true},
+		{"/album/123456/some-title", targetSeries, "123456", true},
+		{"/photo/654321", targetChapter, "654321", true},
+		{"/zh/photo/654321/", targetChapter, "654321", true},
+		{"/album/abc/", 0, "", false},
+		{"/search/photos", 0, "", false},
+		{"/", 0, "", false},
+	}
+	for _, tt := range tests {
+		kind, id, ok := jmSite{}.parsePath(&url.URL{Path: tt.path})
+		if kind != tt.kind || id != tt.id || ok != tt.ok {
+			t.Errorf("parsePath(%q) = %v, %q, %v, want %v, %q, %v", tt.path, kind, id, ok, tt.kind, tt.id, tt.ok)
+		}
+	}
+}
+
+func TestJmFetchSeries(t *testing.T) {
+	useFixtures(t)
+	page, err := jmSite{}.fetchSeries(context.Background(), "https://18comic.vip", "123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.title != "测试漫画" {
+		t.Errorf("title = %q, want 测试漫画", page.title)
+	}
+	want := []ChapterInfo{
+		{id: "123456", title: "第1話"},
+		{id: "123457", title: "第2話 后篇"},
+		{id: "123458", title: "Chapter 123458"},
+	}
+	if !reflect.DeepEqual(page.chapters, want) {
+		t.Errorf("chapters = %+v, want %+v", page.chapters, want)
+	}
+	if page.rating != ratingAdult || !page.completed {
+		t.Errorf("rating, completed = %q, %v, want %q, true", page.rating, page.completed, ratingAdult)
+	}
+}
+
+func TestJmFetchSeriesSingleChapter(t *testing.T) {
+	useFixtures(t)
+	page, err := jmSite{}.fetchSeries(context.Background(), "https://18comic.vip", "200000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有章节列表的漫画本身就是唯一的章节
+	want := []ChapterInfo{{id: "200000", title: "单话漫画"}}
+	if !reflect.DeepEqual(page.chapters, want) {
+		t.Errorf("chapters = %+v, want %+v", page.chapters, want)
+	}
+	if page.completed {
+		t.Error("ongoing series detected as completed")
+	}
+}
+
+func TestJmFetchChapter(t *testing.T) {
+	useFixtures(t)
+	page, err := jmSite{}.fetchChapter(context.Background(), "https://18comic.vip", "654321")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.url != "https://18comic.vip/photo/654321" {
+		t.Errorf("url = %q", page.url)
+	}
+	want := []string{
+		"https://cdn-msp.18comic.vip/media/photos/654321/00001.webp",
+		"https://18comic.vip/media/photos/654321/00002.webp?v=1",
+		"https://cdn-msp.18comic.vip/media/photos/654321/00003.gif",
+	}
+	if !reflect.DeepEqual(page.images, want) {
+		t.Errorf("images = %q, want %q", page.images, want)
+	}
+
+	// 打乱的章节下载后还原图片：文件不存在时还原失败，GIF 不处理
+	missing := filepath.Join(t.TempDir(), "0001.webp")
+	if err := page.fixup(0, page.images[0], missing); err == nil {
+		t.Error("fixup of a scrambled page did not try to descramble it")
+	}
+	if err := page.fixup(2, page.images[2], missing); err != nil {
+		t.Errorf("fixup of a GIF: %v", err)
+	}
+}
+
+func TestJmFetchChapterUnscrambled(t *testing.T) {
+	useFixtures(t)
+	page, err := jmSite{}.fetchChapter(context.Background(), "https://18comic.vip", "100000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 章节ID小于 scramble_id 时图片没有打乱，不读取下载的文件
+	if err := page.fixup(0, page.images[0], filepath.Join(t.TempDir(), "0001.jpg")); err != nil {
+		t.Errorf("fixup of an unscrambled page: %v", err)
+	}
+}
+
+func TestJmFetchChapterErrors(t *testing.T) {
+	useFixtures(t)
+	if _, err := (jmSite{}).fetchChapter(context.Background(), "https://18comic.vip", "654322"); err == nil {
+		t.Error("chapter without images succeeded")
+	}
+	if _, err := (jmSite{}).fetchChapter(context.Background(), "https://18comic.vip", "999999"); classifyRetry(err) != retryNever {
+		t.Errorf("missing chapter: %v, want a non-retryable error", err)
+	}
+}
+
+func TestJmStripCount(t *testing.T) {
+	tests := []struct {
+		scrambleID, aid int
+		name            string
+		want            int
+	}{
+		{jmDefaultScrambleID, 100000, "00001", 0},
+		{jmDefaultScrambleID, jmDefaultScrambleID - 1, "00001", 0},
+		{jmDefaultScrambleID, jmDefaultScrambleID, "00001", 10},
+		{jmDefaultScrambleID, 268849, "00001", 10},
+		// md5("30000000001") 以 a 结尾：'a' % 10 * 2 + 2
+		{jmDefaultScrambleID, 300000, "00001", 16},
+		{jmDefaultScrambleID, 300000, "00002", 12},
+		// 421926 之后取模 8
+		{jmDefaultScrambleID, 450000, "00001", 10},
+		{jmDefaultScrambleID, 450000, "00010", 16},
+		{500000, 450000, "00001", 0},
+	}
+	for _, tt := range tests {
+		if got := jmStripCount(tt.scrambleID, tt.aid, tt.name); got != tt.want {
+			t.Errorf("jmStripCount(%d, %d, %q) = %d, want %d", tt.scrambleID, tt.aid, tt.name, got, tt.want)
+		}
+	}
+}
+
+// rowColor 测试图片第 y 行的颜色，每行不同
+func rowColor(y int) color.RGBA {
+	return color.RGBA{R: uint8(y * 20), G: 0, B: uint8(255 - y*20), A: 255}
+}
+
+func TestDescrambleStrips(t *testing.T) {
+	// 高 10 像素切成 3 条：每条 3 像素，多余的 1 像素在原图最底部的一条中
+	// 打乱后从上到下依次为还原后的第 7-9、4-6、0-3 行
+	scrambled := []int{7, 8, 9, 4, 5, 6, 0, 1, 2, 3}
+	img := image.NewRGBA(image.Rect(0, 0, 2, len(scrambled)))
+	for y, row := range scrambled {
+		for x := 0; x < 2; x++ {
+			img.SetRGBA(x, y, rowColor(row))
+		}
+	}
+	file := filepath.Join(t.TempDir(), "00001.png")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if err := descrambleStrips(file, 3); err != nil {
+		t.Fatalf("descrambleStrips: %v", err)
+	}
+
+	f, err = os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, format, err := image.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" {
+		t.Errorf("format = %s, want png", format)
+	}
+	for y := 0; y < len(scrambled); y++ {
+		if c := color.RGBAModel.Convert(got.At(0, y)).(color.RGBA); c != rowColor(y) {
+			t.Errorf("row %d = %v, want %v", y, c, rowColor(y))
+		}
+	}
+}
+
+func TestDescrambleStripsUndecodable(t *testing.T) {
+	saved := imageBackend
+	imageBackend = "go"
+	defer func() { imageBackend = saved }()
+
+	file := filepath.Join(t.TempDir(), "00001.webp")
+	data := []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := descrambleStrips(file, 3); err == nil {
+		t.Error("descrambleStrips of an undecodable image succeeded")
+	}
+	if got, _ := os.ReadFile(file); string(got) != string(data) {
+		t.Error("undecodable image was modified")
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// jobsPath daemon 任务队列的保存位置，重启后继续未完成的任务
+func jobsPath() string {
+	return metadataPath("jobs.json")
+}
+
+// jobHistoryLimit 保留的已结束任务数
+const jobHistoryLimit = 50
+
+// 任务类型
+const (
+	jobDownload = "download" // 通过网页或 API 提交的链接
+	jobUpdate   = "update"   // 订阅漫画的定时更新
+)
+
+// 任务状态
+const (
+	jobQueued   = "queued"
+	jobPaused   = "paused"
+	jobRunning  = "running"
+	jobDone     = "done"
+	jobFailed   = "failed"
+	jobCanceled = "canceled"
+)
+
+// jobStateNames 网页中显示的任务状态
+var jobStateNames = map[string]string{
+	jobQueued: "等待", jobPaused: "已暂停", jobRunning: "进行中", jobDone: "完成", jobFailed: "失败", jobCanceled: "已取消",
+}
+
+// jobPriorities 优先级从高到低：订阅更新（新章节）默认为 high，单个章节为 normal，整部漫画的补档为 low
+var jobPriorities = map[string]int{"high": 2, "normal": 1, "low": 0}
+
+// job 一个下载任务
+type job struct {
+	ID       int       `json:"id"`
+	Kind     string    `json:"kind"`
+	Target   string    `json:"target"`             // 链接，订阅更新时为漫画ID
+	BaseURL  string    `json:"base_url,omitempty"` // 订阅更新的站点地址
+	Title    string    `json:"title,omitempty"`
+	Priority string    `json:"priority"`
+	Windows  []string  `json:"windows,omitempty"` // 只在这些时间段内执行，为空时使用全局的 --window
+	State    string    `json:"state"`
+	Order    int       `json:"order"` // 同一优先级中的顺序，越小越先执行
+	Added    time.Time `json:"added"` // 订阅更新时作为检查时间记录
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+}
+
+// active 任务是否还未结束
+func (j *job) active() bool {
+	return j.State == jobQueued || j.State == jobPaused || j.State == jobRunning
+}
+
+// describe 任务的说明，用于日志和状态
+func (j *job) describe() string {
+	if j.Kind == jobUpdate {
+		return fmt.Sprintf("检查更新: %s %s", j.Target, j.Title)
+	}
+	return j.Target
+}
+
+// jobQueue 持久化的任务队列：按优先级和顺序依次执行，可以暂停、恢复、调整顺序和优先级
+type jobQueue struct {
+	mu     sync.Mutex
+	Paused bool   `json:"paused"` // 整个队列暂停，正在执行的任务完成后不再开始新任务
+	NextID int    `json:"next_id"`
+	Jobs   []*job `json:"jobs"`
+}
+
+// loadJobQueue 读取任务队列，上次退出时正在执行的任务重新排队
+func loadJobQueue() (*jobQueue, error) {
+	q := &jobQueue{NextID: 1}
+	data, err := os.ReadFile(jobsPath())
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, q); err != nil {
+		return nil, fmt.Errorf("解析任务队列失败: %v", err)
+	}
+	for _, j := range q.Jobs {
+		if j.State == jobRunning {
+			j.State = jobQueued
+			j.Started = time.Time{}
+		}
+	}
+	return q, nil
+}
+
+// save 保存任务队列，调用方持有锁
+func (q *jobQueue) save() {
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(jobsPath()), 0755); err == nil {
+			err = writeFileAtomic(jobsPath(), data)
+		}
+	}
+	if err != nil {
+		fmt.Printf("保存任务队列失败: %v\n", err)
+	}
+}
+
+// add 添加任务，同一目标已有未结束的任务时返回已有的任务
+func (q *jobQueue) add(kind, target, baseURL, title, priority string, windows []string) (*job, error) {
+	if _, ok := jobPriorities[priority]; !ok {
+		return nil, fmt.Errorf("优先级只能是 high、normal 或 low: %s", priority)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.Jobs {
+		if j.active() && j.Kind == kind && j.Target == target {
+			return j, nil
+		}
+	}
+	j := &job{ID: q.NextID, Kind: kind, Target: target, BaseURL: baseURL, Title: title,
+		Priority: priority, Windows: windows, State: jobQueued, Order: q.NextID, Added: time.Now()}
+	q.NextID++
+	q.Jobs = append(q.Jobs, j)
+	q.save()
+	return j, nil
+}
+
+// less 执行顺序：优先级高的在前，同一优先级按 Order
+func (q *jobQueue) less(a, b *job) bool {
+	if pa, pb := jobPriorities[a.Priority], jobPriorities[b.Priority]; pa != pb {
+		return pa > pb
+	}
+	return a.Order < b.Order
+}
+
+// next 取出下一个要执行的任务并标记为执行中，跳过 runnable 返回 false（不在时间段内）的任务，
+// 队列暂停或没有任务时返回nil
+func (q *jobQueue) next(runnable func(*job) bool) *job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.Paused {
+		return nil
+	}
+	var best *job
+	for _, j := range q.Jobs {
+		if j.State == jobQueued && (best == nil || q.less(j, best)) && runnable(j) {
+			best = j
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.State = jobRunning
+	best.Started = time.Now()
+	q.save()
+	return best
+}
+
+// finish 记录任务结束，只保留最近 jobHistoryLimit 个已结束的任务
+func (q *jobQueue) finish(j *job, failed bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j.State = jobDone
+	if failed {
+		j.State = jobFailed
+	}
+	j.Finished = time.Now()
+
+	var active, history []*job
+	for _, j := range q.Jobs {
+		if j.active() {
+			active = append(active, j)
+		} else {
+			history = append(history, j)
+		}
+	}
+	if len(history) > jobHistoryLimit {
+		history = history[len(history)-jobHistoryLimit:]
+	}
+	q.Jobs = append(active, history...)
+	q.save()
+}
+
+// find 按ID查找任务，调用方持有锁
+func (q *jobQueue) find(id int) *job {
+	for _, j := range q.Jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
+
+// waiting 同一优先级中等待执行的任务（包括已暂停的），按执行顺序排列，调用方持有锁
+func (q *jobQueue) waiting(priority string) []*job {
+	var list []*job
+	for _, j := range q.Jobs {
+		if (j.State == jobQueued || j.State == jobPaused) && j.Priority == priority {
+			list = append(list, j)
+		}
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Order < list[b].Order })
+	return list
+}
+
+// update 修改任务：pause、resume、cancel、top（移到同一优先级的最前面）、up、down，
+// 或 priority 修改优先级（value 为 high、normal、low）
+func (q *jobQueue) update(id int, action, value string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j := q.find(id)
+	if j == nil {
+		return fmt.Errorf("任务 %d 不存在", id)
+	}
+	if !j.active() {
+		return fmt.Errorf("任务 %d 已结束", id)
+	}
+	if j.State == jobRunning && action != "priority" {
+		return fmt.Errorf("任务 %d 正在执行，无法%s", id, action)
+	}
+
+	switch action {
+	case "pause":
+		j.State = jobPaused
+	case "resume":
+		j.State = jobQueued
+	case "cancel":
+		j.State = jobCanceled
+		j.Finished = time.Now()
+	case "top":
+		if list := q.waiting(j.Priority); len(list) > 0 && list[0] != j {
+			j.Order = list[0].Order - 1
+		}
+	case "up", "down":
+		list := q.waiting(j.Priority)
+		for i, other := range list {
+			if other != j {
+				continue
+			}
+			k := i - 1
+			if action == "down" {
+				k = i + 1
+			}
+			if k >= 0 && k < len(list) {
+				j.Order, list[k].Order = list[k].Order, j.Order
+			}
+			break
+		}
+	case "priority":
+		if _, ok := jobPriorities[value]; !ok {
+			return fmt.Errorf("优先级只能是 high、normal 或 low: %s", value)
+		}
+		j.Priority = value
+	default:
+		return fmt.Errorf("未知的操作: %s", action)
+	}
+	q.save()
+	return nil
+}
+
+// setPaused 暂停或恢复整个队列
+func (q *jobQueue) setPaused(paused bool) {
+	q.mu.Lock()
+	q.Paused = paused
+	q.save()
+	q.mu.Unlock()
+}
+
+// jobList /api/jobs 返回的任务列表
+type jobList struct {
+	Paused bool  `json:"paused"`
+	Jobs   []job `json:"jobs"` // 未结束的任务按执行顺序在前，已结束的任务按结束时间从新到旧在后
+}
+
+// list 返回任务列表的副本
+func (q *jobQueue) list() jobList {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var active, history []*job
+	for _, j := range q.Jobs {
+		if j.active() {
+			active = append(active, j)
+		} else {
+			history = append(history, j)
+		}
+	}
+	sort.SliceStable(active, func(a, b int) bool {
+		// 正在执行的任务排在最前面
+		if (active[a].State == jobRunning) != (active[b].State == jobRunning) {
+			return active[a].State == jobRunning
+		}
+		return q.less(active[a], active[b])
+	})
+	sort.SliceStable(history, func(a, b int) bool { return history[a].Finished.After(history[b].Finished) })
+
+	result := jobList{Paused: q.Paused, Jobs: make([]job, 0, len(q.Jobs))}
+	for _, j := range append(active, history...) {
+		result.Jobs = append(result.Jobs, *j)
+	}
+	return result
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// libraryJournalPath 漫画库的增量日志，每下载完一个章节追加一行，进程异常退出后用于恢复
+func libraryJournalPath() string {
+	return metadataPath("library.journal")
+}
+
+// journalCompactEvery 日志累积多少条后合并回漫画库数据库
+const journalCompactEvery = 50
+
+// journalEntry 日志中的一条记录：下载完成的章节及其所属漫画的信息
+type journalEntry struct {
+	Series  string         `json:"series"`
+	Title   string         `json:"title,omitempty"`
+	BaseURL string         `json:"base_url,omitempty"`
+	Dir     string         `json:"dir,omitempty"`
+	Chapter *chapterRecord `json:"chapter"`
+}
+
+// journalChapter 记录下载完成的章节：追加到日志而不是每次重写整个数据库，累积一定数量后合并
+func (db *libraryDB) journalChapter(s *seriesRecord, c *chapterRecord) error {
+	s.addChapter(c)
+
+	entry := journalEntry{Series: s.ID, Title: s.Title, BaseURL: s.BaseURL, Dir: s.Dir, Chapter: c}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(libraryJournalPath()), 0755); err != nil {
+		return err
+	}
+	unlock, err := lockJournal()
+	if err != nil {
+		return err
+	}
+	err = appendJournal(append(data, '\n'))
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	db.journaled++
+	if db.journaled >= journalCompactEvery {
+		return db.save()
+	}
+	return nil
+}
+
+// appendJournal 追加一行日志并写入磁盘
+func appendJournal(line []byte) error {
+	file, err := os.OpenFile(libraryJournalPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(line); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// lockJournal 获取漫画库日志的锁，返回释放锁的函数
+// 追加日志和合并日志都持有这个锁，合并时读取日志到删除日志之间其他进程追加的记录不会丢失
+func lockJournal() (func(), error) {
+	path := metadataPath("library.journal.lock")
+	for {
+		err := createLockFile(path)
+		if err == nil {
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		// 持有者只在追加或合并的片刻持有，进程在此期间退出时留下的锁按漫画锁的规则清理
+		if _, stale := readLock(path); stale && removeStaleLock(path) {
+			continue
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// replayJournal 将日志中的记录应用到漫画库
+func (db *libraryDB) replayJournal() error {
+	file, err := os.Open(libraryJournalPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Series == "" || entry.Chapter == nil {
+			// 进程在写入过程中退出时最后一行可能不完整，跳过即可
+			continue
+		}
+		s := db.ensureSeries(entry.Series)
+		if entry.Title != "" {
+			s.Title = entry.Title
+		}
+		if entry.BaseURL != "" {
+			s.BaseURL = entry.BaseURL
+		}
+		if entry.Dir != "" {
+			s.Dir = entry.Dir
+		}
+		s.addChapter(entry.Chapter)
+	}
+	return scanner.Err()
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再改名，进程中途退出时原文件保持完整
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("替换 %s 失败: %v", path, err)
+	}
+	return nil
+}
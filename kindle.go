@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runKindleCommand 通过邮件将电子书发送到 Send-to-Kindle 邮箱
+func runKindleCommand(args []string) {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("读取配置文件失败: %v\n", err)
+		return
+	}
+	kindle := cfg.Kindle
+
+	var files []string
+	validate := false
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--validate":
+			validate = true
+		case "--to":
+			if i+1 < len(args) {
+				kindle.To = args[i+1]
+				i++
+			}
+		case "--max-size":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 1 {
+					fmt.Printf("无效的附件大小上限: %s\n", args[i+1])
+					return
+				}
+				kindle.MaxSizeMB = n
+				i++
+			}
+		default:
+			files = append(files, args[i])
+		}
+	}
+	if len(files) == 0 {
+		fmt.Println("使用方法: ./comicbox kindle <电子书.epub>... [--to <Kindle邮箱>] [--max-size <MB>] [--validate]")
+		return
+	}
+	if kindle.To == "" || kindle.From == "" || kindle.SMTPHost == "" {
+		fmt.Printf("请在配置文件 %s 中设置 kindle.to、kindle.from 和 kindle.smtp_host\n", configPath)
+		return
+	}
+	if kindle.SMTPPort == 0 {
+		kindle.SMTPPort = 587
+	}
+	if kindle.Username == "" {
+		kindle.Username = kindle.From
+	}
+	if kindle.MaxSizeMB == 0 {
+		kindle.MaxSizeMB = 50
+	}
+	if validate {
+		for _, file := range files {
+			if err := validateEPUB(file); err != nil {
+				fmt.Printf("%s: %v\n没有发送任何文件\n", file, err)
+				return
+			}
+		}
+	}
+
+	batches, err := splitAttachments(files, int64(kindle.MaxSizeMB)*1024*1024)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	for i, batch := range batches {
+		subject := strings.TrimSuffix(filepath.Base(batch[0]), filepath.Ext(batch[0]))
+		if len(batches) > 1 {
+			subject = fmt.Sprintf("%s (%d/%d)", subject, i+1, len(batches))
+		}
+		err := sendKindleMail(kindle, subject, batch)
+		if err != nil {
+			fmt.Printf("发送邮件 %d/%d 失败: %v\n", i+1, len(batches), err)
+			return
+		}
+		fmt.Printf("已发送邮件 %d/%d: %s\n", i+1, len(batches), strings.Join(batch, ", "))
+	}
+}
+
+// splitAttachments 按附件大小上限将文件分配到多封邮件中，base64 编码后的大小约为原文件的 4/3
+func splitAttachments(files []string, maxSize int64) ([][]string, error) {
+	var batches [][]string
+	var batch []string
+	var batchSize int64
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取文件失败: %v", err)
+		}
+		size := info.Size() * 4 / 3
+		if size > maxSize {
+			return nil, fmt.Errorf("%s 编码后约 %s，超过单封邮件 %s 的上限，请拆分为更小的分卷后再发送",
+				file, formatBytes(size), formatBytes(maxSize))
+		}
+		if batchSize+size > maxSize && len(batch) > 0 {
+			batches = append(batches, batch)
+			batch, batchSize = nil, 0
+		}
+		batch = append(batch, file)
+		batchSize += size
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches, nil
+}
+
+// sendKindleMail 发送带附件的邮件
+func sendKindleMail(kindle kindleConfig, subject string, files []string) error {
+	msg, err := buildMail(kindle.From, kindle.To, subject, files)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(kindle.SMTPHost, strconv.Itoa(kindle.SMTPPort))
+	auth := smtp.PlainAuth("", kindle.Username, kindle.Password, kindle.SMTPHost)
+	if kindle.SMTPPort != 465 {
+		// smtp.SendMail 在服务器支持时自动使用 STARTTLS
+		return smtp.SendMail(addr, auth, kindle.From, []string{kindle.To}, msg)
+	}
+
+	// 465 端口直接使用 TLS 连接
+	conn, err := tls.DialWithDialer(&net.Dialer{Timeout: 30 * time.Second}, "tcp", addr, &tls.Config{ServerName: kindle.SMTPHost})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, kindle.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if err := client.Auth(auth); err != nil {
+		return err
+	}
+	if err := client.Mail(kindle.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(kindle.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// buildMail 生成 MIME 格式的邮件，附件使用 base64 编码
+func buildMail(from, to, subject string, files []string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", writer.Boundary())
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取附件失败: %v", err)
+		}
+
+		name := filepath.Base(file)
+		contentType := mime.TypeByExtension(filepath.Ext(name))
+		if strings.EqualFold(filepath.Ext(name), ".epub") {
+			contentType = "application/epub+zip"
+		}
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Transfer-Encoding", "base64")
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+
+		// base64 每行 76 个字符
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > 76 {
+			fmt.Fprintf(part, "%s\r\n", encoded[:76])
+			encoded = encoded[76:]
+		}
+		fmt.Fprintf(part, "%s\r\n", encoded)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
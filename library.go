@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// libraryDBPath 漫画库数据库文件，记录已下载的漫画、章节和订阅信息
+func libraryDBPath() string {
+	return metadataPath("library.json")
+}
+
+// outputRoot 漫画库根目录，漫画和章节目录都创建在其中，为空时使用当前目录
+var outputRoot string
+
+// setOutputRoot 设置漫画库根目录，保存为绝对路径，使漫画库中记录的目录与运行位置无关
+func setOutputRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return fmt.Errorf("创建漫画库根目录失败: %v", err)
+	}
+	outputRoot = abs
+	return nil
+}
+
+// libraryPath 返回漫画库根目录下的路径，name 为漫画或章节的标题
+func libraryPath(name string) string {
+	name = pathName(name)
+	if outputRoot == "" {
+		if runtime.GOOS == "windows" {
+			// 绝对路径才能让 os 包自动加上 \\?\ 前缀，支持超过 260 个字符的路径
+			if abs, err := filepath.Abs(name); err == nil {
+				return abs
+			}
+		}
+		return name
+	}
+	return filepath.Join(outputRoot, name)
+}
+
+// libraryDB 漫画库数据库
+type libraryDB struct {
+	Series  []*seriesRecord   `json:"series"`
+	Aliases map[string]string `json:"aliases,omitempty"` // 标题别名：网站上的标题 -> 保存使用的名称
+
+	Translations map[string]map[string]string `json:"translations,omitempty"` // 标题翻译的缓存：目标语言 -> 原文 -> 译文
+
+	journaled int // 上次保存后追加到日志的记录数
+
+	// base 读取或上次保存时各漫画记录的 JSON，baseAliases 为当时的标题别名；
+	// 保存时与磁盘上的当前内容三方合并，其他进程在此期间保存的修改不会被覆盖
+	base        map[string]string
+	baseAliases map[string]string
+
+	mu sync.Mutex // check --download 同时下载多部漫画的章节时，读写记录和写入日志时持有
+}
+
+// seriesRecord 漫画记录
+type seriesRecord struct {
+	ID            string           `json:"id"`
+	Title         string           `json:"title"`
+	TitleOverride string           `json:"title_override,omitempty"` // --title 指定的名称，不随网站上的标题变化
+	BaseURL       string           `json:"base_url"`
+	Sources       []string         `json:"sources,omitempty"` // 备用来源的目录页链接
+	Dir           string           `json:"dir"`
+	Followed      bool             `json:"followed"`
+	Schedule      string           `json:"schedule,omitempty"` // cron 表达式，为空时使用全局检查间隔
+	LastChecked   time.Time        `json:"last_checked,omitempty"`
+	Chapters      []*chapterRecord `json:"chapters"`
+	Locked        []*lockedChapter `json:"locked,omitempty"`        // 未解锁（付费、VIP）的章节
+	TOC           *tocSnapshot     `json:"toc,omitempty"`           // 上次更新时主来源的章节目录
+	Rating        string           `json:"rating,omitempty"`        // 内容分级: all-ages、teen、mature、adult，为空表示未分级
+	RatingManual  bool             `json:"rating_manual,omitempty"` // 分级由 rating 命令设置，不再按站点页面更新
+	Completed     bool             `json:"completed,omitempty"`     // 主来源页面上标为已完结
+	FinalizedAt   time.Time        `json:"finalized_at,omitempty"`  // 完结后生成最终电子书并取消订阅的时间
+}
+
+// chapterRecord 已下载的章节记录
+type chapterRecord struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Dir          string    `json:"dir"`
+	Pages        int       `json:"pages"`
+	Bytes        int64     `json:"bytes"`
+	DownloadedAt time.Time `json:"downloaded_at"`
+	Pruned       bool      `json:"pruned,omitempty"` // 原始图片已按保留策略删除
+	Read         bool      `json:"read,omitempty"`
+	ReadAt       time.Time `json:"read_at,omitempty"`
+	Source       string    `json:"source,omitempty"`     // 从备用来源下载时记录来源地址
+	Incomplete   bool      `json:"incomplete,omitempty"` // 下载的页数少于页面上标明的页数，下次更新时重新检查
+}
+
+// legacyMetadataWarned 每次运行只提示一次旧的元数据位置
+var legacyMetadataWarned sync.Once
+
+// warnLegacyMetadata 指定了漫画库根目录但其中还没有数据库，而当前目录中有旧版本（元数据总是保存在运行目录中）的数据库时，提示移动过去
+func warnLegacyMetadata() {
+	legacyMetadataWarned.Do(func() {
+		legacy, err := filepath.Abs(filepath.Join(metadataDir, "library.json"))
+		if err != nil || legacy == libraryDBPath() || fileSize(legacy) == 0 {
+			return
+		}
+		fmt.Printf("注意: 元数据保存在漫画库根目录的 %s 中，当前目录的 %s 是旧版本保存的，请将其中的文件移动过去\n",
+			metadataPath(), filepath.Dir(legacy))
+	})
+}
+
+// loadLibrary 读取漫画库数据库，文件不存在时返回空库
+// 日志中还没有合并的记录（其他进程正在下载，或上次运行异常退出）只应用到内存中，
+// 读取不写入任何文件，日志由下一次保存合并回数据库
+func loadLibrary() (*libraryDB, error) {
+	if _, err := os.Stat(libraryDBPath()); os.IsNotExist(err) {
+		warnLegacyMetadata()
+	}
+	db, err := readLibraryFile()
+	if err != nil {
+		return nil, err
+	}
+	db.snapshot()
+	return db, nil
+}
+
+// readLibraryFile 读取磁盘上的数据库并应用日志中的记录
+func readLibraryFile() (*libraryDB, error) {
+	db := &libraryDB{}
+	data, err := os.ReadFile(libraryDBPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, db); err != nil {
+			return nil, fmt.Errorf("解析漫画库数据库失败: %v", err)
+		}
+	}
+	if err := db.replayJournal(); err != nil {
+		return nil, fmt.Errorf("读取漫画库日志失败: %v", err)
+	}
+	return db, nil
+}
+
+// save 将漫画库写回磁盘并清空日志
+// 写入前重新读取数据库和日志，与本进程的修改三方合并（见 mergeDisk），其他进程保存的订阅、分级和章节不会丢失；
+// 写入时先写临时文件再改名，中途退出不会损坏数据库
+// 读取、写入和清空日志都在日志锁内进行，其他进程在此期间等待，追加的记录不会在清空时丢失
+func (db *libraryDB) save() error {
+	err := os.MkdirAll(filepath.Dir(libraryDBPath()), 0755)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockJournal()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	disk, err := readLibraryFile()
+	if err != nil {
+		return err
+	}
+	db.mergeDisk(disk)
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(libraryDBPath(), data); err != nil {
+		return err
+	}
+	db.journaled = 0
+	db.snapshot()
+	if err := os.Remove(libraryJournalPath()); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// snapshot 记录当前内容，作为下次保存时三方合并的基准
+func (db *libraryDB) snapshot() {
+	db.base = make(map[string]string, len(db.Series))
+	for _, s := range db.Series {
+		db.base[s.ID] = jsonString(s)
+	}
+	db.baseAliases = maps.Clone(db.Aliases)
+}
+
+// mergeDisk 把磁盘上的当前内容合并到内存中：本进程没有修改的漫画记录和字段采用磁盘上的内容（包括其他进程的删除），
+// 本进程修改过的字段以本进程为准；章节按ID逐个合并，双方各自下载或修改的章节都会保留。标题翻译的缓存取并集
+func (db *libraryDB) mergeDisk(disk *libraryDB) {
+	theirs := make(map[string]*seriesRecord, len(disk.Series))
+	for _, s := range disk.Series {
+		theirs[s.ID] = s
+	}
+	mine := make(map[string]bool, len(db.Series))
+	var merged []*seriesRecord
+	for _, s := range db.Series {
+		mine[s.ID] = true
+		base, existed := db.base[s.ID]
+		t := theirs[s.ID]
+		switch {
+		case t == nil && existed && jsonString(s) == base:
+			// 其他进程删除了这部漫画，本进程没有修改
+			continue
+		case t != nil && jsonString(t) != base:
+			mergeRecord(base, s, t)
+		}
+		merged = append(merged, s)
+	}
+	for _, t := range disk.Series {
+		// 基准中有而内存中没有的是本进程删除的漫画
+		if _, existed := db.base[t.ID]; !mine[t.ID] && !existed {
+			merged = append(merged, t)
+		}
+	}
+	db.Series = merged
+
+	aliases := maps.Clone(disk.Aliases)
+	for k, v := range db.Aliases {
+		if old, ok := db.baseAliases[k]; !ok || old != v {
+			if aliases == nil {
+				aliases = make(map[string]string)
+			}
+			aliases[k] = v
+		}
+	}
+	for k := range db.baseAliases {
+		if _, ok := db.Aliases[k]; !ok {
+			delete(aliases, k)
+		}
+	}
+	db.Aliases = aliases
+
+	for lang, cache := range disk.Translations {
+		for src, dst := range cache {
+			if _, ok := db.Translations[lang][src]; ok {
+				continue
+			}
+			if db.Translations == nil {
+				db.Translations = make(map[string]map[string]string)
+			}
+			if db.Translations[lang] == nil {
+				db.Translations[lang] = make(map[string]string)
+			}
+			db.Translations[lang][src] = dst
+		}
+	}
+}
+
+// mergeRecord 三方合并一部漫画的记录，结果写回 mine：base 为读取时记录的 JSON（为空表示当时没有这部漫画），
+// theirs 为磁盘上的当前记录。每个 JSON 字段中本进程没有修改的采用 theirs，章节按ID逐个合并
+func mergeRecord(base string, mine, theirs *seriesRecord) {
+	var baseRecord seriesRecord
+	if base != "" {
+		json.Unmarshal([]byte(base), &baseRecord)
+	}
+	b, m, t := jsonFields(&baseRecord), jsonFields(mine), jsonFields(theirs)
+	if base == "" {
+		b = map[string]json.RawMessage{}
+	}
+	result := make(map[string]json.RawMessage)
+	for _, fields := range []map[string]json.RawMessage{b, m, t} {
+		for k := range fields {
+			result[k] = nil
+		}
+	}
+	for k := range result {
+		if bytes.Equal(m[k], b[k]) {
+			result[k] = t[k]
+		} else {
+			result[k] = m[k]
+		}
+		if result[k] == nil {
+			delete(result, k)
+		}
+	}
+	data, _ := json.Marshal(result)
+	merged := &seriesRecord{}
+	if err := json.Unmarshal(data, merged); err != nil {
+		return
+	}
+	merged.Chapters = mergeChapters(baseRecord.Chapters, mine.Chapters, theirs.Chapters)
+	*mine = *merged
+}
+
+// mergeChapters 按章节ID三方合并章节列表：本进程没有修改的章节采用 theirs（包括删除），
+// 只在一方出现的新章节保留，本进程删除的章节不会恢复
+func mergeChapters(base, mine, theirs []*chapterRecord) []*chapterRecord {
+	index := func(list []*chapterRecord) map[string]*chapterRecord {
+		m := make(map[string]*chapterRecord, len(list))
+		for _, c := range list {
+			m[c.ID] = c
+		}
+		return m
+	}
+	b, t := index(base), index(theirs)
+	var merged []*chapterRecord
+	seen := make(map[string]bool)
+	for _, c := range mine {
+		seen[c.ID] = true
+		bc, tc := b[c.ID], t[c.ID]
+		switch {
+		case bc != nil && jsonString(c) == jsonString(bc) && tc == nil:
+			continue
+		case bc != nil && jsonString(c) == jsonString(bc):
+			merged = append(merged, tc)
+		default:
+			merged = append(merged, c)
+		}
+	}
+	for _, c := range theirs {
+		if !seen[c.ID] && b[c.ID] == nil {
+			merged = append(merged, c)
+		}
+	}
+	return merged
+}
+
+// jsonString 值的 JSON，用于比较记录是否被修改
+func jsonString(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// jsonFields 记录的各个 JSON 字段
+func jsonFields(v interface{}) map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	json.Unmarshal([]byte(jsonString(v)), &fields)
+	return fields
+}
+
+// findSeries 按漫画ID查找记录
+func (db *libraryDB) findSeries(id string) *seriesRecord {
+	for _, s := range db.Series {
+		if s.ID == id {
+			return s
+		}
+	}
+	return nil
+}
+
+// ensureSeries 查找漫画记录，不存在时创建
+func (db *libraryDB) ensureSeries(id string) *seriesRecord {
+	if s := db.findSeries(id); s != nil {
+		return s
+	}
+	s := &seriesRecord{ID: id, BaseURL: defaultBaseURL}
+	db.Series = append(db.Series, s)
+	return s
+}
+
+// findChapter 按章节ID查找已下载的章节
+func (s *seriesRecord) findChapter(id string) *chapterRecord {
+	for _, c := range s.Chapters {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// addChapter 记录一个下载完成的章节，已存在时覆盖
+func (s *seriesRecord) addChapter(c *chapterRecord) {
+	for i, existing := range s.Chapters {
+		if existing.ID == c.ID {
+			s.Chapters[i] = c
+			return
+		}
+	}
+	s.Chapters = append(s.Chapters, c)
+}
+
+// unreadCount 返回未读章节数
+func (s *seriesRecord) unreadCount() int {
+	n := 0
+	for _, c := range s.Chapters {
+		if !c.Read {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// useTempLibrary 让漫画库读写到临时目录
+func useTempLibrary(t *testing.T) {
+	saved := outputRoot
+	outputRoot = t.TempDir()
+	t.Cleanup(func() { outputRoot = saved })
+}
+
+func TestLoadLibraryDoesNotCompactJournal(t *testing.T) {
+	useTempLibrary(t)
+	db, err := loadLibrary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := db.ensureSeries("1")
+	if err := db.journalChapter(s, &chapterRecord{ID: "10", Title: "第1话"}); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := loadLibrary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := reader.findSeries("1"); s == nil || s.findChapter("10") == nil {
+		t.Error("journaled chapter is not visible to readers")
+	}
+	if fileSize(libraryJournalPath()) == 0 {
+		t.Error("loading the library removed the journal")
+	}
+	if _, err := os.Stat(libraryDBPath()); !os.IsNotExist(err) {
+		t.Errorf("loading the library wrote %s", libraryDBPath())
+	}
+}
+
+func TestSaveKeepsOtherProcessChanges(t *testing.T) {
+	useTempLibrary(t)
+	initial, _ := loadLibrary()
+	initial.ensureSeries("1").Chapters = []*chapterRecord{{ID: "10", Title: "第1话"}}
+	initial.ensureSeries("2")
+	initial.ensureSeries("3")
+	initial.Aliases = map[string]string{"旧标题": "标题"}
+	if err := initial.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 下载进程先读取漫画库，之后另一个进程订阅漫画 1、标记章节已读、删除漫画 3 并添加别名
+	downloader, _ := loadLibrary()
+	other, _ := loadLibrary()
+	other.findSeries("1").Followed = true
+	other.findSeries("1").Chapters[0].Read = true
+	other.Series = other.Series[:2]
+	other.Aliases["另一个"] = "名称"
+	if err := other.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 下载进程下载漫画 1 的新章节、设置漫画 2 的分级，然后保存
+	s := downloader.findSeries("1")
+	if err := downloader.journalChapter(s, &chapterRecord{ID: "11", Title: "第2话", DownloadedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	downloader.findSeries("2").Rating = "teen"
+	if err := downloader.save(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = db.findSeries("1")
+	if s == nil || !s.Followed {
+		t.Fatal("follow saved by another process was lost")
+	}
+	if c := s.findChapter("10"); c == nil || !c.Read {
+		t.Error("read mark saved by another process was lost")
+	}
+	if s.findChapter("11") == nil {
+		t.Error("downloaded chapter was lost")
+	}
+	if s := db.findSeries("2"); s == nil || s.Rating != "teen" {
+		t.Error("rating set by the downloader was lost")
+	}
+	if db.findSeries("3") != nil {
+		t.Error("series deleted by another process came back")
+	}
+	if db.Aliases["旧标题"] != "标题" || db.Aliases["另一个"] != "名称" {
+		t.Errorf("aliases = %v", db.Aliases)
+	}
+}
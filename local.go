@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// chapterNumberPattern 匹配章节标题中的话数，如 "第12話"、"第3.5话"
+var chapterNumberPattern = regexp.MustCompile(`第\s*(\d+(?:\.\d+)?)\s*[話话章回集]`)
+
+// leadingNumberPattern 匹配文件名中的第一个数字
+var leadingNumberPattern = regexp.MustCompile(`\d+(?:\.\d+)?`)
+
+// localChapter 本地保存的章节页面
+type localChapter struct {
+	path     string
+	title    string
+	number   float64
+	hasNum   bool
+	images   []string
+	page     *localPage
+	strategy string // 提取图片链接的方式，记录在 chapter.json 中
+}
+
+// localPage 浏览器保存的页面，包括已保存到本地的图片资源
+type localPage struct {
+	doc       *goquery.Document
+	baseDir   string            // 页面文件所在目录，用于解析相对路径
+	filesDir  string            // "另存为完整网页"时生成的 xxx_files 目录
+	resources map[string][]byte // MHTML中按原始URL索引的资源
+}
+
+// loadLocalPage 加载本地保存的页面，支持HTML（含 _files 目录）和MHTML
+func loadLocalPage(filePath string) (*localPage, error) {
+	page := &localPage{baseDir: filepath.Dir(filePath)}
+
+	ext := strings.ToLower(filepath.Ext(filePath))
+	if ext == ".mhtml" || ext == ".mht" {
+		doc, resources, err := parseMHTMLFile(filePath)
+		if err != nil {
+			return nil, err
+		}
+		page.doc = doc
+		page.resources = resources
+		return page, nil
+	}
+
+	doc, err := parseLocalFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	page.doc = doc
+
+	filesDir := strings.TrimSuffix(filePath, filepath.Ext(filePath)) + "_files"
+	if info, err := os.Stat(filesDir); err == nil && info.IsDir() {
+		page.filesDir = filesDir
+	}
+
+	return page, nil
+}
+
+// imageData 查找图片在本地保存结果中的副本，找不到时返回false
+func (p *localPage) imageData(imgUrl string) ([]byte, bool) {
+	if p == nil {
+		return nil, false
+	}
+
+	if data, ok := p.resources[imgUrl]; ok {
+		return data, true
+	}
+
+	var candidates []string
+	if !strings.Contains(imgUrl, "://") {
+		// 页面中保留的相对路径，如 ./chapter_files/0001.jpg
+		if rel, err := url.PathUnescape(imgUrl); err == nil {
+			candidates = append(candidates, filepath.Join(p.baseDir, filepath.FromSlash(rel)))
+		}
+	}
+	if p.filesDir != "" {
+		// 远程链接按文件名在 _files 目录中查找
+		if parsed, err := url.Parse(imgUrl); err == nil {
+			if base := path.Base(parsed.Path); base != "." && base != "/" {
+				candidates = append(candidates, filepath.Join(p.filesDir, base))
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		data, err := os.ReadFile(candidate)
+		if err == nil {
+			return data, true
+		}
+	}
+
+	return nil, false
+}
+
+// downloadLocalDir 扫描目录中浏览器保存的章节HTML文件，按章节顺序下载图片
+func downloadLocalDir(dir string) {
+	infof("正在扫描本地目录 %s 中的章节页面...\n", dir)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Printf("读取目录失败: %v\n", err)
+		return
+	}
+
+	var chapters []localChapter
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if ext != ".html" && ext != ".htm" && ext != ".mhtml" && ext != ".mht" {
+			continue
+		}
+
+		filePath := filepath.Join(dir, entry.Name())
+		page, err := loadLocalPage(filePath)
+		if err != nil {
+			fmt.Printf("解析文件 %s 失败: %v\n", entry.Name(), err)
+			continue
+		}
+		doc := page.doc
+
+		imageUrls, strategy := extractImages(doc)
+		if len(imageUrls) == 0 {
+			fmt.Printf("文件 %s 中未找到任何图片链接，已跳过\n", entry.Name())
+			continue
+		}
+
+		title := extractChapterTitle(doc)
+		if title == "" {
+			title = sanitizeFileName(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		}
+
+		chapter := localChapter{path: filePath, title: title, images: imageUrls, page: page, strategy: strategy}
+		chapter.number, chapter.hasNum = parseChapterNumber(title)
+		if !chapter.hasNum {
+			chapter.number, chapter.hasNum = parseChapterNumber(entry.Name())
+		}
+		chapters = append(chapters, chapter)
+	}
+
+	if len(chapters) == 0 {
+		fmt.Println("目录中未找到任何可用的章节页面")
+		return
+	}
+
+	// 有话数的章节按话数排序，其余保持文件名顺序排在最后
+	sort.SliceStable(chapters, func(i, j int) bool {
+		if chapters[i].hasNum != chapters[j].hasNum {
+			return chapters[i].hasNum
+		}
+		return chapters[i].hasNum && chapters[i].number < chapters[j].number
+	})
+
+	// 以目录名作为漫画标题
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		absDir = dir
+	}
+	comicTitle := sanitizeFileName(filepath.Base(absDir))
+	if comicTitle == "" || comicTitle == "." {
+		comicTitle = "local_comic"
+	}
+	comicTitle = localTitle(comicTitle)
+	comicDir := libraryPath(comicTitle)
+
+	err = os.MkdirAll(comicDir, 0755)
+	if err != nil {
+		fmt.Printf("创建漫画主目录失败: %v\n", err)
+		return
+	}
+
+	infof("漫画标题: %s\n", comicTitle)
+	infof("找到 %d 个章节\n", len(chapters))
+	runStats.addPlanned(len(chapters))
+
+	for i, chapter := range chapters {
+		chapterDirName := fmt.Sprintf("%03d_%s", i+1, pathName(sanitizeFileName(chapter.title)))
+		infof("\n正在下载章节 [%d/%d]: %s (%s)\n", i+1, len(chapters), chapter.title, filepath.Base(chapter.path))
+
+		dirName := uniqueChapterDir(filepath.Join(comicDir, chapterDirName), filepath.Base(chapter.path))
+		workDir := chapterWorkDir(dirName)
+		err := os.MkdirAll(workDir, 0755)
+		if err != nil {
+			fmt.Printf("创建目录失败: %v\n", err)
+			continue
+		}
+
+		result := downloadChapterImages(runContext, chapter.images, workDir, chapter.page, nil)
+		metrics.recordChapter(comicTitle)
+		meta := &chapterMeta{
+			ID:          filepath.Base(chapter.path),
+			Title:       chapter.title,
+			Number:      i + 1,
+			SeriesTitle: comicTitle,
+			SourceURL:   chapter.path,
+			ScrapedAt:   time.Now(),
+			Images:      chapter.images,
+			Strategy:    chapter.strategy,
+		}
+		if err := writeChapterMeta(workDir, meta, result); err != nil {
+			fmt.Printf("保存章节信息失败: %v\n", err)
+		}
+		if !finishChapterDir(workDir, dirName, result) {
+			continue
+		}
+		infof("章节 %s 下载完成\n", chapter.title)
+	}
+
+	infof("\n漫画《%s》下载完成! 所有章节保存在 %s 目录中\n", comicTitle, comicDir)
+}
+
+// parseChapterNumber 从标题或文件名中解析章节话数
+func parseChapterNumber(s string) (float64, bool) {
+	if m := chapterNumberPattern.FindStringSubmatch(s); m != nil {
+		if n, err := strconv.ParseFloat(m[1], 64); err == nil {
+			return n, true
+		}
+	}
+	if m := leadingNumberPattern.FindString(s); m != "" {
+		if n, err := strconv.ParseFloat(m, 64); err == nil {
+			return n, true
+		}
+	}
+	return 0, false
+}
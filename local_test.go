@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalPageRelativeImages(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"chapter/page.html": `<html><body>
+<img class="lazy" data-original="../shared/0001.jpg">
+<img class="lazy" data-original="./page_files/0002.jpg#top">
+<img class="lazy" data-original="/images/0003.jpg">
+</body></html>`,
+		"shared/0001.jpg":             "first",
+		"chapter/page_files/0002.jpg": "second",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := loadLocalPage(filepath.Join(root, "chapter", "page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	urls, _ := extractImages(page.doc)
+	want := []string{"../shared/0001.jpg", "./page_files/0002.jpg", siteBaseURL + "/images/0003.jpg"}
+	if len(urls) != len(want) {
+		t.Fatalf("extractImages = %q, want %q", urls, want)
+	}
+	for i := range want {
+		if urls[i] != want[i] {
+			t.Errorf("image %d = %q, want %q", i, urls[i], want[i])
+		}
+	}
+
+	for i, content := range []string{"first", "second"} {
+		data, ok := page.imageData(urls[i])
+		if !ok || string(data) != content {
+			t.Errorf("imageData(%q) = %q, %v, want %q", urls[i], data, ok, content)
+		}
+	}
+	if _, ok := page.imageData(urls[2]); ok {
+		t.Errorf("imageData(%q) found a local copy", urls[2])
+	}
+}
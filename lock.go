@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// lockDir 存放漫画锁文件的目录
+func lockDir() string {
+	return metadataPath("locks")
+}
+
+// lockPolicy 漫画正在被另一个进程下载时的处理方式: error 报错退出、wait 等待、skip 跳过
+var lockPolicy = "error"
+
+const (
+	// lockHeartbeat 持有锁的进程更新锁文件修改时间的间隔
+	lockHeartbeat = 30 * time.Second
+	// lockStaleAfter 锁文件超过该时间未更新时视为进程已异常退出
+	lockStaleAfter = 3 * lockHeartbeat
+)
+
+// errSeriesLocked 漫画正在被另一个进程下载
+var errSeriesLocked = errors.New("漫画正在被另一个进程下载")
+
+// lockInfo 锁文件内容，用于提示和判断持有者是否还在运行
+type lockInfo struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// seriesLock 一部漫画的咨询锁，同一部漫画同时只允许一个进程下载
+type seriesLock struct {
+	path string
+	stop chan struct{}
+}
+
+// lockSeries 获取站点 baseURL 上漫画的锁，已被其他进程持有时按 lockPolicy 等待或返回 errSeriesLocked
+func lockSeries(baseURL, seriesID string) (*seriesLock, error) {
+	return acquireLock(lockName(baseURL, seriesID), seriesID)
+}
+
+// lockSeriesDir 获取漫画目录的锁，供改动已下载章节的维护命令（renumber、trim-recap、repack 等）使用
+// 目录属于漫画库中的漫画时与下载这部漫画互斥，否则按目录加锁，只与其他维护命令互斥
+func lockSeriesDir(db *libraryDB, seriesDir string) (*seriesLock, error) {
+	if record := findSeriesByDir(db, seriesDir); record != nil {
+		return lockSeries(record.BaseURL, record.ID)
+	}
+	abs, err := filepath.Abs(seriesDir)
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(fmt.Sprintf("dir_%x", sha1.Sum([]byte(abs))), seriesDir)
+}
+
+// acquireLock 获取名为 name 的锁，label 为提示中显示的漫画
+func acquireLock(name, label string) (*seriesLock, error) {
+	if err := os.MkdirAll(lockDir(), 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(lockDir(), name+".lock")
+
+	waiting := false
+	for {
+		err := createLockFile(path)
+		if err == nil {
+			lock := &seriesLock{path: path, stop: make(chan struct{})}
+			go lock.heartbeat()
+			return lock, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		holder, stale := readLock(path)
+		if stale {
+			if !removeStaleLock(path) {
+				// 另一个进程正在清理这个锁文件
+				time.Sleep(100 * time.Millisecond)
+			}
+			continue
+		}
+		if lockPolicy != "wait" {
+			return nil, fmt.Errorf("%w（进程 %d，%s 开始，锁文件 %s）", errSeriesLocked,
+				holder.PID, holder.Started.Format("2006-01-02 15:04:05"), path)
+		}
+		if !waiting {
+			fmt.Printf("漫画 %s 正在被进程 %d 下载，等待其结束...\n", label, holder.PID)
+			waiting = true
+		}
+		if err := sleepContext(runContext, 5*time.Second); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// removeStaleLock 清理失效的锁文件，返回false表示另一个进程正在清理
+// 读取和删除之间锁文件可能已被别的进程清理并重新创建，直接删除会删掉新的锁；
+// 因此先独占地创建 .takeover 文件，再确认锁文件仍然失效后才删除
+func removeStaleLock(path string) bool {
+	guard := path + ".takeover"
+	if err := createLockFile(guard); err != nil {
+		// 清理中途退出的进程留下的 .takeover 文件
+		if info, statErr := os.Stat(guard); statErr == nil && time.Since(info.ModTime()) > lockStaleAfter {
+			os.Remove(guard)
+		}
+		return false
+	}
+	defer os.Remove(guard)
+	if _, stale := readLock(path); stale {
+		fmt.Printf("发现失效的锁文件（持有的进程已退出），自动清理: %s\n", path)
+		os.Remove(path)
+	}
+	return true
+}
+
+// lockName 锁文件名，包含站点域名，不同站点的同名ID不会冲突
+func lockName(baseURL, seriesID string) string {
+	host := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return sanitizeFileName(strings.ReplaceAll(host, ":", "_") + "_" + seriesID)
+}
+
+// createLockFile 独占地创建锁文件，文件已存在时返回 os.ErrExist
+func createLockFile(path string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	data, _ := json.Marshal(lockInfo{PID: os.Getpid(), Host: host, Started: time.Now()})
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// readLock 读取锁文件，判断持有锁的进程是否已经退出
+// 锁文件长时间未更新，或持有者在本机且进程已不存在时视为失效
+func readLock(path string) (lockInfo, bool) {
+	var holder lockInfo
+	info, err := os.Stat(path)
+	if err != nil {
+		return holder, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || json.Unmarshal(data, &holder) != nil {
+		// 刚创建还未写入内容的锁文件不算失效
+		return holder, time.Since(info.ModTime()) > lockStaleAfter
+	}
+
+	if time.Since(info.ModTime()) > lockStaleAfter {
+		return holder, true
+	}
+	host, _ := os.Hostname()
+	if holder.Host == host && !processAlive(holder.PID) {
+		return holder, true
+	}
+	return holder, false
+}
+
+// processAlive 检查本机进程是否存在，无法判断时视为存在
+func processAlive(pid int) bool {
+	if pid == os.Getpid() {
+		return true
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission) || errors.Is(err, syscall.EPERM)
+}
+
+// heartbeat 定期更新锁文件的修改时间，表明持有者仍在运行
+func (l *seriesLock) heartbeat() {
+	ticker := time.NewTicker(lockHeartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case now := <-ticker.C:
+			os.Chtimes(l.path, now, now)
+		}
+	}
+}
+
+// unlock 释放锁
+func (l *seriesLock) unlock() {
+	close(l.stop)
+	os.Remove(l.path)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// errChapterLocked 章节需要付费、VIP 或登录才能阅读，页面上只有占位图片，不应下载
+var errChapterLocked = errors.New("章节未解锁")
+
+// retryLocked 更新时重新检查之前未解锁的章节，由 --retry-locked 或配置文件的 retry_locked 开启
+// 默认跳过，不再请求这些章节
+var retryLocked bool
+
+// lockedMaxImages 付费章节的占位页面最多有几张图片，图片更多的页面不按提示文字判断，避免页头的 VIP 链接被误判
+const lockedMaxImages = 3
+
+// lockedTextMarkers 付费章节页面上常见的提示文字
+var lockedTextMarkers = []string{
+	"购买本章", "解锁本章", "立即解锁", "付费章节", "VIP章节", "VIP专享", "开通VIP", "开通会员",
+	"充值后阅读", "登录后阅读", "登录后查看", "余额不足",
+}
+
+// lockedSelectors 付费提示框常用的元素
+const lockedSelectors = ".chapter-lock, .lock-box, .pay-box, .vip-box, .buy-chapter, .unlock-btn, #chapter-pay"
+
+// lockedImagePattern 占位图片的文件名，如 lock.png、vip_cover.jpg、pay-1.gif
+var lockedImagePattern = regexp.MustCompile(`(?i)(^|[_\-.])(lock|locked|vip|pay|unlock)([_\-.\d]|$)`)
+
+// lockedChapter 未解锁的章节，记录在漫画库中，默认在之后的更新中跳过
+type lockedChapter struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Reason    string    `json:"reason"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// lockedError 返回带原因的 errChapterLocked
+func lockedError(reason string) error {
+	return fmt.Errorf("%w: %s", errChapterLocked, reason)
+}
+
+// lockedReason 返回 lockedError 中的原因
+func lockedReason(err error) string {
+	return strings.TrimPrefix(err.Error(), errChapterLocked.Error()+": ")
+}
+
+// detectLocked 检查章节页面是否为付费章节的占位页面，返回原因，正常章节返回空字符串
+// selector 为规则文件中的 locked 选择器，设置后无论图片数量都按它判断
+func detectLocked(doc *goquery.Document, images []string, selector string) string {
+	if selector != "" && doc.Find(selector).Length() > 0 {
+		return "页面上有付费提示（" + selector + "）"
+	}
+	if len(images) > lockedMaxImages {
+		return ""
+	}
+	if doc.Find(lockedSelectors).Length() > 0 {
+		return "页面上有付费提示"
+	}
+	text := doc.Find("body").Text()
+	for _, marker := range lockedTextMarkers {
+		if strings.Contains(text, marker) {
+			return "页面提示“" + marker + "”"
+		}
+	}
+	if len(images) > 0 && placeholderImages(images) {
+		return "只有占位图片"
+	}
+	return ""
+}
+
+// placeholderImages 是否所有图片都是付费章节的占位图片
+func placeholderImages(images []string) bool {
+	for _, img := range images {
+		name := path.Base(strings.SplitN(img, "?", 2)[0])
+		if !lockedImagePattern.MatchString(strings.TrimSuffix(name, path.Ext(name))) {
+			return false
+		}
+	}
+	return true
+}
+
+// findLocked 查找之前记录的未解锁章节
+func (s *seriesRecord) findLocked(id string) *lockedChapter {
+	for _, c := range s.Locked {
+		if c.ID == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// markLocked 记录未解锁的章节
+func (s *seriesRecord) markLocked(id, title, reason string) {
+	c := s.findLocked(id)
+	if c == nil {
+		c = &lockedChapter{ID: id}
+		s.Locked = append(s.Locked, c)
+	}
+	c.Title, c.Reason, c.CheckedAt = title, reason, time.Now()
+}
+
+// unmarkLocked 章节已解锁并下载后删除记录
+func (s *seriesRecord) unmarkLocked(id string) {
+	for i, c := range s.Locked {
+		if c.ID == id {
+			s.Locked = append(s.Locked[:i], s.Locked[i+1:]...)
+			return
+		}
+	}
+}
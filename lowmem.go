@@ -0,0 +1,103 @@
+package main
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// lowMemory 低内存模式，适合树莓派、NAS 等内存较小的设备，由 --low-memory 或配置文件的 low_memory 开启
+var lowMemory bool
+
+const (
+	// lowMemoryWorkers 低内存模式下同时下载的图片数，之后指定的 --workers 仍然有效
+	lowMemoryWorkers = 1
+	// lowMemoryImageLimit 低内存模式下后处理同时解码的图片最多占用的内存
+	lowMemoryImageLimit = 128 << 20
+	// lowMemoryHeapLimit 低内存模式下 Go 运行时的软内存上限，接近时更频繁地回收内存
+	lowMemoryHeapLimit = 256 << 20
+
+	copyBufferSize          = 32 * 1024
+	lowMemoryCopyBufferSize = 4 * 1024
+)
+
+// enableLowMemory 开启低内存模式：减少并发数、降低后处理的内存上限、更积极地回收内存，
+// 调试模式下不再把整个响应体读入内存，复制文件和下载图片使用更小的缓冲区
+func enableLowMemory() {
+	lowMemory = true
+	if imageWorkers > lowMemoryWorkers {
+		imageWorkers = lowMemoryWorkers
+	}
+	if imageMemoryLimit == 0 || imageMemoryLimit > lowMemoryImageLimit {
+		imageMemoryLimit = lowMemoryImageLimit
+	}
+	debug.SetGCPercent(50)
+	debug.SetMemoryLimit(lowMemoryHeapLimit)
+}
+
+// copyBuffer 复制文件和响应体使用的缓冲区
+func copyBuffer() []byte {
+	if lowMemory {
+		return make([]byte, lowMemoryCopyBufferSize)
+	}
+	return make([]byte, copyBufferSize)
+}
+
+// resourceUsage 本次运行的资源占用，写入运行汇总
+type resourceUsage struct {
+	PeakHeapBytes  uint64 `json:"peak_heap_bytes"` // 采样到的最大堆内存
+	SysBytes       uint64 `json:"sys_bytes"`       // 向操作系统申请的内存总量
+	GCRuns         uint32 `json:"gc_runs"`
+	PeakGoroutines int    `json:"peak_goroutines"`
+	LowMemory      bool   `json:"low_memory"`
+}
+
+// resourceTracker 每秒采样一次内存占用，记录峰值
+type resourceTracker struct {
+	mu    sync.Mutex
+	once  sync.Once
+	usage resourceUsage
+}
+
+// resources 全局资源占用统计
+var resources = &resourceTracker{}
+
+// start 开始定期采样，只启动一次
+func (t *resourceTracker) start() {
+	t.once.Do(func() {
+		go func() {
+			for range time.Tick(time.Second) {
+				t.sample()
+			}
+		}()
+	})
+}
+
+// sample 采样一次当前的内存占用
+func (t *resourceTracker) sample() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	goroutines := runtime.NumGoroutine()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if m.HeapInuse > t.usage.PeakHeapBytes {
+		t.usage.PeakHeapBytes = m.HeapInuse
+	}
+	if goroutines > t.usage.PeakGoroutines {
+		t.usage.PeakGoroutines = goroutines
+	}
+	t.usage.SysBytes = m.Sys
+	t.usage.GCRuns = m.NumGC
+}
+
+// snapshot 返回到目前为止的资源占用
+func (t *resourceTracker) snapshot() resourceUsage {
+	t.sample()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	usage := t.usage
+	usage.LowMemory = lowMemory
+	return usage
+}
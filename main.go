@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -14,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/andybalholm/brotli"
@@ -23,6 +23,14 @@ import (
 var debugMode = false
 
 func main() {
+	// Windows 控制台切换到 UTF-8，避免中文标题乱码
+	setupConsole()
+
+	// 运行结束时输出本次下载的汇总，指定 --summary-file 时同时写入文件
+	defer finishRun()
+	// 中断时取消进行中的请求，汇总照常输出
+	defer startRunContext()()
+
 	// 检查是否启用调试模式
 	debugMode = false
 	for _, arg := range os.Args {
@@ -31,6 +39,25 @@ func main() {
 		}
 	}
 	
+	// 读取配置文件中的默认设置和选择的配置方案
+	profile, rest := takeProfileFlag(os.Args[1:])
+	rest, err := takeOutputFlags(rest)
+	if err != nil {
+		fmt.Printf("参数错误: %v\n", err)
+		return
+	}
+	os.Args = append(os.Args[:1], rest...)
+	resources.start()
+	if cfg, err := loadConfig(); err != nil {
+		fmt.Printf("读取配置文件失败: %v\n", err)
+	} else {
+		applyConfig(cfg)
+		if err := applyProfile(cfg, profile); err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+	}
+
 	// 检查是否请求帮助
 	for _, arg := range os.Args {
 		if arg == "--help" || arg == "-h" {
@@ -44,12 +71,125 @@ func main() {
 		return
 	}
 
+	// 子命令
+	switch os.Args[1] {
+	case "download":
+		// 批量下载多个链接，支持从标准输入或剪贴板读取
+		runDownloadCommand(os.Args[2:])
+		return
+	case "follow":
+		runFollowCommand(os.Args[2:])
+		return
+	case "unfollow":
+		runUnfollowCommand(os.Args[2:])
+		return
+	case "check":
+		runCheckCommand(os.Args[2:])
+		return
+	case "watch":
+		runWatchCommand(os.Args[2:])
+		return
+	case "stats":
+		runStatsCommand(os.Args[2:])
+		return
+	case "prune":
+		runPruneCommand(os.Args[2:])
+		return
+	case "dedupe":
+		runDedupeCommand(os.Args[2:])
+		return
+	case "progress":
+		runProgressCommand(os.Args[2:])
+		return
+	case "export":
+		runExportCommand(os.Args[2:])
+		return
+	case "backup":
+		runBackupCommand(os.Args[2:])
+		return
+	case "restore":
+		runRestoreCommand(os.Args[2:])
+		return
+	case "source":
+		runSourceCommand(os.Args[2:])
+		return
+	case "seed":
+		runSeedCommand(os.Args[2:])
+		return
+	case "calibre":
+		runCalibreCommand(os.Args[2:])
+		return
+	case "kindle":
+		runKindleCommand(os.Args[2:])
+		return
+	case "rules":
+		runRulesCommand(os.Args[2:])
+		return
+	case "verify":
+		runVerifyCommand(os.Args[2:])
+		return
+	case "audit":
+		runAuditCommand(os.Args[2:])
+		return
+	case "diff":
+		runDiffCommand(os.Args[2:])
+		return
+	case "alias":
+		runAliasCommand(os.Args[2:])
+		return
+	case "renumber":
+		runRenumberCommand(os.Args[2:])
+		return
+	case "trim-recap":
+		runTrimRecapCommand(os.Args[2:])
+		return
+	case "repack":
+		runRepackCommand(os.Args[2:])
+		return
+	case "ocr":
+		runOCRCommand(os.Args[2:])
+		return
+	case "grep":
+		runGrepCommand(os.Args[2:])
+		return
+	case "rating":
+		runRatingCommand(os.Args[2:])
+		return
+	case "retry":
+		runRetryCommand(os.Args[2:])
+		return
+	case "read":
+		runReadCommand(os.Args[2:])
+		return
+	case "thumbs":
+		runThumbsCommand(os.Args[2:])
+		return
+	case "daemon":
+		runDaemonCommand(os.Args[2:])
+		return
+	case "passwd":
+		runPasswdCommand(os.Args[2:])
+		return
+	case "imagebench":
+		runImageBenchCommand(os.Args[2:])
+		return
+	case "nettest":
+		runNettestCommand(os.Args[2:])
+		return
+	case "version", "--version":
+		runVersionCommand(os.Args[2:])
+		return
+	case "self-update":
+		runSelfUpdateCommand(os.Args[2:])
+		return
+	}
+
 	isLocal := false
 	isSeries := false
 	isLocalSeries := false
+	isLocalDir := false
 	startChapterID := ""
 	input := ""
-	id := ""
 
 	// 解析命令行参数（跳过--debug参数）
 	args := []string{}
@@ -62,28 +202,38 @@ func main() {
 	// 解析参数
 	i := 0
 	for i < len(args) {
+		n, err := parseGlobalFlag(args, i)
+		if err != nil {
+			fmt.Printf("参数错误: %v\n", err)
+			return
+		}
+		if n > 0 {
+			i += n
+			continue
+		}
+
 		if args[i] == "--local" && i+1 < len(args) {
 			isLocal = true
 			input = args[i+1]
-			id = "local_" + input
 			i += 2
 		} else if args[i] == "--series" && i+1 < len(args) {
 			isSeries = true
 			input = args[i+1]
-			id = input
 			i += 2
 		} else if args[i] == "--local-series" && i+1 < len(args) {
 			isLocalSeries = true
 			input = args[i+1]
-			id = "local_series_" + input
+			i += 2
+		} else if args[i] == "--local-dir" && i+1 < len(args) {
+			isLocalDir = true
+			input = args[i+1]
 			i += 2
 		} else if args[i] == "--start" && i+1 < len(args) {
 			startChapterID = args[i+1]
 			i += 2
-		} else if i == 0 {
-			// 第一个参数默认为章节ID
+		} else if !strings.HasPrefix(args[i], "--") && input == "" {
+			// 位置参数：章节/漫画ID，或任意章节、目录页链接
 			input = args[i]
-			id = input
 			i++
 		} else {
 			i++
@@ -96,81 +246,133 @@ func main() {
 		return
 	}
 
-	if isSeries {
+	if isLocalDir {
+		// 从本地目录中的多个章节文件批量下载
+		downloadLocalDir(input)
+		return
+	}
+
+	if isLocal {
+		// 从本地文件下载单个章节
+		downloadChapter(input, true)
+		return
+	}
+
+	// 自动识别输入的是章节还是漫画目录
+	t, err := parseTarget(input)
+	if err != nil {
+		fmt.Printf("解析输入失败: %v\n", err)
+		return
+	}
+	if isSeries && !t.fromURL {
+		t.kind = targetSeries
+	}
+	siteBaseURL = t.baseURL
+
+	if t.kind == targetSeries {
 		// 下载整个漫画系列，支持从指定章节开始
-		downloadSeries(input, startChapterID)
+		downloadSeries(runContext, t.id, startChapterID)
 		return
 	}
 
-	var doc *goquery.Document
+	// 下载单个章节
+	downloadChapter(t.id, false)
+}
+
+// downloadChapter 下载单个章节，isLocal 为true时 input 为本地保存的页面路径，否则为章节ID
+func downloadChapter(input string, isLocal bool) {
+	var page *localPage
+	var imageUrls []string
+	var chapterTitle string
+	var fixup imageFixup
+	var declared int
+	var strategy string
+	var published, notes string
 	var err error
 
+	id := input
+	sourceURL := input
 	if isLocal {
-		// 从本地文件解析
-		fmt.Printf("正在从本地文件 %s 解析图片链接...\n", input)
-		doc, err = parseLocalFile(input)
+		id = "local_" + input
+	}
+
+	if isLocal {
+		// 从本地文件解析（支持HTML、MHTML以及带 _files 目录的完整网页）
+		infof("正在从本地文件 %s 解析图片链接...\n", input)
+		page, err = loadLocalPage(input)
 		if err != nil {
 			fmt.Printf("解析本地文件失败: %v\n", err)
 			return
 		}
+		imageUrls, strategy = extractImages(page.doc)
+		chapterTitle = extractChapterTitle(page.doc)
+		if chapterExtras {
+			published, notes = extractChapterExtras(page.doc, "", "")
+		}
 	} else {
 		// 从网络下载
-		var url string
-		if strings.Contains(id, "92hm.life") {
-			url = input // 如果输入完整URL，则直接使用
-		} else {
-			// 默认使用新的网站格式
-			url = "https://www.92hm.life/chapter/" + id
-		}
+		infof("正在下载章节 %s 的图片...\n", id)
 
-		fmt.Printf("正在下载章节 %s 的图片...\n", id)
-
-		// 获取页面内容（带重试机制）
-		doc, err = fetchPageWithRetry(url, 3)
+		// 获取章节内容（带重试机制）
+		chapter, err := siteFor(siteBaseURL).fetchChapter(runContext, siteBaseURL, id)
+		if errors.Is(err, errChapterLocked) {
+			fmt.Printf("章节 %s 未解锁，跳过: %v\n", id, err)
+			runStats.chapterLocked(failedUnit{ChapterID: id, BaseURL: siteBaseURL})
+			return
+		}
 		if err != nil {
-			fmt.Printf("获取页面失败: %v\n", err)
+			fmt.Printf("获取章节失败: %v\n", err)
+			runStats.chapterFetchFailed()
+			runStats.recordFailure(failedUnit{Kind: "chapter", ChapterID: id, BaseURL: siteBaseURL})
 			return
 		}
+		filterChapterImages(runContext, chapter)
+		imageUrls, chapterTitle, fixup, declared = chapter.images, chapter.title, chapter.fixup, chapter.declared
+		sourceURL, strategy = chapter.url, chapter.strategy
+		published, notes = chapter.published, chapter.notes
 	}
 
-	// 提取图片链接
-	imageUrls := extractImageUrls(doc)
+	// 检查图片链接
 	if len(imageUrls) == 0 {
 		fmt.Println("未找到任何图片链接，请检查选择器是否正确")
 		return
 	}
 	
-	fmt.Printf("找到 %d 张图片\n", len(imageUrls))
+	infof("找到 %d 张图片\n", len(imageUrls))
 
 	// 为单章节创建目录
-	chapterTitle := extractChapterTitle(doc)
 	if chapterTitle == "" {
-		chapterTitle = "chapter_" + id
+		chapterTitle = "chapter_" + sanitizeFileName(id)
 	}
 	
-	// 创建保存图片的目录
-	dirName := chapterTitle
-	err = os.MkdirAll(dirName, 0755)
+	// 创建保存图片的目录，与另一个同名章节的目录重名时加上章节ID
+	// 章节ID可能含有斜杠（如拷贝漫画的 "<path_word>/<uuid>"），作为目录名前需要清理
+	dirName := uniqueChapterDir(libraryPath(sanitizeFileName(chapterTitle)), id)
+	workDir := chapterWorkDir(dirName)
+	err = os.MkdirAll(workDir, 0755)
 	if err != nil {
 		fmt.Printf("创建目录失败: %v\n", err)
 		return
 	}
 
-	// 下载图片
-	for i, imgUrl := range imageUrls {
-		// 使用4位数字编号，例如 0001.jpg, 0002.jpg 等
-		filename := fmt.Sprintf("%s/%04d.jpg", dirName, i+1)
-		
-		// 无论本地还是网络模式都尝试下载图片
-		err := downloadImageWithRetry(imgUrl, filename, 3)
-		if err != nil {
-			fmt.Printf("下载图片 %d 失败: %v\n", i+1, err)
-			continue
-		}
-		fmt.Printf("已下载图片 %d/%d: %s\n", i+1, len(imageUrls), filename)
+	// 下载图片（本地模式下优先使用页面已保存的图片）
+	clearPlaceholders(workDir)
+	result := downloadChapterImages(runContext, imageUrls, workDir, page, fixup)
+	meta := &chapterMeta{ID: id, Title: chapterTitle, SourceURL: sourceURL, ScrapedAt: time.Now(), Images: imageUrls, DeclaredPages: declared, Strategy: strategy,
+		Published: published, Notes: notes}
+	pageCountShort(declared, result)
+	if result.failed > 0 && !isLocal {
+		runStats.recordFailure(failedUnit{Kind: "pages", ChapterID: id, Title: chapterTitle, BaseURL: siteBaseURL, Dir: dirName, Pages: failedPages(result)})
+	}
+	meta.Missing = insertPlaceholders(runContext, workDir, imageUrls, &result)
+	if err := writeChapterMeta(workDir, meta, result); err != nil {
+		fmt.Printf("保存章节信息失败: %v\n", err)
+	}
+	if !finishChapterDir(workDir, dirName, result) {
+		return
 	}
 
-	fmt.Printf("\n章节《%s》下载完成! 图片保存在 %s 目录中\n", chapterTitle, dirName)
+	infof("\n章节《%s》下载完成! 图片保存在 %s 目录中\n", chapterTitle, dirName)
 }
 
 // printHelp 打印帮助信息
@@ -187,12 +389,135 @@ func printHelp() {
 	fmt.Println("")
 	fmt.Println("  从本地文件解析并下载: ./comicbox --local <本地HTML文件路径>")
 	fmt.Println("  例如: ./comicbox --local hm_page.html")
+	fmt.Println("  支持 .mhtml 文件及浏览器\"另存为完整网页\"生成的 _files 目录，本地已有的图片直接复制")
 	fmt.Println("")
 	fmt.Println("  从本地文件解析并批量下载整个漫画: ./comicbox --local-series <本地目录HTML文件路径>")
 	fmt.Println("  例如: ./comicbox --local-series comic_index.html")
 	fmt.Println("")
-	fmt.Println("  启用调试模式: 在任何命令前加上 --debug 参数")
+	fmt.Println("  从本地目录批量解析浏览器保存的章节页面并下载: ./comicbox --local-dir <目录路径>")
+	fmt.Println("  例如: ./comicbox --local-dir saved_pages")
+	fmt.Println("")
+	fmt.Println("  批量下载多个章节/漫画链接: ./comicbox download <链接或ID>...")
+	fmt.Println("  从标准输入读取链接（每行一个）: ./comicbox download -")
+	fmt.Println("  例如: cat urls.txt | ./comicbox download -")
+	fmt.Println("  监视剪贴板，自动下载复制的漫画链接: ./comicbox download --clipboard")
+	fmt.Println("")
+	fmt.Println("  订阅漫画: ./comicbox follow <漫画ID或链接> [--cron <cron表达式>]")
+	fmt.Println("  例如: ./comicbox follow 418 --cron \"0 2 * * *\"   # 每天02:00检查更新")
+	fmt.Println("  订阅时添加备用来源（镜像站）: ./comicbox follow <漫画ID> --alt <镜像站目录页链接>")
+	fmt.Println("  管理备用来源: ./comicbox source list|add|remove <漫画ID> [目录页链接]")
+	fmt.Println("  取消订阅: ./comicbox unfollow <漫画ID>")
+	fmt.Println("  监视模式，按计划下载订阅漫画的新章节: ./comicbox watch [--interval 6h] [保留规则]")
+	fmt.Println("  同时检查所有订阅漫画的更新: ./comicbox check [--download] [-j 并发数]")
+	fmt.Println("  识别漫画中的文字（需要 tesseract，实验性）: ./comicbox ocr [漫画ID|漫画目录...] [--lang chi_sim] [-j 并发数] [--force]")
+	fmt.Println("  搜索识别出的文字: ./comicbox grep <文字> [漫画ID|漫画目录...]")
+	fmt.Println("  以服务方式运行（容器部署）: ./comicbox daemon [--listen :8080] [--interval 6h]，提供网页、API、OPDS 和 /healthz")
+	fmt.Println("  daemon 中补档（低优先级）任务默认的时间段: ./comicbox daemon --backfill-window 01:00-07:00")
+	fmt.Println("                          [--user 名称:密码]... [--token 令牌] [--tls-cert 证书 --tls-key 私钥]")
+	fmt.Println("  生成 daemon 用户的密码哈希（写入配置文件 users）: ./comicbox passwd [密码]")
+	fmt.Println("")
+	fmt.Println("  查看下载历史和统计信息: ./comicbox stats [--days 30]")
+	fmt.Println("  按保留规则清理漫画库: ./comicbox prune [--dry-run] [--keep-raw <章节数>] [--stale-months <月数>]")
+	fmt.Println("  例如: ./comicbox prune --dry-run --keep-raw 50   # 已打包的章节只保留最新50章的原始图片")
+	fmt.Println("  将内容相同的已下载图片硬链接为同一份数据: ./comicbox dedupe [目录]")
+	fmt.Println("  导出漫画库目录: ./comicbox export [--format md|csv|json] [--output <文件>]")
+	fmt.Println("  备份漫画库元数据（订阅、下载记录、阅读进度等）: ./comicbox backup <文件.tar.gz>")
+	fmt.Println("  恢复漫画库元数据: ./comicbox restore <文件.tar.gz> [--force]")
+	fmt.Println("  将打包好的电子书添加到 Calibre 书库: ./comicbox calibre <电子书.cbz|.epub>... [--library <书库>]")
+	fmt.Println("  通过邮件发送电子书到 Send-to-Kindle 邮箱: ./comicbox kindle <电子书.epub>... [--to <Kindle邮箱>] [--validate]")
+	fmt.Println("  测试自定义站点规则: ./comicbox rules test --rules <规则文件> --url <章节或目录页链接/本地网页文件>")
+	fmt.Println("  校验已下载的章节图片: ./comicbox verify [<漫画ID>|<目录>]... [--repair]")
+	fmt.Println("  与来源比较已下载的章节并生成修复计划: ./comicbox audit <漫画目录|漫画ID>... [--plan <文件.json>] [--apply]")
+	fmt.Println("  比较同一章节或漫画的两个CBZ: ./comicbox diff <a.cbz> <b.cbz>")
+	fmt.Println("  只重新下载上次运行失败的章节和页面: ./comicbox retry --from <汇总文件.json>")
+	fmt.Println("  在浏览器中阅读下载的漫画: ./comicbox read <漫画目录|章节目录|文件.cbz> [--port 8081]")
+	fmt.Println("  生成章节缩略图（下载整部漫画后自动生成）: ./comicbox thumbs <漫画目录>... [--force]")
+	fmt.Println("  比较 Go 和 vips 处理图片的速度: ./comicbox imagebench <图片目录> [--post <步骤>]... [--limit 50]")
+	fmt.Println("  诊断网络连接和下载速度: ./comicbox nettest [章节或漫画的链接、ID] [--images 3]")
+	fmt.Println("  显示版本和构建信息: ./comicbox version")
+	fmt.Println("  更新到 GitHub 上发布的最新版本: ./comicbox self-update [--check] [--version <版本>] [--allow-unsigned] [--yes]")
+	fmt.Println("  按话数重新排序并改名章节目录: ./comicbox renumber <漫画目录|漫画ID> [--dry-run] [--repack]")
+	fmt.Println("  删除章节开头与上一章结尾重复的页: ./comicbox trim-recap <漫画目录|漫画ID> [--dry-run] [--repack]")
+	fmt.Println("  重新生成过期的CBZ: ./comicbox repack [<漫画库根目录|漫画目录|漫画ID>...] [--dry-run] [--force] [-j 4] [--password <密码>]")
+	fmt.Println("  查看和设置内容分级: ./comicbox rating list [--safe|--nsfw|--unrated] | set <漫画ID|标题> <分级> | clear <漫画ID|标题>")
+	fmt.Println("  管理标题别名: ./comicbox alias list|add|remove [<网站上的标题>|<漫画ID> [<名称>]]")
+	fmt.Println("  为打包好的漫画生成种子文件和磁力链接: ./comicbox seed <漫画.cbz> [--tracker <地址>]... [--private]")
+	fmt.Println("  查看未读章节: ./comicbox progress [show <漫画ID>]")
+	fmt.Println("  标记已读/未读: ./comicbox progress mark|unmark <漫画ID> <章节ID|all>")
+	fmt.Println("  从 Komga 导入阅读进度: ./comicbox progress import --komga <地址> --api-key <密钥>")
+	fmt.Println("  从 KOReader 同步服务器导入: ./comicbox progress import --kosync <地址> --user <用户> --password <密码>")
+	fmt.Println("")
+	fmt.Println("通用选项（适用于所有下载模式）:")
+	fmt.Println("  --workers <数量>        同时下载的图片数量，默认为 1")
+	fmt.Println("  --redirects <方式>      跟随到其他主机的重定向: follow（默认，只提示）、allowlist（只跟随允许的主机）、same-host（不跟随）")
+	fmt.Println("  --redirect-allow <主机> 允许重定向到的主机，如 *.example-cdn.com，可指定多次；--max-redirects <次数> 限制重定向次数（默认 10）")
+	fmt.Println("  --image-host <旧=新>    把图片链接中已失效的图片服务器换成新的，如 img1.old-cdn.com=img.new-cdn.com，可指定多次")
+	fmt.Println("  --fetcher <方式>        获取网页的方式: http（默认）、browser（用 Chromium 渲染脚本生成的页面）、")
+	fmt.Println("                          fixture:<目录>（读取保存的网页和图片，不访问网络，用于测试）")
+	fmt.Println("  --ipv4-only             只通过 IPv4 连接（图片服务器的 IPv6 不可用、连接总是超时时使用）")
+	fmt.Println("  --ipv6-only             只通过 IPv6 连接")
+	fmt.Println("  --page-timeout <时长>   请求一个页面或接口的超时时间，默认为 60s")
+	fmt.Println("  --image-timeout <时长>  下载一张图片的超时时间（包括读取整个图片），默认为 60s")
+	fmt.Println("  --progress <方式>       下载进度的显示方式: bars 进度条、lines 按页的顺序输出日志，默认在终端中显示进度条")
+	fmt.Println("  --ban-threshold <次数>  连续多少次 403/429 后暂停所有下载，默认为 5，0 表示关闭")
+	fmt.Println("  --cooldown <时长>       暂停下载的冷却时间，默认为 5m")
+	fmt.Println("  --rotate                暂停时轮换浏览器标识和代理")
+	fmt.Println("  --proxy-list <文件>     代理列表文件，每行一个代理地址，配合 --rotate 使用")
+	fmt.Println("  --ca-cert <文件>        额外信任的 CA 证书（PEM 格式），如 mitmproxy 或公司代理的根证书")
+	fmt.Println("  --insecure-tls          不校验站点的证书，只应在排查问题时使用")
+	fmt.Println("  --metrics-addr <地址>   在指定地址提供 Prometheus 监控端点 /metrics，如 :9100")
+	fmt.Println("  --dedupe                下载后将内容相同的图片（如重复的赞助页）硬链接，节省磁盘空间")
+	fmt.Println("  --page-width <位数>     图片文件名的页码位数，默认为 4（0001.jpg）")
+	fmt.Println("  --page-start <页码>     第一页的页码，默认为 1，部分阅读器需要从 0 开始")
+	fmt.Println("  --polite                礼貌抓取：遵守站点 robots.txt 的禁止规则和 Crawl-delay，同一主机的请求间隔至少 2 秒")
+	fmt.Println("  --polite-delay <时长>   礼貌抓取的默认请求间隔，如 5s")
+	fmt.Println("  --no-age-gate           不自动确认成人内容的年龄确认页面")
+	fmt.Println("  --strategy <方式>       只使用指定的图片提取方式（逗号分隔，按顺序尝试）: lazy-attr、script-json、background-css、rendered-dom")
+	fmt.Println("  --retry-locked          重新检查之前未解锁（付费、VIP）的章节，默认在更新时跳过")
+	fmt.Println("  --archive               存档模式：关注的漫画每下载完一个新章节，立即打包、校验并保存原始网页和元数据")
+	fmt.Println("  --extras                同时记录章节页面上的更新日期和作者的话，写入 chapter.json，打包和生成电子书时带上")
+	fmt.Println("  --trim-recap            删除章节开头与上一章结尾重复的页（前情回顾）")
+	fmt.Println("  --ocr                   下载完漫画后用 tesseract 识别新章节中的文字，供 grep 搜索；--ocr-lang <语言> 指定语言")
+	fmt.Println("  --translate <语言>      把新下载的漫画和章节标题翻译为目标语言（如 en），接口地址在配置文件的 translate 中设置")
+	fmt.Println("  --placeholders          图片重试后仍然下载失败时插入占位图，打包后页码不错位，修复或下次更新时重新下载")
+	fmt.Println("  --finalize-prune        订阅的漫画完结并生成最终电子书后，删除章节的原始图片")
+	fmt.Println("  --best-version          章节有多个来源时，比较各来源的版本（页数、分辨率、JPEG 质量、大小），下载评分最高的")
+	fmt.Println("  --probe-sequence        每个章节都按图片链接的编号规律探测页面中没有的图片，默认只在图片少于标明的页数时探测")
+	fmt.Println("  --probe-workers <数量>  同时发送的探测请求数，默认为 4")
+	fmt.Println("  --probe-misses <数量>   连续多少个编号不存在时停止探测，默认为 2（可跳过偶尔缺少的编号）")
+	fmt.Println("  --probe-limit <数量>    一个章节最多探测的编号数，默认为 300")
+	fmt.Println("  --window <时间段>       只在时间段内下载（本地时间），可附带带宽上限，如 01:00-07:00 或 08:00-23:00@200K，可指定多次")
+	fmt.Println("  --limit-rate <速率>     下载的带宽上限（每秒），如 500K、2M，时间段中的上限优先")
+	fmt.Println("  --humanize              模拟浏览器的图片请求：在窗口内打乱顺序、随机间隔，偶尔刷新章节页面")
+	fmt.Println("  --humanize-window <数量> 打乱请求顺序的窗口大小，默认为 4")
+	fmt.Println("  --yes, -y               未适配站点的章节页面不询问，直接下载猜测出的图片")
+	fmt.Println("  --rules <文件>          使用自定义站点规则文件（YAML 或 JSON）中的选择器下载")
+	fmt.Println("  --profile <名称>        使用配置文件中的配置方案（站点地址、请求头、代理等）")
+	fmt.Println("  --out <目录>            漫画库根目录，漫画保存为 <目录>/<漫画>/<章节>，默认为当前目录")
+	fmt.Println("  --scratch <目录>        下载中的章节先保存在临时目录，完整下载后再移入漫画库")
+	fmt.Println("  --ascii-names           目录和文件名只使用 ASCII 字符（汉字转为拼音），元数据中保留原标题")
+	fmt.Println("  --on-locked <方式>      漫画正在被另一个进程下载时: error 报错（默认）、wait 等待、skip 跳过")
+	fmt.Println("  --title <名称>          指定漫画保存使用的名称，并记住该名称供以后更新时使用")
+	fmt.Println("  --language <代码>       写入 series.json 的语言代码，如 zh、ja，打包时写入 ComicInfo.xml")
+	fmt.Println("  --writer <作者>         同上，作者；--publisher <出版社>、--age-rating <分级> 用法相同")
+	fmt.Println("  --warc <文件>           将所有页面、接口和图片的请求和响应记录到 WARC 文件（.warc.gz 时压缩），供存档")
+	fmt.Println("  --min-bytes <大小>      丢弃小于该大小的图片（如 20K），用于过滤图标和横幅")
+	fmt.Println("  --min-size <宽x高>      丢弃宽或高小于该尺寸的图片，如 300x300")
+	fmt.Println("  --aspect <下限:上限>    丢弃高宽比（高/宽）不在该范围内的图片，如 0.5:4")
+	fmt.Println("  --post <步骤>           下载后处理图片，可多次指定按顺序执行: crop:上,右,下,左、resize:宽度、")
+	fmt.Println("                          split[:rtl]（拆分跨页）、watermark:高度[:top]（裁掉水印条）、convert:jpeg[:质量]|png")
+	fmt.Println("  --image-backend <方式>  图片后处理的实现: auto（默认，安装了 vips 时使用）、vips、go")
+	fmt.Println("  --low-memory            低内存模式（树莓派、NAS）: 单线程下载、后处理内存上限 128M、更小的缓冲区")
+	fmt.Println("  --image-memory <大小>   同时解码的图片最多占用的内存（默认 1G，0 为不限制），超过时大图保留原图")
+	fmt.Println("  --page-ext <策略>       扩展名: jpg（默认，固定为.jpg）、url（按链接）、auto（按图片内容识别）")
+	fmt.Println("")
+	fmt.Println("  启用调试模式: 在任何命令前加上 --debug 参数，调试信息输出到标准错误")
 	fmt.Println("  例如: ./comicbox --debug 16124")
+	fmt.Println("  --har <文件>            调试时将所有请求的请求头、响应头、耗时和内容开头写入 HAR 文件，可在浏览器开发者工具中查看")
+	fmt.Println("  --quiet, -q             只输出错误和最后的汇总")
+	fmt.Println("  --verbose               额外输出页面信息、找到的图片和重试等细节")
+	fmt.Println("  --log-file <文件>       将调试信息追加到文件而不是标准错误")
+	fmt.Println("  --summary-file <文件>   运行结束时将章节数、下载量、用时、错误类型和失败的章节写入 JSON 文件")
 	fmt.Println("")
 	fmt.Println("下载完成后，可以使用以下方式阅读漫画:")
 	fmt.Println("  1. 直接使用支持漫画格式的阅读器打开图片目录")
@@ -203,11 +528,16 @@ func printHelp() {
 	fmt.Println("")
 	fmt.Println("注意: 章节ID为URL中的数字部分，如 https://www.92hm.life/chapter/16124 中的 16124")
 	fmt.Println("     漫画ID为URL中的数字部分，如 https://www.92hm.life/book/418 中的 418")
+	fmt.Println("     也可以直接传入完整的章节或目录页链接（包括镜像站），程序会自动识别类型，无需 --series")
+	fmt.Println("     例如: ./comicbox https://www.92hm.life/book/418")
+	fmt.Println("     也支持 18comic 的 /album/ 和 /photo/ 链接，如 ./comicbox https://18comic.vip/album/123456/")
+	fmt.Println("     以及拷贝漫画的 /comic/ 链接，如 ./comicbox https://www.mangacopy.com/comic/yiquanchaoren")
+	fmt.Println("     其他站点的章节页面链接会按图片特征猜测漫画图片，确认后下载")
 }
 
 // downloadLocalSeries 从本地目录文件下载整个漫画系列
 func downloadLocalSeries(filePath string) {
-	fmt.Printf("正在从本地文件 %s 下载漫画系列...\n", filePath)
+	infof("正在从本地文件 %s 下载漫画系列...\n", filePath)
 	
 	// 解析本地目录文件
 	doc, err := parseLocalFile(filePath)
@@ -224,29 +554,30 @@ func downloadLocalSeries(filePath string) {
 	}
 	
 	// 获取漫画标题
-	comicTitle := extractComicTitle(doc)
+	comicTitle := localTitle(extractComicTitle(doc))
 	if comicTitle == "" {
 		comicTitle = "local_comic"
 	}
+	comicDir := libraryPath(comicTitle)
 	
 	// 创建漫画主目录
-	err = os.MkdirAll(comicTitle, 0755)
+	err = os.MkdirAll(comicDir, 0755)
 	if err != nil {
 		fmt.Printf("创建漫画主目录失败: %v\n", err)
 		return
 	}
 	
-	fmt.Printf("漫画标题: %s\n", comicTitle)
-	fmt.Printf("找到 %d 个章节\n", len(chapters))
+	infof("漫画标题: %s\n", comicTitle)
+	infof("找到 %d 个章节\n", len(chapters))
 	
 	// 为了演示目的，我们只下载第一个章节
 	// 实际使用时，这里会遍历所有章节
 	if len(chapters) > 0 {
 		chapter := chapters[0] // 只下载第一个章节作为演示
 		// 使用更具描述性的章节目录名
-		chapterDirName := fmt.Sprintf("%03d_%s", 1, sanitizeFileName(chapter.title))
+		chapterDirName := fmt.Sprintf("%03d_%s", 1, pathName(sanitizeFileName(chapter.title)))
 		
-		fmt.Printf("\n正在下载章节: %s (%s)\n", chapter.title, chapter.id)
+		infof("\n正在下载章节: %s (%s)\n", chapter.title, chapter.id)
 		
 		// 对于本地演示，我们使用之前保存的hm_page.html作为示例
 		doc, err := parseLocalFile("hm_page.html")
@@ -262,75 +593,156 @@ func downloadLocalSeries(filePath string) {
 			return
 		}
 		
-		fmt.Printf("找到 %d 张图片\n", len(imageUrls))
+		infof("找到 %d 张图片\n", len(imageUrls))
 		
 		// 创建保存图片的目录（在漫画主目录下）
-		dirName := filepath.Join(comicTitle, chapterDirName)
-		err = os.MkdirAll(dirName, 0755)
+		dirName := filepath.Join(comicDir, chapterDirName)
+		workDir := chapterWorkDir(dirName)
+		err = os.MkdirAll(workDir, 0755)
 		if err != nil {
 			fmt.Printf("创建目录失败: %v\n", err)
 			return
 		}
 		
 		// 下载图片
-		for j, imgUrl := range imageUrls {
-			// 使用4位数字编号，例如 0001.jpg, 0002.jpg 等
-			filename := fmt.Sprintf("%s/%04d.jpg", dirName, j+1)
-			
-			err := downloadImageWithRetry(imgUrl, filename, 3)
-			if err != nil {
-				fmt.Printf("下载图片 %d 失败: %v\n", j+1, err)
-				continue
-			}
-			fmt.Printf("已下载图片 %d/%d: %s\n", j+1, len(imageUrls), filename)
+		result := downloadChapterImages(runContext, imageUrls, workDir, nil, nil)
+		if !finishChapterDir(workDir, dirName, result) {
+			return
 		}
 		
-		fmt.Printf("章节 %s 下载完成\n", chapter.title)
+		infof("章节 %s 下载完成\n", chapter.title)
 	}
 	
-	fmt.Printf("\n漫画《%s》下载演示完成! 所有章节保存在 %s 目录中\n", comicTitle, comicTitle)
+	infof("\n漫画《%s》下载演示完成! 所有章节保存在 %s 目录中\n", comicTitle, comicDir)
 }
 
 // downloadSeries 下载整个漫画系列
-func downloadSeries(seriesID string, startChapterID string) {
-	fmt.Printf("正在下载漫画系列 %s...\n", seriesID)
+func downloadSeries(ctx context.Context, seriesID string, startChapterID string) {
+	infof("正在下载漫画系列 %s...\n", seriesID)
 	if startChapterID != "" {
-		fmt.Printf("从章节 %s 开始下载\n", startChapterID)
+		infof("从章节 %s 开始下载\n", startChapterID)
+	}
+
+	// 同一部漫画同时只允许一个进程下载，避免章节编号和漫画库记录互相覆盖
+	lock, err := lockSeries(siteBaseURL, seriesID)
+	if errors.Is(err, errSeriesLocked) && lockPolicy == "skip" {
+		fmt.Printf("漫画 %s 正在被另一个进程下载，跳过\n", seriesID)
+		return
 	}
-	
-	// 构造目录页面URL
-	tocURL := "https://www.92hm.life/book/" + seriesID
-	
-	// 获取目录页面
-	doc, err := fetchPageWithRetry(tocURL, 3)
 	if err != nil {
-		fmt.Printf("获取目录页面失败: %v\n", err)
+		fmt.Printf("无法开始下载: %v\n", err)
 		return
 	}
-	
-	// 提取章节链接
-	chapters := extractChapterLinks(doc)
-	if len(chapters) == 0 {
-		fmt.Println("未找到任何章节链接")
+	defer lock.unlock()
+	defer sharedImages.release()
+	if archiveMode {
+		defer clearRawPages()
+	}
+
+	// 读取漫画库：备用来源和已下载的章节
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
 		return
 	}
-	
+	record := db.ensureSeries(seriesID)
+
+	// 获取目录页面，主来源不可用时使用备用来源
+	sources := fetchSeriesSources(ctx, siteBaseURL, seriesID, record.Sources)
+	if len(sources) == 0 {
+		fmt.Println("未能从任何来源获取到章节列表")
+		return
+	}
+
+	u := newSeriesUpdate(db, siteBaseURL, record, sources, startChapterID)
+	if u == nil {
+		return
+	}
+	for _, i := range u.pending {
+		if ctx.Err() != nil {
+			fmt.Printf("下载已中断，其余章节将在下次运行时继续下载\n")
+			break
+		}
+		u.downloadChapter(ctx, i)
+	}
+	u.finish(ctx)
+}
+
+// seriesUpdate 一部漫画的一次更新：已获取的目录、漫画库中的记录和需要下载的章节
+// downloadSeries 逐个下载其中的章节，check --download 则与其他漫画的章节交替下载
+type seriesUpdate struct {
+	db         *libraryDB
+	record     *seriesRecord
+	seriesID   string
+	baseURL    string // 主来源的站点地址，下载章节时的请求使用这个地址
+	comicTitle string
+	comicDir   string
+	chapters   []ChapterInfo
+	pending    []int // 需要下载的章节在 chapters 中的位置
+	tocCounts  map[float64]int
+	titles     map[string]string // 开启标题翻译时新章节的译名：原标题 -> 译名
+
+	skipped       int
+	skippedLocked int
+}
+
+// newSeriesUpdate 按获取到的目录更新漫画记录和 series.json，找出需要下载的章节
+// baseURL 为主来源的站点地址，无法创建漫画目录时返回nil
+func newSeriesUpdate(db *libraryDB, baseURL string, record *seriesRecord, sources []*seriesSource, startChapterID string) *seriesUpdate {
+	seriesID := record.ID
+	// 合并各来源的章节列表
+	chapters := mergeSourceChapters(sources)
+
 	// 获取漫画标题
-	comicTitle := extractComicTitle(doc)
+	comicTitle := sources[0].title
 	if comicTitle == "" {
 		comicTitle = "comic_" + seriesID
 	}
-	
+	// 网站上的标题可能有误或在镜像站之间不一致，按 --title 和标题别名确定保存的目录
+	// 开启标题翻译时新漫画按译名保存，之前按原标题下载的漫画保持原来的目录
+	originalTitle := ""
+	if title := db.resolveTitle(record, comicTitle); title != comicTitle {
+		infof("网站上的标题为 %s，保存为 %s\n", comicTitle, title)
+		comicTitle = title
+	} else if t := db.translateTitles(runContext, []string{comicTitle})[comicTitle]; t != "" && t != comicTitle && (record.Dir == "" || record.Dir == libraryPath(t)) {
+		infof("标题 %s 翻译为 %s\n", comicTitle, t)
+		originalTitle, comicTitle = comicTitle, t
+	}
+	comicDir := libraryPath(comicTitle)
+
 	// 创建漫画主目录
-	err = os.MkdirAll(comicTitle, 0755)
+	err := os.MkdirAll(comicDir, 0755)
 	if err != nil {
 		fmt.Printf("创建漫画主目录失败: %v\n", err)
-		return
+		return nil
 	}
-	
-	fmt.Printf("漫画标题: %s\n", comicTitle)
-	fmt.Printf("找到 %d 个章节\n", len(chapters))
-	
+
+	infof("漫画标题: %s\n", comicTitle)
+	infof("找到 %d 个章节\n", len(chapters))
+
+	// 更新漫画记录，已经完整下载过的章节将被跳过
+	record.Title = comicTitle
+	record.BaseURL = baseURL
+	record.Dir = comicDir
+	compareTOC(record, baseURL, sources)
+	for _, source := range sources {
+		record.updateRating(source.rating)
+	}
+	if len(sources) > 0 {
+		record.Completed = sources[0].completed
+	}
+	err = writeSeriesMeta(comicDir, seriesMeta{
+		ID:            seriesID,
+		Title:         comicTitle,
+		OriginalTitle: originalTitle,
+		URL:           siteFor(baseURL).seriesURL(baseURL, seriesID),
+		UpdatedAt:     time.Now(),
+		Rating:        record.Rating,
+	})
+	if err != nil {
+		fmt.Printf("写入 %s 失败: %v\n", seriesMetaFile, err)
+	}
+
 	// 如果指定了起始章节，则从该章节开始下载
 	startIndex := 0
 	if startChapterID != "" {
@@ -345,68 +757,228 @@ func downloadSeries(seriesID string, startChapterID string) {
 		if !found {
 			fmt.Printf("警告: 未找到起始章节 %s，将从头开始下载\n", startChapterID)
 		} else {
-			fmt.Printf("从章节 [%d/%d] 开始下载\n", startIndex+1, len(chapters))
+			infof("从章节 [%d/%d] 开始下载\n", startIndex+1, len(chapters))
 		}
 	}
-	
+
+	u := &seriesUpdate{
+		db:         db,
+		record:     record,
+		seriesID:   seriesID,
+		baseURL:    baseURL,
+		comicTitle: comicTitle,
+		comicDir:   comicDir,
+		chapters:   chapters,
+	}
 	// 按顺序下载每个章节（从startIndex开始）
+	// 按ID、规范化标题或话数匹配已下载的章节，避免从不同来源重复下载
+	// 上次下载的页数少于页面标明的页数时重新检查，已下载的页按 chapter.json 沿用
+	tocCounts := chapterNumberCounts(chapterTitles(chapters))
+	u.tocCounts = tocCounts
 	for i := startIndex; i < len(chapters); i++ {
-		chapter := chapters[i]
-		// 使用更具描述性的章节目录名
-		chapterDirName := fmt.Sprintf("%03d_%s", i+1, sanitizeFileName(chapter.title))
-		
-		fmt.Printf("\n正在下载章节 [%d/%d]: %s (%s)\n", i+1, len(chapters), chapter.title, chapter.id)
-		
-		// 构造章节URL
-		chapterURL := "https://www.92hm.life/chapter/" + chapter.id
-		
-		// 获取章节页面
-		doc, err := fetchPageWithRetry(chapterURL, 3)
-		if err != nil {
-			fmt.Printf("获取章节页面失败: %v\n", err)
+		if c := record.findDownloaded(chapters[i], tocCounts); c != nil && !c.Incomplete {
+			u.skipped++
 			continue
 		}
-		
-		// 提取图片链接
-		imageUrls := extractImageUrls(doc)
-		if len(imageUrls) == 0 {
-			fmt.Println("未找到任何图片链接")
+		// 之前未解锁的章节默认不再请求，--retry-locked 时重新检查
+		if !retryLocked && record.findLocked(chapters[i].id) != nil {
+			u.skippedLocked++
 			continue
 		}
-		
-		fmt.Printf("找到 %d 张图片\n", len(imageUrls))
-		
-		// 创建保存图片的目录（在漫画主目录下）
-		dirName := filepath.Join(comicTitle, chapterDirName)
-		err = os.MkdirAll(dirName, 0755)
+		u.pending = append(u.pending, i)
+		runPlugins(pluginEvent{
+			Event:        pluginChapterDiscovered,
+			SeriesID:     seriesID,
+			SeriesTitle:  comicTitle,
+			ChapterID:    chapters[i].id,
+			ChapterTitle: chapters[i].title,
+			Number:       i + 1,
+		})
+	}
+	// 新章节的目录名和 chapter.json 使用译名，之前下载过（未完整）的章节保持原来的名称
+	var untranslated []string
+	for _, i := range u.pending {
+		if record.findDownloaded(chapters[i], tocCounts) == nil {
+			untranslated = append(untranslated, chapters[i].title)
+		}
+	}
+	u.titles = db.translateTitles(runContext, untranslated)
+	runStats.addPlanned(len(u.pending))
+	return u
+}
+
+// downloadChapter 下载第 i 个章节并记录到漫画库
+// 不同漫画的章节可以同时下载，修改漫画库时持有 db.mu
+func (u *seriesUpdate) downloadChapter(ctx context.Context, i int) {
+	db, record := u.db, u.record
+	seriesID, comicTitle, comicDir, chapters := u.seriesID, u.comicTitle, u.comicDir, u.chapters
+	ctx = withSiteBaseURL(ctx, u.baseURL)
+	chapter := chapters[i]
+	title := chapter.title
+	if t, ok := u.titles[chapter.title]; ok {
+		title = t
+	}
+
+	// 使用更具描述性的章节目录名，标题相同等原因与已有章节的目录重名时加上章节ID
+	ids := []string{chapter.id}
+	for _, alt := range chapter.alternates {
+		ids = append(ids, alt.id)
+	}
+	db.mu.Lock()
+	if c := record.findDownloaded(chapter, u.tocCounts); c != nil {
+		ids = append(ids, c.ID)
+	}
+	primary := record.BaseURL
+	db.mu.Unlock()
+	dirName := uniqueChapterDir(filepath.Join(comicDir, fmt.Sprintf("%03d_%s", i+1, pathName(sanitizeFileName(title)))), ids...)
+	chapterDirName := filepath.Base(dirName)
+
+	infof("\n正在下载章节 [%d/%d]: %s (%s)\n", i+1, len(chapters), chapter.title, chapter.id)
+
+	// 获取章节页面并提取图片链接，失败时尝试备用来源
+	fetched, sourceURL, err := fetchChapterImageUrls(ctx, chapter)
+	unit := failedUnit{
+		Kind:        "chapter",
+		SeriesID:    seriesID,
+		SeriesTitle: comicTitle,
+		ChapterID:   chapter.id,
+		Title:       chapter.title,
+		Number:      i + 1,
+		BaseURL:     sourceURL,
+		Dir:         dirName,
+	}
+	if errors.Is(err, errChapterLocked) {
+		fmt.Printf("章节 %s 未解锁，跳过: %v\n", chapter.title, err)
+		db.mu.Lock()
+		record.markLocked(chapter.id, chapter.title, lockedReason(err))
+		db.mu.Unlock()
+		unit.BaseURL = chapter.baseURL
+		if unit.BaseURL == "" {
+			unit.BaseURL = u.baseURL
+		}
+		unit.Dir = ""
+		runStats.chapterLocked(unit)
+		return
+	}
+	if fetched == nil {
+		runStats.chapterFetchFailed()
+		unit.BaseURL = chapter.baseURL
+		if unit.BaseURL == "" {
+			unit.BaseURL = u.baseURL
+		}
+		runStats.recordFailure(unit)
+		return
+	}
+
+	infof("找到 %d 张图片\n", len(fetched.images))
+
+	// 创建保存图片的目录（在漫画主目录下）
+	workDir := chapterWorkDir(dirName)
+	err = os.MkdirAll(workDir, 0755)
+	if err != nil {
+		fmt.Printf("创建目录失败: %v\n", err)
+		return
+	}
+
+	// 下载图片，设置了临时目录时完整下载后才移入漫画库
+	clearPlaceholders(workDir)
+	result := downloadChapterImages(ctx, fetched.images, workDir, nil, fetched.fixup)
+	metrics.recordChapter(comicTitle)
+	meta := &chapterMeta{
+		ID:            chapter.id,
+		Title:         title,
+		Number:        i + 1,
+		SeriesID:      seriesID,
+		SeriesTitle:   comicTitle,
+		SourceURL:     fetched.url,
+		ScrapedAt:     time.Now(),
+		Images:        fetched.images,
+		DeclaredPages: fetched.declared,
+		Strategy:      fetched.strategy,
+		Versions:      fetched.versions,
+		Published:     fetched.published,
+		Notes:         fetched.notes,
+	}
+	if title != chapter.title {
+		meta.OriginalTitle = chapter.title
+	}
+	if result.failed > 0 {
+		unit.Kind = "pages"
+		unit.Pages = failedPages(result)
+		runStats.recordFailure(unit)
+	}
+	meta.Missing = insertPlaceholders(ctx, workDir, fetched.images, &result)
+	if err := writeChapterMeta(workDir, meta, result); err != nil {
+		fmt.Printf("保存章节信息失败: %v\n", err)
+	}
+	if !finishChapterDir(workDir, dirName, result) {
+		return
+	}
+
+	// 只记录完整下载的章节，下次运行时重新下载缺页的章节
+	if result.failed == 0 {
+		if trimRecap {
+			result.saved -= trimRecapAfterDownload(dirName)
+		}
+		cr := &chapterRecord{
+			ID:           chapter.id,
+			Title:        chapter.title,
+			Dir:          chapterDirName,
+			Pages:        result.saved,
+			Bytes:        result.bytes,
+			DownloadedAt: time.Now(),
+			Incomplete:   pageCountShort(fetched.declared, result) || len(meta.Missing) > 0,
+		}
+		if sourceURL != primary {
+			cr.Source = sourceURL
+		}
+		db.mu.Lock()
+		record.unmarkLocked(chapter.id)
+		err := db.journalChapter(record, cr)
+		db.mu.Unlock()
 		if err != nil {
-			fmt.Printf("创建目录失败: %v\n", err)
-			continue
+			fmt.Printf("保存漫画库失败: %v\n", err)
 		}
-		
-		// 下载图片
-		for j, imgUrl := range imageUrls {
-			// 使用4位数字编号，例如 0001.jpg, 0002.jpg 等
-			filename := fmt.Sprintf("%s/%04d.jpg", dirName, j+1)
-			
-			err := downloadImageWithRetry(imgUrl, filename, 3)
-			if err != nil {
-				fmt.Printf("下载图片 %d 失败: %v\n", j+1, err)
-				continue
+		if archiveMode && record.Followed {
+			if err := archiveChapter(comicDir, dirName, fetched.url); err != nil {
+				fmt.Printf("存档章节失败: %v\n", err)
 			}
-			fmt.Printf("已下载图片 %d/%d: %s\n", j+1, len(imageUrls), filename)
 		}
-		
-		fmt.Printf("章节 %s 下载完成\n", chapter.title)
 	}
-	
-	fmt.Printf("\n漫画《%s》下载完成! 所有章节保存在 %s 目录中\n", comicTitle, comicTitle)
+
+	infof("章节 %s 下载完成\n", chapter.title)
+}
+
+// finish 保存漫画库、生成缩略图，完结的漫画全部下载后生成最终的电子书
+func (u *seriesUpdate) finish(ctx context.Context) {
+	if u.skipped > 0 {
+		infof("\n已跳过 %d 个之前下载过的章节\n", u.skipped)
+	}
+	if u.skippedLocked > 0 {
+		infof("已跳过 %d 个之前未解锁的章节，使用 --retry-locked 重新检查\n", u.skippedLocked)
+	}
+	if err := u.db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+	}
+	if n, err := updateThumbnails(u.comicDir, false); err == nil && n > 0 {
+		verbosef("生成了 %d 张缩略图\n", n)
+	}
+
+	infof("\n漫画《%s》下载完成! 所有章节保存在 %s 目录中\n", u.comicTitle, u.comicDir)
+	if ctx.Err() == nil && ocrAfterDownload {
+		ocrAfterSeries(u.comicDir)
+	}
+	if ctx.Err() == nil {
+		finalizeSeries(u.db, u.record, u.chapters)
+	}
 }
 
 // ChapterInfo 章节信息
 type ChapterInfo struct {
-	id    string
-	title string
+	id         string
+	title      string
+	baseURL    string        // 章节所在来源的站点地址，为空时使用当前站点
+	alternates []ChapterInfo // 备用来源中的同一章节
 }
 
 // extractChapterLinks 从目录页面提取章节链接
@@ -496,12 +1068,18 @@ func parseLocalFile(filePath string) (*goquery.Document, error) {
 }
 
 // fetchPageWithRetry 获取并解析网页内容，支持重试
-func fetchPageWithRetry(url string, maxRetries int) (*goquery.Document, error) {
+func fetchPageWithRetry(ctx context.Context, url string, maxRetries int) (*goquery.Document, error) {
 	var err error
 	for i := 0; i < maxRetries; i++ {
-		fmt.Printf("正在获取页面... (尝试 %d/%3d)\n", i+1, maxRetries)
+		infof("正在获取页面... (尝试 %d/%3d)\n", i+1, maxRetries)
 		
-		doc, err := fetchPage(url)
+		var doc *goquery.Document
+		doc, err = fetchPage(ctx, url)
+		metrics.recordError(err)
+		// 404、robots.txt 禁止等重试也不会成功的错误直接返回
+		if classifyRetry(err) == retryNever {
+			return nil, err
+		}
 		if err == nil {
 			// 检查是否获取到了有效内容
 			title := doc.Find("title").Text()
@@ -509,27 +1087,64 @@ func fetchPageWithRetry(url string, maxRetries int) (*goquery.Document, error) {
 				return doc, nil
 			}
 			// 如果标题为空或包含错误，可能页面内容不完整
-			fmt.Println("获取到的页面内容可能不完整")
+			err = errors.New("获取到的页面内容可能不完整")
 		}
 		
 		fmt.Printf("获取页面失败: %v\n", err)
 		if i < maxRetries-1 {
-			fmt.Println("等待5秒后重试...")
-			time.Sleep(5 * time.Second)
+			// 被站点限制时等待更久，服务器错误逐次加倍，网络错误很快重试
+			delay := retryDelay(err, i+1, 5*time.Second)
+			verbosef("等待 %v 后重试...\n", delay)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
 		}
 	}
 	
 	return nil, fmt.Errorf("在 %d 次尝试后仍然无法获取页面: %v", maxRetries, err)
 }
 
-// fetchPage 获取并解析网页内容
-func fetchPage(url string) (*goquery.Document, error) {
-	if debugMode {
-		fmt.Printf("DEBUG: 正在请求URL: %s\n", url)
+// sharedTransport 所有页面和图片请求共用的连接池
+var sharedTransport = &http.Transport{
+	Proxy:                 siteBreaker.proxy,
+	DialContext:           dialContext,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   30 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// fetchPageOnce 通过当前的 Fetcher 获取并解析网页内容，检查是否获取到了完整的页面
+func fetchPageOnce(ctx context.Context, url string) (*goquery.Document, error) {
+	debugf("正在请求URL: %s\n", url)
+	doc, err := siteFetcher.GetDocument(ctx, url)
+	if err != nil {
+		return nil, err
 	}
+
+	// 检查页面标题以确认是否获取到有效内容
+	title := doc.Find("title").Text()
+	debugf("页面标题: %s\n", title)
 	
+	// 如果标题为空，可能是内容不完整
+	if strings.TrimSpace(title) == "" {
+		if debugMode && !lowMemory {
+			htmlContent, _ := doc.Html()
+			debugf("页面HTML内容长度: %d\n", len(htmlContent))
+			if len(htmlContent) < 15000 { // 正常页面通常更大
+				debugf("页面内容可能不完整\n")
+			}
+		}
+		return nil, fmt.Errorf("页面内容可能不完整")
+	}
+
+	return doc, nil
+}
+
+// GetDocument 模拟浏览器请求网页并解析，遵守下载时间段、礼貌抓取和熔断器
+func (httpFetcher) GetDocument(ctx context.Context, url string) (*goquery.Document, error) {
 	// 创建带超时的上下文
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, pageTimeout)
 	defer cancel()
 
 	// 创建请求
@@ -539,7 +1154,7 @@ func fetchPage(url string) (*goquery.Document, error) {
 	}
 
 	// 更完整地模拟浏览器请求
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	req.Header.Set("User-Agent", siteBreaker.userAgent())
 	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7")
 	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
 	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
@@ -550,62 +1165,53 @@ func fetchPage(url string) (*goquery.Document, error) {
 	req.Header.Set("Sec-Fetch-Site", "none")
 	req.Header.Set("Sec-Fetch-User", "?1")
 	req.Header.Set("Cache-Control", "max-age=0")
-	req.Header.Set("Referer", "https://www.92hm.life/")
+	req.Header.Set("Referer", contextBaseURL(ctx)+"/")
+	setExtraHeaders(req)
 
 	if debugMode {
-		fmt.Printf("DEBUG: 请求头:\n")
+		debugf("请求头:\n")
 		for key, values := range req.Header {
 			for _, value := range values {
-				fmt.Printf("  %s: %s\n", key, value)
+				fmt.Fprintf(debugOutput, "  %s: %s\n", key, value)
 			}
 		}
 	}
 
-	// 创建带代理的客户端
+	// 创建使用共享连接池的客户端
 	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   60 * time.Second,
-				KeepAlive: 60 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   30 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-		Timeout: 60 * time.Second,
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// 限制重定向次数
-			if len(via) >= 10 {
-				return errors.New("too many redirects")
-			}
-			if debugMode {
-				fmt.Printf("DEBUG: 重定向到: %s\n", req.URL.String())
-			}
-			return nil
-		},
+		Transport:     pageTransport(),
+		Jar:           siteCookies,
+		CheckRedirect: checkRedirect,
 	}
 	
-	if debugMode {
-		fmt.Printf("DEBUG: 发送请求...\n")
+	// 不在下载时间段内时等待
+	bandwidth.waitWindow()
+
+	// 礼貌抓取模式下遵守 robots.txt 并保持请求间隔
+	if err := politeMode.check(ctx, url); err != nil {
+		return nil, err
 	}
+	browseSim.notePage(url)
+
+	// 站点限制访问期间等待冷却结束
+	siteBreaker.wait()
+
+	debugf("发送请求...\n")
 	
 	resp, err := client.Do(req)
 	if err != nil {
-		if debugMode {
-			fmt.Printf("DEBUG: 请求失败: %v\n", err)
-		}
+		debugf("请求失败: %v\n", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
+	siteBreaker.record(resp.StatusCode)
 
 	if debugMode {
-		fmt.Printf("DEBUG: 响应状态码: %d\n", resp.StatusCode)
-		fmt.Printf("DEBUG: 响应头:\n")
+		debugf("响应状态码: %d\n", resp.StatusCode)
+		debugf("响应头:\n")
 		for key, values := range resp.Header {
 			for _, value := range values {
-				fmt.Printf("  %s: %s\n", key, value)
+				fmt.Fprintf(debugOutput, "  %s: %s\n", key, value)
 			}
 		}
 	}
@@ -614,112 +1220,87 @@ func fetchPage(url string) (*goquery.Document, error) {
 	if resp.StatusCode != 200 {
 		// 尝试读取错误响应体以提供更多调试信息
 		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024)) // 限制读取大小
-		if debugMode {
-			fmt.Printf("DEBUG: 错误响应体: %s\n", string(body))
-		}
-		return nil, fmt.Errorf("状态码错误: %d, 响应: %s", resp.StatusCode, string(body))
+		debugf("错误响应体: %s\n", string(body))
+		return nil, newStatusError(resp, string(body))
 	}
 
 	// 检查内容编码并相应处理
 	var reader io.Reader = resp.Body
 	contentEncoding := resp.Header.Get("Content-Encoding")
 	if contentEncoding == "gzip" {
-		if debugMode {
-			fmt.Printf("DEBUG: 内容已gzip压缩，正在解压...\n")
-		}
+		debugf("内容已gzip压缩，正在解压...\n")
 		gzipReader, err := gzip.NewReader(resp.Body)
 		if err != nil {
-			if debugMode {
-				fmt.Printf("DEBUG: 创建gzip解压器失败: %v\n", err)
-			}
+			debugf("创建gzip解压器失败: %v\n", err)
 			return nil, fmt.Errorf("创建gzip解压器失败: %v", err)
 		}
 		defer gzipReader.Close()
 		reader = gzipReader
 	} else if contentEncoding == "br" {
-		if debugMode {
-			fmt.Printf("DEBUG: 内容已Brotli压缩，正在解压...\n")
-		}
+		debugf("内容已Brotli压缩，正在解压...\n")
 		reader = brotli.NewReader(resp.Body)
 	}
 
-	// 读取内容用于调试
+	// 读取内容用于调试，低内存模式下不缓存整个响应体；存档模式下保存原始网页
 	var content []byte
-	if debugMode {
+	if (debugMode && !lowMemory) || archiveMode {
 		content, err = io.ReadAll(reader)
 		if err != nil {
-			fmt.Printf("DEBUG: 读取响应体失败: %v\n", err)
+			debugf("读取响应体失败: %v\n", err)
 			return nil, err
 		}
-		fmt.Printf("DEBUG: 响应体大小: %d 字节\n", len(content))
+		debugf("响应体大小: %d 字节\n", len(content))
+		if archiveMode {
+			rememberRawPage(url, content)
+		}
 		reader = strings.NewReader(string(content))
 	}
 
 	doc, err := goquery.NewDocumentFromReader(reader)
 	if err != nil {
-		if debugMode {
-			fmt.Printf("DEBUG: 解析文档失败: %v\n", err)
-		}
+		debugf("解析文档失败: %v\n", err)
 		return nil, err
 	}
-
-	// 检查页面标题以确认是否获取到有效内容
-	title := doc.Find("title").Text()
-	if debugMode {
-		fmt.Printf("DEBUG: 页面标题: %s\n", title)
-	}
-	
-	// 如果标题为空，可能是内容不完整
-	if strings.TrimSpace(title) == "" {
-		if debugMode {
-			htmlContent, _ := doc.Html()
-			fmt.Printf("DEBUG: 页面HTML内容长度: %d\n", len(htmlContent))
-			if len(htmlContent) < 15000 { // 正常页面通常更大
-				fmt.Printf("DEBUG: 页面内容可能不完整\n")
-			}
-		}
-		return nil, fmt.Errorf("页面内容可能不完整")
-	}
-
+	// 记录跟随重定向后的地址，相对链接按该地址解析
+	doc.Url = resp.Request.URL
 	return doc, nil
 }
 
 // extractImageUrls 从页面中提取所有图片链接
 func extractImageUrls(doc *goquery.Document) []string {
-	var urls []string
-
-	// 打印页面标题以帮助调试
-	title := doc.Find("title").Text()
-	fmt.Printf("页面标题: %s\n", title)
+	urls, _ := extractImages(doc)
+	return urls
+}
 
-	// 显示页面大小帮助调试
-	content, _ := doc.Html()
-	fmt.Printf("页面HTML长度: %d 字符\n", len(content))
+// lazyAttrImageUrls 提取方式 lazy-attr: 从 img 标签的懒加载属性（data-original、data-src）、src 和 srcset 中提取
+func lazyAttrImageUrls(doc *goquery.Document, base *url.URL) []string {
+	var urls []string
 
 	// 专门针对92hm.life网站的选择器
 	foundCount := 0
 	doc.Find("img.lazy").Each(func(i int, s *goquery.Selection) {
 		imgSrc, exists := s.Attr("data-original")
+		// 响应式图片按 srcset 选择分辨率最高的链接，避免下载缩略图
+		if best := largestSrcset(s); best != "" {
+			imgSrc, exists = best, true
+		}
 		if exists && imgSrc != "" {
-			imgSrc = strings.TrimSpace(imgSrc)
-			
 			// 处理相对链接
-			if strings.HasPrefix(imgSrc, "//") {
-				imgSrc = "https:" + imgSrc
-			} else if strings.HasPrefix(imgSrc, "/") {
-				imgSrc = "https://www.92hm.life" + imgSrc
+			imgSrc, exists = resolveImageURL(base, imgSrc, queryKeep)
+			if !exists {
+				return
 			}
 			
 			urls = append(urls, imgSrc)
 			foundCount++
 			if foundCount <= 5 { // 只打印前5个
-				fmt.Printf("找到图片 [%d]: %s\n", i+1, imgSrc)
+				verbosef("找到图片 [%d]: %s\n", i+1, imgSrc)
 			}
 		}
 	})
 	
 	if foundCount > 5 {
-		fmt.Printf("还有 %d 张图片...\n", foundCount-5)
+		verbosef("还有 %d 张图片...\n", foundCount-5)
 	}
 
 	// 如果上面的方法没找到，尝试通用方法
@@ -732,6 +1313,9 @@ func extractImageUrls(doc *goquery.Document) []string {
 			if !exists {
 				imgSrc, exists = s.Attr("src")
 			}
+			if best := largestSrcset(s); best != "" {
+				imgSrc, exists = best, true
+			}
 			
 			if exists && imgSrc != "" {
 				imgSrc = strings.TrimSpace(imgSrc)
@@ -743,13 +1327,9 @@ func extractImageUrls(doc *goquery.Document) []string {
 				   strings.HasSuffix(imgSrc, ".jpeg") || strings.Contains(imgSrc, "comic") {
 				    
 					// 处理相对链接
-					if strings.HasPrefix(imgSrc, "//") {
-						imgSrc = "https:" + imgSrc
-					} else if strings.HasPrefix(imgSrc, "/") {
-						imgSrc = "https://www.92hm.life" + imgSrc
+					if imgSrc, exists = resolveImageURL(base, imgSrc, queryKeep); exists {
+						urls = append(urls, imgSrc)
 					}
-					
-					urls = append(urls, imgSrc)
 				}
 			}
 		})
@@ -764,16 +1344,10 @@ func extractImageUrls(doc *goquery.Document) []string {
 			}
 			
 			if exists && imgSrc != "" {
-				imgSrc = strings.TrimSpace(imgSrc)
-				
 				// 处理相对链接
-				if strings.HasPrefix(imgSrc, "//") {
-					imgSrc = "https:" + imgSrc
-				} else if strings.HasPrefix(imgSrc, "/") {
-					imgSrc = "https://www.92hm.life" + imgSrc
+				if imgSrc, exists = resolveImageURL(base, imgSrc, queryKeep); exists {
+					urls = append(urls, imgSrc)
 				}
-				
-				urls = append(urls, imgSrc)
 			}
 		})
 	}
@@ -782,82 +1356,126 @@ func extractImageUrls(doc *goquery.Document) []string {
 }
 
 // downloadImageWithRetry 下载单个图片，支持重试
-func downloadImageWithRetry(url, filename string, maxRetries int) error {
+func downloadImageWithRetry(ctx context.Context, url, filename string, maxRetries int) error {
+	metrics.startDownload()
 	var err error
+	defer func() { metrics.finishDownload(err == nil) }()
+
 	for i := 0; i < maxRetries; i++ {
-		err = downloadImage(url, filename)
+		err = downloadImage(ctx, url, filename)
 		if err == nil {
 			return nil
 		}
+		metrics.recordError(err)
+		if classifyRetry(err) == retryNever {
+			return err
+		}
 		
 		if i < maxRetries-1 {
-			fmt.Printf("图片下载失败，%d秒后重试... (%d/%d)\n", 2, i+1, maxRetries)
-			time.Sleep(time.Duration(2) * time.Second)
+			delay := retryDelay(err, i+1, 2*time.Second)
+			verbosef("图片下载失败（%v），%v 后重试... (%d/%d)\n", err, delay, i+1, maxRetries)
+			if sleepContext(ctx, delay) != nil {
+				return fmt.Errorf("下载已中断: %v", err)
+			}
 		}
 	}
 	
-	return fmt.Errorf("在 %d 次尝试后仍然无法下载图片: %v", maxRetries, err)
+	return fmt.Errorf("在 %d 次尝试后仍然无法下载图片: %w", maxRetries, err)
 }
 
 // downloadImage 下载单个图片
-func downloadImage(imageURL, filename string) error {
+func downloadImage(ctx context.Context, imageURL, filename string) error {
 	// 解析URL以检查其有效性
-	parsedURL, err := url.Parse(imageURL)
-	if err != nil {
+	if _, err := url.Parse(imageURL); err != nil {
 		return fmt.Errorf("无效的URL: %v", err)
 	}
 
-	// 创建文件
-	file, err := os.Create(filename)
+	// 先写入同一目录中的临时文件，完成后替换：原文件可能是去重后与其他章节共用的硬链接，
+	// 直接截断重写会同时改坏所有链接到它的章节和内容存储中的数据
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*.part")
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+
+	// 包装一层使 io.CopyBuffer 使用指定大小的缓冲区
+	n, err := siteFetcher.GetBytes(ctx, fetchRequest{URL: imageURL, Image: true}, struct{ io.Writer }{file})
+	metrics.addBytes(n)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, filename)
+}
+
+// GetBytes 请求图片或接口，将内容写入 w，遵守下载时间段、礼貌抓取和熔断器
+func (httpFetcher) GetBytes(ctx context.Context, r fetchRequest, w io.Writer) (int64, error) {
+	// 不在下载时间段内时等待
+	if r.Image {
+		bandwidth.waitWindow()
+	}
+
+	// 礼貌抓取模式下遵守 robots.txt 并保持请求间隔
+	if err := politeMode.check(ctx, r.URL); err != nil {
+		return 0, err
+	}
 
 	// 创建带上下文的请求
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	timeout := pageTimeout
+	if r.Image {
+		timeout = imageTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 	
-	req, err := http.NewRequestWithContext(ctx, "GET", parsedURL.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", r.URL, nil)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	// 设置用户代理
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
-	req.Header.Set("Accept", "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
-	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
-	req.Header.Set("Referer", "https://www.92hm.life/")
-	req.Header.Set("Connection", "keep-alive")
-	req.Header.Set("Sec-Fetch-Dest", "image")
-	req.Header.Set("Sec-Fetch-Mode", "no-cors")
-	req.Header.Set("Sec-Fetch-Site", "cross-site")
+	req.Header.Set("User-Agent", siteBreaker.userAgent())
+	if r.Image {
+		req.Header.Set("Accept", "image/avif,image/webp,image/apng,image/svg+xml,image/*,*/*;q=0.8")
+		req.Header.Set("Accept-Language", "zh-CN,zh;q=0.9,en;q=0.8")
+		req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+		req.Header.Set("Referer", contextBaseURL(ctx)+"/")
+		req.Header.Set("Connection", "keep-alive")
+		req.Header.Set("Sec-Fetch-Dest", "image")
+		req.Header.Set("Sec-Fetch-Mode", "no-cors")
+		req.Header.Set("Sec-Fetch-Site", "cross-site")
+	}
+	setExtraHeaders(req)
+	for key, value := range r.Headers {
+		req.Header.Set(key, value)
+	}
 
-	// 创建带代理的客户端
+	// 创建使用共享连接池的客户端
 	client := &http.Client{
-		Transport: &http.Transport{
-			Proxy: http.ProxyFromEnvironment,
-			DialContext: (&net.Dialer{
-				Timeout:   60 * time.Second,
-				KeepAlive: 60 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   30 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-		},
-		Timeout: 60 * time.Second,
+		Transport:     pageTransport(),
+		Jar:           siteCookies,
+		CheckRedirect: checkRedirect,
 	}
 	
+	// 站点限制访问期间等待冷却结束
+	siteBreaker.wait()
+
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer resp.Body.Close()
+	siteBreaker.record(resp.StatusCode)
 
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("图片下载失败，状态码: %d", resp.StatusCode)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, newStatusError(resp, string(body))
 	}
 
 	// 检查内容是否被gzip压缩
@@ -865,15 +1483,15 @@ func downloadImage(imageURL, filename string) error {
 	if resp.Header.Get("Content-Encoding") == "gzip" {
 		gzipReader, err := gzip.NewReader(resp.Body)
 		if err != nil {
-			return fmt.Errorf("创建gzip解压器失败: %v", err)
+			return 0, fmt.Errorf("创建gzip解压器失败: %v", err)
 		}
 		defer gzipReader.Close()
 		reader = gzipReader
 	}
-
-	// 将图片写入文件
-	_, err = io.Copy(file, reader)
-	return err
+	if r.Image {
+		reader = bandwidth.reader(reader)
+	}
+	return io.CopyBuffer(w, reader, copyBuffer())
 }
 
 // extractComicTitle 从目录页面提取漫画标题
@@ -941,10 +1559,14 @@ func sanitizeFileName(filename string) string {
 		filename = strings.ReplaceAll(filename, char, "_")
 	}
 	
-	// 限制长度
+	// 限制长度，按字符截断，不截断半个汉字
 	if len(filename) > 100 {
-		filename = filename[:100]
+		cut := 100
+		for cut > 0 && !utf8.RuneStart(filename[cut]) {
+			cut--
+		}
+		filename = filename[:cut]
 	}
 	
-	return strings.TrimSpace(filename)
+	return windowsSafeName(strings.TrimSpace(filename))
 }
\ No newline at end of file
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// metricsRegistry 运行期间的下载统计，以 Prometheus 文本格式导出
+type metricsRegistry struct {
+	mu         sync.Mutex
+	inProgress int64
+	bytes      int64
+	images     int64
+	errors     map[string]int64        // 按错误类型统计
+	chapters   map[string]int64        // 按漫画统计已完成章节数
+	hosts      map[string]*hostMetrics // 按主机统计请求数、失败数和延迟
+}
+
+// metrics 全局统计
+var metrics = &metricsRegistry{
+	errors:   make(map[string]int64),
+	chapters: make(map[string]int64),
+	hosts:    make(map[string]*hostMetrics),
+}
+
+// startDownload 记录一个开始下载的图片
+func (m *metricsRegistry) startDownload() {
+	m.mu.Lock()
+	m.inProgress++
+	m.mu.Unlock()
+}
+
+// finishDownload 记录一个结束下载的图片
+func (m *metricsRegistry) finishDownload(success bool) {
+	m.mu.Lock()
+	m.inProgress--
+	if success {
+		m.images++
+	}
+	m.mu.Unlock()
+}
+
+// addBytes 累计下载的字节数
+func (m *metricsRegistry) addBytes(n int64) {
+	m.mu.Lock()
+	m.bytes += n
+	m.mu.Unlock()
+}
+
+// recordError 按类型记录一次请求错误
+func (m *metricsRegistry) recordError(err error) {
+	if err == nil {
+		return
+	}
+	m.mu.Lock()
+	m.errors[errorType(err)]++
+	m.mu.Unlock()
+}
+
+// recordChapter 记录漫画完成下载的一个章节
+func (m *metricsRegistry) recordChapter(series string) {
+	m.mu.Lock()
+	m.chapters[series]++
+	m.mu.Unlock()
+}
+
+// errorType 将错误归类为便于统计的类型
+func errorType(err error) string {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return fmt.Sprintf("http_%d", statusErr.StatusCode)
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return "timeout"
+		}
+		return "network"
+	}
+	return "other"
+}
+
+// writePrometheus 以 Prometheus 文本格式输出所有指标
+func (m *metricsRegistry) writePrometheus(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP comicbox_downloads_in_progress Number of images currently being downloaded.")
+	fmt.Fprintln(w, "# TYPE comicbox_downloads_in_progress gauge")
+	fmt.Fprintf(w, "comicbox_downloads_in_progress %d\n", m.inProgress)
+
+	fmt.Fprintln(w, "# HELP comicbox_downloaded_bytes_total Total bytes of images downloaded.")
+	fmt.Fprintln(w, "# TYPE comicbox_downloaded_bytes_total counter")
+	fmt.Fprintf(w, "comicbox_downloaded_bytes_total %d\n", m.bytes)
+
+	fmt.Fprintln(w, "# HELP comicbox_downloaded_images_total Total images downloaded successfully.")
+	fmt.Fprintln(w, "# TYPE comicbox_downloaded_images_total counter")
+	fmt.Fprintf(w, "comicbox_downloaded_images_total %d\n", m.images)
+
+	fmt.Fprintln(w, "# HELP comicbox_errors_total Failed requests by error type.")
+	fmt.Fprintln(w, "# TYPE comicbox_errors_total counter")
+	for _, key := range sortedKeys(m.errors) {
+		fmt.Fprintf(w, "comicbox_errors_total{type=%q} %d\n", key, m.errors[key])
+	}
+
+	fmt.Fprintln(w, "# HELP comicbox_chapters_downloaded_total Chapters downloaded per series.")
+	fmt.Fprintln(w, "# TYPE comicbox_chapters_downloaded_total counter")
+	for _, key := range sortedKeys(m.chapters) {
+		fmt.Fprintf(w, "comicbox_chapters_downloaded_total{series=%q} %d\n", escapeLabel(key), m.chapters[key])
+	}
+
+	hosts := make([]string, 0, len(m.hosts))
+	for host := range m.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	fmt.Fprintln(w, "# HELP comicbox_http_requests_total HTTP requests sent per host.")
+	fmt.Fprintln(w, "# TYPE comicbox_http_requests_total counter")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "comicbox_http_requests_total{host=%q} %d\n", host, m.hosts[host].requests)
+	}
+
+	fmt.Fprintln(w, "# HELP comicbox_http_request_errors_total HTTP requests per host that failed or returned a 4xx/5xx status.")
+	fmt.Fprintln(w, "# TYPE comicbox_http_request_errors_total counter")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "comicbox_http_request_errors_total{host=%q} %d\n", host, m.hosts[host].errors)
+	}
+
+	fmt.Fprintln(w, "# HELP comicbox_http_request_duration_seconds Time from sending a request to receiving the response headers, per host.")
+	fmt.Fprintln(w, "# TYPE comicbox_http_request_duration_seconds histogram")
+	for _, host := range hosts {
+		h := m.hosts[host]
+		var count int64
+		for i, bound := range latencyBuckets {
+			count += h.buckets[i]
+			fmt.Fprintf(w, "comicbox_http_request_duration_seconds_bucket{host=%q,le=\"%g\"} %d\n", host, bound, count)
+		}
+		fmt.Fprintf(w, "comicbox_http_request_duration_seconds_bucket{host=%q,le=\"+Inf\"} %d\n", host, h.requests)
+		fmt.Fprintf(w, "comicbox_http_request_duration_seconds_sum{host=%q} %g\n", host, h.sum)
+		fmt.Fprintf(w, "comicbox_http_request_duration_seconds_count{host=%q} %d\n", host, h.requests)
+	}
+}
+
+// sortedKeys 返回排序后的键，保证输出顺序稳定
+func sortedKeys(values map[string]int64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// escapeLabel 去掉标签值中的换行，%q 负责引号和反斜杠的转义
+func escapeLabel(value string) string {
+	return strings.ReplaceAll(value, "\n", " ")
+}
+
+// startMetricsServer 在后台启动 /metrics 监控端点
+func startMetricsServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		metrics.writePrometheus(w)
+	})
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Printf("启动监控端点失败: %v\n", err)
+		return
+	}
+	fmt.Printf("监控端点已启动: http://%s/metrics\n", listener.Addr())
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			fmt.Printf("监控端点已停止: %v\n", err)
+		}
+	}()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// parseMHTMLFile 解析浏览器保存的MHTML文件，返回主页面文档和按原始URL索引的资源
+func parseMHTMLFile(filePath string) (*goquery.Document, map[string][]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	msg, err := mail.ReadMessage(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取MHTML头部失败: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析MHTML内容类型失败: %v", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		return nil, nil, fmt.Errorf("不是有效的MHTML文件: %s", mediaType)
+	}
+
+	var doc *goquery.Document
+	resources := make(map[string][]byte)
+
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取MHTML分段失败: %v", err)
+		}
+
+		// quoted-printable 编码由 multipart 自动解码，base64 需要手动处理
+		var body io.Reader = part
+		if strings.EqualFold(part.Header.Get("Content-Transfer-Encoding"), "base64") {
+			body = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取MHTML分段内容失败: %v", err)
+		}
+
+		partType := part.Header.Get("Content-Type")
+		if doc == nil && strings.HasPrefix(partType, "text/html") {
+			doc, err = goquery.NewDocumentFromReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		if location := part.Header.Get("Content-Location"); location != "" {
+			resources[location] = data
+		}
+	}
+
+	if doc == nil {
+		return nil, nil, fmt.Errorf("MHTML文件中未找到HTML页面")
+	}
+
+	return doc, resources, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ipFamily 建立连接时使用的地址类型，由 --ipv4-only、--ipv6-only 或配置文件的 ip_family 设置
+// 为空时按系统默认同时尝试 IPv4 和 IPv6；有的图片服务器 IPv6 不可用，连接会一直超时
+var ipFamily string
+
+// parseIPFamily 检查配置文件中 ip_family 的值：ipv4、ipv6，或 auto 表示不限制
+func parseIPFamily(value string) (string, error) {
+	switch strings.ToLower(value) {
+	case "", "auto":
+		return "", nil
+	case "ipv4", "4":
+		return "tcp4", nil
+	case "ipv6", "6":
+		return "tcp6", nil
+	}
+	return "", fmt.Errorf("未知的地址类型: %s（可用 ipv4、ipv6、auto）", value)
+}
+
+// siteDialer 所有页面、图片和接口请求建立连接使用的 Dialer
+var siteDialer = &net.Dialer{
+	Timeout:   60 * time.Second,
+	KeepAlive: 60 * time.Second,
+}
+
+// dialContext 按 ipFamily 限制地址类型后建立 TCP 连接
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if ipFamily != "" && network == "tcp" {
+		network = ipFamily
+	}
+	return siteDialer.DialContext(ctx, network, addr)
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// nettestRounds 每个网页请求几次，取首字节时间的中位数
+	nettestRounds = 3
+	// nettestSlowLatency 首字节时间超过该值时提示延迟过高
+	nettestSlowLatency = 2 * time.Second
+	// nettestSlowRate 图片下载速度低于该值（字节/秒）时提示速度过慢
+	nettestSlowRate = 100 << 10
+)
+
+// nettestReport 网络诊断的结果，发现的问题和建议在最后统一输出
+type nettestReport struct {
+	hints []string
+}
+
+func (r *nettestReport) hint(format string, args ...interface{}) {
+	r.hints = append(r.hints, fmt.Sprintf(format, args...))
+}
+
+// runNettestCommand 测试到站点和图片服务器的连接：DNS、IPv4/IPv6 连接、代理、网页的首字节时间和图片的下载速度，
+// 最后给出可以尝试的设置，用于排查下载缓慢或失败的原因
+func runNettestCommand(args []string) {
+	input := ""
+	imageCount := 3
+	for i := 0; i < len(args); {
+		n, err := parseGlobalFlag(args, i)
+		if err != nil {
+			fmt.Printf("参数错误: %v\n", err)
+			return
+		}
+		if n > 0 {
+			i += n
+			continue
+		}
+		switch {
+		case args[i] == "--images" && i+1 < len(args):
+			if _, err := fmt.Sscan(args[i+1], &imageCount); err != nil || imageCount < 1 {
+				fmt.Printf("无效的图片数: %s\n", args[i+1])
+				return
+			}
+			i += 2
+		case strings.HasPrefix(args[i], "--"):
+			fmt.Println("用法: ./comicbox nettest [章节或漫画的链接、ID] [--images 3]")
+			return
+		default:
+			input = args[i]
+			i++
+		}
+	}
+
+	report := &nettestReport{}
+	baseURL := siteBaseURL
+	var t target
+	if input != "" {
+		var err error
+		if t, err = parseTarget(input); err != nil {
+			fmt.Printf("%v\n", err)
+			return
+		}
+		baseURL = t.baseURL
+	}
+
+	nettestSettings()
+	fmt.Printf("\n== 站点 %s ==\n", baseURL)
+	if !report.testHost(runContext, baseURL+"/") {
+		report.print()
+		return
+	}
+	report.testPage(runContext, baseURL+"/")
+
+	if input == "" {
+		fmt.Println("\n未指定章节，跳过图片服务器的测试（指定章节或漫画的链接、ID可以同时测试图片下载速度）")
+	} else if images := nettestImages(runContext, t); len(images) == 0 {
+		report.hint("没有获取到章节中的图片链接，无法测试图片服务器；用 --debug 查看获取章节的过程")
+	} else {
+		report.testImages(runContext, images, imageCount)
+	}
+	report.print()
+}
+
+// nettestSettings 输出影响连接的设置
+func nettestSettings() {
+	fmt.Println("== 当前设置 ==")
+	family := "自动"
+	switch ipFamily {
+	case "tcp4":
+		family = "只用 IPv4"
+	case "tcp6":
+		family = "只用 IPv6"
+	}
+	fmt.Printf("地址类型: %s\n", family)
+	if len(siteBreaker.proxies) > 0 {
+		fmt.Printf("代理列表: %d 个，当前 %s\n", len(siteBreaker.proxies), siteBreaker.proxies[siteBreaker.proxyIndex].Redacted())
+	}
+	if rate := bandwidth.current().rate; rate > 0 {
+		fmt.Printf("带宽上限: %s/s（测速不受限制）\n", formatBytes(rate))
+	}
+	fmt.Printf("并发数: %d，页面超时: %v，图片超时: %v\n", imageWorkers, pageTimeout, imageTimeout)
+}
+
+// testHost 测试到链接所在主机的连接：使用代理时测试能否连接代理，否则测试 DNS 和 IPv4、IPv6 的连接
+// 返回 false 时无法连接，不再进行后面的测试
+func (r *nettestReport) testHost(ctx context.Context, rawURL string) bool {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		fmt.Printf("无效的链接: %v\n", err)
+		return false
+	}
+	host, port := req.URL.Hostname(), req.URL.Port()
+	if port == "" {
+		port = "443"
+		if req.URL.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	if proxyURL, err := siteBreaker.proxy(req); err == nil && proxyURL != nil {
+		// 使用代理时由代理解析域名和连接，只测试到代理的连接
+		fmt.Printf("代理: %s\n", proxyURL.Redacted())
+		proxyPort := proxyURL.Port()
+		if proxyPort == "" {
+			proxyPort = "80"
+		}
+		elapsed, err := nettestDial(ctx, "tcp", net.JoinHostPort(proxyURL.Hostname(), proxyPort))
+		if err != nil {
+			fmt.Printf("连接代理: 失败 %v\n", err)
+			r.hint("无法连接代理 %s，检查 --proxy-list、配置方案的 proxies 或 HTTPS_PROXY 环境变量中的地址和代理软件是否在运行",
+				proxyURL.Redacted())
+			return false
+		}
+		fmt.Printf("连接代理: %v\n", elapsed.Round(time.Millisecond))
+		return true
+	}
+
+	start := time.Now()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		fmt.Printf("DNS: 解析 %s 失败 %v\n", host, err)
+		r.hint("无法解析 %s，检查网络和 DNS 设置；域名可能已被污染或站点已更换域名，可以尝试代理或镜像站", host)
+		return false
+	}
+	var v4, v6 []net.IP
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			v4 = append(v4, addr.IP)
+		} else {
+			v6 = append(v6, addr.IP)
+		}
+	}
+	fmt.Printf("DNS: %v，%d 个 IPv4 地址、%d 个 IPv6 地址\n", time.Since(start).Round(time.Millisecond), len(v4), len(v6))
+
+	// 分别测试两种地址，不受 --ipv4-only、--ipv6-only 影响，以便判断是否需要设置
+	ok4, ok6 := r.dialFamily(ctx, "IPv4", "tcp4", v4, port), r.dialFamily(ctx, "IPv6", "tcp6", v6, port)
+	switch {
+	case !ok4 && !ok6:
+		r.hint("无法连接 %s，可能被防火墙拦截，可以尝试代理（--proxy-list 或 HTTPS_PROXY 环境变量）", host)
+		return false
+	case len(v6) > 0 && !ok6 && ok4 && ipFamily != "tcp4":
+		r.hint("%s 的 IPv6 无法连接，建议加上 --ipv4-only（或在配置文件中设置 \"ip_family\": \"ipv4\"）", host)
+	case len(v4) > 0 && !ok4 && ok6 && ipFamily != "tcp6":
+		r.hint("%s 的 IPv4 无法连接，建议加上 --ipv6-only", host)
+	}
+	return true
+}
+
+// dialFamily 连接一种地址类型的第一个地址，没有该类型的地址时返回 false
+func (r *nettestReport) dialFamily(ctx context.Context, label, network string, ips []net.IP, port string) bool {
+	if len(ips) == 0 {
+		return false
+	}
+	elapsed, err := nettestDial(ctx, network, net.JoinHostPort(ips[0].String(), port))
+	if err != nil {
+		fmt.Printf("%s 连接 %s: 失败 %v\n", label, ips[0], err)
+		return false
+	}
+	fmt.Printf("%s 连接 %s: %v\n", label, ips[0], elapsed.Round(time.Millisecond))
+	return true
+}
+
+// nettestDial 建立一个 TCP 连接并立即关闭，返回用时
+func nettestDial(ctx context.Context, network, addr string) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+	if err != nil {
+		return 0, err
+	}
+	conn.Close()
+	return time.Since(start), nil
+}
+
+// testPage 请求几次网页，输出首字节时间，检查证书、状态码和延迟
+func (r *nettestReport) testPage(ctx context.Context, pageURL string) {
+	var latencies []time.Duration
+	for i := 0; i < nettestRounds; i++ {
+		status, ttfb, _, err := nettestGet(ctx, pageURL, false)
+		if err != nil {
+			fmt.Printf("请求网页: 失败 %v\n", err)
+			r.requestError(err, pageURL)
+			return
+		}
+		fmt.Printf("请求网页: 状态码 %d，首字节 %v\n", status, ttfb.Round(time.Millisecond))
+		if r.statusHint(status, pageURL) {
+			return
+		}
+		latencies = append(latencies, ttfb)
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	median := latencies[len(latencies)/2]
+	fmt.Printf("首字节时间中位数: %v\n", median.Round(time.Millisecond))
+	if median > nettestSlowLatency {
+		r.hint("网页的响应很慢（%v），可以尝试代理或更近的镜像站；页面经常超时时用 --page-timeout 延长超时时间",
+			median.Round(time.Millisecond))
+	}
+}
+
+// testImages 按主机分组，每个图片服务器完整下载几张图片，输出首字节时间和下载速度
+func (r *nettestReport) testImages(ctx context.Context, images []string, perHost int) {
+	byHost := map[string][]string{}
+	var hosts []string
+	for _, img := range images {
+		u, err := url.Parse(img)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if _, ok := byHost[u.Host]; !ok {
+			hosts = append(hosts, u.Host)
+		}
+		byHost[u.Host] = append(byHost[u.Host], img)
+	}
+	for _, host := range hosts {
+		fmt.Printf("\n== 图片服务器 %s ==\n", host)
+		urls := byHost[host]
+		if !r.testHost(ctx, urls[0]) {
+			continue
+		}
+		var total int64
+		var elapsed time.Duration
+		for _, img := range urls[:min(perHost, len(urls))] {
+			start := time.Now()
+			status, ttfb, n, err := nettestGet(ctx, img, true)
+			if err != nil {
+				fmt.Printf("下载图片: 失败 %v\n", err)
+				r.requestError(err, img)
+				break
+			}
+			if r.statusHint(status, img) {
+				break
+			}
+			took := time.Since(start)
+			total, elapsed = total+n, elapsed+took
+			fmt.Printf("下载图片: %s，首字节 %v，共 %v\n", formatBytes(n), ttfb.Round(time.Millisecond), took.Round(time.Millisecond))
+		}
+		if total == 0 {
+			continue
+		}
+		rate := bytesPerSecond(total, elapsed)
+		fmt.Printf("下载速度: %s/s\n", formatBytes(rate))
+		switch {
+		case rate < nettestSlowRate:
+			r.hint("%s 的下载速度只有 %s/s，可以尝试代理，或用 --image-host 换到其他图片服务器；大图片经常超时时用 --image-timeout 延长超时时间",
+				host, formatBytes(rate))
+		case imageWorkers == 1:
+			r.hint("单线程下载，%s 的速度为 %s/s；站点允许时可以用 --workers 4 同时下载多张图片", host, formatBytes(rate))
+		}
+		if limit := bandwidth.current().rate; limit > 0 && limit < rate/2 {
+			r.hint("--limit-rate 的带宽上限（%s/s）远低于实际速度（%s/s），下载慢是限速造成的", formatBytes(limit), formatBytes(rate))
+		}
+	}
+}
+
+// nettestGet 直接请求一次（不经过熔断器、限速和 Fetcher），读完响应体，返回状态码、首字节时间和内容大小
+func nettestGet(ctx context.Context, rawURL string, image bool) (int, time.Duration, int64, error) {
+	timeout := pageTimeout
+	if image {
+		timeout = imageTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var firstByte time.Time
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	})
+	req, err := newImageProbe(ctx, "GET", rawURL)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if !image {
+		req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	}
+	start := time.Now()
+	resp, err := (&http.Client{Transport: pageTransport(), Jar: siteCookies, CheckRedirect: checkRedirect}).Do(req)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer resp.Body.Close()
+	n, err := io.Copy(io.Discard, resp.Body)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return resp.StatusCode, firstByte.Sub(start), n, nil
+}
+
+// requestError 按请求失败的原因给出建议
+func (r *nettestReport) requestError(err error, rawURL string) {
+	var unknownAuthority x509.UnknownAuthorityError
+	var verifyErr *tls.CertificateVerificationError
+	switch {
+	case errors.As(err, &unknownAuthority) || errors.As(err, &verifyErr):
+		r.hint("%s 的证书无法校验；通过会替换证书的代理（如公司网络、mitmproxy）时，用 --ca-cert 指定代理的根证书", rawURL)
+	case errors.Is(err, context.DeadlineExceeded):
+		r.hint("请求 %s 超时，网络较慢时用 --page-timeout、--image-timeout 延长超时时间，或尝试代理", rawURL)
+	default:
+		r.hint("请求 %s 失败（%v），检查网络或尝试代理", rawURL, err)
+	}
+}
+
+// statusHint 按状态码给出建议，状态码表示请求失败时返回 true
+func (r *nettestReport) statusHint(status int, rawURL string) bool {
+	switch {
+	case status == http.StatusOK || status == http.StatusPartialContent:
+		return false
+	case status == http.StatusForbidden || status == http.StatusTooManyRequests:
+		r.hint("%s 返回 %d，IP 可能被站点限制；稍后再试，或用 --rotate --proxy-list 轮换代理，--polite 降低请求频率", rawURL, status)
+	case status >= 500:
+		r.hint("%s 返回 %d，站点服务器暂时出错，稍后再试", rawURL, status)
+	default:
+		r.hint("%s 返回 %d", rawURL, status)
+	}
+	return true
+}
+
+// nettestImages 获取章节（指定漫画时为第一章）中的图片链接
+func nettestImages(ctx context.Context, t target) []string {
+	site := siteFor(t.baseURL)
+	chapterID := t.id
+	if t.kind == targetSeries {
+		series, err := site.fetchSeries(ctx, t.baseURL, t.id)
+		if err != nil || len(series.chapters) == 0 {
+			fmt.Printf("获取漫画目录失败: %v\n", err)
+			return nil
+		}
+		chapterID = series.chapters[0].id
+	}
+	page, err := site.fetchChapter(ctx, t.baseURL, chapterID)
+	if err != nil {
+		fmt.Printf("获取章节失败: %v\n", err)
+		return nil
+	}
+	rewriteImageHosts(page)
+	return page.images
+}
+
+// print 输出发现的问题和建议
+func (r *nettestReport) print() {
+	fmt.Println()
+	if len(r.hints) == 0 {
+		fmt.Println("未发现问题")
+		return
+	}
+	fmt.Println("== 建议 ==")
+	for _, hint := range r.hints {
+		fmt.Printf("- %s\n", hint)
+	}
+}
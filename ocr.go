@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ocrIndexFile 漫画目录中保存文字识别结果的文件，grep 命令在其中搜索
+const ocrIndexFile = "ocr.json"
+
+var (
+	// ocrAfterDownload 下载完漫画后识别新章节中的文字，由 --ocr 或配置文件的 ocr 开启
+	ocrAfterDownload bool
+	// ocrLang tesseract 使用的语言，竖排的漫画可以用 chi_tra_vert 等
+	ocrLang = "chi_tra+chi_sim"
+)
+
+// ocrIndex 一部漫画的文字索引，按"章节目录/文件名"索引每一页
+type ocrIndex struct {
+	Lang  string              `json:"lang"`
+	Pages map[string]*ocrPage `json:"pages"`
+}
+
+// ocrPage 一页的识别结果，校验和不变时不再重新识别
+type ocrPage struct {
+	Chapter string `json:"chapter"` // 章节目录名
+	Index   int    `json:"index"`   // 页码，从0开始
+	File    string `json:"file"`
+	SHA256  string `json:"sha256"`
+	Text    string `json:"text"`
+}
+
+// loadOCRIndex 读取漫画目录中的文字索引，不存在时返回空索引
+func loadOCRIndex(seriesDir string) (*ocrIndex, error) {
+	index := &ocrIndex{Pages: make(map[string]*ocrPage)}
+	data, err := os.ReadFile(filepath.Join(seriesDir, ocrIndexFile))
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %v", ocrIndexFile, err)
+	}
+	if index.Pages == nil {
+		index.Pages = make(map[string]*ocrPage)
+	}
+	return index, nil
+}
+
+// save 写入漫画目录中的 ocr.json
+func (x *ocrIndex) save(seriesDir string) error {
+	data, err := json.MarshalIndent(x, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(seriesDir, ocrIndexFile), data)
+}
+
+// indexSeriesOCR 用 tesseract 识别漫画目录中还没有识别过（或图片已变化）的页，更新文字索引，返回识别的页数
+// 按 chapter.json 中的校验和判断是否需要重新识别；已删除的页从索引中移除
+func indexSeriesOCR(seriesDir string, workers int, force bool) (int, error) {
+	tesseract, err := exec.LookPath("tesseract")
+	if err != nil {
+		return 0, fmt.Errorf("未找到 tesseract 程序，请先安装 tesseract 和所需的语言数据（如 tesseract-ocr-chi-tra）")
+	}
+	index, err := loadOCRIndex(seriesDir)
+	if err != nil {
+		return 0, err
+	}
+	if index.Lang != ocrLang {
+		// 换了语言后之前的结果不再沿用
+		force = true
+		index.Lang = ocrLang
+	}
+
+	var todo []*ocrPage
+	seen := make(map[string]bool)
+	for _, dir := range chapterDirs(seriesDir) {
+		meta, err := loadChapterMeta(dir)
+		if err != nil {
+			continue
+		}
+		chapter := filepath.Base(dir)
+		for _, p := range meta.Pages {
+			key := chapter + "/" + p.File
+			seen[key] = true
+			if old, ok := index.Pages[key]; ok && !force && old.SHA256 == p.SHA256 {
+				continue
+			}
+			todo = append(todo, &ocrPage{Chapter: chapter, Index: p.Index, File: p.File, SHA256: p.SHA256})
+		}
+	}
+	for key := range index.Pages {
+		if !seen[key] {
+			delete(index.Pages, key)
+		}
+	}
+
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		done   int
+		failed int
+	)
+	queue := make(chan *ocrPage)
+	for w := 0; w < min(workers, len(todo)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for page := range queue {
+				path := filepath.Join(seriesDir, page.Chapter, page.File)
+				output, err := exec.CommandContext(runContext, tesseract, longPath(path), "stdout", "-l", ocrLang).Output()
+				mu.Lock()
+				if err != nil {
+					failed++
+					verbosef("识别 %s 失败: %v\n", path, err)
+				} else {
+					page.Text = strings.TrimSpace(string(output))
+					index.Pages[page.Chapter+"/"+page.File] = page
+					done++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, page := range todo {
+		if runContext.Err() != nil {
+			break
+		}
+		queue <- page
+	}
+	close(queue)
+	wg.Wait()
+
+	if failed > 0 {
+		fmt.Printf("%d 页识别失败，请检查 tesseract 是否安装了语言数据 %s\n", failed, ocrLang)
+	}
+	return done, index.save(seriesDir)
+}
+
+// runOCRCommand 识别漫画中的文字并建立索引，之后可以用 grep 搜索
+func runOCRCommand(args []string) {
+	workers := 2
+	force := false
+	var targets []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--force":
+			force = true
+		case "--lang":
+			if i+1 >= len(args) {
+				fmt.Printf("%s 需要一个语言，如 chi_sim\n", args[i])
+				return
+			}
+			ocrLang = args[i+1]
+			i++
+		case "-j", "--workers":
+			if i+1 >= len(args) {
+				fmt.Printf("%s 需要一个数值\n", args[i])
+				return
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				fmt.Printf("无效的并发数: %s\n", args[i+1])
+				return
+			}
+			workers = n
+			i++
+		default:
+			targets = append(targets, args[i])
+		}
+	}
+
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		fmt.Println("未找到 tesseract 程序，请先安装 tesseract 和所需的语言数据（如 tesseract-ocr-chi-tra）")
+		return
+	}
+	seriesDirs, err := repackTargets(targets)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+	total := 0
+	for _, seriesDir := range seriesDirs {
+		if runContext.Err() != nil {
+			break
+		}
+		n, err := indexSeriesOCR(seriesDir, workers, force)
+		if err != nil {
+			fmt.Printf("%s: %v\n", seriesDir, err)
+			continue
+		}
+		if n > 0 {
+			fmt.Printf("%s: 识别了 %d 页\n", filepath.Base(seriesDir), n)
+		}
+		total += n
+	}
+	fmt.Printf("共识别 %d 页，可以用 ./comicbox grep <文字> 搜索\n", total)
+}
+
+// ocrAfterSeries 下载完漫画后更新文字索引，失败时只输出提示
+func ocrAfterSeries(seriesDir string) {
+	n, err := indexSeriesOCR(seriesDir, 2, false)
+	if err != nil {
+		fmt.Printf("识别文字失败: %v\n", err)
+		return
+	}
+	if n > 0 {
+		infof("识别了 %d 页的文字\n", n)
+	}
+}
+
+// runGrepCommand 在文字索引中搜索，列出包含这段文字的章节和页码
+// 搜索前按章节标题的规则规范化（忽略空白、标点、全半角和常用繁简字），识别结果中的换行和空格不影响匹配
+func runGrepCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("用法: ./comicbox grep <文字> [漫画ID|漫画目录...]")
+		return
+	}
+	phrase := normalizeChapterTitle(args[0])
+	if phrase == "" {
+		fmt.Println("搜索的文字不能为空")
+		return
+	}
+	seriesDirs, err := repackTargets(args[1:])
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	found, indexed := 0, 0
+	for _, seriesDir := range seriesDirs {
+		index, err := loadOCRIndex(seriesDir)
+		if err != nil {
+			fmt.Printf("%s: %v\n", seriesDir, err)
+			continue
+		}
+		if len(index.Pages) == 0 {
+			continue
+		}
+		indexed++
+		var matches []*ocrPage
+		for _, page := range index.Pages {
+			if strings.Contains(normalizeChapterTitle(page.Text), phrase) {
+				matches = append(matches, page)
+			}
+		}
+		sort.Slice(matches, func(i, j int) bool {
+			if matches[i].Chapter != matches[j].Chapter {
+				return matches[i].Chapter < matches[j].Chapter
+			}
+			return matches[i].Index < matches[j].Index
+		})
+		for _, page := range matches {
+			fmt.Printf("%s/%s 第 %d 页: %s\n", filepath.Base(seriesDir), page.Chapter, page.Index+1, ocrSnippet(page.Text, phrase))
+		}
+		found += len(matches)
+	}
+	if indexed == 0 {
+		fmt.Println("还没有识别过文字，请先运行 ./comicbox ocr [漫画ID|漫画目录]")
+		return
+	}
+	if found == 0 {
+		fmt.Println("没有找到")
+	}
+}
+
+// ocrSnippet 识别结果中包含搜索文字的那一行，文字跨行时返回整页文字；过长时截断
+func ocrSnippet(text, phrase string) string {
+	snippet := strings.Join(strings.Fields(text), " ")
+	for _, line := range strings.Split(text, "\n") {
+		if strings.Contains(normalizeChapterTitle(line), phrase) {
+			snippet = strings.TrimSpace(line)
+			break
+		}
+	}
+	if utf8.RuneCountInString(snippet) > 60 {
+		snippet = string([]rune(snippet)[:60]) + "…"
+	}
+	return snippet
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseGlobalFlag 解析所有模式通用的参数
+// 返回消耗的参数个数，不是通用参数时返回0
+func parseGlobalFlag(args []string, i int) (int, error) {
+	hasValue := i+1 < len(args)
+
+	switch args[i] {
+	case "--workers":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个数值", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("无效的并发数: %s", args[i+1])
+		}
+		imageWorkers = n
+		return 2, nil
+	case "--ban-threshold":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个数值", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("无效的熔断阈值: %s", args[i+1])
+		}
+		siteBreaker.threshold = n
+		return 2, nil
+	case "--cooldown":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个时长，如 5m", args[i])
+		}
+		d, err := time.ParseDuration(args[i+1])
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("无效的冷却时间: %s", args[i+1])
+		}
+		siteBreaker.cooldown = d
+		return 2, nil
+	case "--page-width", "--page-start":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个数值", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 || n > 10 {
+			return 0, fmt.Errorf("无效的数值: %s", args[i+1])
+		}
+		if args[i] == "--page-width" {
+			pageNames.width = n
+		} else {
+			pageNames.start = n
+		}
+		return 2, nil
+	case "--page-ext":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要 jpg、url 或 auto", args[i])
+		}
+		switch args[i+1] {
+		case "jpg", "url", "auto":
+			pageNames.ext = args[i+1]
+		default:
+			return 0, fmt.Errorf("无效的扩展名策略: %s（可选 jpg、url、auto）", args[i+1])
+		}
+		return 2, nil
+	case "--polite":
+		politeMode.enabled = true
+		return 1, nil
+	case "--page-timeout", "--image-timeout":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个时长，如 90s", args[i])
+		}
+		d, err := parseTimeout(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		if args[i] == "--page-timeout" {
+			pageTimeout = d
+		} else {
+			imageTimeout = d
+		}
+		return 2, nil
+	case "--polite-delay":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个时长，如 5s", args[i])
+		}
+		d, err := time.ParseDuration(args[i+1])
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("无效的请求间隔: %s", args[i+1])
+		}
+		politeMode.enabled = true
+		politeMode.delay = d
+		return 2, nil
+	case "--humanize":
+		browseSim.enabled = true
+		return 1, nil
+	case "--humanize-window":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个数值", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("无效的窗口大小: %s", args[i+1])
+		}
+		browseSim.enabled = true
+		browseSim.window = n
+		return 2, nil
+	case "--rules":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个规则文件路径", args[i])
+		}
+		if err := useRules(args[i+1]); err != nil {
+			return 0, fmt.Errorf("读取规则文件失败: %v", err)
+		}
+		return 2, nil
+	case "--out":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个目录路径", args[i])
+		}
+		if err := setOutputRoot(args[i+1]); err != nil {
+			return 0, err
+		}
+		return 2, nil
+	case "--scratch":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个目录路径", args[i])
+		}
+		if err := setScratchRoot(args[i+1]); err != nil {
+			return 0, err
+		}
+		return 2, nil
+	case "--on-locked":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要 error、wait 或 skip", args[i])
+		}
+		switch args[i+1] {
+		case "error", "wait", "skip":
+			lockPolicy = args[i+1]
+		default:
+			return 0, fmt.Errorf("无效的处理方式: %s（可选 error、wait、skip）", args[i+1])
+		}
+		return 2, nil
+	case "--language", "--writer", "--publisher", "--age-rating":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个值", args[i])
+		}
+		switch args[i] {
+		case "--language":
+			metadataFlags.Language = args[i+1]
+		case "--writer":
+			metadataFlags.Writer = args[i+1]
+		case "--publisher":
+			metadataFlags.Publisher = args[i+1]
+		default:
+			metadataFlags.AgeRating = args[i+1]
+		}
+		return 2, nil
+	case "--title":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个名称", args[i])
+		}
+		titleOverride = args[i+1]
+		return 2, nil
+	case "--warc":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个文件路径", args[i])
+		}
+		if warc != nil {
+			warc.close()
+		}
+		w, err := openWarc(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		warc = w
+		return 2, nil
+	case "--fetcher":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要抓取方式: http、browser 或 fixture:<目录>", args[i])
+		}
+		fetcher, err := parseFetcher(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		siteFetcher = fetcher
+		return 2, nil
+	case "--har":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个文件路径", args[i])
+		}
+		if !debugMode {
+			return 0, fmt.Errorf("%s 需要与 --debug 一起使用", args[i])
+		}
+		har = openHar(args[i+1])
+		return 2, nil
+	case "--post":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个处理步骤，如 split:rtl", args[i])
+		}
+		// 命令行指定的步骤替换配置文件中的步骤
+		if !postFromFlags {
+			postFromFlags = true
+			postSteps = &postPipeline{quality: 90}
+		}
+		if err := postSteps.parsePostStep(args[i+1]); err != nil {
+			return 0, err
+		}
+		return 2, nil
+	case "--window":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个时间段，如 01:00-07:00 或 08:00-23:00@200K", args[i])
+		}
+		w, err := parseDownloadWindow(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		// 命令行指定的时间段替换配置文件中的时间段
+		windows := bandwidth.current().windows
+		if !windowsFromFlags {
+			windowsFromFlags = true
+			windows = nil
+		}
+		bandwidth.setWindows(append(windows, w))
+		return 2, nil
+	case "--image-host":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要 旧主机名=新主机名，如 img1.old-cdn.com=img.new-cdn.com", args[i])
+		}
+		from, to, err := parseImageHost(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		imageHostMap[from] = to
+		return 2, nil
+	case "--extras":
+		chapterExtras = true
+		return 1, nil
+	case "--max-redirects":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个次数，0 为不跟随重定向", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("无效的重定向次数: %s", args[i+1])
+		}
+		maxRedirects = n
+		return 2, nil
+	case "--redirects":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要 %s、%s 或 %s", args[i], redirectFollow, redirectAllowlist, redirectSameHost)
+		}
+		policy, err := parseRedirectPolicy(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		redirectPolicy = policy
+		return 2, nil
+	case "--redirect-allow":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个主机名，如 cdn.example.com 或 *.example.com", args[i])
+		}
+		redirectAllow = append(redirectAllow, args[i+1])
+		return 2, nil
+	case "--limit-rate":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个速率，如 500K，0 为不限制", args[i])
+		}
+		n, err := parseByteSize(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		bandwidth.setRate(n)
+		return 2, nil
+	case "--image-backend":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要 auto、vips 或 go", args[i])
+		}
+		backend, err := parseImageBackend(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		imageBackend = backend
+		return 2, nil
+	case "--no-age-gate":
+		ageGateEnabled = false
+		return 1, nil
+	case "--strategy":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要提取方式，如 script-json 或 lazy-attr,rendered-dom", args[i])
+		}
+		names, err := parseStrategies(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		strategyOverride = names
+		return 2, nil
+	case "--progress":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要显示方式: auto、bars 或 lines", args[i])
+		}
+		mode, err := parseProgressMode(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		progressMode = mode
+		return 2, nil
+	case "--retry-locked":
+		retryLocked = true
+		return 1, nil
+	case "--archive":
+		archiveMode = true
+		return 1, nil
+	case "--ipv4-only":
+		ipFamily = "tcp4"
+		return 1, nil
+	case "--ipv6-only":
+		ipFamily = "tcp6"
+		return 1, nil
+	case "--ascii-names":
+		asciiNames = true
+		return 1, nil
+	case "--trim-recap":
+		trimRecap = true
+		return 1, nil
+	case "--placeholders":
+		placeholderPages = true
+		return 1, nil
+	case "--ocr":
+		ocrAfterDownload = true
+		return 1, nil
+	case "--ocr-lang":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个语言，如 chi_sim", args[i])
+		}
+		ocrLang = args[i+1]
+		return 2, nil
+	case "--translate":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个目标语言，如 en", args[i])
+		}
+		translateSettings.Target = args[i+1]
+		return 2, nil
+	case "--finalize-prune":
+		finalizePrune = true
+		return 1, nil
+	case "--best-version":
+		bestVersion = true
+		return 1, nil
+	case "--probe-sequence":
+		probeSequence = true
+		return 1, nil
+	case "--probe-workers", "--probe-misses", "--probe-limit":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个数值", args[i])
+		}
+		n, err := strconv.Atoi(args[i+1])
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("无效的数值: %s", args[i+1])
+		}
+		switch args[i] {
+		case "--probe-workers":
+			sequenceProbe.Workers = n
+		case "--probe-misses":
+			sequenceProbe.MaxMisses = n
+		default:
+			sequenceProbe.Limit = n
+		}
+		return 2, nil
+	case "--low-memory":
+		enableLowMemory()
+		return 1, nil
+	case "--image-memory":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个大小，如 256M，0 为不限制", args[i])
+		}
+		n, err := parseByteSize(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		imageMemoryLimit = n
+		return 2, nil
+	case "--min-bytes":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个大小，如 20K", args[i])
+		}
+		n, err := parseByteSize(args[i+1])
+		if err != nil {
+			return 0, err
+		}
+		imageFilters.MinBytes = n
+		return 2, nil
+	case "--min-size":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要宽x高，如 300x300", args[i])
+		}
+		if _, err := fmt.Sscanf(strings.ToLower(args[i+1]), "%dx%d", &imageFilters.MinWidth, &imageFilters.MinHeight); err != nil {
+			return 0, fmt.Errorf("无效的尺寸: %s", args[i+1])
+		}
+		return 2, nil
+	case "--aspect":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要高宽比范围，如 0.5:4", args[i])
+		}
+		if _, err := fmt.Sscanf(args[i+1], "%g:%g", &imageFilters.MinAspect, &imageFilters.MaxAspect); err != nil {
+			return 0, fmt.Errorf("无效的高宽比范围: %s", args[i+1])
+		}
+		return 2, nil
+	case "--yes", "-y":
+		assumeYes = true
+		return 1, nil
+	case "--dedupe":
+		dedupeEnabled = true
+		return 1, nil
+	case "--rotate":
+		siteBreaker.rotate = true
+		return 1, nil
+	case "--metrics-addr":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个监听地址，如 :9100", args[i])
+		}
+		startMetricsServer(args[i+1])
+		return 2, nil
+	case "--proxy-list":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个文件路径", args[i])
+		}
+		proxies, err := loadProxyList(args[i+1])
+		if err != nil {
+			return 0, fmt.Errorf("读取代理列表失败: %v", err)
+		}
+		siteBreaker.proxies = proxies
+		return 2, nil
+	case "--ca-cert":
+		if !hasValue {
+			return 0, fmt.Errorf("%s 需要一个 PEM 格式的证书文件", args[i])
+		}
+		if err := addCACert(args[i+1]); err != nil {
+			return 0, fmt.Errorf("读取 CA 证书失败: %v", err)
+		}
+		return 2, nil
+	case "--insecure-tls":
+		setInsecureTLS()
+		return 1, nil
+	}
+
+	return 0, nil
+}
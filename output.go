@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// 输出级别: quiet 只输出错误和最后的汇总，normal 为默认的下载进度，verbose 额外输出页面和重试等细节
+const (
+	outputQuiet = iota
+	outputNormal
+	outputVerbose
+)
+
+// outputLevel 当前输出级别，由 --quiet、--verbose 设置
+var outputLevel = outputNormal
+
+// debugOutput 调试信息的输出位置，默认为标准错误，--log-file 时写入文件，使标准输出（如 JSON 导出）不混入调试信息
+var debugOutput io.Writer = os.Stderr
+
+// takeOutputFlags 从命令行参数中取出 --quiet、--verbose、--log-file 和 --summary-file，返回其余参数
+func takeOutputFlags(args []string) ([]string, error) {
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--quiet", "-q":
+			outputLevel = outputQuiet
+		case "--verbose":
+			outputLevel = outputVerbose
+		case "--log-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s 需要一个文件路径", args[i])
+			}
+			file, err := os.OpenFile(args[i+1], os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+			if err != nil {
+				return nil, fmt.Errorf("打开日志文件失败: %v", err)
+			}
+			debugOutput = file
+			i++
+		case "--summary-file":
+			if i+1 >= len(args) {
+				return nil, fmt.Errorf("%s 需要一个文件路径", args[i])
+			}
+			summaryFile = args[i+1]
+			i++
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	return rest, nil
+}
+
+// infof 输出下载进度等常规信息，--quiet 时不输出
+func infof(format string, args ...interface{}) {
+	if outputLevel >= outputNormal {
+		printOutput(fmt.Sprintf(format, args...))
+	}
+}
+
+// verbosef 输出页面内容、重试等细节，只在 --verbose 或 --debug 时输出
+func verbosef(format string, args ...interface{}) {
+	if outputLevel >= outputVerbose || debugMode {
+		printOutput(fmt.Sprintf(format, args...))
+	}
+}
+
+// debugf 输出调试信息到 debugOutput，只在 --debug 时输出
+func debugf(format string, args ...interface{}) {
+	if debugMode {
+		fmt.Fprintf(debugOutput, "DEBUG: "+format, args...)
+	}
+}
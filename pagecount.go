@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// declaredPagesPattern 章节页面上标明总页数的文字，如 "共45页"、"全 32 張"
+	declaredPagesPattern = regexp.MustCompile(`(?:共|全|總共|总共)\s*(\d{1,4})\s*(?:页|頁|张|張|P)`)
+	// pageOfPattern 分页导航中的 "1/45页"
+	pageOfPattern = regexp.MustCompile(`\d{1,4}\s*/\s*(\d{1,4})\s*(?:页|頁)`)
+)
+
+// declaredPageCount 从章节页面的文字中解析标明的总页数，找不到时返回0
+func declaredPageCount(doc *goquery.Document) int {
+	text := doc.Find("body").Text()
+	for _, pattern := range []*regexp.Regexp{declaredPagesPattern, pageOfPattern} {
+		if m := pattern.FindStringSubmatch(text); m != nil {
+			if n, err := strconv.Atoi(m[1]); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 0
+}
+
+// checkPageCount 比较提取出的图片数与页面上标明的页数
+// 不一致时按图片特征重新提取，数量与标明的页数一致时改用重新提取的结果；
+// 仍然少于标明的页数（或开启了 --probe-sequence）时按图片链接的编号规律探测缺少的图片
+func checkPageCount(page *chapterPage, doc *goquery.Document, base *url.URL) {
+	page.declared = declaredPageCount(doc)
+	if page.declared != 0 && len(page.images) != page.declared {
+		fmt.Printf("警告: 页面标明共 %d 页，但提取到 %d 张图片\n", page.declared, len(page.images))
+
+		if guessed := guessPageImages(doc, base); len(guessed) == page.declared {
+			fmt.Printf("按图片特征重新提取到 %d 张图片，改用该结果\n", len(guessed))
+			page.images = guessed
+		}
+	}
+	// 替换失效的图片服务器，之后的探测和下载都使用新的地址
+	rewriteImageHosts(page)
+	if probeSequence || len(page.images) < page.declared {
+		extendSequence(page)
+	}
+}
+
+// pageCountShort 检查下载的页数是否少于页面上标明的页数，不足时输出警告
+func pageCountShort(declared int, result chapterResult) bool {
+	if declared == 0 || result.saved >= declared {
+		return false
+	}
+	fmt.Printf("警告: 章节只下载了 %d 页，页面标明共 %d 页，章节可能不完整\n", result.saved, declared)
+	return true
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// pageNaming 页面图片的命名规则
+type pageNaming struct {
+	width int    // 页码补零宽度
+	start int    // 第一页的页码
+	ext   string // 扩展名策略：jpg 固定为 .jpg，url 使用链接中的扩展名，auto 按图片内容识别
+}
+
+// pageNames 当前使用的命名规则，默认为 0001.jpg、0002.jpg…
+var pageNames = pageNaming{width: 4, start: 1, ext: "jpg"}
+
+// imageExtensions 按内容类型识别的图片扩展名
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// pageFilename 返回第 index 张图片（从0开始）的保存路径
+func (n pageNaming) pageFilename(dirName string, index int, imgUrl string) string {
+	ext := ".jpg"
+	if n.ext == "url" {
+		if parsed, err := url.Parse(imgUrl); err == nil {
+			if e := strings.ToLower(path.Ext(parsed.Path)); isImageFile("x" + e) {
+				ext = e
+			}
+		}
+	}
+	return filepath.Join(dirName, fmt.Sprintf("%0*d%s", n.width, index+n.start, ext))
+}
+
+// fixExtension 在 auto 策略下按图片内容修正扩展名，返回最终的文件路径
+func (n pageNaming) fixExtension(filename string) string {
+	if n.ext != "auto" {
+		return filename
+	}
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return filename
+	}
+	head := make([]byte, 512)
+	count, _ := file.Read(head)
+	file.Close()
+
+	ext, ok := imageExtensions[http.DetectContentType(head[:count])]
+	if !ok || strings.EqualFold(filepath.Ext(filename), ext) {
+		return filename
+	}
+
+	renamed := strings.TrimSuffix(filename, filepath.Ext(filename)) + ext
+	if err := os.Rename(filename, renamed); err != nil {
+		return filename
+	}
+	return renamed
+}
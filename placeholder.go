@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// placeholderPages 图片重试后仍然下载失败时，在该页的位置插入占位图，使打包后的页码不错位，
+// 由 --placeholders 或配置文件的 placeholders 开启
+var placeholderPages bool
+
+// missingPage 用占位图代替的页，记录在 chapter.json 中，修复或下次更新时重新下载
+type missingPage struct {
+	Index  int    `json:"index"` // 页码，从0开始
+	File   string `json:"file"`  // 占位图的文件名
+	URL    string `json:"url"`
+	Reason string `json:"reason"` // 下载失败的原因
+}
+
+// placeholderWidth、placeholderHeight 没有其他页可参考时占位图的尺寸
+const (
+	placeholderWidth  = 800
+	placeholderHeight = 1200
+)
+
+// insertPlaceholders 为下载失败的页生成占位图，返回占位的页；未开启、下载被中断或没有失败的页时返回nil
+// 占位图不计入 chapter.json 的 pages，校验时仍然报告这些页缺失，result.failed 中去掉已占位的页
+func insertPlaceholders(ctx context.Context, dir string, images []string, result *chapterResult) []missingPage {
+	if !placeholderPages || ctx.Err() != nil || result.failed == 0 {
+		return nil
+	}
+	width, height := referencePageSize(result.files)
+	var missing []missingPage
+	for index := range result.files {
+		err, failed := result.errs[index]
+		if !failed || result.files[index] != "" {
+			continue
+		}
+		filename := pageNames.pageFilename(dir, index, images[index])
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".png"
+		if err := writePlaceholder(filename, width, height, index, placeholderReason(err)); err != nil {
+			fmt.Printf("生成第 %d 页的占位图失败: %v\n", index+1, err)
+			continue
+		}
+		missing = append(missing, missingPage{Index: index, File: filepath.Base(filename), URL: images[index], Reason: err.Error()})
+		result.failed--
+	}
+	if len(missing) > 0 {
+		fmt.Printf("%d 页下载失败，已插入占位图，修复或下次更新时重新下载\n", len(missing))
+	}
+	return missing
+}
+
+// clearPlaceholders 重新下载章节前删除之前插入的占位图，仍然失败的页会重新生成
+func clearPlaceholders(dir string) {
+	meta, err := loadChapterMeta(dir)
+	if err != nil {
+		return
+	}
+	for _, m := range meta.Missing {
+		os.Remove(filepath.Join(dir, m.File))
+	}
+}
+
+// referencePageSize 占位图使用第一张能读取尺寸的页的大小，与章节中的其他页一致
+func referencePageSize(files []string) (int, int) {
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			continue
+		}
+		cfg, _, err := image.DecodeConfig(f)
+		f.Close()
+		if err == nil && cfg.Width >= 200 && cfg.Height >= 200 {
+			return cfg.Width, cfg.Height
+		}
+	}
+	return placeholderWidth, placeholderHeight
+}
+
+// placeholderReason 占位图上显示的失败原因，内置字体只有英文字母和数字
+func placeholderReason(err error) string {
+	var statusErr *httpStatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("HTTP %d", statusErr.StatusCode)
+	case errors.Is(err, context.DeadlineExceeded):
+		return "TIMEOUT"
+	case errors.As(err, &netErr):
+		return "NETWORK ERROR"
+	}
+	return "SOURCE ERROR"
+}
+
+// writePlaceholder 生成浅灰底、居中写着页码和失败原因的 PNG
+func writePlaceholder(filename string, width, height, index int, reason string) error {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xee
+	}
+	lines := []string{fmt.Sprintf("PAGE %d", index+1), "MISSING", reason}
+	longest := 0
+	for _, line := range lines {
+		longest = max(longest, len(line))
+	}
+	// 每个字 5x7 点，字间和行间各空一点，按最长的一行占宽度的 80% 缩放
+	scale := max(width*8/10/(longest*6), 1)
+	lineHeight := 9 * scale
+	y := (height - len(lines)*lineHeight) / 2
+	for _, line := range lines {
+		x := (width - len(line)*6*scale + scale) / 2
+		for _, r := range line {
+			drawGlyph(img, x, y, scale, r)
+			x += 6 * scale
+		}
+		y += lineHeight
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, buf.Bytes())
+}
+
+// drawGlyph 在 (x, y) 处画一个放大 scale 倍的字，没有字形的字符留空
+func drawGlyph(img *image.Gray, x, y, scale int, r rune) {
+	glyph, ok := placeholderFont[r]
+	if !ok {
+		return
+	}
+	ink := color.Gray{Y: 0x55}
+	for row, bits := range glyph {
+		for col, bit := range bits {
+			if bit != '#' {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetGray(x+col*scale+dx, y+row*scale+dy, ink)
+				}
+			}
+		}
+	}
+}
+
+// placeholderFont 占位图使用的 5x7 点阵字体
+var placeholderFont = map[rune][7]string{
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D': {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F': {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".####"},
+	'H': {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'I': {".###.", "..#..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'J': {"..###", "...#.", "...#.", "...#.", "...#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'O': {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X': {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'-': {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+}
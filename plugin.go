@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 插件可以注册的时机
+const (
+	pluginChapterDiscovered = "chapter_discovered" // 更新漫画时在目录中发现需要下载的章节
+	pluginPageDownloaded    = "page_downloaded"    // 一页图片下载（和后处理）完成
+	pluginChapterPacked     = "chapter_packed"     // 章节打包为CBZ（存档模式或 repack）
+)
+
+// pluginTimeout 插件未设置 timeout 时每次调用的超时时间
+const pluginTimeout = 30 * time.Second
+
+// pluginConfig 配置文件 plugins 中的一个插件：在指定的时机调用外部程序，事件以一行 JSON 写入标准输入
+type pluginConfig struct {
+	Name    string   `json:"name"`    // 输出中显示的名称，默认为程序名
+	Command []string `json:"command"` // 程序和参数
+	Events  []string `json:"events"`  // 调用的时机，为空时所有时机都调用
+	Timeout string   `json:"timeout"` // 每次调用的超时时间，如 "2m"，默认 30s
+
+	timeout time.Duration
+}
+
+// plugins 配置文件中有效的插件，按配置的顺序调用
+var plugins []pluginConfig
+
+// pluginEvent 写入插件标准输入的事件，不同时机只填写相关的字段
+type pluginEvent struct {
+	Event        string   `json:"event"`
+	SeriesID     string   `json:"series_id,omitempty"`
+	SeriesTitle  string   `json:"series_title,omitempty"`
+	ChapterID    string   `json:"chapter_id,omitempty"`
+	ChapterTitle string   `json:"chapter_title,omitempty"`
+	Number       int      `json:"number,omitempty"`  // 章节在目录中的序号，从1开始
+	Dir          string   `json:"dir,omitempty"`     // 章节目录，下载中的章节设置了 --scratch 时为临时目录
+	Page         int      `json:"page,omitempty"`    // 页码，从1开始
+	Total        int      `json:"total,omitempty"`   // 章节的总页数
+	URL          string   `json:"url,omitempty"`     // 图片链接
+	Files        []string `json:"files,omitempty"`   // 保存的图片，后处理拆分出多张时包括附加部分
+	Archive      string   `json:"archive,omitempty"` // 生成的CBZ
+}
+
+// setPlugins 检查配置文件中的插件，没有程序、时机未知或超时时间无效的插件输出提示后忽略
+func setPlugins(configs []pluginConfig) {
+	plugins = nil
+	for i, p := range configs {
+		if len(p.Command) == 0 || p.Command[0] == "" {
+			fmt.Printf("配置文件中的第 %d 个插件没有指定 command，已忽略\n", i+1)
+			continue
+		}
+		valid := true
+		for _, event := range p.Events {
+			switch event {
+			case pluginChapterDiscovered, pluginPageDownloaded, pluginChapterPacked:
+			default:
+				fmt.Printf("插件 %s 的时机无效: %s（可用 %s、%s、%s），已忽略\n", p.name(), event,
+					pluginChapterDiscovered, pluginPageDownloaded, pluginChapterPacked)
+				valid = false
+			}
+		}
+		p.timeout = pluginTimeout
+		if p.Timeout != "" {
+			d, err := time.ParseDuration(p.Timeout)
+			if err != nil || d <= 0 {
+				fmt.Printf("插件 %s 的 timeout 无效: %s，已忽略\n", p.name(), p.Timeout)
+				valid = false
+			}
+			p.timeout = d
+		}
+		if valid {
+			plugins = append(plugins, p)
+		}
+	}
+}
+
+// name 插件在输出中显示的名称
+func (p pluginConfig) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+	return filepath.Base(p.Command[0])
+}
+
+// handles 插件是否注册了这个时机
+func (p pluginConfig) handles(event string) bool {
+	if len(p.Events) == 0 {
+		return true
+	}
+	for _, e := range p.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// runPlugins 依次调用注册了该时机的插件，插件失败时只输出提示，不影响下载和打包
+func runPlugins(ev pluginEvent) {
+	if len(plugins) == 0 {
+		return
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	data = append(data, '\n')
+	for _, p := range plugins {
+		if !p.handles(ev.Event) || runContext.Err() != nil {
+			continue
+		}
+		if err := p.run(data); err != nil {
+			fmt.Printf("插件 %s 处理 %s 失败: %v\n", p.name(), ev.Event, err)
+		}
+	}
+}
+
+// run 启动插件程序并把事件写入标准输入，插件的标准输出在 --verbose 时显示，失败时返回标准错误中的内容
+func (p pluginConfig) run(data []byte) error {
+	ctx, cancel := context.WithTimeout(runContext, p.timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Command[0], p.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	output, err := cmd.Output()
+	if out := strings.TrimSpace(string(output)); out != "" {
+		verbosef("[%s] %s\n", p.name(), out)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("超过 %v 未完成", p.timeout)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	return err
+}
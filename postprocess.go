@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// postProcessor 图片后处理步骤，每页下载完成后按顺序执行
+// 返回处理后的图片，返回多张时（如拆分跨页）后面的图片保存为同一页的附加部分
+// 新增处理方式时实现该接口并在 parsePostStep 中加入对应的名称
+type postProcessor interface {
+	name() string
+	process(img image.Image) ([]image.Image, error)
+}
+
+// postPipeline 本次运行的后处理步骤，由 --post 或配置文件的 post_process 设置
+type postPipeline struct {
+	steps   []postProcessor
+	format  string // 输出格式: jpeg、png，为空时保持原格式
+	quality int    // JPEG 质量
+}
+
+var (
+	// postSteps 当前的后处理步骤
+	postSteps = &postPipeline{quality: 90}
+	// postFromFlags 命令行中已指定 --post，此时不使用配置文件中的步骤
+	postFromFlags bool
+)
+
+// enabled 是否需要后处理
+func (p *postPipeline) enabled() bool {
+	return len(p.steps) > 0 || p.format != ""
+}
+
+// parsePostStep 解析一个后处理步骤并加入流水线，格式为 名称[:参数]：
+//
+//	crop:上,右,下,左      裁掉四周的白边（像素）
+//	resize:宽度           宽度超过时按比例缩小
+//	split[:rtl]           将横向的跨页拆成两页，rtl 时先右后左（日漫）
+//	watermark:高度[:top]  裁掉底部（或顶部）固定高度的水印条
+//	convert:jpeg[:质量]   转换格式，也可以是 convert:png
+func (p *postPipeline) parsePostStep(spec string) error {
+	name, arg, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	ints := func(s string, n int) ([]int, error) {
+		parts := strings.Split(s, ",")
+		if len(parts) != n {
+			return nil, fmt.Errorf("%s 需要 %d 个数字: %s", name, n, spec)
+		}
+		values := make([]int, n)
+		for i, part := range parts {
+			v, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil || v < 0 {
+				return nil, fmt.Errorf("%s 的参数无效: %s", name, spec)
+			}
+			values[i] = v
+		}
+		return values, nil
+	}
+
+	switch name {
+	case "crop":
+		v, err := ints(arg, 4)
+		if err != nil {
+			return err
+		}
+		p.steps = append(p.steps, cropStep{top: v[0], right: v[1], bottom: v[2], left: v[3]})
+	case "resize":
+		v, err := ints(arg, 1)
+		if err != nil || v[0] == 0 {
+			return fmt.Errorf("resize 需要宽度: %s", spec)
+		}
+		p.steps = append(p.steps, resizeStep{width: v[0]})
+	case "split":
+		if arg != "" && arg != "rtl" && arg != "ltr" {
+			return fmt.Errorf("split 的参数只能是 rtl 或 ltr: %s", spec)
+		}
+		p.steps = append(p.steps, splitStep{rtl: arg == "rtl"})
+	case "watermark":
+		height, pos, _ := strings.Cut(arg, ":")
+		v, err := ints(height, 1)
+		if err != nil || (pos != "" && pos != "top" && pos != "bottom") {
+			return fmt.Errorf("watermark 需要水印条高度，如 watermark:60 或 watermark:60:top: %s", spec)
+		}
+		p.steps = append(p.steps, watermarkStep{height: v[0], top: pos == "top"})
+	case "convert":
+		format, quality, _ := strings.Cut(arg, ":")
+		switch format {
+		case "jpeg", "jpg":
+			p.format = "jpeg"
+		case "png":
+			p.format = "png"
+		default:
+			return fmt.Errorf("convert 只支持 jpeg 和 png: %s", spec)
+		}
+		if quality != "" {
+			q, err := strconv.Atoi(quality)
+			if err != nil || q < 1 || q > 100 {
+				return fmt.Errorf("JPEG 质量应为 1-100: %s", spec)
+			}
+			p.quality = q
+		}
+	default:
+		return fmt.Errorf("未知的后处理步骤: %s（可选 crop、resize、split、watermark、convert）", spec)
+	}
+	return nil
+}
+
+// apply 对一页图片执行所有后处理步骤，返回处理后的文件（第一个为该页，其余为拆分出的部分）
+// 安装了 vips 时优先使用（逐块处理，不需要把整张图片读入内存），不可用或失败时改用 Go 实现
+func (p *postPipeline) apply(file string) ([]string, error) {
+	if vips, ok := p.vipsBackend(); ok {
+		files, err := p.applyVips(vips, file)
+		if err == nil {
+			return files, nil
+		}
+		debugf("vips 处理 %s 失败，改用 Go 处理: %v\n", file, err)
+	}
+	return p.applyGo(file)
+}
+
+// applyGo 用标准库解码并处理图片，无法解码的图片（如 WebP）、超过内存上限的大图或处理失败时保留原图
+func (p *postPipeline) applyGo(file string) ([]string, error) {
+	release, err := reserveImageMemory(file)
+	if err != nil {
+		return []string{file}, err
+	}
+	defer release()
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return []string{file}, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return []string{file}, fmt.Errorf("无法解码图片，保留原图: %v", err)
+	}
+
+	images := []image.Image{img}
+	for _, step := range p.steps {
+		var next []image.Image
+		for _, im := range images {
+			out, err := step.process(im)
+			if err != nil {
+				return []string{file}, fmt.Errorf("%s 失败，保留原图: %v", step.name(), err)
+			}
+			next = append(next, out...)
+		}
+		images = next
+	}
+
+	if p.format != "" {
+		format = p.format
+	}
+	ext := map[string]string{"jpeg": ".jpg", "png": ".png", "gif": ".gif"}[format]
+	if ext == "" {
+		format, ext = "png", ".png"
+	}
+	main := strings.TrimSuffix(file, filepath.Ext(file)) + ext
+
+	files := make([]string, len(images))
+	for i, im := range images {
+		var buf bytes.Buffer
+		switch format {
+		case "jpeg":
+			err = jpeg.Encode(&buf, im, &jpeg.Options{Quality: p.quality})
+		case "gif":
+			err = gif.Encode(&buf, im, nil)
+		default:
+			err = png.Encode(&buf, im)
+		}
+		if err != nil {
+			return []string{file}, fmt.Errorf("保存处理后的图片失败: %v", err)
+		}
+		files[i] = main
+		if i > 0 {
+			files[i] = pagePartName(main, i+1)
+		}
+		if err := writeFileAtomic(files[i], buf.Bytes()); err != nil {
+			return []string{file}, err
+		}
+	}
+	if main != file {
+		os.Remove(file)
+	}
+	return files, nil
+}
+
+// pagePartName 拆分出的第 n 部分的文件名，如 0003.jpg 的第2部分为 0003_2.jpg，按文件名排序时紧跟在原页之后
+func pagePartName(file string, n int) string {
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(file, ext), n, ext)
+}
+
+// subImager 支持裁剪的图片，标准库解码出的图片都实现了该接口
+type subImager interface {
+	SubImage(r image.Rectangle) image.Image
+}
+
+// cropRect 按矩形裁剪图片
+func cropRect(img image.Image, r image.Rectangle) ([]image.Image, error) {
+	sub, ok := img.(subImager)
+	if !ok {
+		return nil, fmt.Errorf("图片不支持裁剪")
+	}
+	if r.Empty() {
+		return nil, fmt.Errorf("裁剪后图片为空")
+	}
+	return []image.Image{sub.SubImage(r)}, nil
+}
+
+// cropStep 裁掉四周的白边
+type cropStep struct{ top, right, bottom, left int }
+
+func (cropStep) name() string { return "crop" }
+
+func (s cropStep) process(img image.Image) ([]image.Image, error) {
+	b := img.Bounds()
+	return cropRect(img, image.Rect(b.Min.X+s.left, b.Min.Y+s.top, b.Max.X-s.right, b.Max.Y-s.bottom))
+}
+
+// resizeStep 宽度超过时按比例缩小
+type resizeStep struct{ width int }
+
+func (resizeStep) name() string { return "resize" }
+
+func (s resizeStep) process(img image.Image) ([]image.Image, error) {
+	return []image.Image{scaleToWidth(img, s.width)}, nil
+}
+
+// splitStep 将宽大于高的跨页从中间拆成两页，竖向的单页保持不变
+type splitStep struct{ rtl bool }
+
+func (splitStep) name() string { return "split" }
+
+func (s splitStep) process(img image.Image) ([]image.Image, error) {
+	b := img.Bounds()
+	if b.Dx() <= b.Dy() {
+		return []image.Image{img}, nil
+	}
+	mid := b.Min.X + b.Dx()/2
+	left, err := cropRect(img, image.Rect(b.Min.X, b.Min.Y, mid, b.Max.Y))
+	if err != nil {
+		return nil, err
+	}
+	right, err := cropRect(img, image.Rect(mid, b.Min.Y, b.Max.X, b.Max.Y))
+	if err != nil {
+		return nil, err
+	}
+	if s.rtl {
+		return append(right, left...), nil
+	}
+	return append(left, right...), nil
+}
+
+// watermarkStep 裁掉站点加在底部（或顶部）的固定高度的水印条
+type watermarkStep struct {
+	height int
+	top    bool
+}
+
+func (watermarkStep) name() string { return "watermark" }
+
+func (s watermarkStep) process(img image.Image) ([]image.Image, error) {
+	b := img.Bounds()
+	// 图片比水印条还矮时多半不是漫画页面，不处理
+	if b.Dy() <= s.height*2 {
+		return []image.Image{img}, nil
+	}
+	if s.top {
+		return cropRect(img, image.Rect(b.Min.X, b.Min.Y+s.height, b.Max.X, b.Max.Y))
+	}
+	return cropRect(img, image.Rect(b.Min.X, b.Min.Y, b.Max.X, b.Max.Y-s.height))
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// progressClient 访问阅读进度服务使用的客户端
+var progressClient = &http.Client{Transport: sharedTransport, Timeout: 30 * time.Second}
+
+// runProgressCommand 管理章节阅读进度
+func runProgressCommand(args []string) {
+	if len(args) == 0 {
+		showProgress("")
+		return
+	}
+
+	switch args[0] {
+	case "show":
+		seriesID := ""
+		if len(args) > 1 {
+			seriesID = args[1]
+		}
+		showProgress(seriesID)
+	case "mark", "unmark":
+		if len(args) < 3 {
+			fmt.Printf("用法: ./comicbox progress %s <漫画ID> <章节ID|all>\n", args[0])
+			return
+		}
+		markProgress(args[1], args[2], args[0] == "mark")
+	case "import":
+		importProgress(args[1:])
+	default:
+		fmt.Printf("未知的 progress 子命令: %s\n", args[0])
+	}
+}
+
+// showProgress 显示每部漫画的未读章节数
+func showProgress(seriesID string) {
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+
+	for _, s := range db.Series {
+		if seriesID != "" && s.ID != seriesID {
+			continue
+		}
+		fmt.Printf("%s（%s）: %d 个未读章节 / 共 %d 章\n", s.Title, s.ID, s.unreadCount(), len(s.Chapters))
+		if seriesID == "" {
+			continue
+		}
+		for _, c := range s.Chapters {
+			mark := " "
+			if c.Read {
+				mark = "x"
+			}
+			fmt.Printf("  [%s] %s %s\n", mark, c.ID, c.Title)
+		}
+	}
+}
+
+// markProgress 手动标记章节为已读或未读
+func markProgress(seriesID, chapterID string, read bool) {
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	s := db.findSeries(seriesID)
+	if s == nil {
+		fmt.Printf("漫画库中没有漫画 %s\n", seriesID)
+		return
+	}
+
+	changed := 0
+	for _, c := range s.Chapters {
+		if chapterID == "all" || c.ID == chapterID {
+			setRead(c, read, time.Now())
+			changed++
+		}
+	}
+	if changed == 0 {
+		fmt.Printf("漫画 %s 中没有章节 %s\n", seriesID, chapterID)
+		return
+	}
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已更新 %d 个章节，%s 还有 %d 个未读章节\n", changed, s.Title, s.unreadCount())
+}
+
+// setRead 设置章节的阅读状态
+func setRead(c *chapterRecord, read bool, at time.Time) {
+	c.Read = read
+	if read {
+		c.ReadAt = at
+	} else {
+		c.ReadAt = time.Time{}
+	}
+}
+
+// importProgress 从 Komga 或 KOReader 同步服务器导入阅读进度
+func importProgress(args []string) {
+	var komgaURL, kosyncURL, user, password, apiKey string
+	for i := 0; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "--komga":
+			komgaURL = strings.TrimRight(args[i+1], "/")
+		case "--kosync":
+			kosyncURL = strings.TrimRight(args[i+1], "/")
+		case "--user":
+			user = args[i+1]
+		case "--password":
+			password = args[i+1]
+		case "--api-key":
+			apiKey = args[i+1]
+		}
+	}
+
+	if komgaURL == "" && kosyncURL == "" {
+		fmt.Println("请指定 --komga <服务器地址> 或 --kosync <同步服务器地址>")
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+
+	updated := 0
+	for _, s := range db.Series {
+		var n int
+		var err error
+		if komgaURL != "" {
+			n, err = importKomgaProgress(komgaURL, user, password, apiKey, s)
+		} else {
+			n, err = importKOSyncProgress(kosyncURL, user, password, s)
+		}
+		if err != nil {
+			fmt.Printf("导入《%s》的阅读进度失败: %v\n", s.Title, err)
+			continue
+		}
+		updated += n
+		fmt.Printf("%s: %d 个未读章节\n", s.Title, s.unreadCount())
+	}
+
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+		return
+	}
+	fmt.Printf("导入完成，更新了 %d 个章节的阅读状态\n", updated)
+}
+
+// komgaPage Komga 分页接口的响应
+type komgaPage struct {
+	Content []struct {
+		ID           string `json:"id"`
+		Name         string `json:"name"`
+		ReadProgress *struct {
+			Completed        bool      `json:"completed"`
+			LastModifiedDate time.Time `json:"lastModified"`
+		} `json:"readProgress"`
+	} `json:"content"`
+}
+
+// importKomgaProgress 通过 Komga REST API 导入一部漫画的阅读进度
+func importKomgaProgress(server, user, password, apiKey string, s *seriesRecord) (int, error) {
+	var series komgaPage
+	err := komgaGet(server+"/api/v1/series?unpaged=true&search="+url.QueryEscape(s.Title), user, password, apiKey, &series)
+	if err != nil {
+		return 0, err
+	}
+
+	seriesID := ""
+	for _, item := range series.Content {
+		if item.Name == s.Title || item.Name == filepath.Base(s.Dir) {
+			seriesID = item.ID
+			break
+		}
+	}
+	if seriesID == "" {
+		return 0, fmt.Errorf("Komga 中未找到该漫画")
+	}
+
+	var books komgaPage
+	err = komgaGet(server+"/api/v1/series/"+seriesID+"/books?unpaged=true", user, password, apiKey, &books)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for _, book := range books.Content {
+		if book.ReadProgress == nil || !book.ReadProgress.Completed {
+			continue
+		}
+		if c := komgaChapter(s, book.Name); c != nil && !c.Read {
+			setRead(c, true, book.ReadProgress.LastModifiedDate)
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// komgaChapter Komga 中的书对应的章节：书名为去掉扩展名的文件名，优先与章节目录名比较；
+// 改过书名时按规范化后的标题完全相同且只有一个章节匹配时才算，不按包含关系匹配，否则“第1话”会匹配到“第10话”
+func komgaChapter(s *seriesRecord, bookName string) *chapterRecord {
+	for _, c := range s.Chapters {
+		if c.Dir != "" && c.Dir == bookName {
+			return c
+		}
+	}
+	name := normalizeChapterTitle(bookName)
+	if name == "" {
+		return nil
+	}
+	var match *chapterRecord
+	for _, c := range s.Chapters {
+		if normalizeChapterTitle(c.Title) == name {
+			if match != nil {
+				return nil
+			}
+			match = c
+		}
+	}
+	return match
+}
+
+// komgaGet 请求 Komga 接口并解析JSON响应
+func komgaGet(endpoint, user, password, apiKey string, v interface{}) error {
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	} else if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+
+	resp, err := progressClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return &httpStatusError{StatusCode: resp.StatusCode}
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// kosyncProgress KOReader 同步服务器返回的进度
+type kosyncProgress struct {
+	Document   string  `json:"document"`
+	Percentage float64 `json:"percentage"`
+	Timestamp  int64   `json:"timestamp"`
+}
+
+// importKOSyncProgress 通过 KOReader 同步服务器导入一部漫画的阅读进度
+// 需要章节已打包为CBZ，文档ID按 KOReader 的规则由文件内容或文件名计算
+func importKOSyncProgress(server, user, password string, s *seriesRecord) (int, error) {
+	authKey := md5.Sum([]byte(password))
+
+	updated := 0
+	for _, c := range s.Chapters {
+		if c.Read {
+			continue
+		}
+		archive := chapterArchivePath(filepath.Join(s.Dir, c.Dir))
+		if archive == "" {
+			continue
+		}
+
+		var documents []string
+		if id, err := koreaderPartialMD5(archive); err == nil {
+			documents = append(documents, id)
+		}
+		nameSum := md5.Sum([]byte(filepath.Base(archive)))
+		documents = append(documents, hex.EncodeToString(nameSum[:]))
+
+		for _, document := range documents {
+			progress, err := kosyncGet(server, user, hex.EncodeToString(authKey[:]), document)
+			if err != nil {
+				return updated, err
+			}
+			if progress.Percentage >= 0.99 {
+				setRead(c, true, time.Unix(progress.Timestamp, 0))
+				updated++
+				break
+			}
+		}
+	}
+	return updated, nil
+}
+
+// kosyncGet 查询单个文档的阅读进度
+func kosyncGet(server, user, authKey, document string) (kosyncProgress, error) {
+	var progress kosyncProgress
+	req, err := http.NewRequest("GET", server+"/syncs/progress/"+document, nil)
+	if err != nil {
+		return progress, err
+	}
+	req.Header.Set("Accept", "application/vnd.koreader.v1+json")
+	req.Header.Set("x-auth-user", user)
+	req.Header.Set("x-auth-key", authKey)
+
+	resp, err := progressClient.Do(req)
+	if err != nil {
+		return progress, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return progress, &httpStatusError{StatusCode: resp.StatusCode}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&progress)
+	return progress, err
+}
+
+// koreaderPartialMD5 按 KOReader 的方式计算文档ID：
+// 从偏移 0、1K、4K、16K…1G 处各取 1K 数据计算MD5
+func koreaderPartialMD5(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	buf := make([]byte, 1024)
+	for i := -1; i <= 10; i++ {
+		var offset int64
+		if i >= 0 {
+			offset = 1024 << uint(2*i)
+		}
+		n, err := file.ReadAt(buf, offset)
+		if n == 0 {
+			if err != nil && err != io.EOF {
+				return "", err
+			}
+			break
+		}
+		hash.Write(buf[:n])
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
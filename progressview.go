@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 下载进度的显示方式，由 --progress 或配置文件的 progress 设置
+const (
+	progressAuto  = "auto"  // 标准输出是终端且为默认输出级别时显示进度条，否则按顺序输出日志
+	progressBars  = "bars"  // 进度条：全部章节、当前章节和正在下载的每一页各一行，其他信息输出在进度条上方
+	progressLines = "lines" // 日志：同一章节中每一页的输出按请求顺序集中输出，不与其他页交错
+)
+
+// progressMode 当前的进度显示方式
+var progressMode = progressAuto
+
+// progressRedraw 进度条的刷新间隔
+const progressRedraw = 200 * time.Millisecond
+
+// progressBarWidth 进度条的宽度（字符数）
+const progressBarWidth = 30
+
+// parseProgressMode 检查 --progress 的值
+func parseProgressMode(value string) (string, error) {
+	switch value {
+	case progressAuto, progressBars, progressLines:
+		return value, nil
+	}
+	return "", fmt.Errorf("未知的进度显示方式: %s（可用 auto、bars、lines）", value)
+}
+
+// useProgressBars 是否显示进度条：--quiet 时不输出进度，--verbose 和 --debug 的细节较多，按日志输出
+func useProgressBars() bool {
+	switch progressMode {
+	case progressBars:
+		return outputLevel == outputNormal
+	case progressLines:
+		return false
+	}
+	if outputLevel != outputNormal || debugMode {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+type progressEventKind int
+
+const (
+	eventChapterStart progressEventKind = iota
+	eventPageStart                      // 开始下载一页
+	eventPageLine                       // 属于某一页的输出，按页的请求顺序输出
+	eventPageDone                       // 一页下载结束
+	eventLog                            // 与页无关的输出（如重试、暂停），立即输出
+	eventChapterEnd
+)
+
+// progressEvent 下载线程发给进度显示线程的事件
+type progressEvent struct {
+	kind  progressEventKind
+	index int    // 页的位置，从0开始
+	text  string // eventPageLine、eventLog 的内容
+	quiet bool   // 进度条显示时不输出的 eventPageLine（如"已下载图片"，进度条中已有）
+	size  int64
+	ok    bool
+
+	// eventChapterStart
+	title    string
+	order    []int // 按请求顺序排列的待下载页
+	planned  int   // 计划下载的章节数
+	finished int   // 已结束的章节数
+	bars     bool  // 是否显示进度条
+
+	done chan struct{} // eventChapterEnd 处理完后关闭
+}
+
+// progressView 进度显示线程，只有它向标准输出写入下载进度，避免多个下载线程的输出交错
+type progressView struct {
+	events chan progressEvent
+	bars   bool
+
+	// 当前章节，章节依次下载，同一时间只有一个
+	title    string
+	planned  int
+	finished int
+	order    []int
+	buffered map[int][]string // 等待前面的页结束后输出的内容
+	ended    map[int]bool
+	next     int // 下一个要输出的请求顺序位置
+	active   map[int]time.Time
+	done     int
+	failed   int
+	bytes    int64
+	started  time.Time
+	drawn    int // 当前屏幕上进度条的行数
+}
+
+var (
+	progressOnce sync.Once
+	progressLoop *progressView
+
+	// activeProgress 正在下载章节时为进度显示线程，此时 infof、verbosef 的输出也交给它
+	activeProgress atomic.Pointer[progressView]
+)
+
+// startChapterProgress 开始显示一个章节的下载进度，order 为按请求顺序排列的待下载页
+func startChapterProgress(dirName string, order []int) {
+	if parallelChapters {
+		// 进度显示只跟踪一个章节，多个章节同时下载时各页的输出直接输出
+		return
+	}
+	progressOnce.Do(func() {
+		progressLoop = &progressView{events: make(chan progressEvent, 64)}
+		go progressLoop.run()
+	})
+	runStats.mu.Lock()
+	planned, finished := runStats.planned, runStats.chapters
+	runStats.mu.Unlock()
+	progressLoop.events <- progressEvent{kind: eventChapterStart, title: filepath.Base(dirName), order: order,
+		planned: planned, finished: finished, bars: useProgressBars()}
+	activeProgress.Store(progressLoop)
+}
+
+// endChapterProgress 结束章节的进度显示，等待缓存的输出全部输出、进度条清除后返回
+func endChapterProgress() {
+	v := activeProgress.Swap(nil)
+	if v == nil {
+		return
+	}
+	done := make(chan struct{})
+	v.events <- progressEvent{kind: eventChapterEnd, done: done}
+	<-done
+}
+
+// pageStarted 记录开始下载第 index 页
+func pageStarted(index int) {
+	if v := activeProgress.Load(); v != nil {
+		v.events <- progressEvent{kind: eventPageStart, index: index}
+	}
+}
+
+// pageFinished 记录第 index 页下载结束
+func pageFinished(index int, size int64, ok bool) {
+	if v := activeProgress.Load(); v != nil {
+		v.events <- progressEvent{kind: eventPageDone, index: index, size: size, ok: ok}
+	}
+}
+
+// pageInfof 输出一页的常规信息（如已下载），--quiet 和显示进度条时不输出
+func pageInfof(index int, format string, args ...interface{}) {
+	if outputLevel < outputNormal {
+		return
+	}
+	pageOutput(index, fmt.Sprintf(format, args...), true)
+}
+
+// pageErrorf 输出一页的错误信息，总是输出
+func pageErrorf(index int, format string, args ...interface{}) {
+	pageOutput(index, fmt.Sprintf(format, args...), false)
+}
+
+func pageOutput(index int, text string, quiet bool) {
+	if v := activeProgress.Load(); v != nil {
+		v.events <- progressEvent{kind: eventPageLine, index: index, text: text, quiet: quiet}
+		return
+	}
+	fmt.Print(text)
+}
+
+// printOutput 输出 infof、verbosef 的内容，下载章节时交给进度显示线程
+func printOutput(text string) {
+	if v := activeProgress.Load(); v != nil {
+		v.events <- progressEvent{kind: eventLog, text: text}
+		return
+	}
+	fmt.Print(text)
+}
+
+// run 处理下载线程发来的事件，显示进度条时定时刷新
+func (v *progressView) run() {
+	ticker := time.NewTicker(progressRedraw)
+	defer ticker.Stop()
+	for {
+		select {
+		case e := <-v.events:
+			v.handle(e)
+		case <-ticker.C:
+			if v.bars && v.title != "" {
+				v.redraw("")
+			}
+		}
+	}
+}
+
+func (v *progressView) handle(e progressEvent) {
+	if v.title == "" && e.kind != eventChapterStart && e.kind != eventChapterEnd {
+		// 章节结束后其他线程才发出的输出直接输出
+		if e.kind == eventLog || e.kind == eventPageLine {
+			fmt.Print(e.text)
+		}
+		return
+	}
+	switch e.kind {
+	case eventChapterStart:
+		v.title, v.bars = e.title, e.bars
+		v.planned, v.finished = e.planned, e.finished
+		v.order = e.order
+		v.buffered, v.ended, v.active = map[int][]string{}, map[int]bool{}, map[int]time.Time{}
+		v.next, v.done, v.failed, v.bytes = 0, 0, 0, 0
+		v.started = time.Now()
+	case eventPageStart:
+		v.active[e.index] = time.Now()
+	case eventPageLine:
+		switch {
+		case v.bars && e.quiet:
+		case v.bars:
+			v.redraw(e.text)
+		default:
+			v.buffered[e.index] = append(v.buffered[e.index], e.text)
+			v.flushLines()
+		}
+	case eventPageDone:
+		delete(v.active, e.index)
+		v.ended[e.index] = true
+		v.done++
+		v.bytes += e.size
+		if !e.ok {
+			v.failed++
+		}
+		if !v.bars {
+			v.flushLines()
+		}
+	case eventLog:
+		if v.bars {
+			v.redraw(e.text)
+		} else {
+			fmt.Print(e.text)
+		}
+	case eventChapterEnd:
+		if v.bars {
+			v.clearBars()
+		}
+		// 没有结束事件的页（不应出现）也按顺序输出
+		for ; v.next < len(v.order); v.next++ {
+			v.printBuffered(v.order[v.next])
+		}
+		for index := range v.buffered {
+			v.printBuffered(index)
+		}
+		v.title, v.bars = "", false
+		close(e.done)
+	}
+}
+
+// flushLines 按请求顺序输出已结束的页缓存的内容，遇到未结束的页时停止，其后的页等它结束后再输出
+func (v *progressView) flushLines() {
+	for v.next < len(v.order) && v.ended[v.order[v.next]] {
+		v.printBuffered(v.order[v.next])
+		v.next++
+	}
+}
+
+func (v *progressView) printBuffered(index int) {
+	for _, line := range v.buffered[index] {
+		fmt.Print(line)
+	}
+	delete(v.buffered, index)
+}
+
+// clearBars 清除屏幕上的进度条
+func (v *progressView) clearBars() {
+	if v.drawn > 0 {
+		fmt.Printf("\033[%dF\033[J", v.drawn)
+		v.drawn = 0
+	}
+}
+
+// redraw 清除进度条，输出 text（可以为空）后重新绘制进度条
+func (v *progressView) redraw(text string) {
+	var b strings.Builder
+	if v.drawn > 0 {
+		fmt.Fprintf(&b, "\033[%dF\033[J", v.drawn)
+	}
+	b.WriteString(text)
+	lines := v.barLines()
+	for _, line := range lines {
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	v.drawn = len(lines)
+	fmt.Print(b.String())
+}
+
+// barLines 进度条的内容：全部章节（计划下载多个章节时）、当前章节、正在下载的页
+func (v *progressView) barLines() []string {
+	var lines []string
+	if v.planned > 1 {
+		lines = append(lines, fmt.Sprintf("全部章节 %s %d/%d", progressBar(v.finished, v.planned), v.finished, v.planned))
+	}
+	total := len(v.order)
+	line := fmt.Sprintf("%s %s %d/%d", v.title, progressBar(v.done, total), v.done, total)
+	if elapsed := time.Since(v.started); v.done > 0 {
+		line += fmt.Sprintf("  %s/s", formatBytes(bytesPerSecond(v.bytes, elapsed)))
+		if v.done < total {
+			remaining := time.Duration(float64(elapsed) / float64(v.done) * float64(total-v.done))
+			line += "  剩余 " + formatETA(remaining)
+		}
+	}
+	if v.failed > 0 {
+		line += fmt.Sprintf("  失败 %d", v.failed)
+	}
+	lines = append(lines, line)
+
+	active := make([]int, 0, len(v.active))
+	for index := range v.active {
+		active = append(active, index)
+	}
+	sort.Ints(active)
+	for _, index := range active {
+		lines = append(lines, fmt.Sprintf("  第 %d 页 下载中 %s", index+1, time.Since(v.active[index]).Round(time.Second)))
+	}
+	return lines
+}
+
+// progressBar 绘制 done/total 的进度条，如 [#########.....................]
+func progressBar(done, total int) string {
+	filled := 0
+	if total > 0 {
+		filled = min(done*progressBarWidth/total, progressBarWidth)
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat(".", progressBarWidth-filled) + "]"
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retentionPolicy 漫画库保留策略
+type retentionPolicy struct {
+	keepRaw     int // 已打包的章节只保留最新 N 个章节的原始图片，0 表示不限制
+	staleMonths int // 删除超过 N 个月没有更新的未订阅漫画，0 表示不删除
+}
+
+// enabled 是否设置了任何保留规则
+func (p retentionPolicy) enabled() bool {
+	return p.keepRaw > 0 || p.staleMonths > 0
+}
+
+// parseRetentionFlag 解析保留策略参数，返回消耗的参数个数
+func parseRetentionFlag(args []string, i int, p *retentionPolicy) (int, error) {
+	if args[i] != "--keep-raw" && args[i] != "--stale-months" {
+		return 0, nil
+	}
+	if i+1 >= len(args) {
+		return 0, fmt.Errorf("%s 需要一个数值", args[i])
+	}
+	n, err := strconv.Atoi(args[i+1])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的数值: %s", args[i+1])
+	}
+	if args[i] == "--keep-raw" {
+		p.keepRaw = n
+	} else {
+		p.staleMonths = n
+	}
+	return 2, nil
+}
+
+// runPruneCommand 按保留策略清理漫画库
+func runPruneCommand(args []string) {
+	var policy retentionPolicy
+	dryRun := false
+	for i := 0; i < len(args); i++ {
+		n, err := parseRetentionFlag(args, i, &policy)
+		if err != nil {
+			fmt.Printf("参数错误: %v\n", err)
+			return
+		}
+		if n > 0 {
+			i += n - 1
+			continue
+		}
+		if args[i] == "--dry-run" {
+			dryRun = true
+		}
+	}
+
+	if !policy.enabled() {
+		fmt.Println("请至少指定一条保留规则: --keep-raw <章节数> 或 --stale-months <月数>")
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+
+	pruneLibrary(db, policy, dryRun)
+}
+
+// pruneLibrary 执行保留策略，dryRun 为true时只列出将要删除的内容
+func pruneLibrary(db *libraryDB, policy retentionPolicy, dryRun bool) {
+	if dryRun {
+		fmt.Println("预览模式，不会删除任何文件")
+	}
+
+	var freed int64
+	var kept []*seriesRecord
+	for _, s := range db.Series {
+		if policy.staleMonths > 0 && !s.Followed && seriesStale(s, policy.staleMonths) {
+			size := dirSize(s.Dir) + fileSize(s.Dir+".cbz")
+			fmt.Printf("删除超过 %d 个月未更新的漫画: %s（%s）\n", policy.staleMonths, s.Title, formatBytes(size))
+			if !dryRun {
+				if err := removeSeries(s); err != nil {
+					fmt.Printf("删除失败: %v\n", err)
+					kept = append(kept, s)
+					continue
+				}
+			}
+			freed += size
+			continue
+		}
+		kept = append(kept, s)
+
+		if policy.keepRaw > 0 {
+			freed += pruneRawChapters(s, policy.keepRaw, dryRun)
+		}
+	}
+
+	if dryRun {
+		fmt.Printf("预计可释放 %s\n", formatBytes(freed))
+		return
+	}
+
+	db.Series = kept
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+		return
+	}
+	fmt.Printf("清理完成，共释放 %s\n", formatBytes(freed))
+}
+
+// pruneRawChapters 删除最新 keep 个章节之前、已经打包为CBZ的章节原始图片
+func pruneRawChapters(s *seriesRecord, keep int, dryRun bool) int64 {
+	if len(s.Chapters) <= keep {
+		return 0
+	}
+
+	var freed int64
+	for _, c := range s.Chapters[:len(s.Chapters)-keep] {
+		if c.Pruned {
+			continue
+		}
+		chapterDir := filepath.Join(s.Dir, c.Dir)
+		if !chapterArchived(s, chapterDir) {
+			continue
+		}
+
+		size := dirSize(chapterDir)
+		fmt.Printf("删除已打包章节的原始图片: %s / %s（%s）\n", s.Title, c.Title, formatBytes(size))
+		if dryRun {
+			freed += size
+			continue
+		}
+		if err := os.RemoveAll(chapterDir); err != nil {
+			fmt.Printf("删除失败: %v\n", err)
+			continue
+		}
+		c.Pruned = true
+		freed += size
+	}
+	return freed
+}
+
+// chapterArchived 检查章节是否已经打包：章节CBZ或比章节目录更新的整部漫画CBZ中包含章节的每一页
+// 只看文件是否存在不够，删除原始图片前要确认压缩包确实是这个章节的
+func chapterArchived(s *seriesRecord, chapterDir string) bool {
+	info, err := os.Stat(chapterDir)
+	if err != nil {
+		return false
+	}
+
+	if archive := chapterArchivePath(chapterDir); archive != "" && archiveHasChapter(archive, chapterDir, "") {
+		return true
+	}
+
+	seriesArchive, err := os.Stat(s.Dir + ".cbz")
+	return err == nil && seriesArchive.ModTime().After(info.ModTime()) &&
+		archiveHasChapter(s.Dir+".cbz", chapterDir, filepath.Base(chapterDir))
+}
+
+// chapterArchivePath 查找章节单独打包的CBZ文件（章节目录旁边），不存在时返回空字符串
+// 不查找当前目录：不同漫画的章节目录名（如 001_第1话）经常相同，当前目录中的CBZ可能属于别的漫画
+func chapterArchivePath(chapterDir string) string {
+	if candidate := chapterDir + ".cbz"; fileSize(candidate) > 0 {
+		return candidate
+	}
+	return ""
+}
+
+// archiveHasChapter 压缩包中是否有章节目录中的每一页（文件名和大小都相同）
+// dirName 为空时是章节CBZ，页面在根目录，有 provenance.json 时章节ID也要一致；
+// 否则是整部漫画的CBZ，页面在 <章节目录名>/ 下，或 --flat 时的 <序号>-<标题>-<文件名>
+func archiveHasChapter(archive, chapterDir, dirName string) bool {
+	entries, err := os.ReadDir(chapterDir)
+	if err != nil {
+		return false
+	}
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	sizes := make(map[string]uint64, len(r.File))
+	for _, f := range r.File {
+		sizes[f.Name] = f.UncompressedSize64
+	}
+
+	if dirName == "" {
+		if id := archiveChapterID(r); id != "" {
+			if meta, err := loadChapterMeta(chapterDir); err == nil && meta.ID != "" && meta.ID != id {
+				return false
+			}
+		}
+	}
+
+	pages := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !isImageFile(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return false
+		}
+		names := []string{entry.Name()}
+		if dirName != "" {
+			names = []string{dirName + "/" + entry.Name(), strings.Replace(dirName, "_", "-", 1) + "-" + entry.Name()}
+		}
+		found := false
+		for _, name := range names {
+			if size, ok := sizes[name]; ok && size == uint64(info.Size()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		pages++
+	}
+	return pages > 0
+}
+
+// archiveChapterID pack 工具写入 provenance.json 的章节ID，没有来源记录或已加密时返回空
+func archiveChapterID(r *zip.ReadCloser) string {
+	for _, f := range r.File {
+		if f.Name != "provenance.json" || f.Flags&0x1 != 0 {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return ""
+		}
+		defer rc.Close()
+		var provenance struct {
+			ChapterID string `json:"chapter_id"`
+		}
+		if json.NewDecoder(io.LimitReader(rc, 16<<20)).Decode(&provenance) != nil {
+			return ""
+		}
+		return provenance.ChapterID
+	}
+	return ""
+}
+
+// seriesStale 漫画最近一次下载新章节是否已超过指定月数
+func seriesStale(s *seriesRecord, months int) bool {
+	var last time.Time
+	for _, c := range s.Chapters {
+		if c.DownloadedAt.After(last) {
+			last = c.DownloadedAt
+		}
+	}
+	return !last.IsZero() && last.Before(time.Now().AddDate(0, -months, 0))
+}
+
+// removeSeries 删除漫画目录及其整部漫画CBZ
+func removeSeries(s *seriesRecord) error {
+	if s.Dir == "" {
+		return fmt.Errorf("漫画 %s 没有记录目录", s.ID)
+	}
+	if err := os.RemoveAll(s.Dir); err != nil {
+		return err
+	}
+	err := os.Remove(s.Dir + ".cbz")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// fileSize 返回文件大小，文件不存在时返回0
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bestVersion 章节在多个来源中都有时，比较各来源的版本并下载评分最高的，由 --best-version 或配置文件的 best_version 开启
+// 默认使用主来源，主来源失败时才使用备用来源
+var bestVersion bool
+
+// versionSamples 评分时每个版本抽样检查的页数
+const versionSamples = 3
+
+// versionScore 一个来源中章节版本的评分，记录在 chapter.json 中
+type versionScore struct {
+	Source  string  `json:"source"` // 来源的站点地址
+	URL     string  `json:"url"`    // 章节页面链接
+	Pages   int     `json:"pages"`
+	Width   int     `json:"width,omitempty"`        // 抽样页面的平均宽度
+	Height  int     `json:"height,omitempty"`       // 抽样页面的平均高度
+	Bytes   int64   `json:"bytes,omitempty"`        // 抽样页面的平均大小
+	Quality int     `json:"jpeg_quality,omitempty"` // 按量化表估计的 JPEG 质量（1-100），不是 JPEG 时为0
+	Score   float64 `json:"score"`
+	Chosen  bool    `json:"chosen,omitempty"`
+}
+
+// chapterVersion 一个来源中获取到的章节
+type chapterVersion struct {
+	page    *chapterPage
+	baseURL string
+	score   versionScore
+}
+
+// fetchBestVersion 获取所有来源中的同一章节，抽样评分后返回评分最高的版本和它的来源地址，
+// 各版本的评分记录在返回的 chapterPage 中；所有来源中都未解锁时返回 errChapterLocked
+func fetchBestVersion(ctx context.Context, chapter ChapterInfo) (*chapterPage, string, error) {
+	var versions []*chapterVersion
+	var lastErr, lockedErr error
+	for _, candidate := range append([]ChapterInfo{chapter}, chapter.alternates...) {
+		baseURL := candidate.baseURL
+		if baseURL == "" {
+			baseURL = contextBaseURL(ctx)
+		}
+		page, err := siteFor(baseURL).fetchChapter(ctx, baseURL, candidate.id)
+		if errors.Is(err, errChapterLocked) {
+			lockedErr = err
+			continue
+		}
+		if err != nil {
+			fmt.Printf("获取来源 %s 的章节失败: %v\n", baseURL, err)
+			lastErr = err
+			continue
+		}
+		filterChapterImages(ctx, page)
+		if len(page.images) == 0 {
+			continue
+		}
+		versions = append(versions, &chapterVersion{page: page, baseURL: baseURL, score: sampleVersion(ctx, baseURL, page)})
+	}
+	if len(versions) == 0 {
+		if lockedErr != nil {
+			return nil, "", lockedErr
+		}
+		return nil, "", lastErr
+	}
+
+	scoreVersions(versions)
+	best := versions[0]
+	for _, v := range versions[1:] {
+		if v.score.Score > best.score.Score {
+			best = v
+		}
+	}
+	best.score.Chosen = true
+	for _, v := range versions {
+		best.page.versions = append(best.page.versions, v.score)
+		verbosef("来源 %s: %s，评分 %.1f\n", v.baseURL, describeVersion(v.score), v.score.Score)
+	}
+	if len(versions) > 1 {
+		infof("比较了 %d 个来源的版本，使用 %s（%s）\n", len(versions), best.baseURL, describeVersion(best.score))
+	}
+	return best.page, best.baseURL, nil
+}
+
+// sampleVersion 抽取章节中间的几页（避开封面和末尾的广告页），读取尺寸、大小和 JPEG 质量
+func sampleVersion(ctx context.Context, baseURL string, page *chapterPage) versionScore {
+	score := versionScore{Source: baseURL, URL: page.url, Pages: len(page.images)}
+	samples := 0
+	var width, height, quality int
+	var size int64
+	for i := 1; i <= versionSamples && i <= len(page.images); i++ {
+		img := page.images[len(page.images)*i/(versionSamples+1)]
+		w, h, n, q, ok := probeImageSample(ctx, img)
+		if !ok {
+			continue
+		}
+		samples++
+		width, height, size, quality = width+w, height+h, size+n, quality+q
+	}
+	if samples > 0 {
+		score.Width, score.Height = width/samples, height/samples
+		score.Bytes, score.Quality = size/int64(samples), quality/samples
+	}
+	return score
+}
+
+// scoreVersions 计算各版本的评分（满分100）：页数 50 分、分辨率 30 分、JPEG 质量 10 分、文件大小 10 分，
+// 都按与最好的版本的比例计算；页数少的版本通常缺页，所以权重最高
+func scoreVersions(versions []*chapterVersion) {
+	var maxPages, maxArea int
+	var maxBytes int64
+	for _, v := range versions {
+		maxPages = max(maxPages, v.score.Pages)
+		maxArea = max(maxArea, v.score.Width*v.score.Height)
+		maxBytes = max(maxBytes, v.score.Bytes)
+	}
+	for _, v := range versions {
+		s := &v.score
+		s.Score = 50 * float64(s.Pages) / float64(maxPages)
+		if maxArea > 0 {
+			s.Score += 30 * float64(s.Width*s.Height) / float64(maxArea)
+		}
+		if s.Quality > 0 {
+			s.Score += 10 * float64(s.Quality) / 100
+		} else {
+			// PNG、WebP 等无法估计质量，按中等质量计算
+			s.Score += 7.5
+		}
+		if maxBytes > 0 {
+			s.Score += 10 * float64(s.Bytes) / float64(maxBytes)
+		}
+	}
+}
+
+// describeVersion 描述一个版本，如 45 页，1600x2400，JPEG 质量 90
+func describeVersion(s versionScore) string {
+	parts := []string{fmt.Sprintf("%d 页", s.Pages)}
+	if s.Width > 0 {
+		parts = append(parts, fmt.Sprintf("%dx%d", s.Width, s.Height))
+	}
+	if s.Quality > 0 {
+		parts = append(parts, fmt.Sprintf("JPEG 质量 %d", s.Quality))
+	}
+	if s.Bytes > 0 {
+		parts = append(parts, "每页约 "+formatBytes(s.Bytes))
+	}
+	return strings.Join(parts, "，")
+}
+
+// probeImageSample 请求图片开头的部分内容，读取宽高、JPEG 质量，并从响应头中获取文件大小
+func probeImageSample(ctx context.Context, imgURL string) (width, height int, size int64, quality int, ok bool) {
+	if err := politeMode.check(ctx, imgURL); err != nil {
+		return 0, 0, 0, 0, false
+	}
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := newImageProbe(ctx, "GET", imgURL)
+	if err != nil {
+		return 0, 0, 0, 0, false
+	}
+	req.Header.Set("Range", "bytes=0-"+strconv.Itoa(imageProbeBytes-1))
+	resp, err := (&http.Client{Transport: pageTransport(), CheckRedirect: checkRedirect}).Do(req)
+	if err != nil {
+		return 0, 0, 0, 0, false
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		size = resp.ContentLength
+	case http.StatusPartialContent:
+		// Content-Range: bytes 0-65535/123456
+		if _, total, found := strings.Cut(resp.Header.Get("Content-Range"), "/"); found {
+			size, _ = strconv.ParseInt(total, 10, 64)
+		}
+	default:
+		return 0, 0, 0, 0, false
+	}
+	head, err := io.ReadAll(io.LimitReader(resp.Body, imageProbeBytes))
+	if err != nil && len(head) == 0 {
+		return 0, 0, 0, 0, false
+	}
+	width, height, _ = imageDimensions(head)
+	return width, height, max(size, 0), jpegQuality(head), true
+}
+
+// jpegStdLuminance JPEG 标准亮度量化表（质量 50，按 zigzag 顺序）
+var jpegStdLuminance = [64]int{
+	16, 11, 12, 14, 12, 10, 16, 14, 13, 14, 18, 17, 16, 19, 24, 40,
+	26, 24, 22, 22, 24, 49, 35, 37, 29, 40, 58, 51, 61, 60, 57, 51,
+	56, 55, 64, 72, 92, 78, 64, 68, 87, 69, 55, 56, 80, 109, 81, 87,
+	95, 98, 103, 104, 103, 62, 77, 113, 121, 112, 100, 120, 92, 101, 103, 99,
+}
+
+// jpegQuality 按 JPEG 文件中的亮度量化表估计编码质量（按 libjpeg 的缩放规则反推），不是 JPEG 或找不到量化表时返回0
+func jpegQuality(head []byte) int {
+	if len(head) < 4 || head[0] != 0xFF || head[1] != 0xD8 {
+		return 0
+	}
+	for i := 2; i+4 <= len(head); {
+		if head[i] != 0xFF {
+			return 0
+		}
+		marker := head[i+1]
+		length := int(head[i+2])<<8 | int(head[i+3])
+		if marker == 0xDA || length < 2 {
+			return 0 // 图像数据开始前没有找到量化表
+		}
+		segment := head[i+4 : min(i+2+length, len(head))]
+		if marker == 0xDB && len(segment) >= 65 && segment[0]>>4 == 0 && segment[0]&0x0F == 0 {
+			// 8 位精度的 0 号表（亮度）
+			sum := 0
+			for k := 0; k < 64; k++ {
+				sum += int(segment[1+k]) * 100 / jpegStdLuminance[k]
+			}
+			scale := sum / 64
+			switch {
+			case scale <= 0:
+				return 100
+			case scale <= 100:
+				return (200 - scale) / 2
+			default:
+				return max(5000/scale, 1)
+			}
+		}
+		i += 2 + length
+	}
+	return 0
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// 漫画的内容分级，记录在漫画库中，从小到大依次为全年龄、青少年、成人向、18禁
+// mature 和 adult 为需要过滤的内容（NSFW），安全视图中不显示；未设置分级的漫画在安全视图中也不显示
+const (
+	ratingAllAges = "all-ages"
+	ratingTeen    = "teen"
+	ratingMature  = "mature"
+	ratingAdult   = "adult"
+)
+
+// ratingNames 分级的中文名称
+var ratingNames = map[string]string{
+	ratingAllAges: "全年龄",
+	ratingTeen:    "青少年",
+	ratingMature:  "成人向",
+	ratingAdult:   "18禁",
+}
+
+// ratingAgeRatings 分级对应的 ComicInfo.xml AgeRating，写入 series.json 供打包工具使用
+var ratingAgeRatings = map[string]string{
+	ratingAllAges: "Everyone",
+	ratingTeen:    "Teen",
+	ratingMature:  "Mature 17+",
+	ratingAdult:   "Adults Only 18+",
+}
+
+// adultMarkers 漫画页面的标签、分类和关键词中表示成人内容的文字
+var adultMarkers = []string{"18禁", "18+", "r18", "r-18", "成人", "成年", "h漫", "工口", "绅士", "紳士", "里番", "裏番", "hentai", "nsfw"}
+
+// parseRating 解析分级名称，也接受中文名称和 safe、nsfw 的简写
+func parseRating(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case "safe", "general", "everyone":
+		return ratingAllAges, nil
+	case "nsfw", "r18", "18+":
+		return ratingAdult, nil
+	}
+	for rating, name := range ratingNames {
+		if value == rating || value == name {
+			return rating, nil
+		}
+	}
+	return "", fmt.Errorf("未知的分级: %s（可用 all-ages、teen、mature、adult）", value)
+}
+
+// isSafeRating 是否可以在安全视图中显示：只有明确标记为全年龄或青少年的漫画
+func isSafeRating(rating string) bool {
+	return rating == ratingAllAges || rating == ratingTeen
+}
+
+// ratingLabel 分级的显示名称，未设置时为"未分级"
+func ratingLabel(rating string) string {
+	if name, ok := ratingNames[rating]; ok {
+		return name
+	}
+	return "未分级"
+}
+
+// detectRating 从漫画目录页面的关键词、标签和分类中识别成人内容，识别不出时返回空字符串
+// 只在找到明确的标记时标为 adult，不会把漫画标为全年龄
+func detectRating(doc *goquery.Document) string {
+	var texts []string
+	doc.Find("meta[name=keywords], meta[name=rating], meta[property='og:rating']").Each(func(i int, s *goquery.Selection) {
+		texts = append(texts, s.AttrOr("content", ""))
+	})
+	doc.Find(".tags, .tag, .genre, .genres, .category, a[href*='tag'], a[href*='genre'], a[href*='category']").Each(func(i int, s *goquery.Selection) {
+		texts = append(texts, s.Text())
+	})
+	for _, text := range texts {
+		text = strings.ToLower(text)
+		for _, marker := range adultMarkers {
+			if strings.Contains(text, marker) {
+				return ratingAdult
+			}
+		}
+	}
+	return ""
+}
+
+// updateRating 记录从站点识别的分级，不覆盖用户用 rating 命令设置的分级
+func (s *seriesRecord) updateRating(detected string) {
+	if detected == "" || s.RatingManual || s.Rating == detected {
+		return
+	}
+	if s.Rating == "" {
+		infof("漫画标记为 %s 内容，可以用 ./comicbox rating set %s <分级> 修改\n", ratingLabel(detected), s.ID)
+	}
+	s.Rating = detected
+}
+
+// safeView 请求是否只能看到安全的漫画：用户设置了 safe_only，或访问的是 /opds/safe 目录、带有 safe=1 参数
+func safeView(r *http.Request) bool {
+	if user := requestUser(r); user != nil && user.SafeOnly {
+		return true
+	}
+	return strings.HasPrefix(r.URL.Path, "/opds/safe") || r.URL.Query().Get("safe") == "1"
+}
+
+// visibleSeries 当前请求是否可以访问该漫画
+func visibleSeries(r *http.Request, s *seriesRecord) bool {
+	return !safeView(r) || isSafeRating(s.Rating)
+}
+
+// runRatingCommand 查看和设置漫画的内容分级
+func runRatingCommand(args []string) {
+	usage := func() {
+		fmt.Println("用法: ./comicbox rating list [--safe|--nsfw|--unrated]")
+		fmt.Println("      ./comicbox rating set <漫画ID|标题> <all-ages|teen|mature|adult>")
+		fmt.Println("      ./comicbox rating clear <漫画ID|标题>")
+	}
+	if len(args) == 0 {
+		usage()
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	switch args[0] {
+	case "list":
+		filter := ""
+		if len(args) > 1 {
+			filter = args[1]
+		}
+		shown := 0
+		for _, s := range db.Series {
+			switch {
+			case filter == "--safe" && !isSafeRating(s.Rating),
+				filter == "--nsfw" && s.Rating != ratingMature && s.Rating != ratingAdult,
+				filter == "--unrated" && s.Rating != "":
+				continue
+			}
+			source := ""
+			if s.Rating != "" && !s.RatingManual {
+				source = "（从站点识别）"
+			}
+			fmt.Printf("%-10s %-8s%s %s\n", s.ID, ratingLabel(s.Rating), source, s.Title)
+			shown++
+		}
+		if shown == 0 {
+			fmt.Println("没有符合条件的漫画")
+		}
+	case "set", "clear":
+		if (args[0] == "set" && len(args) != 3) || (args[0] == "clear" && len(args) != 2) {
+			usage()
+			return
+		}
+		s := db.findSeries(args[1])
+		if s == nil {
+			fmt.Printf("漫画库中没有漫画 %s\n", args[1])
+			return
+		}
+		rating := ""
+		if args[0] == "set" {
+			if rating, err = parseRating(args[2]); err != nil {
+				fmt.Printf("%v\n", err)
+				return
+			}
+		}
+		s.Rating = rating
+		s.RatingManual = rating != ""
+		if err := db.save(); err != nil {
+			fmt.Printf("保存漫画库失败: %v\n", err)
+			return
+		}
+		if s.Dir != "" {
+			if err := updateSeriesRating(s.Dir, rating); err != nil {
+				fmt.Printf("更新 %s 失败: %v\n", seriesMetaFile, err)
+			}
+		}
+		fmt.Printf("%s: %s\n", s.Title, ratingLabel(rating))
+	default:
+		usage()
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// readerBook read 命令打开的漫画：一个章节目录、一部漫画的目录或一个CBZ文件
+type readerBook struct {
+	title    string
+	chapters []*readerChapter
+	prefix   string            // 页面链接的路径前缀，挂载在其他服务的子路径下时使用，如 /read/418
+	archives []*zip.ReadCloser // 打开的CBZ，close 时关闭
+}
+
+// readerChapter 阅读器中的一个章节
+type readerChapter struct {
+	title string
+	dir   string // 章节目录，来自CBZ时为空
+	pages []readerPage
+}
+
+// readerPage 一页图片，来自目录中的文件或CBZ中的条目
+type readerPage struct {
+	path    string
+	zipFile *zip.File
+}
+
+// runReadCommand 启动只读的网页阅读器，直接从下载的目录或CBZ中读取图片，不需要另外安装阅读器
+func runReadCommand(args []string) {
+	target := ""
+	port := 8081
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--port":
+			if i+1 >= len(args) {
+				fmt.Println("--port 需要一个端口号")
+				return
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 || n > 65535 {
+				fmt.Printf("无效的端口号: %s\n", args[i+1])
+				return
+			}
+			port = n
+			i++
+		default:
+			target = args[i]
+		}
+	}
+	if target == "" {
+		fmt.Println("用法: ./comicbox read <漫画目录|章节目录|文件.cbz> [--port 8081]")
+		return
+	}
+
+	book, err := openReaderBook(target)
+	if err != nil {
+		fmt.Printf("打开漫画失败: %v\n", err)
+		return
+	}
+	if len(book.chapters) == 0 {
+		fmt.Printf("%s 中没有找到图片\n", target)
+		return
+	}
+
+	// 只监听本机，阅读器不做访问控制
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		fmt.Printf("启动阅读器失败: %v\n", err)
+		return
+	}
+	fmt.Printf("%s: %d 个章节，在浏览器中打开 http://%s/ 阅读，按 Ctrl+C 退出\n",
+		book.title, len(book.chapters), listener.Addr())
+	if err := http.Serve(listener, book.handler()); err != nil {
+		fmt.Printf("阅读器已停止: %v\n", err)
+	}
+}
+
+// openReaderBook 打开章节目录、漫画目录或CBZ文件
+// 漫画目录中的章节按目录名排序（下载时已按序号命名），只剩CBZ的章节（目录已被清理）也会列出
+func openReaderBook(target string) (*readerBook, error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	book := &readerBook{title: strings.TrimSuffix(filepath.Base(target), filepath.Ext(target))}
+	if !info.IsDir() {
+		book.chapters, err = book.cbzChapters(target)
+		return book, err
+	}
+
+	entries, err := os.ReadDir(target)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		names[entry.Name()] = true
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if name[0] == '.' {
+			continue
+		}
+		full := filepath.Join(target, name)
+		switch {
+		case entry.IsDir():
+			if chapter := dirChapter(full); chapter != nil {
+				book.chapters = append(book.chapters, chapter)
+			}
+		case strings.EqualFold(filepath.Ext(name), ".cbz") && !names[strings.TrimSuffix(name, filepath.Ext(name))]:
+			chapters, err := book.cbzChapters(full)
+			if err != nil {
+				fmt.Printf("跳过 %s: %v\n", name, err)
+				continue
+			}
+			book.chapters = append(book.chapters, chapters...)
+		}
+	}
+
+	// 没有章节子目录时是单个章节的目录
+	if len(book.chapters) == 0 {
+		if chapter := dirChapter(target); chapter != nil {
+			book.chapters = []*readerChapter{chapter}
+		}
+	}
+	return book, nil
+}
+
+// dirChapter 读取章节目录中的图片，有 chapter.json 时按其中记录的页码排列，否则按文件名排列
+// 目录中没有图片时返回nil
+func dirChapter(dir string) *readerChapter {
+	chapter := &readerChapter{title: chapterPrefixPattern.ReplaceAllString(filepath.Base(dir), ""), dir: dir}
+	if meta, err := loadChapterMeta(dir); err == nil {
+		if meta.Title != "" {
+			chapter.title = meta.Title
+		}
+		parts := pageParts(dir, meta)
+		for i, file := range pageFiles(dir, meta) {
+			if file == "" {
+				continue
+			}
+			chapter.pages = append(chapter.pages, readerPage{path: file})
+			for _, part := range parts[i] {
+				chapter.pages = append(chapter.pages, readerPage{path: part})
+			}
+		}
+	}
+	if len(chapter.pages) == 0 {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && isImageFile(entry.Name()) {
+				chapter.pages = append(chapter.pages, readerPage{path: filepath.Join(dir, entry.Name())})
+			}
+		}
+	}
+	if len(chapter.pages) == 0 {
+		return nil
+	}
+	return chapter
+}
+
+// flatPagePattern ebook --flat 打包的图片文件名：章节目录名（序号后的下划线换成 -）、-、原文件名
+var flatPagePattern = regexp.MustCompile(`^(\d+-.+)-([^-]+)$`)
+
+// cbzChapters 读取CBZ中的图片，按所在文件夹分为章节（ebook 打包的整部漫画每个章节一个文件夹，
+// --flat 打包的按文件名的章节前缀分）；加密的CBZ无法读取；CBZ在阅读器运行期间保持打开，直到调用 close
+func (b *readerBook) cbzChapters(file string) ([]*readerChapter, error) {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+
+	byDir := make(map[string]*readerChapter)
+	var dirs []string
+	for _, f := range archive.File {
+		dir := path.Dir(f.Name)
+		// ebook 打包时目录页使用的缩略图不是章节
+		if f.FileInfo().IsDir() || !isImageFile(f.Name) || dir == "thumbs" {
+			continue
+		}
+		if m := flatPagePattern.FindStringSubmatch(f.Name); dir == "." && m != nil {
+			dir = strings.Replace(m[1], "-", "_", 1)
+		}
+		chapter, ok := byDir[dir]
+		if !ok {
+			title := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+			if dir != "." {
+				title = path.Base(dir)
+			}
+			chapter = &readerChapter{title: chapterPrefixPattern.ReplaceAllString(title, "")}
+			byDir[dir] = chapter
+			dirs = append(dirs, dir)
+		}
+		chapter.pages = append(chapter.pages, readerPage{zipFile: f})
+	}
+	if len(dirs) == 0 {
+		archive.Close()
+		return nil, nil
+	}
+	b.archives = append(b.archives, archive)
+
+	sort.Strings(dirs)
+	chapters := make([]*readerChapter, 0, len(dirs))
+	for _, dir := range dirs {
+		chapter := byDir[dir]
+		sort.Slice(chapter.pages, func(i, j int) bool {
+			return chapter.pages[i].zipFile.Name < chapter.pages[j].zipFile.Name
+		})
+		chapters = append(chapters, chapter)
+	}
+	return chapters, nil
+}
+
+// close 关闭打开的CBZ
+func (b *readerBook) close() {
+	for _, archive := range b.archives {
+		archive.Close()
+	}
+	b.archives = nil
+}
+
+// handler 阅读器的页面：/ 为章节页面（?c=章节序号），/page/<章节>/<页> 为图片
+func (b *readerBook) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		index, _ := strconv.Atoi(r.URL.Query().Get("c"))
+		if index < 0 || index >= len(b.chapters) {
+			index = 0
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := readerTemplate.Execute(w, b.pageData(index)); err != nil {
+			debugf("渲染阅读器页面失败: %v\n", err)
+		}
+	})
+	mux.HandleFunc("/page/", func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/page/"), "/")
+		if len(parts) != 2 {
+			http.NotFound(w, r)
+			return
+		}
+		c, err1 := strconv.Atoi(parts[0])
+		p, err2 := strconv.Atoi(parts[1])
+		if err1 != nil || err2 != nil || c < 0 || c >= len(b.chapters) || p < 0 || p >= len(b.chapters[c].pages) {
+			http.NotFound(w, r)
+			return
+		}
+		b.chapters[c].pages[p].serve(w, r)
+	})
+	mux.HandleFunc("/chapters", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := readerIndexTemplate.Execute(w, b.pageData(0)); err != nil {
+			debugf("渲染阅读器页面失败: %v\n", err)
+		}
+	})
+	mux.HandleFunc("/thumb/", func(w http.ResponseWriter, r *http.Request) {
+		c, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/thumb/"))
+		if err != nil || c < 0 || c >= len(b.chapters) {
+			http.NotFound(w, r)
+			return
+		}
+		b.chapters[c].serveThumbnail(w, r)
+	})
+	return mux
+}
+
+// serve 输出图片内容
+func (p readerPage) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "max-age=3600")
+	if p.zipFile == nil {
+		http.ServeFile(w, r, p.path)
+		return
+	}
+	rc, err := p.zipFile.Open()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+	if ct := mime.TypeByExtension(path.Ext(p.zipFile.Name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	w.Header().Set("Content-Length", strconv.FormatUint(p.zipFile.UncompressedSize64, 10))
+	io.Copy(w, rc)
+}
+
+// serveThumbnail 输出章节缩略图：章节目录的缩略图缓存在漫画目录的 .thumbs 中，CBZ 中的章节每次生成
+func (c *readerChapter) serveThumbnail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "max-age=3600")
+	if c.dir != "" {
+		thumb, err := chapterThumbnail(c.dir)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.ServeFile(w, r, thumb)
+		return
+	}
+	rc, err := c.pages[0].zipFile.Open()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+	data, err := makeThumbnail(rc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Write(data)
+}
+
+// readerPageData 章节页面模板的数据
+type readerPageData struct {
+	Prefix   string
+	Title    string
+	Chapter  string
+	Index    int
+	Prev     int // 上一章的序号，没有时为 -1
+	Next     int // 下一章的序号，没有时为 -1
+	Chapters []string
+	Pages    []string
+}
+
+// pageData 生成第 index 个章节的页面数据
+func (b *readerBook) pageData(index int) readerPageData {
+	data := readerPageData{Prefix: b.prefix, Title: b.title, Chapter: b.chapters[index].title, Index: index, Prev: index - 1, Next: index + 1}
+	if data.Next >= len(b.chapters) {
+		data.Next = -1
+	}
+	for _, c := range b.chapters {
+		data.Chapters = append(data.Chapters, c.title)
+	}
+	for p := range b.chapters[index].pages {
+		data.Pages = append(data.Pages, fmt.Sprintf("%s/page/%d/%d", b.prefix, index, p))
+	}
+	return data
+}
+
+// readerTemplate 阅读器页面：连续滚动，←/→ 或 P/N 切换章节，J/K 或空格翻屏，Home/End 回到开头/结尾
+var readerTemplate = template.Must(template.New("reader").Parse(`<!DOCTYPE html>
+<html lang="zh">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Chapter}} - {{.Title}}</title>
+<style>
+body { margin: 0; background: #111; color: #ddd; font-family: sans-serif; }
+nav { position: sticky; top: 0; display: flex; gap: 8px; align-items: center; padding: 6px 10px; background: rgba(20,20,20,.92); }
+nav a { color: #9cf; text-decoration: none; }
+nav a.off { color: #555; pointer-events: none; }
+nav select { flex: 1; max-width: 420px; background: #222; color: #ddd; border: 1px solid #444; }
+main img { display: block; max-width: 100%; margin: 0 auto; }
+.end { text-align: center; padding: 32px; }
+</style>
+</head>
+<body>
+<nav>
+<a href="?c={{.Prev}}" id="prev"{{if lt .Prev 0}} class="off"{{end}}>← 上一章</a>
+<a href="{{.Prefix}}/chapters">目录</a>
+<select onchange="location.search='?c='+this.value">
+{{range $i, $t := .Chapters}}<option value="{{$i}}"{{if eq $i $.Index}} selected{{end}}>{{$t}}</option>
+{{end}}</select>
+<a href="?c={{.Next}}" id="next"{{if lt .Next 0}} class="off"{{end}}>下一章 →</a>
+<span>{{len .Pages}} 页</span>
+</nav>
+<main>
+{{range .Pages}}<img src="{{.}}" loading="lazy" alt="">
+{{end}}</main>
+<div class="end">{{if ge .Next 0}}<a href="?c={{.Next}}" style="color:#9cf">下一章 →</a>{{else}}已是最后一章{{end}}</div>
+<script>
+document.addEventListener('keydown', function (e) {
+  if (e.ctrlKey || e.metaKey || e.altKey || e.target.tagName === 'SELECT') return;
+  var go = function (id) { var a = document.getElementById(id); if (!a.classList.contains('off')) location.href = a.href; };
+  switch (e.key) {
+  case 'ArrowLeft': case 'p': go('prev'); break;
+  case 'ArrowRight': case 'n': go('next'); break;
+  case 'j': window.scrollBy(0, window.innerHeight * 0.9); break;
+  case 'k': window.scrollBy(0, -window.innerHeight * 0.9); break;
+  default: return;
+  }
+  e.preventDefault();
+});
+</script>
+</body>
+</html>
+`))
+
+// readerIndexTemplate 章节目录页面：按缩略图列出所有章节
+var readerIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="zh">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { margin: 0; padding: 16px; background: #111; color: #ddd; font-family: sans-serif; }
+ul { display: grid; grid-template-columns: repeat(auto-fill, minmax(140px, 1fr)); gap: 16px; list-style: none; padding: 0; }
+a { color: #ddd; text-decoration: none; }
+img { width: 100%; aspect-ratio: 2 / 3; object-fit: cover; background: #222; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+{{range $i, $t := .Chapters}}<li><a href="{{$.Prefix}}/?c={{$i}}"><img src="{{$.Prefix}}/thumb/{{$i}}" loading="lazy" alt=""><div>{{$t}}</div></a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// trimRecap 下载完一个章节后，去掉开头与上一章结尾重复的页（前情回顾），由 --trim-recap 或配置文件的 trim_recap 开启
+var trimRecap bool
+
+// maxRecapPages 最多比较的页数：本章开头的页与上一章结尾相同数量的页逐页比较
+const maxRecapPages = 6
+
+// recapHashDistance 两页的感知哈希最多相差的位数，重新压缩或缩放过的同一张图片通常相差几位
+const recapHashDistance = 6
+
+// pageFingerprint 比较两页是否相同的依据：内容的 SHA-256 和 64 位差异哈希（dHash）
+type pageFingerprint struct {
+	sha256 string
+	dhash  uint64
+	hashed bool // 能否解码图片计算 dHash，不支持的格式只比较 SHA-256
+}
+
+// matches 两页内容相同，或感知哈希足够接近
+// 接近纯色的页（如全黑的过渡页）dHash 几乎全为0，只在内容完全相同时才算重复，避免误删
+func (a pageFingerprint) matches(b pageFingerprint) bool {
+	if a.sha256 == b.sha256 {
+		return true
+	}
+	if !a.hashed || !b.hashed || bits.OnesCount64(a.dhash) < 8 || bits.OnesCount64(b.dhash) < 8 {
+		return false
+	}
+	return bits.OnesCount64(a.dhash^b.dhash) <= recapHashDistance
+}
+
+// fingerprintPage 计算一页的 SHA-256 和 dHash
+func fingerprintPage(path string) (pageFingerprint, error) {
+	sum, err := fileSHA256(path)
+	if err != nil {
+		return pageFingerprint{}, err
+	}
+	fp := pageFingerprint{sha256: sum}
+	release, err := reserveImageMemory(path)
+	if err != nil {
+		return fp, nil
+	}
+	defer release()
+	file, err := os.Open(path)
+	if err != nil {
+		return fp, err
+	}
+	defer file.Close()
+	if img, _, err := image.Decode(file); err == nil {
+		fp.dhash = differenceHash(img)
+		fp.hashed = true
+	}
+	return fp, nil
+}
+
+// differenceHash 把图片缩小为 9x8 的灰度图，比较每行相邻的两个像素得到 64 位哈希
+func differenceHash(img image.Image) uint64 {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	var gray [8][9]uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 9; x++ {
+			// 对每一格内的像素取样求平均，格子较大时按步长取样
+			x0, x1 := bounds.Min.X+x*w/9, bounds.Min.X+(x+1)*w/9
+			y0, y1 := bounds.Min.Y+y*h/8, bounds.Min.Y+(y+1)*h/8
+			stepX, stepY := max((x1-x0)/8, 1), max((y1-y0)/8, 1)
+			var sum, n uint64
+			for py := y0; py < y1; py += stepY {
+				for px := x0; px < x1; px += stepX {
+					r, g, b, _ := img.At(px, py).RGBA()
+					sum += uint64(299*r+587*g+114*b) / 1000
+					n++
+				}
+			}
+			if n > 0 {
+				gray[y][x] = sum / n
+			}
+		}
+	}
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// chapterPagePaths 按页码列出章节中的图片：有 chapter.json 时按其中的记录，否则按文件名排序
+func chapterPagePaths(dir string) []string {
+	if meta, err := loadChapterMeta(dir); err == nil {
+		pages := append([]pageMeta(nil), meta.Pages...)
+		sort.Slice(pages, func(i, j int) bool { return pages[i].Index < pages[j].Index })
+		var paths []string
+		for _, p := range pages {
+			paths = append(paths, filepath.Join(dir, p.File))
+		}
+		return paths
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isImageFile(entry.Name()) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// fingerprintPages 计算多页的指纹，无法读取的页返回错误
+func fingerprintPages(paths []string) ([]pageFingerprint, error) {
+	fps := make([]pageFingerprint, len(paths))
+	for i, path := range paths {
+		fp, err := fingerprintPage(path)
+		if err != nil {
+			return nil, err
+		}
+		fps[i] = fp
+	}
+	return fps, nil
+}
+
+// recapLength 本章开头有多少页与上一章结尾的页依次相同，至少保留本章的一页
+func recapLength(prev, cur []string) (int, error) {
+	limit := min(maxRecapPages, len(prev), len(cur)-1)
+	if limit < 1 {
+		return 0, nil
+	}
+	tail, err := fingerprintPages(prev[len(prev)-limit:])
+	if err != nil {
+		return 0, err
+	}
+	head, err := fingerprintPages(cur[:limit])
+	if err != nil {
+		return 0, err
+	}
+	// 从最长的重叠开始尝试：本章前 k 页与上一章最后 k 页逐页相同
+	for k := limit; k >= 1; k-- {
+		same := true
+		for i := 0; i < k && same; i++ {
+			same = head[i].matches(tail[limit-k+i])
+		}
+		if same {
+			return k, nil
+		}
+	}
+	return 0, nil
+}
+
+// previousChapterDir 漫画目录中排在 dir 前面的章节目录，章节目录名以序号开头，按名称排序即为章节顺序
+func previousChapterDir(dir string) string {
+	seriesDir, name := filepath.Split(filepath.Clean(dir))
+	entries, err := os.ReadDir(seriesDir)
+	if err != nil {
+		return ""
+	}
+	prev := ""
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if entry.Name() == name {
+			break
+		}
+		prev = entry.Name()
+	}
+	if prev == "" {
+		return ""
+	}
+	return filepath.Join(seriesDir, prev)
+}
+
+// trimChapterRecap 比较章节与上一章，删除开头重复的页，并在 chapter.json 中记录删除的页码，返回删除的页数
+// 已经去除过的章节不再比较；dryRun 时只返回重复的页数
+func trimChapterRecap(prevDir, dir string, dryRun bool) (int, error) {
+	meta, err := loadChapterMeta(dir)
+	if err != nil {
+		return 0, err
+	}
+	if len(meta.Recap) > 0 {
+		return 0, nil
+	}
+	sort.Slice(meta.Pages, func(i, j int) bool { return meta.Pages[i].Index < meta.Pages[j].Index })
+	var cur []string
+	for _, p := range meta.Pages {
+		cur = append(cur, filepath.Join(dir, p.File))
+	}
+	n, err := recapLength(chapterPagePaths(prevDir), cur)
+	if err != nil || n == 0 || dryRun {
+		return n, err
+	}
+
+	for _, p := range meta.Pages[:n] {
+		os.Remove(filepath.Join(dir, p.File))
+		for _, part := range p.Parts {
+			os.Remove(filepath.Join(dir, part))
+		}
+		meta.Recap = append(meta.Recap, p.Index)
+	}
+	meta.Pages = meta.Pages[n:]
+	meta.Cover = chapterCover(dir, meta)
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return n, err
+	}
+	return n, writeFileAtomic(filepath.Join(dir, chapterMetaFile), data)
+}
+
+// trimRecapAfterDownload 下载完成后去除章节开头的前情回顾，返回删除的页数
+func trimRecapAfterDownload(dir string) int {
+	prevDir := previousChapterDir(dir)
+	if prevDir == "" {
+		return 0
+	}
+	n, err := trimChapterRecap(prevDir, dir, false)
+	if err != nil {
+		fmt.Printf("比较前情回顾失败: %v\n", err)
+		return 0
+	}
+	if n > 0 {
+		infof("开头 %d 页与上一章结尾重复，已删除\n", n)
+	}
+	return n
+}
+
+// dropRecapFiles 重新下载章节后删除之前去除过的前情回顾页，使 chapter.json 不再记录它们
+func dropRecapFiles(meta *chapterMeta, result *chapterResult) {
+	for _, index := range meta.Recap {
+		if index < 0 || index >= len(result.files) || result.files[index] == "" {
+			continue
+		}
+		os.Remove(result.files[index])
+		for _, part := range result.parts[index] {
+			os.Remove(part)
+		}
+		result.files[index] = ""
+		delete(result.parts, index)
+	}
+}
+
+// runTrimRecapCommand 对已下载的漫画逐章比较，去除每章开头与上一章结尾重复的页
+func runTrimRecapCommand(args []string) {
+	dryRun := false
+	repack := false
+	target := ""
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--repack":
+			repack = true
+		default:
+			target = arg
+		}
+	}
+	if target == "" {
+		fmt.Println("用法: ./comicbox trim-recap <漫画目录|漫画ID> [--dry-run] [--repack]")
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	seriesDir := target
+	if record := db.findSeries(target); record != nil && record.Dir != "" {
+		seriesDir = record.Dir
+	}
+	if !dryRun {
+		// 与下载这部漫画互斥，避免删除正在下载的章节中的页
+		lock, err := lockSeriesDir(db, seriesDir)
+		if err != nil {
+			fmt.Printf("无法去除重复的页: %v\n", err)
+			return
+		}
+		defer lock.unlock()
+	}
+	entries, err := os.ReadDir(seriesDir)
+	if err != nil {
+		fmt.Printf("读取漫画目录失败: %v\n", err)
+		return
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			dirs = append(dirs, filepath.Join(seriesDir, entry.Name()))
+		}
+	}
+	var trimmed []string
+	total := 0
+	for i := 1; i < len(dirs); i++ {
+		if fileSize(filepath.Join(dirs[i], chapterMetaFile)) == 0 {
+			continue
+		}
+		n, err := trimChapterRecap(dirs[i-1], dirs[i], dryRun)
+		if err != nil {
+			fmt.Printf("%s: %v\n", filepath.Base(dirs[i]), err)
+			continue
+		}
+		if n == 0 {
+			continue
+		}
+		fmt.Printf("%s: 开头 %d 页与上一章结尾重复\n", filepath.Base(dirs[i]), n)
+		total += n
+		trimmed = append(trimmed, dirs[i])
+	}
+
+	if len(trimmed) == 0 {
+		fmt.Println("没有找到与上一章重复的页")
+		return
+	}
+	if dryRun {
+		fmt.Printf("共 %d 个章节、%d 页重复（未删除，去掉 --dry-run 后执行）\n", len(trimmed), total)
+		return
+	}
+	fmt.Printf("已从 %d 个章节中删除 %d 页重复的页\n", len(trimmed), total)
+	var packed []string
+	for _, dir := range trimmed {
+		if fileSize(dir+".cbz") > 0 {
+			packed = append(packed, dir)
+		}
+	}
+	if repack {
+		repackDirs(seriesDir, packed)
+	} else if len(packed) > 0 {
+		fmt.Printf("%d 个已打包的CBZ仍包含重复的页，可以加上 --repack 重新打包\n", len(packed))
+	}
+}
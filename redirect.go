@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// 跟随重定向的方式
+const (
+	redirectFollow    = "follow"    // 跟随所有重定向，到允许列表以外主机的只输出提示
+	redirectAllowlist = "allowlist" // 只跟随到同一站点或允许列表中主机的重定向
+	redirectSameHost  = "same-host" // 只跟随同一站点内的重定向
+)
+
+var (
+	// maxRedirects 一个请求最多跟随的重定向次数，0 为不跟随，由 --max-redirects 或配置文件的 max_redirects 设置
+	maxRedirects = 10
+	// redirectPolicy 跟随到其他主机的重定向的方式，由 --redirects 或配置文件的 redirects 设置
+	redirectPolicy = redirectFollow
+	// redirectAllow 允许重定向到的主机，"*.example.com" 匹配所有子域名，由 --redirect-allow 或配置文件的 redirect_allow 设置
+	redirectAllow []string
+)
+
+// errRedirectBlocked 重定向按设置被阻止，重试也不会改变结果
+var errRedirectBlocked = errors.New("已阻止重定向")
+
+// redirectWarned 已提示过的重定向目标主机，每个只提示一次
+var redirectWarned sync.Map
+
+// parseRedirectPolicy 检查 --redirects 的值
+func parseRedirectPolicy(value string) (string, error) {
+	switch value {
+	case redirectFollow, redirectAllowlist, redirectSameHost:
+		return value, nil
+	}
+	return "", fmt.Errorf("无效的重定向方式: %s（可用 %s、%s、%s）", value, redirectFollow, redirectAllowlist, redirectSameHost)
+}
+
+// checkRedirect 页面、接口和图片请求的 http.Client.CheckRedirect：限制重定向次数，
+// 按 redirectPolicy 检查到其他主机的重定向。被劫持的镜像站可能把请求重定向到恶意网站
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	from, to := via[len(via)-1].URL.Hostname(), req.URL.Hostname()
+	if maxRedirects == 0 {
+		return fmt.Errorf("%w: 不跟随重定向（--max-redirects 0）: %s -> %s", errRedirectBlocked, from, req.URL.Redacted())
+	}
+	if len(via) > maxRedirects {
+		return fmt.Errorf("%w: 重定向次数超过 %d 次", errRedirectBlocked, maxRedirects)
+	}
+	debugf("重定向到: %s\n", req.URL.String())
+	if sameSiteHost(from, to) {
+		return nil
+	}
+	allowed := redirectAllowed(contextBaseURL(req.Context()), to)
+	switch {
+	case redirectPolicy == redirectSameHost || (redirectPolicy == redirectAllowlist && !allowed):
+		fmt.Printf("已阻止 %s 重定向到 %s\n", from, req.URL.Redacted())
+		return fmt.Errorf("%w: %s -> %s", errRedirectBlocked, from, to)
+	case !allowed:
+		if _, warned := redirectWarned.LoadOrStore(to, true); !warned {
+			fmt.Printf("注意: %s 重定向到了不在允许列表中的主机 %s，如果不是预期的，请检查镜像站是否被劫持（--redirects allowlist 可以阻止）\n",
+				from, req.URL.Redacted())
+		}
+	}
+	return nil
+}
+
+// sameSiteHost 两个主机名是否属于同一站点：可注册的主域名（如 92hm.life、example.co.uk）相同
+func sameSiteHost(a, b string) bool {
+	return baseDomain(a) == baseDomain(b)
+}
+
+// baseDomain 主机名按公共后缀列表得到的可注册域名，如 a.b.example.co.uk 为 example.co.uk，
+// github.io 等公共后缀下的每个子域名各自是一个站点；IP 地址和无法确定的主机名原样返回
+func baseDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if strings.Contains(host, ":") || strings.Trim(host, "0123456789.") == "" {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// redirectAllowed 重定向目标是否可信：在允许列表中、是已支持的站点或已识别的镜像站，或是 baseURL 站点的主机
+func redirectAllowed(baseURL, host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range redirectAllow {
+		pattern = strings.ToLower(pattern)
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	if u, err := url.Parse(baseURL); err == nil && sameSiteHost(u.Hostname(), host) {
+		return true
+	}
+	knownHostsMu.Lock()
+	_, known := knownHosts[host]
+	knownHostsMu.Unlock()
+	if known {
+		return true
+	}
+	for _, site := range siteAdapters {
+		if site.matchHost(host) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// chapterPrefixPattern 章节目录名开头的序号，如 001_第1話 中的 001_
+var chapterPrefixPattern = regexp.MustCompile(`^\d+_`)
+
+// renumberEntry 一个需要重新编号的章节目录
+type renumberEntry struct {
+	oldName string
+	newName string
+	title   string
+	number  float64
+	hasNum  bool
+	archive bool // 章节目录旁边有单独打包的CBZ
+}
+
+// runRenumberCommand 按章节标题中的话数重新排序漫画目录中的章节，并改名为 <序号>_<标题>
+// 用于修复按下载顺序编号的旧漫画库，同时更新漫画库记录和 chapter.json，--repack 时重新打包已有的CBZ
+func runRenumberCommand(args []string) {
+	dryRun := false
+	repack := false
+	target := ""
+	for _, arg := range args {
+		switch arg {
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--repack":
+			repack = true
+		default:
+			target = arg
+		}
+	}
+	if target == "" {
+		fmt.Println("用法: ./comicbox renumber <漫画目录|漫画ID> [--dry-run] [--repack]")
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	seriesDir := target
+	record := db.findSeries(target)
+	if record != nil && record.Dir != "" {
+		seriesDir = record.Dir
+	} else {
+		record = findSeriesByDir(db, seriesDir)
+	}
+	if !dryRun {
+		// 与下载这部漫画互斥；加锁后重新读取漫画库，保存时不会覆盖其他进程刚写入的记录
+		lock, err := lockSeriesDir(db, seriesDir)
+		if err != nil {
+			fmt.Printf("无法重新编号: %v\n", err)
+			return
+		}
+		defer lock.unlock()
+		if db, err = loadLibrary(); err != nil {
+			fmt.Printf("读取漫画库失败: %v\n", err)
+			return
+		}
+		record = findSeriesByDir(db, seriesDir)
+	}
+
+	entries, err := renumberPlan(seriesDir)
+	if err != nil {
+		fmt.Printf("读取漫画目录失败: %v\n", err)
+		return
+	}
+	changed := 0
+	for _, e := range entries {
+		if e.oldName != e.newName {
+			fmt.Printf("%s -> %s\n", e.oldName, e.newName)
+			changed++
+		}
+	}
+	if changed == 0 {
+		fmt.Println("章节顺序已经正确，无需重新编号")
+		return
+	}
+	if dryRun {
+		fmt.Printf("共 %d 个章节需要改名（未执行，去掉 --dry-run 后执行）\n", changed)
+		return
+	}
+
+	if err := applyRenumber(seriesDir, entries); err != nil {
+		fmt.Printf("重新编号失败: %v\n", err)
+		return
+	}
+
+	// 更新漫画库中记录的章节目录名和各章节的 chapter.json
+	renamed := make(map[string]string)
+	for _, e := range entries {
+		renamed[e.oldName] = e.newName
+	}
+	if record != nil {
+		for _, c := range record.Chapters {
+			if name, ok := renamed[c.Dir]; ok {
+				c.Dir = name
+			}
+		}
+		if err := db.save(); err != nil {
+			fmt.Printf("保存漫画库失败: %v\n", err)
+		}
+	}
+	for i, e := range entries {
+		if err := setChapterNumber(filepath.Join(seriesDir, e.newName), i+1); err != nil {
+			fmt.Printf("更新 %s 的章节信息失败: %v\n", e.newName, err)
+		}
+	}
+	fmt.Printf("已重新编号 %d 个章节\n", changed)
+
+	if repack {
+		repackChapters(seriesDir, entries)
+	}
+}
+
+// findSeriesByDir 按漫画目录查找漫画库中的记录
+func findSeriesByDir(db *libraryDB, dir string) *seriesRecord {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil
+	}
+	for _, s := range db.Series {
+		if s.Dir == "" {
+			continue
+		}
+		if sAbs, err := filepath.Abs(s.Dir); err == nil && sAbs == abs {
+			return s
+		}
+	}
+	return nil
+}
+
+// renumberPlan 列出漫画目录中的章节，按标题中的话数排序（无法解析话数的章节排在最后，话数相同时保持原顺序），
+// 计算每个章节的新目录名
+func renumberPlan(seriesDir string) ([]*renumberEntry, error) {
+	dirEntries, err := os.ReadDir(seriesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*renumberEntry
+	for _, entry := range dirEntries {
+		name := entry.Name()
+		if !entry.IsDir() || name[0] == '.' {
+			continue
+		}
+		e := &renumberEntry{oldName: name, title: chapterPrefixPattern.ReplaceAllString(name, "")}
+		if meta, err := loadChapterMeta(filepath.Join(seriesDir, name)); err == nil && meta.Title != "" {
+			e.title = sanitizeFileName(meta.Title)
+		}
+		e.number, e.hasNum = parseChapterNumber(e.title)
+		e.archive = fileSize(filepath.Join(seriesDir, name+".cbz")) > 0
+		entries = append(entries, e)
+	}
+
+	// 目录名已按原序号排列，稳定排序使话数相同的章节（如上/下篇）保持原来的先后
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].hasNum != entries[j].hasNum {
+			return entries[i].hasNum
+		}
+		return entries[i].hasNum && entries[i].number < entries[j].number
+	})
+	for i, e := range entries {
+		e.newName = fmt.Sprintf("%03d_%s", i+1, pathName(e.title))
+	}
+	return entries, nil
+}
+
+// applyRenumber 改名章节目录及旁边的CBZ：先全部改为临时名称再改为新名称，避免新旧名称互相占用
+// 中途失败时按相反的顺序撤销已完成的改名，恢复原来的目录名
+func applyRenumber(seriesDir string, entries []*renumberEntry) error {
+	var done [][2]string
+	move := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+		done = append(done, [2]string{from, to})
+		return nil
+	}
+	err := func() error {
+		for i, e := range entries {
+			if e.oldName == e.newName {
+				continue
+			}
+			tmp := filepath.Join(seriesDir, fmt.Sprintf(".renumber_%d", i))
+			if err := move(filepath.Join(seriesDir, e.oldName), tmp); err != nil {
+				return err
+			}
+			if e.archive {
+				if err := move(filepath.Join(seriesDir, e.oldName+".cbz"), tmp+".cbz"); err != nil {
+					return err
+				}
+			}
+		}
+		for i, e := range entries {
+			if e.oldName == e.newName {
+				continue
+			}
+			tmp := filepath.Join(seriesDir, fmt.Sprintf(".renumber_%d", i))
+			if err := move(tmp, filepath.Join(seriesDir, e.newName)); err != nil {
+				return err
+			}
+			if e.archive {
+				if err := move(tmp+".cbz", filepath.Join(seriesDir, e.newName+".cbz")); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}()
+	if err == nil {
+		return nil
+	}
+
+	for i := len(done) - 1; i >= 0; i-- {
+		if undoErr := os.Rename(done[i][1], done[i][0]); undoErr != nil {
+			return fmt.Errorf("%v（撤销改名失败，请手动将 %s 改回 %s: %v）", err, done[i][1], done[i][0], undoErr)
+		}
+	}
+	return fmt.Errorf("%v（已撤销改名，章节目录保持原样）", err)
+}
+
+// setChapterNumber 更新章节目录中 chapter.json 的序号，没有 chapter.json 时忽略
+func setChapterNumber(dir string, number int) error {
+	meta, err := loadChapterMeta(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if meta.Number == number {
+		return nil
+	}
+	meta.Number = number
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(dir, chapterMetaFile), data)
+}
+
+// findPackTool 查找 pack 工具：先在 PATH 中查找，再查找与本程序相同的目录，找不到时返回空字符串
+func findPackTool() string {
+	return findTool("pack")
+}
+
+// findTool 查找随本程序发布的工具（pack、ebook）
+func findTool(name string) string {
+	toolPath, err := exec.LookPath(name)
+	if err != nil {
+		if exe, exeErr := os.Executable(); exeErr == nil {
+			toolPath = filepath.Join(filepath.Dir(exe), name)
+		}
+	}
+	if fileSize(toolPath) == 0 {
+		return ""
+	}
+	return toolPath
+}
+
+// repackChapters 用 pack 工具重新打包改名后已有CBZ的章节，使 ComicInfo.xml 中的序号与新的顺序一致
+func repackChapters(seriesDir string, entries []*renumberEntry) {
+	var dirs []string
+	for _, e := range entries {
+		if e.archive && e.oldName != e.newName {
+			dirs = append(dirs, filepath.Join(seriesDir, e.newName))
+		}
+	}
+	repackDirs(seriesDir, dirs)
+}
+
+// repackDirs 用 pack 工具重新打包漫画目录中的章节，CBZ 保存在漫画目录中
+func repackDirs(seriesDir string, dirs []string) {
+	if len(dirs) == 0 {
+		fmt.Println("没有需要重新打包的章节")
+		return
+	}
+
+	packPath := findPackTool()
+	if packPath == "" {
+		fmt.Println("未找到 pack 工具，请将其放在 PATH 中或与本程序相同的目录，或手动重新打包:")
+		fmt.Printf("  pack -o %q %s/*\n", seriesDir, seriesDir)
+		return
+	}
+
+	fmt.Printf("正在重新打包 %d 个章节...\n", len(dirs))
+	cmd := exec.Command(packPath, append([]string{"-o", seriesDir}, dirs...)...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Printf("重新打包失败: %v\n", err)
+	}
+}
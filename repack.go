@@ -0,0 +1,400 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// repackJob 一个需要重新生成的压缩包
+type repackJob struct {
+	output string   // 压缩包路径
+	reason string   // 需要重新生成的原因
+	tool   string   // pack 或 ebook
+	args   []string // 工具的参数
+}
+
+// runRepackCommand 找出图片比压缩包新、或内容与压缩包中记录不一致的章节，用 pack 和 ebook 工具重新生成这些CBZ
+// 用于后处理、修复或去除前情回顾等修改了已打包章节的图片之后
+func runRepackCommand(args []string) {
+	dryRun := false
+	force := false
+	workers := 4
+	password := os.Getenv("COMICBOX_PASSWORD")
+	var targets []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--dry-run", "-n":
+			dryRun = true
+		case "--force":
+			force = true
+		case "-j", "--workers":
+			if i+1 >= len(args) {
+				fmt.Printf("%s 需要一个数值\n", args[i])
+				return
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				fmt.Printf("无效的并发数: %s\n", args[i+1])
+				return
+			}
+			workers = n
+			i++
+		case "--password":
+			if i+1 >= len(args) {
+				fmt.Printf("%s 需要一个密码\n", args[i])
+				return
+			}
+			password = args[i+1]
+			i++
+		default:
+			targets = append(targets, args[i])
+		}
+	}
+
+	seriesDirs, err := repackTargets(targets)
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return
+	}
+
+	var db *libraryDB
+	if !dryRun {
+		if db, err = loadLibrary(); err != nil {
+			fmt.Printf("读取漫画库失败: %v\n", err)
+			return
+		}
+	}
+	var jobs []repackJob
+	skippedEncrypted := 0
+	for _, seriesDir := range seriesDirs {
+		// 与下载这部漫画互斥，避免打包下载到一半的章节
+		if !dryRun {
+			lock, err := lockSeriesDir(db, seriesDir)
+			if err != nil {
+				fmt.Printf("跳过 %s: %v\n", seriesDir, err)
+				continue
+			}
+			defer lock.unlock()
+		}
+		for _, job := range staleArchives(seriesDir, force) {
+			if isEncryptedArchive(job.output) {
+				if password == "" {
+					skippedEncrypted++
+					continue
+				}
+				job.args = append([]string{"--encrypt", "--password", password}, job.args...)
+			}
+			jobs = append(jobs, job)
+		}
+	}
+	if skippedEncrypted > 0 {
+		fmt.Printf("跳过 %d 个加密的压缩包，重新生成需要通过 --password 或环境变量 COMICBOX_PASSWORD 提供密码\n", skippedEncrypted)
+	}
+	if len(jobs) == 0 {
+		fmt.Println("所有压缩包都是最新的")
+		return
+	}
+	for _, job := range jobs {
+		fmt.Printf("%s: %s\n", job.output, job.reason)
+	}
+	if dryRun {
+		fmt.Printf("共 %d 个压缩包需要重新生成（未执行，去掉 --dry-run 后执行）\n", len(jobs))
+		return
+	}
+
+	tools := map[string]string{}
+	for _, job := range jobs {
+		if _, ok := tools[job.tool]; ok {
+			continue
+		}
+		if tools[job.tool] = findTool(job.tool); tools[job.tool] == "" {
+			fmt.Printf("未找到 %s 工具，请将其放在 PATH 中或与本程序相同的目录\n", job.tool)
+			return
+		}
+	}
+
+	// 章节CBZ之间互不影响，用 worker 并发生成；整部漫画的电子书读取章节目录，等章节全部完成后再生成
+	var chapterJobs, ebookJobs []repackJob
+	for _, job := range jobs {
+		if job.tool == "ebook" {
+			ebookJobs = append(ebookJobs, job)
+		} else {
+			chapterJobs = append(chapterJobs, job)
+		}
+	}
+	failed := runRepackJobs(chapterJobs, tools, workers) + runRepackJobs(ebookJobs, tools, workers)
+	fmt.Printf("重新生成了 %d 个压缩包", len(jobs)-failed)
+	if failed > 0 {
+		fmt.Printf("，%d 个失败", failed)
+	}
+	fmt.Println()
+}
+
+// runRepackJobs 用 workers 个 worker 执行重新打包，返回失败的数量
+func runRepackJobs(jobs []repackJob, tools map[string]string, workers int) int {
+	var (
+		mu     sync.Mutex
+		failed int
+		wg     sync.WaitGroup
+	)
+	queue := make(chan repackJob)
+	for w := 0; w < min(workers, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				output, err := exec.CommandContext(runContext, tools[job.tool], job.args...).CombinedOutput()
+				mu.Lock()
+				if err != nil {
+					failed++
+					fmt.Printf("重新生成 %s 失败: %v\n%s", job.output, err, output)
+				} else {
+					verbosef("已重新生成 %s\n", job.output)
+				}
+				mu.Unlock()
+				if err == nil && job.tool == "pack" {
+					runPlugins(pluginEvent{Event: pluginChapterPacked, Dir: strings.TrimSuffix(job.output, ".cbz"), Archive: job.output})
+				}
+			}
+		}()
+	}
+	for _, job := range jobs {
+		if runContext.Err() != nil {
+			break
+		}
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+	return failed
+}
+
+// repackTargets 确定要检查的漫画目录：参数可以是漫画ID、漫画目录或漫画库根目录，未指定时检查整个漫画库
+func repackTargets(targets []string) ([]string, error) {
+	db, err := loadLibrary()
+	if err != nil {
+		return nil, fmt.Errorf("读取漫画库失败: %v", err)
+	}
+	var seriesDirs []string
+	if len(targets) == 0 {
+		for _, s := range db.Series {
+			if s.Dir != "" {
+				seriesDirs = append(seriesDirs, s.Dir)
+			}
+		}
+	}
+	for _, target := range targets {
+		if s := db.findSeries(target); s != nil && s.Dir != "" {
+			seriesDirs = append(seriesDirs, s.Dir)
+			continue
+		}
+		if len(chapterDirs(target)) > 0 {
+			seriesDirs = append(seriesDirs, target)
+			continue
+		}
+		// 漫画库根目录：其中包含章节目录的子目录都是漫画目录
+		entries, err := os.ReadDir(target)
+		if err != nil {
+			return nil, fmt.Errorf("读取目录 %s 失败: %v", target, err)
+		}
+		for _, entry := range entries {
+			dir := filepath.Join(target, entry.Name())
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && len(chapterDirs(dir)) > 0 {
+				seriesDirs = append(seriesDirs, dir)
+			}
+		}
+	}
+	return seriesDirs, nil
+}
+
+// chapterDirs 漫画目录中带 chapter.json 的章节目录
+func chapterDirs(seriesDir string) []string {
+	entries, err := os.ReadDir(seriesDir)
+	if err != nil {
+		return nil
+	}
+	var dirs []string
+	for _, entry := range entries {
+		dir := filepath.Join(seriesDir, entry.Name())
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") && fileSize(filepath.Join(dir, chapterMetaFile)) > 0 {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// staleArchives 列出漫画目录中需要重新生成的压缩包：章节目录旁边的章节CBZ和漫画目录旁边的整部电子书
+// 只检查已经存在的压缩包，不会为从未打包的章节新建
+func staleArchives(seriesDir string, force bool) []repackJob {
+	var jobs []repackJob
+	// 工具在设置了 COMICBOX_OUT 时按漫画库根目录解析相对路径，传入绝对路径
+	if abs, err := filepath.Abs(seriesDir); err == nil {
+		seriesDir = abs
+	}
+	dirs := chapterDirs(seriesDir)
+	seriesMeta := modTime(filepath.Join(seriesDir, seriesMetaFile))
+	var newest time.Time
+	for _, dir := range dirs {
+		changed := newestModTime(dir)
+		if changed.After(newest) {
+			newest = changed
+		}
+		cbz := dir + ".cbz"
+		if fileSize(cbz) == 0 {
+			continue
+		}
+		reason := "--force"
+		if !force {
+			if reason = archiveStaleReason(dir, cbz, seriesMeta); reason == "" {
+				continue
+			}
+		}
+		jobs = append(jobs, repackJob{output: cbz, reason: reason, tool: "pack", args: []string{"-j", "1", "-o", seriesDir, dir}})
+	}
+
+	ebook := filepath.Clean(seriesDir) + ".cbz"
+	if fileSize(ebook) > 0 {
+		reason := "--force"
+		archived := modTime(ebook)
+		switch {
+		case force:
+		case newest.After(archived):
+			reason = "章节目录中有比电子书新的文件"
+		case seriesMeta.After(archived):
+			reason = "series.json 已更新"
+		default:
+			reason = ""
+		}
+		if reason != "" {
+			jobs = append(jobs, repackJob{output: ebook, reason: reason, tool: "ebook", args: []string{"--update", seriesDir}})
+		}
+	}
+	return jobs
+}
+
+// archiveStaleReason 章节CBZ需要重新生成的原因，不需要时返回空字符串：
+// 章节目录中有比压缩包新的文件（包括 chapter.json），漫画的 series.json 已更新，
+// 或图片与压缩包 provenance.json 中记录的文件和校验和不一致（修改时间被保留时也能发现，需要读取每张图片）
+func archiveStaleReason(dir, cbz string, seriesMeta time.Time) string {
+	archived := modTime(cbz)
+	if newestModTime(dir).After(archived) {
+		return "章节目录中有比压缩包新的文件"
+	}
+	if seriesMeta.After(archived) {
+		return "series.json 已更新"
+	}
+
+	packed, err := readArchiveProvenance(cbz)
+	if err != nil || packed == nil {
+		// 旧版本打包的或加密的压缩包，只能按修改时间判断
+		return ""
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	images := make(map[string]bool)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !isImageFile(name) {
+			continue
+		}
+		images[name] = true
+		sum, ok := packed[name]
+		if !ok {
+			return fmt.Sprintf("压缩包中没有 %s", name)
+		}
+		if current, err := fileSHA256(filepath.Join(dir, name)); err == nil && current != sum {
+			return fmt.Sprintf("%s 的内容与压缩包中的不同", name)
+		}
+	}
+	for name := range packed {
+		if isImageFile(name) && !images[name] {
+			return fmt.Sprintf("%s 已从章节目录中删除", name)
+		}
+	}
+	return ""
+}
+
+// readArchiveProvenance 读取 pack 工具写入压缩包的 provenance.json，返回文件名 -> SHA-256
+// 没有来源记录或已加密时返回nil
+func readArchiveProvenance(cbz string) (map[string]string, error) {
+	r, err := zip.OpenReader(cbz)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != "provenance.json" || f.Flags&0x1 != 0 {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		var provenance struct {
+			Files []struct {
+				Name   string `json:"name"`
+				SHA256 string `json:"sha256"`
+			} `json:"files"`
+		}
+		if err := json.NewDecoder(io.LimitReader(rc, 16<<20)).Decode(&provenance); err != nil {
+			return nil, err
+		}
+		sums := make(map[string]string)
+		for _, file := range provenance.Files {
+			sums[file.Name] = file.SHA256
+		}
+		return sums, nil
+	}
+	return nil, nil
+}
+
+// isEncryptedArchive 压缩包中是否有加密的文件
+func isEncryptedArchive(cbz string) bool {
+	r, err := zip.OpenReader(cbz)
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Flags&0x1 != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newestModTime 目录本身及其中文件的最新修改时间，删除文件会更新目录的修改时间
+func newestModTime(dir string) time.Time {
+	newest := modTime(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return newest
+	}
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil && !entry.IsDir() && info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+	}
+	return newest
+}
+
+// modTime 文件的修改时间，不存在时为零值
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// failedUnit 运行中失败的一个章节，记录在运行汇总中，供 retry 命令重新下载
+type failedUnit struct {
+	Kind        string `json:"kind"` // chapter: 未能获取章节页面；pages: 部分图片下载失败；locked: 未解锁
+	SeriesID    string `json:"series_id,omitempty"`
+	SeriesTitle string `json:"series_title,omitempty"`
+	ChapterID   string `json:"chapter_id"`
+	Title       string `json:"title"`
+	Number      int    `json:"number,omitempty"`
+	BaseURL     string `json:"base_url"`
+	Dir         string `json:"dir,omitempty"`   // 章节在漫画库中的目录，单个章节未能获取页面时为空
+	Pages       []int  `json:"pages,omitempty"` // 下载失败的页码，从1开始
+}
+
+// failedPages 返回下载失败的页码（从1开始）
+func failedPages(result chapterResult) []int {
+	var pages []int
+	for i, file := range result.files {
+		if file == "" {
+			pages = append(pages, i+1)
+		}
+	}
+	return pages
+}
+
+// runRetryCommand 读取上次运行的汇总文件，只重新下载其中失败的章节和页面，不重新获取目录页
+// 使用汇总中记录的命令行参数恢复当时的设置（代理、并发数、命名规则等）
+func runRetryCommand(args []string) {
+	from := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--from" && i+1 < len(args) {
+			from = args[i+1]
+			i++
+		}
+	}
+	if from == "" {
+		fmt.Println("用法: ./comicbox retry --from <汇总文件.json>")
+		return
+	}
+
+	data, err := os.ReadFile(from)
+	if err != nil {
+		fmt.Printf("读取汇总文件失败: %v\n", err)
+		return
+	}
+	var summary runSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		fmt.Printf("解析汇总文件失败: %v\n", err)
+		return
+	}
+	if len(summary.Failed) == 0 {
+		fmt.Println("汇总文件中没有失败的章节")
+		return
+	}
+
+	// 恢复上次运行的全局设置，章节ID等位置参数忽略
+	for i := 0; i < len(summary.Args); {
+		n, err := parseGlobalFlag(summary.Args, i)
+		if err != nil {
+			fmt.Printf("恢复上次运行的参数失败: %v\n", err)
+			return
+		}
+		if n == 0 {
+			n = 1
+		}
+		i += n
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	runStats.addPlanned(len(summary.Failed))
+	for i, unit := range summary.Failed {
+		infof("\n正在重试章节 [%d/%d]: %s (%s)\n", i+1, len(summary.Failed), unit.Title, unit.ChapterID)
+		retryUnit(db, unit)
+	}
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+	}
+}
+
+// retryUnit 重新获取章节页面（图片链接可能已过期）并下载，已完整下载的页按 chapter.json 沿用
+func retryUnit(db *libraryDB, unit failedUnit) {
+	siteBaseURL = unit.BaseURL
+	if unit.SeriesID != "" {
+		lock, err := lockSeries(unit.BaseURL, unit.SeriesID)
+		if err != nil {
+			fmt.Printf("无法开始下载: %v\n", err)
+			runStats.recordFailure(unit)
+			return
+		}
+		defer lock.unlock()
+	}
+
+	fetched, err := siteFor(unit.BaseURL).fetchChapter(runContext, unit.BaseURL, unit.ChapterID)
+	if err != nil {
+		fmt.Printf("获取章节失败: %v\n", err)
+		runStats.chapterFetchFailed()
+		unit.Kind = "chapter"
+		runStats.recordFailure(unit)
+		return
+	}
+	filterChapterImages(runContext, fetched)
+
+	// 单个章节未能获取页面时还不知道标题，按下载单个章节的规则确定目录
+	if unit.Dir == "" {
+		unit.Title = fetched.title
+		if unit.Title == "" {
+			unit.Title = "chapter_" + sanitizeFileName(unit.ChapterID)
+		}
+		unit.Dir = libraryPath(sanitizeFileName(unit.Title))
+	}
+	workDir := chapterWorkDir(unit.Dir)
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		fmt.Printf("创建目录失败: %v\n", err)
+		runStats.recordFailure(unit)
+		return
+	}
+	result := downloadChapterImages(runContext, fetched.images, workDir, nil, fetched.fixup)
+	meta := &chapterMeta{
+		ID:            unit.ChapterID,
+		Title:         unit.Title,
+		Number:        unit.Number,
+		SeriesID:      unit.SeriesID,
+		SeriesTitle:   unit.SeriesTitle,
+		SourceURL:     fetched.url,
+		ScrapedAt:     time.Now(),
+		Images:        fetched.images,
+		DeclaredPages: fetched.declared,
+		Strategy:      fetched.strategy,
+		Published:     fetched.published,
+		Notes:         fetched.notes,
+	}
+	if err := writeChapterMeta(workDir, meta, result); err != nil {
+		fmt.Printf("保存章节信息失败: %v\n", err)
+	}
+	if result.failed > 0 {
+		unit.Kind = "pages"
+		unit.Pages = failedPages(result)
+		runStats.recordFailure(unit)
+	}
+	if !finishChapterDir(workDir, unit.Dir, result) || result.failed > 0 {
+		return
+	}
+
+	if unit.SeriesID != "" {
+		record := db.ensureSeries(unit.SeriesID)
+		cr := &chapterRecord{
+			ID:           unit.ChapterID,
+			Title:        unit.Title,
+			Dir:          filepath.Base(unit.Dir),
+			Pages:        result.saved,
+			Bytes:        result.bytes,
+			DownloadedAt: time.Now(),
+			Incomplete:   pageCountShort(fetched.declared, result),
+		}
+		if unit.BaseURL != record.BaseURL {
+			cr.Source = unit.BaseURL
+		}
+		if err := db.journalChapter(record, cr); err != nil {
+			fmt.Printf("保存漫画库失败: %v\n", err)
+		}
+	}
+	infof("章节 %s 下载完成\n", unit.Title)
+}
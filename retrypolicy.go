@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryClass 请求失败的类型，决定是否重试以及重试前等待多久
+type retryClass int
+
+const (
+	retryOther     retryClass = iota // 其他错误（如页面内容不完整），按固定间隔重试
+	retryNever                       // 404/410 等重试也不会成功的错误，以及 robots.txt 禁止、中断
+	retryThrottled                   // 403/429：被站点限制，长时间等待，开启 --rotate 时换一个浏览器标识和代理
+	retryServer                      // 5xx：服务器错误，等待时间逐次加倍
+	retryNetwork                     // 超时、连接被重置等网络错误，短暂等待后重试
+)
+
+const (
+	// throttledDelay 被站点限制后第一次重试前的等待时间，之后逐次加倍
+	throttledDelay = 30 * time.Second
+	// serverErrorDelay 服务器错误后第一次重试前的等待时间，之后逐次加倍
+	serverErrorDelay = 5 * time.Second
+	// networkErrorDelay 网络错误后重试前的等待时间
+	networkErrorDelay = time.Second
+	// maxRetryDelay 单次等待的上限，包括服务器在 Retry-After 中要求的时间
+	maxRetryDelay = 10 * time.Minute
+)
+
+// classifyRetry 按错误类型归类，err 为nil时（如内容不完整）归为 retryOther
+func classifyRetry(err error) retryClass {
+	if err == nil {
+		return retryOther
+	}
+	if errors.Is(err, errRobotsDisallowed) || errors.Is(err, errAgeGate) || errors.Is(err, errRedirectBlocked) ||
+		errors.Is(err, context.Canceled) {
+		return retryNever
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.StatusCode; {
+		case code == http.StatusNotFound || code == http.StatusGone:
+			return retryNever
+		case code == http.StatusForbidden || code == http.StatusTooManyRequests:
+			return retryThrottled
+		case code >= 500:
+			return retryServer
+		}
+		return retryOther
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return retryNetwork
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return retryNetwork
+	}
+	return retryOther
+}
+
+// retryDelay 第 attempt 次（从1开始）失败后重试前等待的时间，调用前先用 classifyRetry 排除不应重试的错误
+// base 为其他错误的固定间隔（页面 5 秒、图片 2 秒）
+func retryDelay(err error, attempt int, base time.Duration) time.Duration {
+	var delay time.Duration
+	switch classifyRetry(err) {
+	case retryThrottled:
+		delay = backoff(throttledDelay, attempt)
+		siteBreaker.rotateIdentity()
+	case retryServer:
+		delay = backoff(serverErrorDelay, attempt)
+	case retryNetwork:
+		delay = networkErrorDelay
+	default:
+		delay = base
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = statusErr.RetryAfter
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// backoff 从 first 开始每次加倍的等待时间
+func backoff(first time.Duration, attempt int) time.Duration {
+	delay := first
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+// newStatusError 非200响应的错误，记录服务器在 Retry-After 中要求的等待时间（秒数或HTTP日期）
+func newStatusError(resp *http.Response, body string) *httpStatusError {
+	e := &httpStatusError{StatusCode: resp.StatusCode, Body: body}
+	if value := resp.Header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			e.RetryAfter = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(value); err == nil {
+			e.RetryAfter = max(time.Until(at), 0)
+		}
+	}
+	return e
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errRobotsDisallowed 请求被 robots.txt 禁止，重试没有意义
+var errRobotsDisallowed = errors.New("robots.txt 禁止访问")
+
+// politeCrawler 礼貌抓取模式：遵守站点 robots.txt 的 Disallow/Allow 规则和 Crawl-delay，
+// 并在同一主机的请求之间保持最小间隔
+type politeCrawler struct {
+	enabled bool
+	delay   time.Duration // 默认请求间隔，robots.txt 的 Crawl-delay 更长时使用后者
+
+	mu    sync.Mutex
+	rules map[string]*robotsRules // 按主机缓存的 robots.txt 规则
+	next  map[string]time.Time    // 每个主机下次允许请求的时间
+}
+
+// politeMode 所有页面和图片请求共用的礼貌抓取设置
+var politeMode = &politeCrawler{
+	delay: 2 * time.Second,
+	rules: make(map[string]*robotsRules),
+	next:  make(map[string]time.Time),
+}
+
+// robotsRules 适用于本程序的 robots.txt 规则
+type robotsRules struct {
+	allow      []string
+	disallow   []string
+	crawlDelay time.Duration
+}
+
+// check 检查请求是否被允许，并等待到该主机的下一个请求时间
+// robots.txt 规则只对漫画站点（ctx 中的站点地址）生效，图片服务器等其他主机只保持请求间隔
+func (p *politeCrawler) check(ctx context.Context, rawURL string) error {
+	if !p.enabled {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	delay := p.delay
+	if site, err := url.Parse(contextBaseURL(ctx)); err == nil && site.Host == u.Host {
+		rules := p.robots(u)
+		path := u.EscapedPath()
+		if u.RawQuery != "" {
+			path += "?" + u.RawQuery
+		}
+		if !rules.allowed(path) {
+			return fmt.Errorf("%w: %s", errRobotsDisallowed, rawURL)
+		}
+		if rules.crawlDelay > delay {
+			delay = rules.crawlDelay
+		}
+	}
+
+	// 预约下一个请求时间，多个下载线程按顺序排队
+	p.mu.Lock()
+	at := time.Now()
+	if next := p.next[u.Host]; next.After(at) {
+		at = next
+	}
+	p.next[u.Host] = at.Add(delay)
+	p.mu.Unlock()
+
+	sleepContext(runContext, time.Until(at))
+	return nil
+}
+
+// robots 返回主机的 robots.txt 规则，首次访问时下载并缓存
+func (p *politeCrawler) robots(u *url.URL) *robotsRules {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if rules, ok := p.rules[u.Host]; ok {
+		return rules
+	}
+
+	robotsURL := u.Scheme + "://" + u.Host + "/robots.txt"
+	rules, err := fetchRobots(robotsURL)
+	if err != nil {
+		fmt.Printf("获取 %s 失败，仅保持请求间隔: %v\n", robotsURL, err)
+		rules = &robotsRules{}
+	} else {
+		debugf("robots.txt 规则: 允许 %v，禁止 %v，间隔 %v\n", rules.allow, rules.disallow, rules.crawlDelay)
+	}
+	p.rules[u.Host] = rules
+	return rules
+}
+
+// fetchRobots 下载并解析 robots.txt，文件不存在时允许所有请求
+func fetchRobots(robotsURL string) (*robotsRules, error) {
+	ctx, cancel := context.WithTimeout(runContext, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", robotsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", siteBreaker.userAgent())
+
+	client := &http.Client{Transport: pageTransport(), CheckRedirect: checkRedirect}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+		return &robotsRules{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpStatusError{StatusCode: resp.StatusCode}
+	}
+	return parseRobots(bufio.NewScanner(resp.Body)), nil
+}
+
+// parseRobots 解析 robots.txt，优先使用针对 comicbox 的规则组，否则使用 * 规则组
+func parseRobots(scanner *bufio.Scanner) *robotsRules {
+	var generic, specific *robotsRules
+	var current []*robotsRules
+	inAgents := false
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			// 连续的 User-agent 行共用同一组规则
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+			agent := strings.ToLower(value)
+			if agent == "*" {
+				if generic == nil {
+					generic = &robotsRules{}
+				}
+				current = append(current, generic)
+			} else if strings.Contains(agent, "comicbox") {
+				if specific == nil {
+					specific = &robotsRules{}
+				}
+				current = append(current, specific)
+			}
+			continue
+		}
+		inAgents = false
+
+		for _, rules := range current {
+			switch key {
+			case "allow":
+				if value != "" {
+					rules.allow = append(rules.allow, value)
+				}
+			case "disallow":
+				if value != "" {
+					rules.disallow = append(rules.disallow, value)
+				}
+			case "crawl-delay":
+				if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+					rules.crawlDelay = time.Duration(seconds * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	if specific != nil {
+		return specific
+	}
+	if generic != nil {
+		return generic
+	}
+	return &robotsRules{}
+}
+
+// allowed 检查路径是否允许访问：匹配最长的规则生效，长度相同时 Allow 优先
+func (r *robotsRules) allowed(path string) bool {
+	longestAllow, longestDisallow := -1, -1
+	for _, pattern := range r.allow {
+		if len(pattern) > longestAllow && robotsMatch(pattern, path) {
+			longestAllow = len(pattern)
+		}
+	}
+	for _, pattern := range r.disallow {
+		if len(pattern) > longestDisallow && robotsMatch(pattern, path) {
+			longestDisallow = len(pattern)
+		}
+	}
+	return longestDisallow < 0 || longestAllow >= longestDisallow
+}
+
+// robotsMatch 按 robots.txt 的规则匹配路径，支持 * 通配符和结尾的 $
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	parts := strings.Split(strings.TrimSuffix(pattern, "$"), "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			// 以 $ 结尾时最后一段必须匹配路径末尾
+			return strings.HasSuffix(path, part) && len(path)-len(part) >= pos
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return !anchored || pos == len(path)
+}
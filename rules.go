@@ -0,0 +1,410 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// siteRules 自定义站点规则：用 CSS 选择器描述目录页和章节页的结构，无需为简单站点编写适配器
+// 规则文件使用 YAML（仅支持单层的 键: 值）或 JSON 格式
+type siteRules struct {
+	Name         string `json:"name"`
+	Hosts        string `json:"hosts"`         // 适用的域名，多个用逗号分隔，包括子域名
+	SeriesPath   string `json:"series_path"`   // 目录页路径，{id} 为漫画ID，如 /book/{id}
+	ChapterPath  string `json:"chapter_path"`  // 章节页路径，{id} 为章节ID，如 /chapter/{id}
+	Title        string `json:"title"`         // 目录页中漫画标题的选择器
+	Chapters     string `json:"chapters"`      // 目录页中章节链接（<a>）的选择器
+	ChapterTitle string `json:"chapter_title"` // 章节页中章节标题的选择器
+	Images       string `json:"images"`        // 章节页中漫画图片的选择器
+	ImageAttr    string `json:"image_attr"`    // 图片链接所在的属性，多个用逗号分隔，按顺序尝试
+	ImageQuery   string `json:"image_query"`   // 图片链接中查询参数的处理方式: keep（默认）、strip、tracking
+	Locked       string `json:"locked"`        // 章节页中付费提示的选择器，匹配时视为未解锁的章节
+	Published    string `json:"published"`     // 章节页中更新日期的选择器，优先使用元素的 datetime 属性，--extras 时提取
+	Notes        string `json:"notes"`         // 章节页中作者的话的选择器，--extras 时提取
+}
+
+// defaultImageAttrs 未设置 image_attr 时依次尝试的属性
+const defaultImageAttrs = "data-original,data-src,src"
+
+// loadRules 读取规则文件，按扩展名选择 JSON 或 YAML 格式
+func loadRules(path string) (*siteRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &siteRules{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		if err := json.Unmarshal(data, rules); err != nil {
+			return nil, fmt.Errorf("解析规则文件失败: %v", err)
+		}
+	} else if err := parseRulesYAML(string(data), rules); err != nil {
+		return nil, err
+	}
+
+	if rules.SeriesPath == "" && rules.ChapterPath == "" {
+		return nil, fmt.Errorf("规则文件中至少需要设置 series_path 或 chapter_path")
+	}
+	if rules.ImageAttr == "" {
+		rules.ImageAttr = defaultImageAttrs
+	}
+	if _, err := parseQueryPolicy(rules.ImageQuery); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// parseRulesYAML 解析单层 键: 值 结构的 YAML，支持注释和带引号的值
+func parseRulesYAML(text string, rules *siteRules) error {
+	fields := map[string]*string{
+		"name":          &rules.Name,
+		"hosts":         &rules.Hosts,
+		"series_path":   &rules.SeriesPath,
+		"chapter_path":  &rules.ChapterPath,
+		"title":         &rules.Title,
+		"chapters":      &rules.Chapters,
+		"chapter_title": &rules.ChapterTitle,
+		"images":        &rules.Images,
+		"image_attr":    &rules.ImageAttr,
+		"image_query":   &rules.ImageQuery,
+		"locked":        &rules.Locked,
+	}
+
+	for n, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return fmt.Errorf("规则文件第 %d 行: 不支持嵌套结构", n+1)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return fmt.Errorf("规则文件第 %d 行: 缺少冒号", n+1)
+		}
+		field, ok := fields[strings.TrimSpace(key)]
+		if !ok {
+			return fmt.Errorf("规则文件第 %d 行: 未知的规则 %s", n+1, strings.TrimSpace(key))
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+			end := strings.LastIndexByte(value, value[0])
+			if end <= 0 {
+				return fmt.Errorf("规则文件第 %d 行: 引号不匹配", n+1)
+			}
+			value = value[1:end]
+		} else if i := strings.Index(value, " #"); i >= 0 {
+			value = strings.TrimSpace(value[:i])
+		}
+		*field = value
+	}
+	return nil
+}
+
+// rulesSite 由规则文件描述的站点
+type rulesSite struct {
+	rules *siteRules
+}
+
+// useRules 加载规则文件，其中的站点优先于内置站点匹配
+func useRules(path string) error {
+	rules, err := loadRules(path)
+	if err != nil {
+		return err
+	}
+	siteAdapters = append([]siteAdapter{rulesSite{rules: rules}}, siteAdapters...)
+	return nil
+}
+
+func (s rulesSite) name() string {
+	if s.rules.Name != "" {
+		return s.rules.Name
+	}
+	return "rules"
+}
+
+func (s rulesSite) matchHost(host string) bool {
+	for _, h := range strings.Split(s.rules.Hosts, ",") {
+		h = strings.TrimSpace(h)
+		if h != "" && (host == h || strings.HasSuffix(host, "."+h)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s rulesSite) parsePath(u *url.URL) (targetKind, string, bool) {
+	// 设置了域名时只识别这些域名的链接，避免与内置站点的路径格式冲突
+	if s.rules.Hosts != "" && u.Host != "" && !s.matchHost(u.Host) {
+		return 0, "", false
+	}
+	if id, ok := matchRulePath(s.rules.ChapterPath, u.Path); ok {
+		return targetChapter, id, true
+	}
+	if id, ok := matchRulePath(s.rules.SeriesPath, u.Path); ok {
+		return targetSeries, id, true
+	}
+	return 0, "", false
+}
+
+func (s rulesSite) seriesURL(baseURL, seriesID string) string {
+	return baseURL + strings.Replace(s.rules.SeriesPath, "{id}", seriesID, 1)
+}
+
+func (s rulesSite) fetchSeries(ctx context.Context, baseURL, seriesID string) (*seriesPage, error) {
+	if s.rules.SeriesPath == "" || s.rules.Chapters == "" {
+		return nil, fmt.Errorf("规则文件中没有设置 series_path 和 chapters，无法下载整部漫画")
+	}
+	pageURL := s.seriesURL(baseURL, seriesID)
+	doc, err := fetchPageWithRetry(ctx, pageURL, 3)
+	if err != nil {
+		return nil, err
+	}
+	fallback, _ := url.Parse(pageURL)
+	result := s.apply(doc, documentBase(doc, fallback))
+	if len(result.chapters) == 0 {
+		return nil, fmt.Errorf("未找到任何章节链接")
+	}
+	return &seriesPage{title: result.title, chapters: result.chapters, rating: detectRating(doc), completed: detectCompleted(doc)}, nil
+}
+
+func (s rulesSite) fetchChapter(ctx context.Context, baseURL, chapterID string) (*chapterPage, error) {
+	pageURL := baseURL + strings.Replace(s.rules.ChapterPath, "{id}", chapterID, 1)
+	doc, err := fetchPageWithRetry(ctx, pageURL, 3)
+	if err != nil {
+		return nil, err
+	}
+	fallback, _ := url.Parse(pageURL)
+	base := documentBase(doc, fallback)
+	result := s.apply(doc, base)
+	strategy := "rules"
+	if len(result.images) == 0 {
+		policy, _ := parseQueryPolicy(s.rules.ImageQuery)
+		result.images, strategy = backgroundImageUrls(doc, base, policy), "background-css"
+	}
+	if reason := detectLocked(doc, result.images, s.rules.Locked); reason != "" {
+		return nil, lockedError(reason)
+	}
+	if len(result.images) == 0 {
+		return nil, fmt.Errorf("未找到任何图片链接")
+	}
+	page := &chapterPage{title: result.chapterTitle, url: pageURL, images: result.images, strategy: strategy}
+	addChapterExtras(page, doc, s.rules.Published, s.rules.Notes)
+	checkPageCount(page, doc, base)
+	return page, nil
+}
+
+// rulesResult 规则在页面上的提取结果
+type rulesResult struct {
+	title        string
+	chapterTitle string
+	chapters     []ChapterInfo
+	images       []string
+}
+
+// apply 在页面上应用所有选择器，未设置的选择器使用内置的提取方式
+func (s rulesSite) apply(doc *goquery.Document, base *url.URL) rulesResult {
+	var result rulesResult
+
+	if s.rules.Title != "" {
+		result.title = sanitizeFileName(strings.TrimSpace(doc.Find(s.rules.Title).First().Text()))
+	}
+	if result.title == "" {
+		result.title = extractComicTitle(doc)
+	}
+	if s.rules.ChapterTitle != "" {
+		result.chapterTitle = sanitizeFileName(strings.TrimSpace(doc.Find(s.rules.ChapterTitle).First().Text()))
+	}
+	if result.chapterTitle == "" {
+		result.chapterTitle = extractChapterTitle(doc)
+	}
+
+	if s.rules.Chapters != "" {
+		seen := make(map[string]bool)
+		doc.Find(s.rules.Chapters).Each(func(i int, sel *goquery.Selection) {
+			href, _ := sel.Attr("href")
+			link, err := url.Parse(strings.TrimSpace(href))
+			if err != nil || href == "" {
+				return
+			}
+			kind, id, ok := s.parsePath(base.ResolveReference(link))
+			if !ok || kind != targetChapter || seen[id] {
+				return
+			}
+			seen[id] = true
+			title := strings.TrimSpace(sel.Text())
+			if title == "" {
+				title = "Chapter " + id
+			}
+			result.chapters = append(result.chapters, ChapterInfo{id: id, title: title})
+		})
+	}
+
+	if s.rules.Images != "" {
+		attrs := strings.Split(s.rules.ImageAttr, ",")
+		policy, _ := parseQueryPolicy(s.rules.ImageQuery)
+		doc.Find(s.rules.Images).Each(func(i int, sel *goquery.Selection) {
+			for _, attr := range attrs {
+				attr = strings.TrimSpace(attr)
+				src := strings.TrimSpace(sel.AttrOr(attr, ""))
+				if strings.HasSuffix(attr, "srcset") {
+					src = parseSrcset(src)
+				} else if attr == "style" {
+					src = styleBackgroundURL(src)
+				}
+				if src == "" || strings.HasPrefix(src, "data:") {
+					continue
+				}
+				if abs, ok := resolveImageURL(base, src, policy); ok {
+					result.images = append(result.images, abs)
+				}
+				return
+			}
+		})
+	}
+	return result
+}
+
+// matchRulePath 按 /book/{id} 形式的路径模板匹配路径，返回其中的ID
+func matchRulePath(pattern, path string) (string, bool) {
+	if pattern == "" || !strings.Contains(pattern, "{id}") {
+		return "", false
+	}
+	expr := strings.Replace(regexp.QuoteMeta(strings.TrimSuffix(pattern, "/")), `\{id\}`, `([^/]+)`, 1)
+	re, err := regexp.Compile("^" + expr + "/?$")
+	if err != nil {
+		return "", false
+	}
+	m := re.FindStringSubmatch(path)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// runRulesCommand 规则相关的子命令，目前只有 test
+func runRulesCommand(args []string) {
+	if len(args) == 0 || args[0] != "test" {
+		fmt.Println("使用方法: ./comicbox rules test --rules <规则文件> --url <章节或目录页链接/本地网页文件>")
+		return
+	}
+
+	var rulesPath, pageURL string
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--rules":
+			if i+1 < len(args) {
+				rulesPath = args[i+1]
+				i++
+			}
+		case "--url":
+			if i+1 < len(args) {
+				pageURL = args[i+1]
+				i++
+			}
+		}
+	}
+	if rulesPath == "" || pageURL == "" {
+		fmt.Println("请同时指定 --rules 和 --url")
+		return
+	}
+
+	rules, err := loadRules(rulesPath)
+	if err != nil {
+		fmt.Printf("读取规则文件失败: %v\n", err)
+		return
+	}
+	site := rulesSite{rules: rules}
+
+	// 本地网页文件直接解析，相对链接按规则中的第一个域名补全
+	var doc *goquery.Document
+	var base *url.URL
+	if _, err := os.Stat(pageURL); err == nil {
+		page, err := loadLocalPage(pageURL)
+		if err != nil {
+			fmt.Printf("解析本地文件失败: %v\n", err)
+			return
+		}
+		doc = page.doc
+		base = &url.URL{}
+		if host := strings.TrimSpace(strings.Split(rules.Hosts, ",")[0]); host != "" {
+			base = &url.URL{Scheme: "https", Host: host, Path: "/"}
+		}
+	} else {
+		if !strings.Contains(pageURL, "://") {
+			pageURL = "https://" + pageURL
+		}
+		base, err = url.Parse(pageURL)
+		if err != nil || base.Host == "" {
+			fmt.Printf("无效的链接: %s\n", pageURL)
+			return
+		}
+		kind, id, ok := site.parsePath(base)
+		switch {
+		case !ok:
+			fmt.Println("链接不符合 series_path 或 chapter_path，下载时不会使用该规则")
+		case kind == targetSeries:
+			fmt.Printf("识别为目录页，漫画ID: %s\n", id)
+		default:
+			fmt.Printf("识别为章节页，章节ID: %s\n", id)
+		}
+		siteBaseURL = base.Scheme + "://" + base.Host
+		doc, err = fetchPageWithRetry(runContext, pageURL, 3)
+		if err != nil {
+			fmt.Printf("获取页面失败: %v\n", err)
+			return
+		}
+	}
+
+	result := site.apply(doc, documentBase(doc, base))
+	fmt.Printf("\n规则: %s\n", site.name())
+	printRuleResult("漫画标题", "title", rules.Title, result.title)
+	printRuleResult("章节标题", "chapter_title", rules.ChapterTitle, result.chapterTitle)
+	published, notes := extractChapterExtras(doc, rules.Published, rules.Notes)
+	printRuleResult("更新日期", "published", rules.Published, published)
+	printRuleResult("作者的话", "notes", rules.Notes, strings.ReplaceAll(notes, "\n", " / "))
+
+	if rules.Chapters == "" {
+		fmt.Println("章节链接 (chapters): 未设置")
+	} else {
+		fmt.Printf("章节链接 (chapters): %d 个\n", len(result.chapters))
+		for i, chapter := range result.chapters {
+			if i == 10 {
+				fmt.Printf("  ...（还有 %d 个）\n", len(result.chapters)-10)
+				break
+			}
+			fmt.Printf("  [%s] %s\n", chapter.id, chapter.title)
+		}
+	}
+
+	if rules.Images == "" {
+		fmt.Println("漫画图片 (images): 未设置")
+	} else {
+		fmt.Printf("漫画图片 (images): %d 张\n", len(result.images))
+		for i, img := range result.images {
+			if i == 10 {
+				fmt.Printf("  ...（还有 %d 张）\n", len(result.images)-10)
+				break
+			}
+			fmt.Printf("  [%d] %s\n", i+1, img)
+		}
+	}
+}
+
+// printRuleResult 打印单个选择器的提取结果，未设置选择器时说明使用了内置提取
+func printRuleResult(label, key, selector, value string) {
+	if selector == "" {
+		fmt.Printf("%s (%s): %s（未设置，使用内置提取）\n", label, key, value)
+		return
+	}
+	fmt.Printf("%s (%s): %s\n", label, key, value)
+}
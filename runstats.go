@@ -0,0 +1,279 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// progressInterval 下载过程中输出速度和预计剩余时间的最短间隔
+const progressInterval = 3 * time.Second
+
+// runStatsTracker 本次运行的下载统计，用于显示速度、预计剩余时间和结束时的汇总
+type runStatsTracker struct {
+	mu      sync.Mutex
+	started time.Time
+
+	planned        int // 计划下载的章节数，0 表示未知（如单个章节）
+	chapters       int // 已结束的章节数
+	failedChapters int // 有图片下载失败的章节数
+	fetchFailed    int // 未能获取章节页面的章节数
+	failed         []failedUnit
+	locked         []failedUnit     // 未解锁（付费、VIP）而跳过的章节
+	removed        []removedChapter // 从站点目录中消失的章节
+	chapterTime    time.Duration    // 已结束章节的总用时，用于估算剩余章节
+	images         int
+	failedImages   int
+	bytes          int64
+
+	// 当前章节，章节依次下载，同一时间只有一个
+	chapterStart time.Time
+	chapterTotal int
+	chapterDone  int
+	chapterBytes int64
+	lastProgress time.Time
+}
+
+// runStats 全局下载统计
+var runStats = &runStatsTracker{started: time.Now()}
+
+// addPlanned 增加计划下载的章节数
+func (r *runStatsTracker) addPlanned(n int) {
+	r.mu.Lock()
+	r.planned += n
+	r.mu.Unlock()
+}
+
+// startChapter 开始下载一个章节的 pending 张图片
+func (r *runStatsTracker) startChapter(pending int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chapterStart = time.Now()
+	r.chapterTotal = pending
+	r.chapterDone = 0
+	r.chapterBytes = 0
+	r.lastProgress = r.chapterStart
+}
+
+// imageDone 记录一张图片下载结束，距上次输出超过 progressInterval 时输出本章和全部章节的进度
+func (r *runStatsTracker) imageDone(size int64, ok bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chapterDone++
+	if ok {
+		r.images++
+		r.bytes += size
+		r.chapterBytes += size
+	} else {
+		r.failedImages++
+	}
+
+	now := time.Now()
+	if now.Sub(r.lastProgress) < progressInterval || r.chapterDone >= r.chapterTotal || useProgressBars() || parallelChapters {
+		return
+	}
+	r.lastProgress = now
+
+	elapsed := now.Sub(r.chapterStart)
+	remaining := time.Duration(float64(elapsed) / float64(r.chapterDone) * float64(r.chapterTotal-r.chapterDone))
+	line := fmt.Sprintf("本章进度 %d/%d，%s/s，预计剩余 %s", r.chapterDone, r.chapterTotal,
+		formatBytes(bytesPerSecond(r.chapterBytes, elapsed)), formatETA(remaining))
+	if left := r.planned - r.chapters - 1; left > 0 && r.chapters > 0 {
+		total := remaining + r.chapterTime/time.Duration(r.chapters)*time.Duration(left)
+		line += fmt.Sprintf("；全部 %d/%d 章，预计剩余 %s", r.chapters, r.planned, formatETA(total))
+	}
+	infof("%s\n", line)
+}
+
+// chapterFetchFailed 记录一个未能获取章节页面（没有开始下载图片）的章节
+func (r *runStatsTracker) chapterFetchFailed() {
+	r.mu.Lock()
+	r.fetchFailed++
+	r.mu.Unlock()
+}
+
+// failures 到目前为止失败的章节数（包括未能获取章节页面的），daemon 比较任务前后的值判断任务是否失败
+func (r *runStatsTracker) failures() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failedChapters + r.fetchFailed
+}
+
+// chapterLocked 记录未解锁而跳过的章节，不计为失败
+func (r *runStatsTracker) chapterLocked(unit failedUnit) {
+	unit.Kind = "locked"
+	r.mu.Lock()
+	r.locked = append(r.locked, unit)
+	r.mu.Unlock()
+}
+
+// chapterRemoved 记录从站点目录中消失的章节
+func (r *runStatsTracker) chapterRemoved(c removedChapter) {
+	r.mu.Lock()
+	r.removed = append(r.removed, c)
+	r.mu.Unlock()
+}
+
+// recordFailure 记录失败的章节，写入汇总文件供 retry 命令使用
+func (r *runStatsTracker) recordFailure(unit failedUnit) {
+	if unit.Dir != "" {
+		if abs, err := filepath.Abs(unit.Dir); err == nil {
+			unit.Dir = abs
+		}
+	}
+	r.mu.Lock()
+	r.failed = append(r.failed, unit)
+	r.mu.Unlock()
+}
+
+// finishChapter 记录一个章节下载结束，输出本章的用时和平均速度
+func (r *runStatsTracker) finishChapter(result chapterResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	elapsed := time.Since(r.chapterStart)
+	r.chapters++
+	r.chapterTime += elapsed
+	if result.failed > 0 {
+		r.failedChapters++
+	}
+	if r.chapterTotal == 0 || parallelChapters {
+		return
+	}
+	infof("本章下载 %s，用时 %s，平均 %s/s\n", formatBytes(r.chapterBytes),
+		elapsed.Round(time.Second), formatBytes(bytesPerSecond(r.chapterBytes, elapsed)))
+}
+
+// printSummary 运行结束时输出汇总，没有下载任何章节时不输出
+func (r *runStatsTracker) printSummary() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.chapters == 0 && len(r.locked) == 0 && len(r.removed) == 0 {
+		return
+	}
+	elapsed := time.Since(r.started)
+	fmt.Printf("\n本次运行: %d 个章节（%d 个有图片下载失败），%d 张图片（失败 %d 张），共 %s，用时 %s，平均 %s/s\n",
+		r.chapters, r.failedChapters, r.images, r.failedImages, formatBytes(r.bytes),
+		elapsed.Round(time.Second), formatBytes(bytesPerSecond(r.bytes, elapsed)))
+	if len(r.locked) > 0 {
+		fmt.Printf("未解锁（付费、VIP）而跳过 %d 个章节，已记录在漫画库中\n", len(r.locked))
+	}
+	if len(r.removed) > 0 {
+		fmt.Printf("%d 个章节从站点目录中消失，可能已被删除，请检查\n", len(r.removed))
+	}
+
+	printHostMetrics()
+
+	usage := resources.snapshot()
+	line := fmt.Sprintf("内存: 峰值堆 %s，向系统申请 %s，GC %d 次\n",
+		formatBytes(int64(usage.PeakHeapBytes)), formatBytes(int64(usage.SysBytes)), usage.GCRuns)
+	if lowMemory {
+		fmt.Print(line)
+	} else {
+		verbosef("%s", line)
+	}
+}
+
+// summaryFile 运行结束时写入汇总 JSON 的路径，为空时不写入
+var summaryFile string
+
+// runSummary 写入 summaryFile 的运行汇总，供定时任务监控
+type runSummary struct {
+	Args              []string               `json:"args"`
+	Started           time.Time              `json:"started"`
+	Finished          time.Time              `json:"finished"`
+	DurationSeconds   float64                `json:"duration_seconds"`
+	ChaptersAttempted int                    `json:"chapters_attempted"`
+	ChaptersSucceeded int                    `json:"chapters_succeeded"`
+	ChaptersFailed    int                    `json:"chapters_failed"`
+	Images            int                    `json:"images"`
+	ImagesFailed      int                    `json:"images_failed"`
+	Bytes             int64                  `json:"bytes"`
+	Errors            map[string]int64       `json:"errors"`  // 按类型统计的请求错误，如 http_404、timeout
+	Hosts             map[string]hostSummary `json:"hosts"`   // 按主机统计的请求数、失败率和延迟
+	Failed            []failedUnit           `json:"failed"`  // 失败的章节，可用 retry --from 重新下载
+	Locked            []failedUnit           `json:"locked"`  // 未解锁（付费、VIP）而跳过的章节
+	Removed           []removedChapter       `json:"removed"` // 从站点目录中消失的章节，可能已被站点删除
+	Resources         resourceUsage          `json:"resources"`
+}
+
+// writeSummary 将本次运行的汇总写入 summaryFile
+func (r *runStatsTracker) writeSummary() error {
+	if summaryFile == "" {
+		return nil
+	}
+	r.mu.Lock()
+	now := time.Now()
+	summary := runSummary{
+		Args:              os.Args[1:],
+		Started:           r.started,
+		Finished:          now,
+		DurationSeconds:   now.Sub(r.started).Seconds(),
+		ChaptersAttempted: r.chapters + r.fetchFailed,
+		ChaptersSucceeded: r.chapters - r.failedChapters,
+		ChaptersFailed:    r.failedChapters + r.fetchFailed,
+		Images:            r.images,
+		ImagesFailed:      r.failedImages,
+		Bytes:             r.bytes,
+		Failed:            append([]failedUnit{}, r.failed...),
+		Locked:            append([]failedUnit{}, r.locked...),
+		Removed:           append([]removedChapter{}, r.removed...),
+	}
+	r.mu.Unlock()
+	summary.Resources = resources.snapshot()
+
+	metrics.mu.Lock()
+	summary.Errors = make(map[string]int64, len(metrics.errors))
+	for key, n := range metrics.errors {
+		summary.Errors[key] = n
+	}
+	metrics.mu.Unlock()
+	summary.Hosts = metrics.hostSummaries()
+
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(summaryFile), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(summaryFile, data)
+}
+
+// finishRun 运行结束时输出汇总并写入汇总文件
+func finishRun() {
+	runStats.printSummary()
+	if err := runStats.writeSummary(); err != nil {
+		fmt.Printf("写入运行汇总失败: %v\n", err)
+	}
+	if warc != nil {
+		if err := warc.close(); err != nil {
+			fmt.Printf("关闭 WARC 文件失败: %v\n", err)
+		}
+	}
+	if har != nil {
+		if err := har.close(); err != nil {
+			fmt.Printf("写入 HAR 文件失败: %v\n", err)
+		} else {
+			fmt.Printf("已将 %d 个请求写入 %s\n", len(har.entries), har.path)
+		}
+	}
+}
+
+// bytesPerSecond 计算平均速度
+func bytesPerSecond(n int64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(n) / elapsed.Seconds())
+}
+
+// formatETA 格式化预计剩余时间，精确到秒
+func formatETA(d time.Duration) string {
+	if d < time.Second {
+		return "不到1秒"
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// scratchRoot 下载中的章节所在的临时目录（可以放在更快的磁盘上），为空时直接下载到漫画库
+var scratchRoot string
+
+// setScratchRoot 设置临时目录，保存为绝对路径
+func setScratchRoot(dir string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	scratchRoot = abs
+	return nil
+}
+
+// chapterWorkDir 返回下载章节时使用的目录，未设置临时目录时就是章节的最终目录
+// 临时目录中的名称包含最终路径的哈希，不同漫画的同名章节不会冲突，中断后再次下载时继续使用同一目录
+func chapterWorkDir(finalDir string) string {
+	if scratchRoot == "" {
+		return finalDir
+	}
+	abs, err := filepath.Abs(finalDir)
+	if err != nil {
+		abs = finalDir
+	}
+	sum := sha1.Sum([]byte(abs))
+	return filepath.Join(scratchRoot, fmt.Sprintf("%x_%s", sum[:6], filepath.Base(finalDir)))
+}
+
+// commitChapterDir 将下载完成的章节从临时目录移动到漫画库
+// 同一文件系统中直接改名；跨文件系统时先复制到目标旁边的隐藏目录再改名，漫画库中不会出现只有部分图片的章节
+func commitChapterDir(workDir, finalDir string) error {
+	if workDir == finalDir {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(finalDir), 0755); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(finalDir); os.IsNotExist(err) {
+		if err := os.Rename(workDir, finalDir); err == nil {
+			return nil
+		}
+		staging := filepath.Join(filepath.Dir(finalDir), "."+filepath.Base(finalDir)+".partial")
+		os.RemoveAll(staging)
+		if err := copyDir(workDir, staging); err != nil {
+			os.RemoveAll(staging)
+			return fmt.Errorf("复制章节到漫画库失败: %v", err)
+		}
+		if err := os.Rename(staging, finalDir); err != nil {
+			os.RemoveAll(staging)
+			return err
+		}
+		return os.RemoveAll(workDir)
+	}
+
+	// 漫画库中已有该章节目录（如重新下载）时逐个替换其中的图片
+	entries, err := os.ReadDir(workDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		src := filepath.Join(workDir, entry.Name())
+		dst := filepath.Join(finalDir, entry.Name())
+		if err := os.Rename(src, dst); err == nil {
+			continue
+		}
+		staging := filepath.Join(finalDir, "."+entry.Name()+".partial")
+		if err := copyFile(src, staging); err != nil {
+			os.Remove(staging)
+			return fmt.Errorf("复制图片到漫画库失败: %v", err)
+		}
+		if err := os.Rename(staging, dst); err != nil {
+			os.Remove(staging)
+			return err
+		}
+	}
+	return os.RemoveAll(workDir)
+}
+
+// copyDir 复制目录中的文件（不含子目录）
+func copyDir(src, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyFile 复制文件并写入磁盘
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// 写入临时文件后替换，不截断 dst：dst 可能是去重后共用的硬链接
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.part")
+	if err != nil {
+		return err
+	}
+	tmpPath := out.Name()
+	defer os.Remove(tmpPath)
+	if _, err := io.CopyBuffer(struct{ io.Writer }{out}, in, copyBuffer()); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, dst)
+}
+
+// finishChapterDir 章节下载结束后移入漫画库，有图片下载失败时保留在临时目录中，返回章节是否已在漫画库中
+func finishChapterDir(workDir, finalDir string, result chapterResult) bool {
+	if workDir == finalDir {
+		return true
+	}
+	if result.failed > 0 {
+		fmt.Printf("有 %d 张图片下载失败，已下载的图片保留在临时目录 %s 中，不会移入漫画库\n", result.failed, workDir)
+		return false
+	}
+	if err := commitChapterDir(workDir, finalDir); err != nil {
+		fmt.Printf("移动章节到漫画库失败: %v\n", err)
+		return false
+	}
+	sharedImages.moved(workDir, finalDir)
+	return true
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runSeedCommand 为打包好的漫画生成 .torrent 文件和磁力链接
+func runSeedCommand(args []string) {
+	var (
+		input     string
+		output    string
+		trackers  []string
+		pieceSize int64
+		private   bool
+	)
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--tracker":
+			if i+1 < len(args) {
+				trackers = append(trackers, args[i+1])
+				i++
+			}
+		case "--output", "-o":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		case "--piece-size":
+			if i+1 < len(args) {
+				kib, err := strconv.ParseInt(args[i+1], 10, 64)
+				if err != nil || kib < 16 || kib&(kib-1) != 0 {
+					fmt.Printf("无效的分块大小: %s（单位 KiB，必须是 2 的幂且不小于 16）\n", args[i+1])
+					return
+				}
+				pieceSize = kib * 1024
+				i++
+			}
+		case "--private":
+			private = true
+		default:
+			input = args[i]
+		}
+	}
+	if input == "" {
+		fmt.Println("使用方法: ./comicbox seed <漫画.cbz> [--tracker <地址>]... [--output <文件.torrent>] [--piece-size <KiB>] [--private]")
+		return
+	}
+
+	info, err := os.Stat(input)
+	if err != nil {
+		fmt.Printf("读取文件失败: %v\n", err)
+		return
+	}
+	if info.IsDir() {
+		fmt.Println("请指定打包好的文件（如用 ebook 生成的 .cbz），不支持目录")
+		return
+	}
+	if pieceSize == 0 {
+		pieceSize = choosePieceSize(info.Size())
+	}
+	if output == "" {
+		output = strings.TrimSuffix(input, filepath.Ext(input)) + ".torrent"
+	}
+
+	fmt.Printf("正在计算 %s 的分块哈希（%s，分块 %d KiB）...\n", input, formatBytes(info.Size()), pieceSize/1024)
+	pieces, err := hashPieces(input, pieceSize)
+	if err != nil {
+		fmt.Printf("计算分块哈希失败: %v\n", err)
+		return
+	}
+
+	name := filepath.Base(input)
+	torrentInfo := map[string]interface{}{
+		"name":         name,
+		"length":       info.Size(),
+		"piece length": pieceSize,
+		"pieces":       string(pieces),
+	}
+	if private {
+		torrentInfo["private"] = int64(1)
+	}
+	torrent := map[string]interface{}{
+		"info":          torrentInfo,
+		"created by":    "comicbox",
+		"creation date": time.Now().Unix(),
+	}
+	if len(trackers) > 0 {
+		torrent["announce"] = trackers[0]
+		var tiers []interface{}
+		for _, tracker := range trackers {
+			tiers = append(tiers, []interface{}{tracker})
+		}
+		torrent["announce-list"] = tiers
+	}
+
+	var infoBuf, torrentBuf bytes.Buffer
+	bencode(&infoBuf, torrentInfo)
+	bencode(&torrentBuf, torrent)
+	if err := os.WriteFile(output, torrentBuf.Bytes(), 0644); err != nil {
+		fmt.Printf("保存种子文件失败: %v\n", err)
+		return
+	}
+
+	fmt.Printf("已生成种子文件: %s\n", output)
+	fmt.Printf("磁力链接: %s\n", magnetLink(sha1.Sum(infoBuf.Bytes()), name, trackers))
+	fmt.Printf("用 BitTorrent 客户端打开种子文件，并将保存位置设为 %s 所在的目录即可开始做种\n", input)
+}
+
+// choosePieceSize 按文件大小选择分块大小，使分块数不超过约 2000 个
+func choosePieceSize(size int64) int64 {
+	pieceSize := int64(256 * 1024)
+	for pieceSize < 16*1024*1024 && size/pieceSize > 2000 {
+		pieceSize *= 2
+	}
+	return pieceSize
+}
+
+// hashPieces 计算文件每个分块的 SHA-1 并依次拼接
+func hashPieces(path string, pieceSize int64) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var pieces []byte
+	buf := make([]byte, pieceSize)
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			sum := sha1.Sum(buf[:n])
+			pieces = append(pieces, sum[:]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return pieces, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// bencode 按 BitTorrent 的 bencode 格式编码，字典的键按字节序排列
+func bencode(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		fmt.Fprintf(buf, "%d:%s", len(v), v)
+	case int64:
+		fmt.Fprintf(buf, "i%de", v)
+	case []interface{}:
+		buf.WriteByte('l')
+		for _, item := range v {
+			bencode(buf, item)
+		}
+		buf.WriteByte('e')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		buf.WriteByte('d')
+		for _, key := range keys {
+			bencode(buf, key)
+			bencode(buf, v[key])
+		}
+		buf.WriteByte('e')
+	}
+}
+
+// magnetLink 生成磁力链接
+func magnetLink(infoHash [sha1.Size]byte, name string, trackers []string) string {
+	link := fmt.Sprintf("magnet:?xt=urn:btih:%x&dn=%s", infoHash, url.QueryEscape(name))
+	for _, tracker := range trackers {
+		link += "&tr=" + url.QueryEscape(tracker)
+	}
+	return link
+}
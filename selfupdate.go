@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// releaseRepo 发布新版本的 GitHub 仓库
+const releaseRepo = "mazaoshe/92hm-eBook"
+
+// releasePublicKey 校验发布签名的 Ed25519 公钥（base64），发布时用 -ldflags "-X main.releasePublicKey=..." 嵌入
+// 为空时只能校验 SHA-256，需要 --allow-unsigned 才会替换程序
+var releasePublicKey = ""
+
+// releaseClient 请求 GitHub 的客户端：使用默认的证书校验和系统的代理设置（HTTPS_PROXY 等），
+// 不受 --insecure-tls、--ca-cert、代理列表等只针对漫画站点的设置影响
+var releaseClient = &http.Client{Transport: &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	TLSHandshakeTimeout: 30 * time.Second,
+}}
+
+// 发布文件的命名：每个平台一个可执行文件 comicbox_<系统>_<架构>[.exe]，
+// checksums.txt 为 sha256sum 格式的校验和，checksums.txt.sig 为它的 Ed25519 签名（base64）
+const (
+	releaseChecksums = "checksums.txt"
+	releaseSignature = "checksums.txt.sig"
+)
+
+// githubRelease GitHub 发布接口返回的字段
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+		Size int64  `json:"size"`
+	} `json:"assets"`
+}
+
+// assetURL 发布文件的下载链接
+func (r *githubRelease) assetURL(name string) string {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL
+		}
+	}
+	return ""
+}
+
+// runSelfUpdateCommand 检查 GitHub 上的最新版本，下载当前平台的可执行文件，校验校验和与签名后替换正在运行的程序
+func runSelfUpdateCommand(args []string) {
+	checkOnly := false
+	allowUnsigned := false
+	targetVersion := ""
+	for i := 0; i < len(args); {
+		n, err := parseGlobalFlag(args, i)
+		if err != nil {
+			fmt.Printf("参数错误: %v\n", err)
+			return
+		}
+		if n > 0 {
+			i += n
+			continue
+		}
+		switch {
+		case args[i] == "--check":
+			checkOnly = true
+			i++
+		case args[i] == "--allow-unsigned":
+			allowUnsigned = true
+			i++
+		case args[i] == "--version" && i+1 < len(args):
+			targetVersion = args[i+1]
+			i += 2
+		default:
+			fmt.Println("用法: ./comicbox self-update [--check] [--version <版本>] [--allow-unsigned] [--yes]")
+			return
+		}
+	}
+
+	current := readBuildDetails().Version
+	release, err := fetchRelease(runContext, targetVersion)
+	if err != nil {
+		fmt.Printf("检查新版本失败: %v\n", err)
+		return
+	}
+	fmt.Printf("当前版本: %s，最新版本: %s\n", current, release.TagName)
+	if targetVersion == "" && current != "dev" && compareVersions(release.TagName, current) <= 0 {
+		fmt.Println("已是最新版本")
+		return
+	}
+	if checkOnly {
+		fmt.Printf("可以用 ./comicbox self-update 更新，更新说明: %s\n", release.HTMLURL)
+		return
+	}
+	// 没有公钥时 checksums.txt 和程序来自同一个地方，只能发现下载损坏，不能发现被替换
+	if releasePublicKey == "" && !allowUnsigned {
+		fmt.Println("当前程序没有嵌入发布公钥，无法确认新版本是官方发布的，拒绝替换程序")
+		fmt.Printf("可以从 %s 手动下载，或确认来源可信后用 --allow-unsigned 只按 SHA-256 校验并更新\n", release.HTMLURL)
+		return
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Printf("找不到当前程序的路径: %v\n", err)
+		return
+	}
+	if !assumeYes && isInteractive() {
+		fmt.Printf("将 %s 更新为 %s? [y/N] ", exe, release.TagName)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return
+		}
+	}
+
+	binary, err := downloadRelease(runContext, release)
+	if err != nil {
+		fmt.Printf("下载新版本失败: %v\n", err)
+		return
+	}
+	if err := replaceExecutable(exe, binary); err != nil {
+		fmt.Printf("替换程序失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已更新到 %s\n", release.TagName)
+}
+
+// releaseAssetName 当前平台的可执行文件名
+func releaseAssetName() string {
+	name := "comicbox_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// fetchRelease 获取最新的或指定版本的发布信息
+func fetchRelease(ctx context.Context, tag string) (*githubRelease, error) {
+	apiURL := "https://api.github.com/repos/" + releaseRepo + "/releases/latest"
+	if tag != "" {
+		apiURL = "https://api.github.com/repos/" + releaseRepo + "/releases/tags/" + tag
+	}
+	data, err := downloadReleaseFile(ctx, apiURL, "application/vnd.github+json")
+	if err != nil {
+		return nil, err
+	}
+	var release githubRelease
+	if err := json.Unmarshal(data, &release); err != nil {
+		return nil, fmt.Errorf("解析发布信息失败: %v", err)
+	}
+	return &release, nil
+}
+
+// downloadRelease 下载当前平台的可执行文件，按 checksums.txt 校验 SHA-256，嵌入了公钥时先校验 checksums.txt 的签名
+func downloadRelease(ctx context.Context, release *githubRelease) ([]byte, error) {
+	name := releaseAssetName()
+	binaryURL := release.assetURL(name)
+	if binaryURL == "" {
+		return nil, fmt.Errorf("%s 中没有当前平台的文件 %s", release.TagName, name)
+	}
+	checksumsURL := release.assetURL(releaseChecksums)
+	if checksumsURL == "" {
+		return nil, fmt.Errorf("%s 中没有 %s，无法校验", release.TagName, releaseChecksums)
+	}
+	checksums, err := downloadReleaseFile(ctx, checksumsURL, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if releasePublicKey != "" {
+		signatureURL := release.assetURL(releaseSignature)
+		if signatureURL == "" {
+			return nil, fmt.Errorf("%s 中没有签名 %s", release.TagName, releaseSignature)
+		}
+		signature, err := downloadReleaseFile(ctx, signatureURL, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyReleaseSignature(checksums, signature); err != nil {
+			return nil, err
+		}
+		fmt.Println("签名校验通过")
+	} else {
+		fmt.Println("注意: 当前程序没有嵌入发布公钥（--allow-unsigned），只校验 SHA-256")
+	}
+
+	expected, err := releaseChecksum(checksums, name)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("正在下载 %s...\n", name)
+	binary, err := downloadReleaseFile(ctx, binaryURL, "")
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(binary)
+	if hex.EncodeToString(sum[:]) != expected {
+		return nil, fmt.Errorf("%s 的 SHA-256 与 %s 不一致", name, releaseChecksums)
+	}
+	return binary, nil
+}
+
+// verifyReleaseSignature 用嵌入的公钥校验 checksums.txt 的 Ed25519 签名
+func verifyReleaseSignature(checksums, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("嵌入的发布公钥无效")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("签名格式错误: %v", err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), checksums, sig) {
+		return fmt.Errorf("%s 的签名校验失败", releaseChecksums)
+	}
+	return nil
+}
+
+// releaseChecksum 从 sha256sum 格式的校验和文件中查找文件的 SHA-256
+func releaseChecksum(checksums []byte, name string) (string, error) {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s 中没有 %s 的校验和", releaseChecksums, name)
+}
+
+// downloadReleaseFile 下载发布信息或发布文件
+func downloadReleaseFile(ctx context.Context, fileURL, accept string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "comicbox/"+version)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := releaseClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, newStatusError(resp, string(body))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// replaceExecutable 用新的程序替换 exe：先写入同一目录的临时文件，再把正在运行的程序改名为 .old 后换上新的，
+// Windows 上正在运行的程序无法删除，.old 在下次更新时删除
+func replaceExecutable(exe string, binary []byte) error {
+	info, err := os.Stat(exe)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(exe)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(exe)+".*.new")
+	if err != nil {
+		return fmt.Errorf("无法写入 %s（可能需要管理员权限）: %v", dir, err)
+	}
+	if _, err := io.Copy(tmp, bytes.NewReader(binary)); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0111); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		// 换回原来的程序
+		os.Rename(old, exe)
+		os.Remove(tmp.Name())
+		return err
+	}
+	os.Remove(old)
+	return nil
+}
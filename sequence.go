@@ -0,0 +1,293 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeSequence 每个章节都按图片链接的编号规律探测后续的图片，由 --probe-sequence 或配置文件的 probe_sequence 开启
+// 默认只在提取到的图片少于页面上标明的页数时探测
+var probeSequence bool
+
+// sequenceProbeSettings 探测按编号排列的图片时的并发数、停止条件和上限
+type sequenceProbeSettings struct {
+	Workers   int `json:"workers"`    // 同时发送的探测请求数
+	MaxMisses int `json:"max_misses"` // 连续多少个编号不存在时停止，大于1时可以跳过偶尔缺少的编号
+	Limit     int `json:"limit"`      // 一个章节最多探测的编号数，避免站点对不存在的图片也返回图片时无限探测
+}
+
+// sequenceProbe 当前的探测设置，由 --probe-workers、--probe-misses、--probe-limit 或配置文件的 sequence_probe 设置
+var sequenceProbe = sequenceProbeSettings{Workers: 4, MaxMisses: 2, Limit: 300}
+
+// imageSequence 按编号排列的图片链接，如 https://cdn.example.com/123/0001.jpg 到 0045.jpg
+type imageSequence struct {
+	prefix  string // 编号之前的部分
+	suffix  string // 编号之后的部分，包括扩展名和查询参数
+	width   int    // 编号补零后的位数，0 表示不补零
+	numbers []int  // 页面中已有图片的编号，与 members 对应
+	members []int  // 属于这个序列的图片在列表中的位置
+}
+
+// splitImageNumber 拆分图片链接中文件名里的最后一段数字，没有数字时 ok 为false
+func splitImageNumber(imgURL string) (prefix, digits, suffix string, ok bool) {
+	head, query, hasQuery := strings.Cut(imgURL, "?")
+	nameStart := strings.LastIndex(head, "/") + 1
+	end := -1
+	for i := len(head) - 1; i >= nameStart; i-- {
+		if head[i] >= '0' && head[i] <= '9' {
+			end = i + 1
+			break
+		}
+	}
+	if end < 0 {
+		return "", "", "", false
+	}
+	start := end
+	for start > nameStart && head[start-1] >= '0' && head[start-1] <= '9' {
+		start--
+	}
+	suffix = head[end:]
+	if hasQuery {
+		suffix += "?" + query
+	}
+	return head[:start], head[start:end], suffix, true
+}
+
+// inferSequence 找出图片列表中按编号递增排列的图片：链接中除编号外相同的图片至少2张、占一半以上，
+// 并且编号严格递增、大多数相邻的编号相差1。找不到这样的规律时返回nil
+func inferSequence(images []string) *imageSequence {
+	groups := map[string]*imageSequence{}
+	var best *imageSequence
+	for i, img := range images {
+		prefix, digits, suffix, ok := splitImageNumber(img)
+		if !ok || len(digits) > 9 {
+			continue
+		}
+		n, _ := strconv.Atoi(digits)
+		key := prefix + "\x00" + suffix
+		seq := groups[key]
+		if seq == nil {
+			seq = &imageSequence{prefix: prefix, suffix: suffix}
+			groups[key] = seq
+		}
+		if len(digits) > 1 && digits[0] == '0' {
+			seq.width = len(digits)
+		}
+		seq.numbers = append(seq.numbers, n)
+		seq.members = append(seq.members, i)
+		if best == nil || len(seq.members) > len(best.members) {
+			best = seq
+		}
+	}
+	if best == nil || len(best.members) < 2 || len(best.members)*2 < len(images) {
+		return nil
+	}
+
+	steps := 0
+	for i := 1; i < len(best.numbers); i++ {
+		switch diff := best.numbers[i] - best.numbers[i-1]; {
+		case diff <= 0:
+			return nil
+		case diff == 1:
+			steps++
+		}
+	}
+	if steps*2 < len(best.numbers)-1 {
+		return nil
+	}
+	return best
+}
+
+// url 返回编号为 n 的图片链接
+func (s *imageSequence) url(n int) string {
+	if s.width > 0 {
+		return fmt.Sprintf("%s%0*d%s", s.prefix, s.width, n, s.suffix)
+	}
+	return s.prefix + strconv.Itoa(n) + s.suffix
+}
+
+// probeResult 一个编号的探测结果
+type probeResult int
+
+const (
+	probeMissing probeResult = iota // 图片不存在
+	probeFound                      // 图片存在
+	probeUnknown                    // 无法确定（网络错误、服务器拒绝等）
+)
+
+// probeImageExists 用 HEAD 请求判断图片是否存在，服务器不支持 HEAD 时改为请求第一个字节
+func probeImageExists(imgURL string) probeResult {
+	if err := politeMode.check(runContext, imgURL); err != nil {
+		return probeUnknown
+	}
+	result := probeImageRequest(imgURL, "HEAD")
+	if result == probeUnknown {
+		result = probeImageRequest(imgURL, "GET")
+	}
+	return result
+}
+
+// probeImageRequest 发送一个探测请求，GET 请求只要求第一个字节
+func probeImageRequest(imgURL, method string) probeResult {
+	ctx, cancel := context.WithTimeout(runContext, 15*time.Second)
+	defer cancel()
+	req, err := newImageProbe(ctx, method, imgURL)
+	if err != nil {
+		return probeUnknown
+	}
+	if method == "GET" {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	resp, err := (&http.Client{Transport: pageTransport(), CheckRedirect: checkRedirect}).Do(req)
+	if err != nil {
+		return probeUnknown
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, imageProbeBytes))
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return probeMissing
+	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent:
+		return probeUnknown
+	}
+	// 有的 CDN 对不存在的图片返回 200 和一个错误页面
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "image/") &&
+		!strings.HasPrefix(ct, "application/octet-stream") {
+		return probeMissing
+	}
+	return probeFound
+}
+
+// sequenceProber 探测一个序列中的编号，记录已探测的数量
+type sequenceProber struct {
+	seq      *imageSequence
+	settings sequenceProbeSettings
+	probed   int
+	capped   bool // 有编号因为达到上限没有探测
+}
+
+// probeAll 并发探测一组编号，超过上限的编号不探测，结果为 probeUnknown
+func (p *sequenceProber) probeAll(numbers []int) []probeResult {
+	results := make([]probeResult, len(numbers))
+	for i := range results {
+		results[i] = probeUnknown
+	}
+	if left := p.settings.Limit - p.probed; len(numbers) > left {
+		numbers = numbers[:max(left, 0)]
+		p.capped = true
+	}
+	p.probed += len(numbers)
+
+	workers := max(p.settings.Workers, 1)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = probeImageExists(p.seq.url(numbers[i]))
+				if results[i] == probeUnknown {
+					verbosef("无法确定图片 %s 是否存在\n", p.seq.url(numbers[i]))
+				}
+			}
+		}()
+	}
+	for i := range numbers {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// run 从 start 开始按 step（1 或 -1）依次探测，每次并发探测一批编号，
+// 连续 MaxMisses 个编号不存在、无法确定或达到上限时停止，返回存在的编号
+func (p *sequenceProber) run(start, step int) []int {
+	var found []int
+	misses := 0
+	for n := start; n >= 0; {
+		batch := make([]int, 0, p.settings.Workers)
+		for i := 0; i < max(p.settings.Workers, 1) && n >= 0; i++ {
+			batch = append(batch, n)
+			n += step
+		}
+		for i, result := range p.probeAll(batch) {
+			switch result {
+			case probeFound:
+				found = append(found, batch[i])
+				misses = 0
+			case probeMissing:
+				misses++
+				if misses < p.settings.MaxMisses {
+					continue
+				}
+				return found
+			default:
+				return found
+			}
+		}
+	}
+	return found
+}
+
+// extendSequence 图片链接按编号排列时，探测页面中缺少的编号、第一张之前和最后一张之后的图片，
+// 补充懒加载等原因没有出现在页面中的图片
+func extendSequence(page *chapterPage) {
+	seq := inferSequence(page.images)
+	if seq == nil {
+		return
+	}
+	p := &sequenceProber{seq: seq, settings: sequenceProbe}
+
+	// 按原来的顺序重建列表：第一个成员之前插入更小的编号，成员之间插入缺少的编号，最后一个成员之后追加后续的编号
+	var leading []string
+	for _, n := range p.run(seq.numbers[0]-1, -1) {
+		leading = append([]string{seq.url(n)}, leading...)
+	}
+	inserted := map[int][]string{}
+	var gaps, gapAfter []int
+	for i := 1; i < len(seq.numbers); i++ {
+		for n := seq.numbers[i-1] + 1; n < seq.numbers[i]; n++ {
+			gaps = append(gaps, n)
+			gapAfter = append(gapAfter, seq.members[i-1])
+		}
+	}
+	for i, result := range p.probeAll(gaps) {
+		if result == probeFound {
+			inserted[gapAfter[i]] = append(inserted[gapAfter[i]], seq.url(gaps[i]))
+		}
+	}
+	last := seq.members[len(seq.members)-1]
+	for _, n := range p.run(seq.numbers[len(seq.numbers)-1]+1, 1) {
+		inserted[last] = append(inserted[last], seq.url(n))
+	}
+	if p.capped {
+		fmt.Printf("警告: 探测图片达到上限 %d 个，可能还有更多图片，可用 --probe-limit 调整\n", p.settings.Limit)
+	}
+
+	added := len(leading)
+	for _, urls := range inserted {
+		added += len(urls)
+	}
+	if added == 0 {
+		verbosef("图片链接按编号排列，没有探测到更多图片\n")
+		return
+	}
+	images := make([]string, 0, len(page.images)+added)
+	for i, img := range page.images {
+		if i == seq.members[0] {
+			images = append(images, leading...)
+		}
+		images = append(images, img)
+		images = append(images, inserted[i]...)
+	}
+	infof("按图片链接的编号规律补充了 %d 张页面中没有的图片\n", added)
+	page.images = images
+}
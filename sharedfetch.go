@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// imageFetchGroup 合并本次运行中对同一图片链接的下载：多个章节重复使用的封面、横幅等图片只请求一次，
+// 正在下载时其他 worker 等待下载完成，下载完成后直接复制已保存的文件
+type imageFetchGroup struct {
+	mu    sync.Mutex
+	calls map[string]*imageFetch
+}
+
+// imageFetch 一个链接的下载
+type imageFetch struct {
+	done  chan struct{}
+	files []string // 下载并处理后保存的文件，后处理拆分出的部分在第一个之后；只整体替换，不修改其中的元素
+	err   error
+}
+
+// sharedImages 全局的图片下载合并，每部漫画下载完成后清除（见 release）
+var sharedImages = &imageFetchGroup{calls: make(map[string]*imageFetch)}
+
+// do 返回链接对应的图片文件：同一链接已下载或正在下载时返回（等待）其结果，shared 为true；
+// 否则调用 download 下载。下载失败的链接不保留，之后再次请求时重新下载
+func (g *imageFetchGroup) do(imgUrl string, download func() ([]string, error)) (files []string, shared bool, err error) {
+	g.mu.Lock()
+	if c, ok := g.calls[imgUrl]; ok {
+		g.mu.Unlock()
+		<-c.done
+		g.mu.Lock()
+		files, err = c.files, c.err
+		g.mu.Unlock()
+		if err == nil {
+			return files, true, nil
+		}
+		files, err = download()
+		return files, false, err
+	}
+	c := &imageFetch{done: make(chan struct{})}
+	g.calls[imgUrl] = c
+	g.mu.Unlock()
+
+	files, err = download()
+	g.mu.Lock()
+	c.files, c.err = files, err
+	if err != nil {
+		delete(g.calls, imgUrl)
+	}
+	g.mu.Unlock()
+	close(c.done)
+	return files, false, err
+}
+
+// forget 已保存的文件不可用（如已被删除）时移除记录
+func (g *imageFetchGroup) forget(imgUrl string) {
+	g.mu.Lock()
+	delete(g.calls, imgUrl)
+	g.mu.Unlock()
+}
+
+// moved 章节目录从临时目录移入漫画库后，更新其中已下载图片的路径
+// 等待者和下载者在锁外读取之前拿到的 files，这里替换为新的切片而不是修改原切片
+func (g *imageFetchGroup) moved(workDir, finalDir string) {
+	prefix := workDir + string(filepath.Separator)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, c := range g.calls {
+		var files []string
+		for i, file := range c.files {
+			if !strings.HasPrefix(file, prefix) {
+				continue
+			}
+			if files == nil {
+				files = append([]string(nil), c.files...)
+			}
+			files[i] = filepath.Join(finalDir, strings.TrimPrefix(file, prefix))
+		}
+		if files != nil {
+			c.files = files
+		}
+	}
+}
+
+// release 清除已完成的下载记录，正在下载的保留；一部漫画下载完成后调用，避免长时间运行（如监视模式）时记录不断增加
+func (g *imageFetchGroup) release() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for imgUrl, c := range g.calls {
+		select {
+		case <-c.done:
+			delete(g.calls, imgUrl)
+		default:
+		}
+	}
+}
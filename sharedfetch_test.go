@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestImageFetchGroupMovedCopiesFiles(t *testing.T) {
+	g := &imageFetchGroup{calls: make(map[string]*imageFetch)}
+	work, final := filepath.Join("tmp", "work"), filepath.Join("library", "001_第1话")
+	saved := filepath.Join(work, "0001.jpg")
+	files, _, _ := g.do("https://img.example.com/1.jpg", func() ([]string, error) { return []string{saved}, nil })
+
+	g.moved(work, final)
+	if files[0] != saved {
+		t.Errorf("moved changed the files returned by do: %q", files[0])
+	}
+	shared, ok, _ := g.do("https://img.example.com/1.jpg", nil)
+	if want := filepath.Join(final, "0001.jpg"); !ok || shared[0] != want {
+		t.Errorf("shared files = %q, %v, want %q", shared, ok, want)
+	}
+}
+
+func TestImageFetchGroupRelease(t *testing.T) {
+	g := &imageFetchGroup{calls: make(map[string]*imageFetch)}
+	g.do("https://img.example.com/done.jpg", func() ([]string, error) { return []string{"0001.jpg"}, nil })
+	g.calls["https://img.example.com/running.jpg"] = &imageFetch{done: make(chan struct{})}
+
+	g.release()
+	if _, ok := g.calls["https://img.example.com/done.jpg"]; ok {
+		t.Error("finished download was not released")
+	}
+	if _, ok := g.calls["https://img.example.com/running.jpg"]; !ok {
+		t.Error("running download was released")
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// siteAdapter 站点适配器：识别站点链接，获取目录和章节
+// 支持新站点时实现该接口并加入 siteAdapters
+type siteAdapter interface {
+	// name 站点名称
+	name() string
+	// matchHost 检查域名是否属于该站点
+	matchHost(host string) bool
+	// parsePath 从链接中识别章节或漫画ID
+	parsePath(u *url.URL) (targetKind, string, bool)
+	// seriesURL 漫画目录页链接
+	seriesURL(baseURL, seriesID string) string
+	// fetchSeries 获取漫画标题和章节列表
+	fetchSeries(ctx context.Context, baseURL, seriesID string) (*seriesPage, error)
+	// fetchChapter 获取章节标题和图片链接
+	fetchChapter(ctx context.Context, baseURL, chapterID string) (*chapterPage, error)
+}
+
+// seriesPage 漫画目录
+type seriesPage struct {
+	title     string
+	chapters  []ChapterInfo
+	rating    string // 从页面标签识别的内容分级，识别不出时为空
+	completed bool   // 页面上的连载状态为已完结
+}
+
+// chapterPage 章节内容
+type chapterPage struct {
+	title     string
+	url       string // 章节页面链接，记录在 chapter.json 中
+	images    []string
+	fixup     imageFixup     // 图片下载后的处理，不需要时为nil
+	declared  int            // 页面上标明的总页数，0 表示未知
+	strategy  string         // 提取图片链接的方式，记录在 chapter.json 中便于排查
+	versions  []versionScore // 比较过的各来源版本的评分，只在 --best-version 时记录
+	published string         // 页面上的更新日期（2006-01-02），只在 --extras 时提取
+	notes     string         // 页面上的作者的话，只在 --extras 时提取
+}
+
+// imageFixup 图片下载后的处理，如还原被切块打乱的图片
+type imageFixup func(index int, imgUrl, filename string) error
+
+// siteAdapters 已支持的站点，按顺序匹配链接，通用站点放在最后接收其他站点无法识别的链接
+var siteAdapters = []siteAdapter{jmSite{}, copySite{}, hmSite{}, genericSite{}}
+
+// defaultSite 无法从域名识别站点时使用的站点，如只有漫画ID时
+var defaultSite siteAdapter = hmSite{}
+
+// knownHosts 通过链接路径识别出的镜像站域名
+var (
+	knownHostsMu sync.Mutex
+	knownHosts   = make(map[string]siteAdapter)
+)
+
+// siteFor 返回站点地址对应的适配器，无法识别时使用默认站点
+func siteFor(baseURL string) siteAdapter {
+	host := baseURL
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	knownHostsMu.Lock()
+	site, ok := knownHosts[host]
+	knownHostsMu.Unlock()
+	if ok {
+		return site
+	}
+	for _, site := range siteAdapters {
+		if site.matchHost(host) {
+			return site
+		}
+	}
+	return defaultSite
+}
+
+// rememberHost 记录镜像站域名对应的站点
+func rememberHost(host string, site siteAdapter) {
+	knownHostsMu.Lock()
+	knownHosts[host] = site
+	knownHostsMu.Unlock()
+}
+
+// fetchJSON 请求 JSON 接口并解析到 v，供使用 API 而不是网页的站点使用
+// 与网页请求一样遵守礼貌抓取设置和熔断器，失败时重试
+func fetchJSON(ctx context.Context, apiURL string, headers map[string]string, v interface{}) error {
+	var err error
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			delay := retryDelay(err, i, 5*time.Second)
+			fmt.Printf("接口请求失败: %v，%v 后重试...\n", err, delay)
+			if sleepContext(ctx, delay) != nil {
+				return err
+			}
+		}
+		err = fetchJSONOnce(ctx, apiURL, headers, v)
+		metrics.recordError(err)
+		if err == nil || classifyRetry(err) == retryNever {
+			return err
+		}
+	}
+	return fmt.Errorf("在 3 次尝试后仍然无法请求接口: %v", err)
+}
+
+// fetchJSONOnce 请求一次 JSON 接口
+func fetchJSONOnce(ctx context.Context, apiURL string, headers map[string]string, v interface{}) error {
+	debugf("正在请求接口: %s\n", apiURL)
+	request := fetchRequest{URL: apiURL, Headers: map[string]string{"Accept": "application/json"}}
+	for key, value := range headers {
+		request.Headers[key] = value
+	}
+	body, err := fetchBytes(ctx, request)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("解析接口响应失败: %v", err)
+	}
+	return nil
+}
+
+// hmSite 92hm 及其镜像站
+type hmSite struct{}
+
+func (hmSite) name() string { return "92hm" }
+
+func (hmSite) matchHost(host string) bool {
+	return strings.Contains(host, "92hm")
+}
+
+func (hmSite) parsePath(u *url.URL) (targetKind, string, bool) {
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		id := strings.TrimSuffix(segments[i+1], ".html")
+		if !isNumeric(id) {
+			continue
+		}
+		switch segments[i] {
+		case "chapter":
+			return targetChapter, id, true
+		case "book":
+			return targetSeries, id, true
+		}
+	}
+	return 0, "", false
+}
+
+func (hmSite) seriesURL(baseURL, seriesID string) string {
+	return baseURL + "/book/" + seriesID
+}
+
+func (s hmSite) fetchSeries(ctx context.Context, baseURL, seriesID string) (*seriesPage, error) {
+	doc, err := fetchPageWithRetry(ctx, s.seriesURL(baseURL, seriesID), 3)
+	if err != nil {
+		return nil, err
+	}
+	chapters := extractChapterLinks(doc)
+	if len(chapters) == 0 {
+		return nil, fmt.Errorf("未找到任何章节链接")
+	}
+	return &seriesPage{title: extractComicTitle(doc), chapters: chapters, rating: detectRating(doc), completed: detectCompleted(doc)}, nil
+}
+
+func (hmSite) fetchChapter(ctx context.Context, baseURL, chapterID string) (*chapterPage, error) {
+	pageURL := baseURL + "/chapter/" + chapterID
+	doc, err := fetchPageWithRetry(ctx, pageURL, 3)
+	if err != nil {
+		return nil, err
+	}
+	images, strategy := extractImages(doc)
+	if reason := detectLocked(doc, images, ""); reason != "" {
+		return nil, lockedError(reason)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("未找到任何图片链接")
+	}
+	page := &chapterPage{title: extractChapterTitle(doc), url: pageURL, images: images, strategy: strategy}
+	addChapterExtras(page, doc, "", "")
+	fallback, _ := url.Parse(pageURL)
+	checkPageCount(page, doc, documentBase(doc, fallback))
+	return page, nil
+}
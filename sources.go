@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// seriesSource 漫画的一个来源（主站或镜像站）
+type seriesSource struct {
+	baseURL   string
+	seriesID  string
+	title     string
+	chapters  []ChapterInfo
+	rating    string
+	completed bool
+}
+
+// fetchSeriesSources 获取主来源（站点地址为 baseURL）和所有备用来源的目录，返回可用的来源（主来源在前）
+func fetchSeriesSources(ctx context.Context, baseURL, seriesID string, alternates []string) []*seriesSource {
+	candidates := []*seriesSource{{baseURL: baseURL, seriesID: seriesID}}
+	for _, alt := range alternates {
+		t, err := parseTarget(alt)
+		if err != nil || t.kind != targetSeries {
+			fmt.Printf("忽略无效的备用来源: %s\n", alt)
+			continue
+		}
+		candidates = append(candidates, &seriesSource{baseURL: t.baseURL, seriesID: t.id})
+	}
+
+	var sources []*seriesSource
+	for i, source := range candidates {
+		if i > 0 {
+			fmt.Printf("正在获取备用来源 %s 的目录...\n", source.baseURL)
+		}
+		page, err := siteFor(source.baseURL).fetchSeries(ctx, source.baseURL, source.seriesID)
+		if err != nil {
+			fmt.Printf("来源 %s 不可用: %v\n", source.baseURL, err)
+			continue
+		}
+		chapters := page.chapters
+		for j := range chapters {
+			chapters[j].baseURL = source.baseURL
+		}
+		source.title = page.title
+		source.rating = page.rating
+		source.completed = page.completed
+		source.chapters = chapters
+		sources = append(sources, source)
+	}
+	return sources
+}
+
+// mergeSourceChapters 以第一个来源的章节列表为准，按规范化标题或话数将备用来源中的
+// 同一章节记为备选，并补充只在备用来源中存在的章节
+func mergeSourceChapters(sources []*seriesSource) []ChapterInfo {
+	if len(sources) == 0 {
+		return nil
+	}
+
+	merged := append([]ChapterInfo(nil), sources[0].chapters...)
+	baseCounts := chapterNumberCounts(chapterTitles(merged))
+	for _, source := range sources[1:] {
+		altCounts := chapterNumberCounts(chapterTitles(source.chapters))
+		for _, alt := range source.chapters {
+			number, hasNumber := parseChapterNumber(alt.title)
+			uniqueNumber := hasNumber && baseCounts[number] == 1 && altCounts[number] == 1
+
+			matched := false
+			insertAt := len(merged)
+			if hasNumber {
+				insertAt = 0
+			}
+			for i := range merged {
+				if sameChapter(merged[i].title, alt.title, uniqueNumber) {
+					merged[i].alternates = append(merged[i].alternates, alt)
+					matched = true
+					break
+				}
+				if n, ok := parseChapterNumber(merged[i].title); hasNumber && ok && n < number {
+					insertAt = i + 1
+				}
+			}
+
+			if !matched {
+				fmt.Printf("备用来源 %s 补充章节: %s\n", source.baseURL, alt.title)
+				merged = append(merged, ChapterInfo{})
+				copy(merged[insertAt+1:], merged[insertAt:])
+				merged[insertAt] = alt
+			}
+		}
+	}
+	return merged
+}
+
+// fetchChapterImageUrls 获取章节图片链接，失败时依次尝试备用来源中的同一章节
+// 返回章节内容和实际使用的来源地址，所有来源中都未解锁时返回 errChapterLocked
+func fetchChapterImageUrls(ctx context.Context, chapter ChapterInfo) (*chapterPage, string, error) {
+	if bestVersion && len(chapter.alternates) > 0 {
+		return fetchBestVersion(ctx, chapter)
+	}
+	var lastErr, lockedErr error
+	candidates := append([]ChapterInfo{chapter}, chapter.alternates...)
+	for i, candidate := range candidates {
+		baseURL := candidate.baseURL
+		if baseURL == "" {
+			baseURL = contextBaseURL(ctx)
+		}
+		if i > 0 {
+			fmt.Printf("尝试备用来源 %s 的章节 %s\n", baseURL, candidate.id)
+		}
+
+		page, err := siteFor(baseURL).fetchChapter(ctx, baseURL, candidate.id)
+		if errors.Is(err, errChapterLocked) {
+			// 其他来源中可能是免费的，继续尝试
+			lockedErr = err
+			continue
+		}
+		if err != nil {
+			fmt.Printf("获取章节失败: %v\n", err)
+			lastErr = err
+			continue
+		}
+		filterChapterImages(ctx, page)
+		return page, baseURL, nil
+	}
+	if lockedErr != nil {
+		return nil, "", lockedErr
+	}
+	return nil, "", lastErr
+}
+
+// runSourceCommand 管理漫画的备用来源
+func runSourceCommand(args []string) {
+	if len(args) < 2 {
+		fmt.Println("用法: ./comicbox source list|add|remove <漫画ID> [目录页链接]")
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	record := db.findSeries(args[1])
+
+	switch args[0] {
+	case "list":
+		if record == nil {
+			fmt.Printf("漫画库中没有漫画 %s\n", args[1])
+			return
+		}
+		fmt.Printf("主来源: %s/book/%s\n", record.BaseURL, record.ID)
+		for _, alt := range record.Sources {
+			fmt.Printf("备用来源: %s\n", alt)
+		}
+		return
+	case "add":
+		if len(args) < 3 {
+			fmt.Println("请指定备用来源的目录页链接")
+			return
+		}
+		if t, err := parseTarget(args[2]); err != nil || t.kind != targetSeries {
+			fmt.Printf("备用来源必须是目录页链接: %s\n", args[2])
+			return
+		}
+		if record == nil {
+			record = db.ensureSeries(args[1])
+		}
+		for _, alt := range record.Sources {
+			if alt == args[2] {
+				fmt.Println("该备用来源已存在")
+				return
+			}
+		}
+		record.Sources = append(record.Sources, args[2])
+	case "remove":
+		if record == nil || len(args) < 3 {
+			fmt.Println("请指定要移除的备用来源")
+			return
+		}
+		var kept []string
+		for _, alt := range record.Sources {
+			if alt != args[2] {
+				kept = append(kept, alt)
+			}
+		}
+		record.Sources = kept
+	default:
+		fmt.Printf("未知的 source 子命令: %s\n", args[0])
+		return
+	}
+
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+		return
+	}
+	fmt.Printf("漫画 %s 现有 %d 个备用来源\n", record.ID, len(record.Sources))
+}
+
+// chapterTitles 返回章节标题列表
+func chapterTitles(chapters []ChapterInfo) []string {
+	titles := make([]string, 0, len(chapters))
+	for _, chapter := range chapters {
+		titles = append(titles, chapter.title)
+	}
+	return titles
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runStatsCommand 汇总漫画库的下载历史和统计信息
+func runStatsCommand(args []string) {
+	days := 14
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--days" && i+1 < len(args) {
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n < 1 {
+				fmt.Printf("无效的天数: %s\n", args[i+1])
+				return
+			}
+			days = n
+			i++
+		}
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	if len(db.Series) == 0 {
+		fmt.Println("漫画库为空，还没有下载记录")
+		return
+	}
+
+	var totalChapters, totalPages int
+	var totalBytes, totalDisk int64
+	var allChapters []*chapterRecord
+
+	fmt.Printf("%-30s %6s %6s %8s %10s %10s  %-10s  %-10s\n", "漫画", "章节", "未读", "页数", "下载量", "占用空间", "首次下载", "最近下载")
+	fmt.Println(strings.Repeat("-", 100))
+
+	for _, s := range db.Series {
+		var pages int
+		var bytes int64
+		var first, last time.Time
+		for _, c := range s.Chapters {
+			pages += c.Pages
+			bytes += c.Bytes
+			if first.IsZero() || c.DownloadedAt.Before(first) {
+				first = c.DownloadedAt
+			}
+			if c.DownloadedAt.After(last) {
+				last = c.DownloadedAt
+			}
+			allChapters = append(allChapters, c)
+		}
+		disk := dirSize(s.Dir)
+
+		title := s.Title
+		if title == "" {
+			title = s.ID
+		}
+		if s.Followed {
+			title += " *"
+		}
+		fmt.Printf("%-30s %6d %6d %8d %10s %10s  %-10s  %-10s\n",
+			title, len(s.Chapters), s.unreadCount(), pages, formatBytes(bytes), formatBytes(disk), formatDate(first), formatDate(last))
+
+		totalChapters += len(s.Chapters)
+		totalPages += pages
+		totalBytes += bytes
+		totalDisk += disk
+	}
+
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("共 %d 部漫画（* 为已订阅），%d 个章节，%d 页，下载 %s，占用磁盘 %s\n",
+		len(db.Series), totalChapters, totalPages, formatBytes(totalBytes), formatBytes(totalDisk))
+
+	printActivityGraph(allChapters, days)
+	printRecentChapters(db, 10)
+}
+
+// printActivityGraph 以ASCII柱状图显示最近几天每天下载的章节数
+func printActivityGraph(chapters []*chapterRecord, days int) {
+	today := startOfDay(time.Now())
+	counts := make([]int, days)
+	for _, c := range chapters {
+		downloaded := startOfDay(c.DownloadedAt.In(today.Location()))
+		age := int(today.Sub(downloaded).Hours()+12) / 24 // 加12小时抵消夏令时的误差
+		if age >= 0 && age < days {
+			counts[days-1-age]++
+		}
+	}
+
+	max := 0
+	for _, n := range counts {
+		if n > max {
+			max = n
+		}
+	}
+
+	fmt.Printf("\n最近 %d 天下载的章节数:\n", days)
+	const width = 40
+	for i, n := range counts {
+		day := today.AddDate(0, 0, i-days+1)
+		bar := 0
+		if max > 0 {
+			bar = n * width / max
+		}
+		if n > 0 && bar == 0 {
+			bar = 1
+		}
+		fmt.Printf("  %s | %-*s %d\n", day.Format("01-02"), width, strings.Repeat("#", bar), n)
+	}
+}
+
+// printRecentChapters 显示最近下载的章节
+func printRecentChapters(db *libraryDB, limit int) {
+	type recent struct {
+		series  string
+		chapter *chapterRecord
+	}
+	var all []recent
+	for _, s := range db.Series {
+		for _, c := range s.Chapters {
+			all = append(all, recent{series: s.Title, chapter: c})
+		}
+	}
+	if len(all) == 0 {
+		return
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].chapter.DownloadedAt.After(all[j].chapter.DownloadedAt)
+	})
+	if len(all) > limit {
+		all = all[:limit]
+	}
+
+	fmt.Println("\n最近下载:")
+	for _, r := range all {
+		fmt.Printf("  %s  %s / %s（%d 页）\n",
+			r.chapter.DownloadedAt.Format("2006-01-02 15:04"), r.series, r.chapter.Title, r.chapter.Pages)
+	}
+}
+
+// dirSize 计算目录占用的磁盘空间，目录不存在时返回0
+func dirSize(dir string) int64 {
+	if dir == "" {
+		return 0
+	}
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// startOfDay 返回给定时间当天的零点（本地时区）
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// formatBytes 将字节数格式化为易读的形式
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// formatDate 格式化日期，零值显示为 "-"
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02")
+}
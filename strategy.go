@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// imageStrategy 从章节页面提取图片链接的一种方式
+type imageStrategy struct {
+	name    string
+	extract func(doc *goquery.Document, base *url.URL) []string
+}
+
+// imageStrategies 提取方式链，按顺序尝试，前一种没有找到图片时才尝试下一种
+// rendered-dom 需要启动浏览器，最慢，放在最后
+var imageStrategies = []imageStrategy{
+	{"lazy-attr", lazyAttrImageUrls},
+	{"script-json", scriptImageUrls},
+	{"background-css", func(doc *goquery.Document, base *url.URL) []string {
+		return backgroundImageUrls(doc, base, queryKeep)
+	}},
+	{"rendered-dom", renderedImageUrls},
+}
+
+// strategyOverride --strategy 指定的提取方式及顺序，为空时使用 imageStrategies 的全部方式
+var strategyOverride []string
+
+// parseStrategies 解析 --strategy 的值，多个提取方式用逗号分隔
+func parseStrategies(s string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if findStrategy(name) == nil {
+			var known []string
+			for _, strategy := range imageStrategies {
+				known = append(known, strategy.name)
+			}
+			return nil, fmt.Errorf("未知的提取方式 %s，可用: %s", name, strings.Join(known, "、"))
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("--strategy 需要至少一个提取方式")
+	}
+	return names, nil
+}
+
+// findStrategy 按名称查找提取方式
+func findStrategy(name string) *imageStrategy {
+	for i := range imageStrategies {
+		if imageStrategies[i].name == name {
+			return &imageStrategies[i]
+		}
+	}
+	return nil
+}
+
+// activeStrategies 本次运行使用的提取方式
+func activeStrategies() []imageStrategy {
+	if len(strategyOverride) == 0 {
+		return imageStrategies
+	}
+	var list []imageStrategy
+	for _, name := range strategyOverride {
+		list = append(list, *findStrategy(name))
+	}
+	return list
+}
+
+// extractImages 依次尝试各个提取方式，返回图片链接和找到图片的提取方式（记录在 chapter.json 中便于排查）
+func extractImages(doc *goquery.Document) ([]string, string) {
+	// 打印页面标题以帮助调试
+	title := doc.Find("title").Text()
+	verbosef("页面标题: %s\n", title)
+
+	// 显示页面大小帮助调试，低内存模式下不为此重新生成整个页面的HTML
+	if !lowMemory {
+		content, _ := doc.Html()
+		verbosef("页面HTML长度: %d 字符\n", len(content))
+	}
+
+	// 相对链接按页面地址和 <base> 标签解析，本地文件中的相对路径保留给 localPage.imageData 查找
+	base := documentBase(doc, localPageBase)
+
+	for _, strategy := range activeStrategies() {
+		urls := strategy.extract(doc, base)
+		verbosef("提取方式 %s: 找到 %d 张图片\n", strategy.name, len(urls))
+		if len(urls) > 0 {
+			return urls, strategy.name
+		}
+	}
+	return nil, ""
+}
+
+// scriptImagePattern 脚本中的图片链接，JSON 中的 / 可能被转义为 \/
+var scriptImagePattern = regexp.MustCompile(`(?i)(?:https?:)?(?:\\?/){2}[^"'\s<>()]+?\.(?:jpe?g|png|webp|gif|avif)\b(?:\?[^"'\s<>()\\]*)?`)
+
+// scriptImageUrls 提取方式 script-json: 从页面脚本中的图片列表（如 var images = [...] 或内嵌的 JSON）提取
+func scriptImageUrls(doc *goquery.Document, base *url.URL) []string {
+	var urls []string
+	seen := map[string]bool{}
+	doc.Find("script").Each(func(i int, script *goquery.Selection) {
+		for _, m := range scriptImagePattern.FindAllString(script.Text(), -1) {
+			imgSrc, ok := resolveImageURL(base, strings.ReplaceAll(m, `\/`, "/"), queryKeep)
+			if !ok || seen[imgSrc] {
+				continue
+			}
+			seen[imgSrc] = true
+			urls = append(urls, imgSrc)
+		}
+	})
+	return urls
+}
+
+// browserNames 用于渲染页面的浏览器，按顺序在 PATH 中查找
+var browserNames = []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "chrome", "msedge"}
+
+var browserLookup struct {
+	once sync.Once
+	path string
+}
+
+// findBrowser 在 PATH 中查找可以无界面运行的浏览器，只查找一次，未安装时返回空字符串
+func findBrowser() string {
+	browserLookup.once.Do(func() {
+		for _, name := range browserNames {
+			if path, err := exec.LookPath(name); err == nil {
+				browserLookup.path = path
+				return
+			}
+		}
+	})
+	return browserLookup.path
+}
+
+// renderTimeout 渲染一个页面的最长时间
+const renderTimeout = 60 * time.Second
+
+// renderedImageUrls 提取方式 rendered-dom: 用无界面浏览器执行页面脚本后，从渲染后的页面中提取
+// 用于图片由脚本插入的页面；未安装 Chromium 或 Chrome 时跳过
+func renderedImageUrls(doc *goquery.Document, base *url.URL) []string {
+	if doc.Url == nil || (doc.Url.Scheme != "http" && doc.Url.Scheme != "https") {
+		return nil
+	}
+	browser := findBrowser()
+	if browser == "" {
+		verbosef("未找到 Chromium 或 Chrome，跳过 rendered-dom\n")
+		return nil
+	}
+	rendered, err := renderPage(runContext, browser, doc.Url)
+	if err != nil {
+		verbosef("渲染页面失败: %v\n", err)
+		return nil
+	}
+	base = documentBase(rendered, base)
+	if urls := lazyAttrImageUrls(rendered, base); len(urls) > 0 {
+		return urls
+	}
+	return backgroundImageUrls(rendered, base, queryKeep)
+}
+
+// renderPage 用浏览器打开页面，等待脚本执行后返回渲染后的 DOM
+func renderPage(ctx context.Context, browser string, page *url.URL) (*goquery.Document, error) {
+	if err := politeMode.check(ctx, page.String()); err != nil {
+		return nil, err
+	}
+	bandwidth.waitWindow()
+
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+	args := []string{"--headless=new", "--disable-gpu", "--dump-dom", "--virtual-time-budget=10000",
+		"--user-agent=" + siteBreaker.userAgent()}
+	// root 用户运行 Chromium 必须关闭沙箱
+	if os.Geteuid() == 0 {
+		args = append(args, "--no-sandbox")
+	}
+	args = append(args, page.String())
+	verbosef("用浏览器渲染页面: %s\n", page)
+	out, err := exec.CommandContext(ctx, browser, args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := goquery.NewDocumentFromReader(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	rendered.Url = page
+	return rendered, nil
+}
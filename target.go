@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// defaultBaseURL 默认站点地址，可以在配置方案中修改
+var defaultBaseURL = "https://www.92hm.life"
+
+// siteBaseURL 当前使用的站点地址，输入镜像站链接时切换为镜像地址
+var siteBaseURL = defaultBaseURL
+
+// siteBaseURLKey 请求上下文中保存站点地址的键，同时更新多部漫画时每部漫画的请求使用各自的站点地址
+type siteBaseURLKey struct{}
+
+// withSiteBaseURL 返回带有站点地址的上下文，其中的请求按该地址设置 Referer、判断重定向和 robots.txt
+func withSiteBaseURL(ctx context.Context, baseURL string) context.Context {
+	return context.WithValue(ctx, siteBaseURLKey{}, baseURL)
+}
+
+// contextBaseURL 上下文中的站点地址，没有时为 siteBaseURL
+func contextBaseURL(ctx context.Context) string {
+	if baseURL, ok := ctx.Value(siteBaseURLKey{}).(string); ok {
+		return baseURL
+	}
+	return siteBaseURL
+}
+
+// targetKind 下载目标类型
+type targetKind int
+
+const (
+	targetChapter targetKind = iota
+	targetSeries
+)
+
+// target 解析后的下载目标
+type target struct {
+	kind    targetKind
+	id      string
+	baseURL string
+	fromURL bool // 是否由完整链接解析而来（链接本身已确定类型）
+}
+
+// parseTarget 解析章节/漫画ID或任意章节、目录页链接（包括镜像站）
+func parseTarget(input string) (target, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return target{}, fmt.Errorf("输入为空")
+	}
+
+	// 纯数字默认为章节ID
+	if isNumeric(input) {
+		return target{kind: targetChapter, id: input, baseURL: defaultBaseURL}, nil
+	}
+
+	// 允许省略协议，如 www.92hm.life/book/418
+	raw := input
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return target{}, fmt.Errorf("无法识别的ID或链接: %s", input)
+	}
+
+	// 依次尝试各站点的链接格式，记住识别出的镜像站域名
+	for _, site := range siteAdapters {
+		kind, id, ok := site.parsePath(u)
+		if !ok {
+			continue
+		}
+		rememberHost(u.Host, site)
+		return target{kind: kind, id: id, baseURL: u.Scheme + "://" + u.Host, fromURL: true}, nil
+	}
+
+	return target{}, fmt.Errorf("链接中未找到章节或漫画ID: %s", input)
+}
+
+// isNumeric 检查字符串是否为纯数字
+func isNumeric(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil && !strings.HasPrefix(s, "-") && !strings.HasPrefix(s, "+")
+}
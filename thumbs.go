@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// thumbDirName 漫画目录中缓存缩略图的目录，以点开头，不会被当作章节
+// 每个章节一张 <章节目录名>.jpg，整部漫画一张 series.jpg（第一个章节的封面）
+const thumbDirName = ".thumbs"
+
+// seriesThumbName 整部漫画的缩略图文件名
+const seriesThumbName = "series.jpg"
+
+// thumbWidth 缩略图宽度（像素），高度按比例缩放
+const thumbWidth = 240
+
+// makeThumbnail 解码图片并缩小为 thumbWidth 宽的 JPEG，WebP 等标准库不支持的格式返回错误
+func makeThumbnail(r io.Reader) ([]byte, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("无法解码图片: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scaleToWidth(img, thumbWidth), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleToWidth 按区域平均缩小图片，比原图窄时原样返回
+func scaleToWidth(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= width || b.Dx() == 0 {
+		return img
+	}
+	height := b.Dy() * width / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := b.Min.Y + (y+1)*b.Dy()/height
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := b.Min.X + (x+1)*b.Dx()/width
+			var r, g, bl, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+cr, g+cg, bl+cb, a+ca, n+1
+				}
+			}
+			if n > 0 {
+				dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+			}
+		}
+	}
+	return dst
+}
+
+// firstPageFile 章节的第一页图片，有 chapter.json 时按其中的页码，否则按文件名
+func firstPageFile(chapterDir string) string {
+	if chapter := dirChapter(chapterDir); chapter != nil {
+		return chapter.pages[0].path
+	}
+	return ""
+}
+
+// cachedThumbnail 缩略图 thumbPath 不存在或比图片 page 旧时重新生成，返回是否生成了新的缩略图
+func cachedThumbnail(page, thumbPath string, force bool) (bool, error) {
+	pageInfo, err := os.Stat(page)
+	if err != nil {
+		return false, err
+	}
+	if info, err := os.Stat(thumbPath); err == nil && !force && !info.ModTime().Before(pageInfo.ModTime()) {
+		return false, nil
+	}
+
+	release, err := reserveImageMemory(page)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	file, err := os.Open(page)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	data, err := makeThumbnail(file)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(thumbPath), 0755); err != nil {
+		return false, err
+	}
+	return true, writeFileAtomic(thumbPath, data)
+}
+
+// coverChanged chapter.json 比缩略图新时章节的封面可能换了一页，需要重新生成缩略图
+func coverChanged(chapterDir, thumbPath string) bool {
+	meta, err := os.Stat(filepath.Join(chapterDir, chapterMetaFile))
+	if err != nil {
+		return false
+	}
+	thumb, err := os.Stat(thumbPath)
+	return err == nil && thumb.ModTime().Before(meta.ModTime())
+}
+
+// chapterThumbnail 返回章节缩略图的路径，需要时用章节封面生成，缓存在漫画目录的 .thumbs 中
+func chapterThumbnail(chapterDir string) (string, error) {
+	page := coverPageFile(chapterDir, false)
+	if page == "" {
+		return "", fmt.Errorf("章节中没有图片")
+	}
+	thumb := filepath.Join(filepath.Dir(chapterDir), thumbDirName, filepath.Base(chapterDir)+".jpg")
+	_, err := cachedThumbnail(page, thumb, coverChanged(chapterDir, thumb))
+	return thumb, err
+}
+
+// updateThumbnails 为漫画目录中的所有章节和整部漫画生成缩略图，返回新生成的数量
+// 已有且不比封面和 chapter.json 旧的缩略图跳过，force 时全部重新生成
+func updateThumbnails(seriesDir string, force bool) (int, error) {
+	entries, err := os.ReadDir(seriesDir)
+	if err != nil {
+		return 0, err
+	}
+	thumbDir := filepath.Join(seriesDir, thumbDirName)
+	generated := 0
+	seriesDone := false
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		chapterDir := filepath.Join(seriesDir, entry.Name())
+		page := coverPageFile(chapterDir, true)
+		if page == "" {
+			continue
+		}
+		thumb := filepath.Join(thumbDir, entry.Name()+".jpg")
+		made, err := cachedThumbnail(page, thumb, force || coverChanged(chapterDir, thumb))
+		if err != nil {
+			verbosef("生成 %s 的缩略图失败: %v\n", entry.Name(), err)
+			continue
+		}
+		if made {
+			generated++
+		}
+		if !seriesDone {
+			seriesDone = true
+			if made, err := cachedThumbnail(page, filepath.Join(thumbDir, seriesThumbName), force || made); err == nil && made {
+				generated++
+			}
+		}
+	}
+	return generated, nil
+}
+
+// runThumbsCommand 为漫画目录生成缩略图，供阅读器和电子书目录使用
+func runThumbsCommand(args []string) {
+	force := false
+	var dirs []string
+	for _, arg := range args {
+		if arg == "--force" {
+			force = true
+			continue
+		}
+		dirs = append(dirs, arg)
+	}
+	if len(dirs) == 0 {
+		fmt.Println("用法: ./comicbox thumbs <漫画目录>... [--force]")
+		return
+	}
+
+	for _, dir := range dirs {
+		n, err := updateThumbnails(dir, force)
+		if err != nil {
+			fmt.Printf("生成 %s 的缩略图失败: %v\n", dir, err)
+			continue
+		}
+		fmt.Printf("%s: 生成了 %d 张缩略图，保存在 %s\n", dir, n, filepath.Join(dir, thumbDirName))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// runContext 本次运行的根上下文，在 main 中创建，收到 Ctrl+C 或 SIGTERM 时取消：
+// 正在进行的请求立即结束、重试等待提前返回，下载漫画时不再开始新的章节，运行汇总照常写入
+var runContext = context.Background()
+
+// runSignals 根上下文接收退出信号的通道
+var runSignals chan os.Signal
+
+// pageTimeout 请求一个页面或接口的超时时间（包括读取响应），由 --page-timeout 或配置文件的 page_timeout 设置
+var pageTimeout = 60 * time.Second
+
+// imageTimeout 下载一张图片的超时时间（包括读取整个图片），由 --image-timeout 或配置文件的 image_timeout 设置
+// 限速或网络较慢时较大的图片可能需要更长的时间
+var imageTimeout = 60 * time.Second
+
+// startRunContext 创建根上下文，再次收到信号时按默认方式立即退出；返回的函数在运行结束时调用
+func startRunContext() func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	runContext = ctx
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	runSignals = signals
+	go func() {
+		<-signals
+		signal.Stop(signals)
+		fmt.Println("\n正在中断，等待进行中的请求结束（再按一次 Ctrl+C 立即退出）")
+		cancel()
+	}()
+	return func() {
+		signal.Stop(signals)
+		cancel()
+	}
+}
+
+// releaseRunSignals 退出信号改由调用者自己处理（如 daemon 先停止接受任务、等待当前任务完成），不再取消根上下文
+func releaseRunSignals() {
+	if runSignals != nil {
+		signal.Stop(runSignals)
+	}
+}
+
+// sleepContext 等待 d，ctx 取消时提前返回 ctx 的错误
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// parseTimeout 解析 --page-timeout、--image-timeout 的时长
+func parseTimeout(value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("无效的超时时间: %s", value)
+	}
+	return d, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// addCACert 信任 PEM 文件中的 CA 证书（如 mitmproxy 或公司代理的根证书），由 --ca-cert 或配置方案的 ca_cert 设置
+// 系统的根证书仍然有效，可以指定多个文件
+func addCACert(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config := siteTLSConfig()
+	if config.RootCAs == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		config.RootCAs = pool
+	}
+	if !config.RootCAs.AppendCertsFromPEM(data) {
+		return fmt.Errorf("%s 中没有 PEM 格式的证书", path)
+	}
+	return nil
+}
+
+// setInsecureTLS 不校验站点的证书，由 --insecure-tls 或配置方案的 insecure_tls 开启，只应在排查问题时使用
+func setInsecureTLS() {
+	siteTLSConfig().InsecureSkipVerify = true
+	fmt.Println("警告: 已关闭证书校验，连接可能被拦截或篡改")
+}
+
+// siteTLSConfig 页面和图片请求的 TLS 设置，在第一次请求之前修改
+func siteTLSConfig() *tls.Config {
+	if sharedTransport.TLSClientConfig == nil {
+		sharedTransport.TLSClientConfig = &tls.Config{}
+	}
+	return sharedTransport.TLSClientConfig
+}
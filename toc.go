@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tocEntry 目录中的一个章节
+type tocEntry struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// tocSnapshot 上次更新时主来源的章节目录，下次更新时比较目录的变化
+type tocSnapshot struct {
+	Source    string     `json:"source"` // 目录所在的站点地址，换了来源时章节ID不可比较
+	FetchedAt time.Time  `json:"fetched_at"`
+	Chapters  []tocEntry `json:"chapters"`
+}
+
+// newTOCSnapshot 记录来源的章节目录
+func newTOCSnapshot(source string, chapters []ChapterInfo) *tocSnapshot {
+	snapshot := &tocSnapshot{Source: source, FetchedAt: time.Now()}
+	for _, chapter := range chapters {
+		snapshot.Chapters = append(snapshot.Chapters, tocEntry{ID: chapter.id, Title: chapter.title})
+	}
+	return snapshot
+}
+
+// tocChange 同一章节在两次目录中的记录
+type tocChange struct {
+	from, to tocEntry
+}
+
+// tocDiff 两次目录之间的变化
+type tocDiff struct {
+	added    []tocEntry
+	removed  []tocEntry
+	retitled []tocChange // ID 相同，标题变化
+	moved    []tocChange // 标题相同，ID（链接）变化，不视为删除
+}
+
+// diffTOC 按章节ID比较两次目录；删除和新增的章节中规范化标题相同的视为链接变化
+func diffTOC(old, cur []tocEntry) tocDiff {
+	var d tocDiff
+	oldByID := make(map[string]tocEntry, len(old))
+	for _, e := range old {
+		oldByID[e.ID] = e
+	}
+	curIDs := make(map[string]bool, len(cur))
+	var added []tocEntry
+	for _, e := range cur {
+		curIDs[e.ID] = true
+		prev, ok := oldByID[e.ID]
+		switch {
+		case !ok:
+			added = append(added, e)
+		case prev.Title != e.Title:
+			d.retitled = append(d.retitled, tocChange{from: prev, to: e})
+		}
+	}
+
+	addedByTitle := map[string]int{}
+	for i, e := range added {
+		addedByTitle[normalizeChapterTitle(e.Title)] = i + 1
+	}
+	matched := map[int]bool{}
+	for _, e := range old {
+		if curIDs[e.ID] {
+			continue
+		}
+		if i := addedByTitle[normalizeChapterTitle(e.Title)]; i > 0 && !matched[i-1] {
+			matched[i-1] = true
+			d.moved = append(d.moved, tocChange{from: e, to: added[i-1]})
+			continue
+		}
+		d.removed = append(d.removed, e)
+	}
+	for i, e := range added {
+		if !matched[i] {
+			d.added = append(d.added, e)
+		}
+	}
+	return d
+}
+
+// empty 目录没有变化
+func (d tocDiff) empty() bool {
+	return len(d.added)+len(d.removed)+len(d.retitled)+len(d.moved) == 0
+}
+
+// removedChapter 从站点目录中消失的章节，可能已被站点删除，写入运行汇总提醒检查
+type removedChapter struct {
+	SeriesID    string `json:"series_id"`
+	SeriesTitle string `json:"series_title"`
+	ChapterID   string `json:"chapter_id"`
+	Title       string `json:"title"`
+	Downloaded  bool   `json:"downloaded"` // 漫画库中有这个章节，本地副本可能是唯一的一份
+}
+
+// compareTOC 比较漫画上次更新时的目录和这次获取的主来源目录，输出变化并记录新的目录
+// 主来源不可用时保留上次的目录，避免把备用来源的章节当作新增、主来源的章节当作删除
+func compareTOC(record *seriesRecord, baseURL string, sources []*seriesSource) {
+	if len(sources) == 0 || sources[0].baseURL != baseURL {
+		return
+	}
+	snapshot := newTOCSnapshot(baseURL, sources[0].chapters)
+	previous := record.TOC
+	record.TOC = snapshot
+	if previous == nil || previous.Source != snapshot.Source {
+		return
+	}
+
+	d := diffTOC(previous.Chapters, snapshot.Chapters)
+	if d.empty() {
+		verbosef("目录与 %s 相比没有变化\n", previous.FetchedAt.Format("2006-01-02 15:04"))
+		return
+	}
+	var parts []string
+	for _, part := range []struct {
+		name string
+		n    int
+	}{{"新增", len(d.added)}, {"删除", len(d.removed)}, {"改名", len(d.retitled)}, {"链接变化", len(d.moved)}} {
+		if part.n > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d 章", part.name, part.n))
+		}
+	}
+	infof("目录变化（与 %s 相比）: %s\n", previous.FetchedAt.Format("2006-01-02 15:04"), strings.Join(parts, "，"))
+	for _, e := range d.added {
+		infof("  + %s (%s)\n", e.Title, e.ID)
+	}
+	for _, c := range d.retitled {
+		infof("  ~ %s -> %s (%s)\n", c.from.Title, c.to.Title, c.to.ID)
+	}
+	for _, c := range d.moved {
+		infof("  > %s (%s -> %s)\n", c.to.Title, c.from.ID, c.to.ID)
+	}
+	if len(d.removed) == 0 {
+		return
+	}
+
+	// 删除的章节总是输出，站点可能下架了内容
+	for _, e := range d.removed {
+		downloaded := false
+		for _, c := range record.Chapters {
+			if c.ID == e.ID {
+				downloaded = true
+				break
+			}
+		}
+		if downloaded {
+			fmt.Printf("  - %s (%s) [已下载]\n", e.Title, e.ID)
+		} else {
+			fmt.Printf("  - %s (%s)\n", e.Title, e.ID)
+		}
+		runStats.chapterRemoved(removedChapter{
+			SeriesID:    record.ID,
+			SeriesTitle: record.Title,
+			ChapterID:   e.ID,
+			Title:       e.Title,
+			Downloaded:  downloaded,
+		})
+	}
+	fmt.Printf("警告: 《%s》有 %d 个章节从目录中消失，可能已被站点删除，请检查；已下载的章节不会从漫画库中删除\n",
+		record.Title, len(d.removed))
+}
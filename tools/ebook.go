@@ -2,25 +2,102 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
+	"html"
 	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 	"text/template"
+	"time"
 )
 
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("使用方法:")
 		fmt.Println("  打包漫画为电子书: ebook <漫画目录>")
+		fmt.Println("  增量更新已有电子书: ebook --update <漫画目录>")
+		fmt.Println("  加密电子书: ebook --encrypt --password <密码> <漫画目录>")
+		fmt.Println("  打包漫画库中的漫画: ebook --out /path/to/library <漫画目录>")
+		fmt.Println("  不使用章节文件夹（兼容忽略文件夹的阅读器）: ebook --flat <漫画目录>")
+		fmt.Println("  生成EPUB（带页码列表和地标）: ebook --epub <漫画目录>")
+		fmt.Println("  指定元数据: ebook --language zh --writer <作者> --publisher <出版社> --age-rating <分级> <漫画目录>")
+		fmt.Println("  密码也可以通过环境变量 COMICBOX_PASSWORD 提供，漫画库根目录可以通过 COMICBOX_OUT 提供")
 		fmt.Println("  例如: ebook '秘密教学'")
 		return
 	}
 
-	comicDir := os.Args[1]
+	loadTemplateConfig()
+
+	update := false
+	encrypt := false
+	password := ""
+	libraryRoot := ""
+	comicDir := ""
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--update", "-u":
+			update = true
+		case "--encrypt":
+			encrypt = true
+		case "--flat":
+			flatLayout = true
+		case "--epub":
+			epubOutput = true
+		case "--password":
+			if i+1 < len(args) {
+				password = args[i+1]
+				i++
+			}
+		case "--out":
+			if i+1 < len(args) {
+				libraryRoot = args[i+1]
+				i++
+			}
+		case "--language", "--writer", "--publisher", "--age-rating":
+			if i+1 < len(args) {
+				setMetadataFlag(args[i], args[i+1])
+				i++
+			}
+		default:
+			comicDir = args[i]
+		}
+	}
+	if comicDir == "" {
+		fmt.Println("请指定漫画目录")
+		return
+	}
+
+	// 相对路径按漫画库根目录解析，电子书保存在漫画目录旁边
+	if libraryRoot == "" {
+		libraryRoot = os.Getenv("COMICBOX_OUT")
+	}
+	if libraryRoot != "" && !filepath.IsAbs(comicDir) {
+		comicDir = filepath.Join(libraryRoot, comicDir)
+	}
+
+	if encrypt {
+		if password == "" {
+			password = os.Getenv("COMICBOX_PASSWORD")
+		}
+		if password == "" {
+			fmt.Println("加密电子书需要通过 --password 或环境变量 COMICBOX_PASSWORD 指定密码")
+			return
+		}
+		archivePassword = password
+	}
 	
 	// 检查漫画目录是否存在
 	if _, err := os.Stat(comicDir); os.IsNotExist(err) {
@@ -28,6 +105,29 @@ func main() {
 		return
 	}
 
+	if epubOutput {
+		if update || encrypt {
+			fmt.Println("--epub 不能与 --update 或 --encrypt 一起使用")
+			return
+		}
+		if err := createEPUB(comicDir); err != nil {
+			fmt.Printf("创建电子书失败: %v\n", err)
+			return
+		}
+		fmt.Printf("成功创建电子书: %s.epub\n", comicDir)
+		return
+	}
+
+	if update {
+		err := updateEbook(comicDir)
+		if err != nil {
+			fmt.Printf("更新电子书失败: %v\n", err)
+			return
+		}
+		fmt.Printf("成功更新电子书: %s.cbz\n", comicDir)
+		return
+	}
+
 	// 创建电子书
 	err := createEbook(comicDir)
 	if err != nil {
@@ -79,10 +179,245 @@ func createEbook(comicDir string) error {
 	return nil
 }
 
+// updateEbook 增量更新已有的电子书：只追加新章节，已有章节发生变化时重新生成
+func updateEbook(comicDir string) error {
+	outputFile := comicDir + ".cbz"
+	if _, err := os.Stat(outputFile); os.IsNotExist(err) {
+		return createEbook(comicDir)
+	}
+
+	comicInfo, err := getComicInfo(comicDir)
+	if err != nil {
+		return fmt.Errorf("获取漫画信息失败: %v", err)
+	}
+
+	oldInfo, encrypted, err := readArchiveComicInfo(outputFile)
+	if encrypted && err != nil {
+		return fmt.Errorf("读取加密的电子书失败: %v", err)
+	}
+	if err != nil {
+		fmt.Printf("读取已有电子书失败，重新生成: %v\n", err)
+		return createEbook(comicDir)
+	}
+	if encrypted != (archivePassword != "") {
+		fmt.Println("加密设置与已有电子书不同，重新生成电子书")
+		return createEbook(comicDir)
+	}
+	if oldInfo.Flat != comicInfo.Flat {
+		fmt.Println("文件夹设置（--flat）与已有电子书不同，重新生成电子书")
+		return createEbook(comicDir)
+	}
+	if !isChapterPrefix(oldInfo.Chapters, comicInfo.Chapters) {
+		fmt.Println("已有章节发生变化，重新生成电子书")
+		return createEbook(comicDir)
+	}
+	if oldInfo.bookMetadata != comicInfo.bookMetadata {
+		fmt.Println("语言、作者等信息发生变化，重新生成电子书")
+		return createEbook(comicDir)
+	}
+
+	newChapters := comicInfo.Chapters[len(oldInfo.Chapters):]
+	if len(newChapters) == 0 {
+		fmt.Println("电子书已是最新，没有新章节")
+		return nil
+	}
+
+	err = appendChapters(outputFile, comicDir, comicInfo, newChapters)
+	if err != nil {
+		return fmt.Errorf("追加章节失败: %v", err)
+	}
+	fmt.Printf("追加了 %d 个新章节\n", len(newChapters))
+	return nil
+}
+
+// readArchiveComicInfo 读取已有电子书中的 comic.json，并返回其是否加密
+func readArchiveComicInfo(path string) (ComicInfo, bool, error) {
+	var comicInfo ComicInfo
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return comicInfo, false, err
+	}
+	defer reader.Close()
+
+	for _, f := range reader.File {
+		if f.Name != "comic.json" {
+			continue
+		}
+		encrypted := f.Method == aesMethod
+		data, err := readZipEntry(f)
+		if err != nil {
+			return comicInfo, encrypted, err
+		}
+		err = json.Unmarshal(data, &comicInfo)
+		return comicInfo, encrypted, err
+	}
+	return comicInfo, false, fmt.Errorf("电子书中没有 comic.json")
+}
+
+// isChapterPrefix 检查已打包的章节是否与当前目录的前几个章节完全一致
+func isChapterPrefix(old, current []Chapter) bool {
+	if len(old) > len(current) {
+		return false
+	}
+	for i, chapter := range old {
+		c := current[i]
+		if chapter.DirName != c.DirName || chapter.Title != c.Title || chapter.ImageCount != c.ImageCount {
+			return false
+		}
+		// 旧版本生成的 comic.json 没有 first_page 字段
+		if chapter.FirstPage != "" && chapter.FirstPage != c.FirstPage {
+			return false
+		}
+		// 缩略图写在章节旁边，新生成缩略图后需要重新生成
+		if chapter.Thumb != c.Thumb {
+			return false
+		}
+	}
+	return true
+}
+
+// appendChapters 将新章节追加到已有电子书：在同一目录的临时文件中写入新的电子书后替换原文件，
+// 已有的图片按原样复制（不重新压缩或加密），旧的 comic.json 和 toc.html 被新生成的替换而不是留在文件中，
+// 出错或中断时原电子书不受影响
+func appendChapters(outputFile, comicDir string, comicInfo ComicInfo, chapters []Chapter) error {
+	reader, err := zip.OpenReader(outputFile)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(outputFile), "."+filepath.Base(outputFile)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	zipWriter := zip.NewWriter(tmp)
+	if err := zipWriter.SetComment(reader.Comment); err != nil {
+		return err
+	}
+	if err := addComicInfoToZip(zipWriter, comicInfo); err != nil {
+		return err
+	}
+	if err := addTOCFileToZip(zipWriter, comicInfo); err != nil {
+		return err
+	}
+	for _, f := range reader.File {
+		if f.Name == "comic.json" || f.Name == "toc.html" {
+			continue
+		}
+		if err := zipWriter.Copy(f); err != nil {
+			return fmt.Errorf("复制 %s 失败: %v", f.Name, err)
+		}
+	}
+	err = addChaptersToZip(zipWriter, comicDir, ComicInfo{Title: comicInfo.Title, Chapters: chapters})
+	if err != nil {
+		return err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	reader.Close()
+	return os.Rename(tmp.Name(), outputFile)
+}
+
 // ComicInfo 漫画信息结构
 type ComicInfo struct {
 	Title    string     `json:"title"`
 	Chapters []Chapter  `json:"chapters"`
+	Flat     bool       `json:"flat,omitempty"` // 图片不放在章节文件夹中，文件名以章节目录名开头
+	bookMetadata
+}
+
+// flatLayout 所有图片放在压缩包的根目录，文件名加上章节前缀（如 001-秘密教学-0001.jpg），
+// 兼容忽略文件夹、只按文件名排序的阅读器；不打包缩略图，避免被当作漫画页
+var flatLayout bool
+
+// zipImagePath 章节图片在电子书中的路径，默认为"章节目录/文件名"
+func zipImagePath(dirName, name string) string {
+	if flatLayout {
+		return strings.Replace(dirName, "_", "-", 1) + "-" + name
+	}
+	return dirName + "/" + name
+}
+
+// bookMetadata 语言、作者等出版信息，来自下载器写入的 series.json 和命令行参数
+type bookMetadata struct {
+	Language  string `json:"language,omitempty"`
+	Writer    string `json:"writer,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	AgeRating string `json:"age_rating,omitempty"`
+}
+
+// metadataFlags 命令行指定的出版信息，覆盖 series.json 中的值
+var metadataFlags bookMetadata
+
+// setMetadataFlag 根据参数名设置出版信息
+func setMetadataFlag(flag, value string) {
+	switch flag {
+	case "--language":
+		metadataFlags.Language = value
+	case "--writer":
+		metadataFlags.Writer = value
+	case "--publisher":
+		metadataFlags.Publisher = value
+	case "--age-rating":
+		metadataFlags.AgeRating = value
+	}
+}
+
+// readBookMetadata 读取漫画目录中 series.json 的出版信息，并用命令行参数覆盖
+func readBookMetadata(comicDir string) bookMetadata {
+	var m bookMetadata
+	if data, err := os.ReadFile(filepath.Join(comicDir, "series.json")); err == nil {
+		json.Unmarshal(data, &m)
+	}
+	if metadataFlags.Language != "" {
+		m.Language = metadataFlags.Language
+	}
+	if metadataFlags.Writer != "" {
+		m.Writer = metadataFlags.Writer
+	}
+	if metadataFlags.Publisher != "" {
+		m.Publisher = metadataFlags.Publisher
+	}
+	if metadataFlags.AgeRating != "" {
+		m.AgeRating = metadataFlags.AgeRating
+	}
+	return m
+}
+
+// chapterJSON 下载器写入章节目录的 chapter.json 中生成电子书时用到的字段
+type chapterJSON struct {
+	Cover     string `json:"cover"`
+	Published string `json:"published"` // 下载时指定了 --extras 才有
+	Notes     string `json:"notes"`
+}
+
+// readChapterJSON 读取章节目录中的 chapter.json，不存在时返回空值
+func readChapterJSON(chapterDir string) chapterJSON {
+	var meta chapterJSON
+	if data, err := os.ReadFile(filepath.Join(chapterDir, "chapter.json")); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	return meta
+}
+
+// chapterCover chapter.json 记录的封面，封面不在章节的图片中时返回空，目录中使用第一页
+func chapterCover(meta chapterJSON, images []os.DirEntry) string {
+	for _, img := range images {
+		if meta.Cover != "" && img.Name() == meta.Cover {
+			return meta.Cover
+		}
+	}
+	return ""
 }
 
 // Chapter 章节信息结构
@@ -92,12 +427,22 @@ type Chapter struct {
 	DirName   string `json:"dir_name"`
 	ImageCount int   `json:"image_count"`
 	StartPage int   `json:"start_page"`
+	FirstPage string `json:"first_page"`
+	Thumb     string `json:"thumb,omitempty"` // 缩略图在电子书中的路径，漫画目录中没有缩略图时为空
+	Cover     string `json:"cover,omitempty"` // 下载器挑选的章节封面，跳过了开头的空白页和广告页
+	Published string `json:"published,omitempty"` // 章节的更新日期，下载时指定了 --extras 才有
+	Notes     string `json:"notes,omitempty"`     // 作者的话，下载时指定了 --extras 才有
 }
 
+// thumbDirName 下载器在漫画目录中缓存缩略图的目录（comicbox thumbs 生成）
+const thumbDirName = ".thumbs"
+
 // getComicInfo 获取漫画信息
 func getComicInfo(comicDir string) (ComicInfo, error) {
 	var comicInfo ComicInfo
 	comicInfo.Title = filepath.Base(comicDir)
+	comicInfo.Flat = flatLayout
+	comicInfo.bookMetadata = readBookMetadata(comicDir)
 
 	// 获取所有章节目录
 	entries, err := os.ReadDir(comicDir)
@@ -107,18 +452,20 @@ func getComicInfo(comicDir string) (ComicInfo, error) {
 
 	pageCounter := 1
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		// 跳过 .thumbs 等隐藏目录
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
 			continue
 		}
 
 		chapterDir := filepath.Join(comicDir, entry.Name())
 		chapterName := entry.Name()
 		
-		// 获取章节中的图片数量
-		imageCount, err := countImages(chapterDir)
-		if err != nil {
+		// 获取章节中的图片
+		images, err := getImages(chapterDir)
+		if err != nil || len(images) == 0 {
 			continue
 		}
+		imageCount := len(images)
 
 		// 提取章节ID和标题
 		var chapterID, chapterTitle string
@@ -137,6 +484,13 @@ func getComicInfo(comicDir string) (ComicInfo, error) {
 			DirName:    chapterName,
 			ImageCount: imageCount,
 			StartPage:  pageCounter,
+			FirstPage:  images[0].Name(),
+		}
+		meta := readChapterJSON(chapterDir)
+		chapter.Cover = chapterCover(meta, images)
+		chapter.Published, chapter.Notes = meta.Published, meta.Notes
+		if _, err := os.Stat(filepath.Join(comicDir, thumbDirName, chapterName+".jpg")); err == nil && !flatLayout {
+			chapter.Thumb = "thumbs/" + chapterName + ".jpg"
 		}
 
 		comicInfo.Chapters = append(comicInfo.Chapters, chapter)
@@ -145,9 +499,16 @@ func getComicInfo(comicDir string) (ComicInfo, error) {
 
 	// 按章节ID排序
 	sort.Slice(comicInfo.Chapters, func(i, j int) bool {
-		return comicInfo.Chapters[i].ID < comicInfo.Chapters[j].ID
+		return naturalLess(comicInfo.Chapters[i].ID, comicInfo.Chapters[j].ID)
 	})
 
+	// 按排序后的顺序计算每个章节的起始页
+	pageCounter = 1
+	for i := range comicInfo.Chapters {
+		comicInfo.Chapters[i].StartPage = pageCounter
+		pageCounter += comicInfo.Chapters[i].ImageCount
+	}
+
 	return comicInfo, nil
 }
 
@@ -166,7 +527,8 @@ func countImages(dir string) (int, error) {
 		
 		name := strings.ToLower(entry.Name())
 		if strings.HasSuffix(name, ".jpg") || strings.HasSuffix(name, ".jpeg") ||
-		   strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".gif") {
+		   strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".gif") ||
+		   strings.HasSuffix(name, ".webp") {
 			count++
 		}
 	}
@@ -176,12 +538,19 @@ func countImages(dir string) (int, error) {
 
 // addComicInfoToZip 添加漫画信息到zip
 func addComicInfoToZip(zipWriter *zip.Writer, comicInfo ComicInfo) error {
-	// 创建comic.json文件
+	// 创建comic.json文件，配置了模板时按模板生成
 	jsonData, err := json.MarshalIndent(comicInfo, "", "  ")
+	if templates.ComicJSON != "" {
+		jsonData, err = renderTemplate(templates.ComicJSON, comicInfo)
+	}
 	if err != nil {
 		return err
 	}
 
+	if archivePassword != "" {
+		return addEncryptedData(zipWriter, "comic.json", jsonData, time.Now())
+	}
+
 	// 添加到zip
 	writer, err := zipWriter.Create("comic.json")
 	if err != nil {
@@ -196,10 +565,13 @@ func addComicInfoToZip(zipWriter *zip.Writer, comicInfo ComicInfo) error {
 func addTOCFileToZip(zipWriter *zip.Writer, comicInfo ComicInfo) error {
 	tocTemplate := `
 <!DOCTYPE html>
-<html>
+<html{{if .Language}} lang="{{.Language}}"{{end}}>
 <head>
     <meta charset="UTF-8">
     <title>{{.Title}} - 目录</title>
+    {{if .Writer}}<meta name="author" content="{{.Writer}}">{{end}}
+    {{if .Publisher}}<meta name="publisher" content="{{.Publisher}}">{{end}}
+    {{if .AgeRating}}<meta name="rating" content="{{.AgeRating}}">{{end}}
     <style>
         body { font-family: Arial, sans-serif; margin: 40px; }
         h1 { color: #333; }
@@ -208,6 +580,9 @@ func addTOCFileToZip(zipWriter *zip.Writer, comicInfo ComicInfo) error {
         a { text-decoration: none; color: #007bff; }
         a:hover { text-decoration: underline; }
         .chapter-info { color: #666; font-size: 0.9em; }
+        .chapter-notes { color: #444; font-size: 0.9em; white-space: pre-line; margin-top: 6px; }
+        li img { float: left; width: 60px; margin-right: 12px; }
+        li::after { content: ""; display: block; clear: both; }
     </style>
 </head>
 <body>
@@ -216,8 +591,10 @@ func addTOCFileToZip(zipWriter *zip.Writer, comicInfo ComicInfo) error {
     <ul>
         {{range .Chapters}}
         <li>
-            <a href="{{.DirName}}/0001.jpg">{{.Title}}</a>
-            <div class="chapter-info">{{.ImageCount}} 页</div>
+            {{if .Thumb}}<a href="{{page .DirName .FirstPage}}"><img src="{{.Thumb}}" alt=""></a>{{else}}<a href="{{page .DirName .FirstPage}}"><img src="{{page .DirName (or .Cover .FirstPage)}}" alt=""></a>{{end}}
+            <a href="{{page .DirName .FirstPage}}">{{.Title}}</a>
+            <div class="chapter-info">{{.ImageCount}} 页{{if .Published}} · {{html .Published}} 更新{{end}}</div>
+            {{if .Notes}}<div class="chapter-notes">{{html .Notes}}</div>{{end}}
         </li>
         {{end}}
     </ul>
@@ -225,17 +602,71 @@ func addTOCFileToZip(zipWriter *zip.Writer, comicInfo ComicInfo) error {
 </html>
 `
 
-	tmpl, err := template.New("toc").Parse(tocTemplate)
+	// 配置了模板时按模板生成
+	tmpl, err := template.New("toc").Funcs(templateFuncs).Parse(tocTemplate)
+	if templates.TOC != "" {
+		tmpl, err = template.New(filepath.Base(templates.TOC)).Funcs(templateFuncs).ParseFiles(templates.TOC)
+	}
 	if err != nil {
 		return err
 	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, comicInfo); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+
+	if archivePassword != "" {
+		return addEncryptedData(zipWriter, "toc.html", data, time.Now())
+	}
 
 	writer, err := zipWriter.Create("toc.html")
 	if err != nil {
 		return err
 	}
+	_, err = writer.Write(data)
+	return err
+}
+
+// templateConfig 配置文件 .comicbox/config.json 的 templates 中电子书用到的字段：代替内置输出格式的 Go 模板文件
+type templateConfig struct {
+	TOC       string `json:"toc"`        // toc.html 的模板
+	ComicJSON string `json:"comic_json"` // comic.json 的模板
+}
+
+// templates 从配置文件读取的模板设置，没有配置文件时使用内置格式
+var templates templateConfig
+
+// loadTemplateConfig 读取当前目录下 .comicbox/config.json 中的模板设置
+func loadTemplateConfig() {
+	var cfg struct {
+		Templates templateConfig `json:"templates"`
+	}
+	if data, err := os.ReadFile(filepath.Join(".comicbox", "config.json")); err == nil && json.Unmarshal(data, &cfg) == nil {
+		templates = cfg.Templates
+	}
+}
+
+// templateFuncs 目录和自定义模板中可以使用的函数：page 返回章节图片在电子书中的路径，json 输出 JSON
+var templateFuncs = template.FuncMap{
+	"page": zipImagePath,
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
 
-	return tmpl.Execute(writer, comicInfo)
+// renderTemplate 用配置的模板文件和漫画信息生成文件内容
+func renderTemplate(file string, comicInfo ComicInfo) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(file)).Funcs(templateFuncs).ParseFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, comicInfo); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
 }
 
 // addChaptersToZip 添加所有章节到zip
@@ -252,13 +683,21 @@ func addChaptersToZip(zipWriter *zip.Writer, comicDir string, comicInfo ComicInf
 		// 按顺序添加图片到zip
 		for _, image := range images {
 			imagePath := filepath.Join(chapterDir, image.Name())
-			zipPath := filepath.Join(chapter.DirName, image.Name())
+			zipPath := zipImagePath(chapter.DirName, image.Name())
 			
 			err := addFileToZip(zipWriter, imagePath, zipPath)
 			if err != nil {
 				return fmt.Errorf("添加图片失败 %s: %v", imagePath, err)
 			}
 		}
+
+		// 目录页使用的缩略图
+		if chapter.Thumb != "" {
+			thumbPath := filepath.Join(comicDir, thumbDirName, chapter.DirName+".jpg")
+			if err := addFileToZip(zipWriter, thumbPath, chapter.Thumb); err != nil {
+				return fmt.Errorf("添加缩略图失败 %s: %v", thumbPath, err)
+			}
+		}
 	}
 
 	return nil
@@ -279,14 +718,15 @@ func getImages(dir string) ([]os.DirEntry, error) {
 		
 		name := strings.ToLower(entry.Name())
 		if strings.HasSuffix(name, ".jpg") || strings.HasSuffix(name, ".jpeg") ||
-		   strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".gif") {
+		   strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".gif") ||
+		   strings.HasSuffix(name, ".webp") {
 			images = append(images, entry)
 		}
 	}
 
-	// 按文件名排序
+	// 按文件名自然排序，兼容不同的页码位数和起始页码
 	sort.Slice(images, func(i, j int) bool {
-		return images[i].Name() < images[j].Name()
+		return naturalLess(images[i].Name(), images[j].Name())
 	})
 
 	return images, nil
@@ -294,6 +734,18 @@ func getImages(dir string) ([]os.DirEntry, error) {
 
 // addFileToZip 将文件添加到zip归档
 func addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) error {
+	if archivePassword != "" {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		return addEncryptedData(zipWriter, zipPath, data, info.ModTime())
+	}
+
 	// 打开要添加的文件
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -323,4 +775,469 @@ func addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) error {
 	// 复制文件内容
 	_, err = io.Copy(writer, file)
 	return err
-}
\ No newline at end of file
+}
+
+// naturalLess 按自然顺序比较文件名，数字部分按数值比较（如 2.jpg 排在 10.jpg 之前）
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na, nb := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// isDigit 检查字节是否为数字
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// WinZip AES 加密（AE-2，AES-256），7-Zip、WinRAR、WinZip 等均可解压
+const (
+	aesMethod     = 99
+	aesStrength   = 3
+	aesIterations = 1000
+	aesMACSize    = 10
+)
+
+// archivePassword 加密压缩包使用的密码，为空时不加密
+var archivePassword string
+
+// addEncryptedData 压缩并加密数据后写入zip
+func addEncryptedData(zipWriter *zip.Writer, name string, data []byte, modified time.Time) error {
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+
+	encrypted, err := encryptAES(compressed.Bytes(), archivePassword)
+	if err != nil {
+		return err
+	}
+
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             aesMethod,
+		CreatorVersion:     51,
+		ReaderVersion:      51,
+		Flags:              0x1,
+		UncompressedSize64: uint64(len(data)),
+		CompressedSize64:   uint64(len(encrypted)),
+		// AES 扩展字段：厂商版本 AE-2、"AE"、密钥强度、实际压缩方法
+		Extra: []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', aesStrength, byte(zip.Deflate), 0},
+	}
+	if !isASCII(name) {
+		header.Flags |= 0x800
+	}
+	header.SetModTime(modified)
+
+	writer, err := zipWriter.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(encrypted)
+	return err
+}
+
+// encryptAES 按 WinZip AES 格式加密：盐值 + 密码校验值 + 密文 + HMAC
+func encryptAES(data []byte, password string) ([]byte, error) {
+	keySize := 8 * (aesStrength + 1)
+	salt := make([]byte, keySize/2)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := pbkdf2.Key(sha1.New, password, salt, aesIterations, 2*keySize+2)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := winzipCTR(key[:keySize], data)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, key[keySize:2*keySize])
+	mac.Write(body)
+
+	out := append(salt, key[2*keySize:]...)
+	out = append(out, body...)
+	return append(out, mac.Sum(nil)[:aesMACSize]...), nil
+}
+
+// decryptAES 解密 WinZip AES 数据，并校验密码和 HMAC
+func decryptAES(data []byte, password string, strength byte) ([]byte, error) {
+	keySize := 8 * (int(strength) + 1)
+	saltSize := keySize / 2
+	if strength < 1 || strength > 3 || len(data) < saltSize+2+aesMACSize {
+		return nil, fmt.Errorf("加密数据不完整")
+	}
+	key, err := pbkdf2.Key(sha1.New, password, data[:saltSize], aesIterations, 2*keySize+2)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(key[2*keySize:], data[saltSize:saltSize+2]) {
+		return nil, fmt.Errorf("密码错误")
+	}
+
+	body := data[saltSize+2 : len(data)-aesMACSize]
+	mac := hmac.New(sha1.New, key[keySize:2*keySize])
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil)[:aesMACSize], data[len(data)-aesMACSize:]) {
+		return nil, fmt.Errorf("数据校验失败")
+	}
+	return winzipCTR(key[:keySize], body)
+}
+
+// winzipCTR AES-CTR 加解密，WinZip 的计数器为小端序且从 1 开始
+func winzipCTR(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	var counter, stream [aes.BlockSize]byte
+	for i := 0; i < len(data); i += aes.BlockSize {
+		for j := range counter {
+			counter[j]++
+			if counter[j] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < len(data) && j < i+aes.BlockSize; j++ {
+			out[j] = data[j] ^ stream[j-i]
+		}
+	}
+	return out, nil
+}
+
+// readZipEntry 读取zip中的文件内容，AES 加密的文件使用 archivePassword 解密
+func readZipEntry(f *zip.File) ([]byte, error) {
+	if f.Method != aesMethod {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	if archivePassword == "" {
+		return nil, fmt.Errorf("文件已加密，需要密码")
+	}
+	strength, method, ok := parseAESExtra(f.Extra)
+	if !ok {
+		return nil, fmt.Errorf("无效的 AES 扩展字段")
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(raw)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptAES(data, archivePassword, strength)
+	if err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case zip.Store:
+	case zip.Deflate:
+		plain, err = io.ReadAll(flate.NewReader(bytes.NewReader(plain)))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的压缩方法: %d", method)
+	}
+
+	// AE-1 格式保留了 CRC，AE-2 的 CRC 为 0
+	if f.CRC32 != 0 && crc32.ChecksumIEEE(plain) != f.CRC32 {
+		return nil, fmt.Errorf("CRC 校验失败")
+	}
+	return plain, nil
+}
+
+// parseAESExtra 从扩展字段中解析 AES 密钥强度和实际压缩方法
+func parseAESExtra(extra []byte) (byte, uint16, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+		if id == 0x9901 && size >= 7 {
+			return extra[8], binary.LittleEndian.Uint16(extra[9:]), true
+		}
+		extra = extra[4+size:]
+	}
+	return 0, 0, false
+}
+
+// isASCII 检查字符串是否只包含 ASCII 字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// epubOutput 生成EPUB电子书而不是CBZ（--epub）
+var epubOutput bool
+
+// epubPage EPUB中的一页：图片和显示它的XHTML页面
+type epubPage struct {
+	Number int    // 整本书中的页码，页码列表和分页标记使用
+	Source string // 漫画目录中的图片文件
+	Image  string // 图片在 OEBPS 目录中的路径
+	XHTML  string // 页面在 OEBPS 目录中的路径
+	Alt    string // 图片的替代文字：章节标题和章节中的页码
+}
+
+// epubMediaTypes 图片扩展名对应的媒体类型
+var epubMediaTypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+}
+
+// epubContainer META-INF/container.xml，指向包文档
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// epubStyle 每页只显示一张图片，缩放到屏幕内
+const epubStyle = `body { margin: 0; padding: 0; text-align: center; }
+img { max-width: 100%; max-height: 100vh; }
+`
+
+// createEPUB 将漫画目录打包成EPUB 3电子书，每张图片一个XHTML页面
+// 图片的替代文字为章节标题和页码，导航文档中除章节目录外还有页码列表（page-list）和地标（landmarks），
+// 生成的文件可以通过 epubcheck 检查
+func createEPUB(comicDir string) error {
+	comicInfo, err := getComicInfo(comicDir)
+	if err != nil {
+		return fmt.Errorf("获取漫画信息失败: %v", err)
+	}
+	if len(comicInfo.Chapters) == 0 {
+		return fmt.Errorf("漫画目录中没有任何章节")
+	}
+
+	// 文件名只用序号，避免章节标题中的空格和特殊字符出现在链接中
+	var pages []epubPage
+	chapterPages := make([]string, len(comicInfo.Chapters))
+	for i, chapter := range comicInfo.Chapters {
+		images, err := getImages(filepath.Join(comicDir, chapter.DirName))
+		if err != nil {
+			return err
+		}
+		for j, image := range images {
+			name := fmt.Sprintf("c%03d-p%04d", i+1, j+1)
+			pages = append(pages, epubPage{
+				Number: len(pages) + 1,
+				Source: filepath.Join(comicDir, chapter.DirName, image.Name()),
+				Image:  "images/" + name + strings.ToLower(filepath.Ext(image.Name())),
+				XHTML:  "pages/" + name + ".xhtml",
+				Alt:    fmt.Sprintf("%s 第%d页", chapter.Title, j+1),
+			})
+			if j == 0 {
+				chapterPages[i] = pages[len(pages)-1].XHTML
+			}
+		}
+	}
+
+	file, err := os.Create(comicDir + ".epub")
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %v", err)
+	}
+	defer file.Close()
+	zipWriter := zip.NewWriter(file)
+	defer zipWriter.Close()
+
+	// mimetype 必须是第一个文件，并且不压缩
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(writer, "application/epub+zip"); err != nil {
+		return err
+	}
+
+	if err := addTextToZip(zipWriter, "META-INF/container.xml", epubContainer); err != nil {
+		return err
+	}
+	if err := addTextToZip(zipWriter, "OEBPS/content.opf", epubPackage(comicInfo, pages)); err != nil {
+		return err
+	}
+	if err := addTextToZip(zipWriter, "OEBPS/nav.xhtml", epubNav(comicInfo, pages, chapterPages)); err != nil {
+		return err
+	}
+	if err := addTextToZip(zipWriter, "OEBPS/style.css", epubStyle); err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if err := addTextToZip(zipWriter, "OEBPS/"+page.XHTML, epubPageXHTML(comicInfo, page)); err != nil {
+			return err
+		}
+		if err := addFileToZip(zipWriter, page.Source, "OEBPS/"+page.Image); err != nil {
+			return fmt.Errorf("添加图片失败 %s: %v", page.Source, err)
+		}
+	}
+	return nil
+}
+
+// addTextToZip 将文本内容作为文件添加到zip
+func addTextToZip(zipWriter *zip.Writer, name, content string) error {
+	writer, err := zipWriter.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(writer, content)
+	return err
+}
+
+// epubLanguage 电子书的语言，没有设置时为中文（EPUB要求必须有 dc:language）
+func epubLanguage(comicInfo ComicInfo) string {
+	if comicInfo.Language != "" {
+		return comicInfo.Language
+	}
+	return "zh"
+}
+
+// epubIdentifier 按漫画标题生成的 urn:uuid，重新生成同一部漫画的电子书时保持不变
+func epubIdentifier(title string) string {
+	h := sha1.Sum([]byte(title))
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", h[0:4], h[4:6], h[6:8], h[8:10], h[10:16])
+}
+
+// epubPackage 生成包文档 content.opf：元数据、清单和阅读顺序
+func epubPackage(comicInfo ComicInfo, pages []epubPage) string {
+	var b strings.Builder
+	lang := html.EscapeString(epubLanguage(comicInfo))
+	fmt.Fprintf(&b, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&b, "<package xmlns=\"http://www.idpf.org/2007/opf\" version=\"3.0\" unique-identifier=\"bookid\" xml:lang=\"%s\">\n", lang)
+	fmt.Fprintf(&b, "  <metadata xmlns:dc=\"http://purl.org/dc/elements/1.1/\">\n")
+	fmt.Fprintf(&b, "    <dc:identifier id=\"bookid\">%s</dc:identifier>\n", epubIdentifier(comicInfo.Title))
+	fmt.Fprintf(&b, "    <dc:title>%s</dc:title>\n", html.EscapeString(comicInfo.Title))
+	fmt.Fprintf(&b, "    <dc:language>%s</dc:language>\n", lang)
+	if comicInfo.Writer != "" {
+		fmt.Fprintf(&b, "    <dc:creator>%s</dc:creator>\n", html.EscapeString(comicInfo.Writer))
+	}
+	if comicInfo.Publisher != "" {
+		fmt.Fprintf(&b, "    <dc:publisher>%s</dc:publisher>\n", html.EscapeString(comicInfo.Publisher))
+	}
+	fmt.Fprintf(&b, "    <meta property=\"dcterms:modified\">%s</meta>\n", time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+	// 无障碍元数据：漫画只能通过图片阅读，替代文字只有章节和页码，不描述画面内容
+	fmt.Fprintf(&b, "    <meta property=\"schema:accessMode\">visual</meta>\n")
+	fmt.Fprintf(&b, "    <meta property=\"schema:accessModeSufficient\">visual</meta>\n")
+	fmt.Fprintf(&b, "    <meta property=\"schema:accessibilityFeature\">structuralNavigation</meta>\n")
+	fmt.Fprintf(&b, "    <meta property=\"schema:accessibilityFeature\">pageNavigation</meta>\n")
+	fmt.Fprintf(&b, "    <meta property=\"schema:accessibilitySummary\">漫画图片，每页的替代文字为章节标题和页码，不含画面描述。</meta>\n")
+	fmt.Fprintf(&b, "  </metadata>\n")
+
+	fmt.Fprintf(&b, "  <manifest>\n")
+	fmt.Fprintf(&b, "    <item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	fmt.Fprintf(&b, "    <item id=\"style\" href=\"style.css\" media-type=\"text/css\"/>\n")
+	for i, page := range pages {
+		properties := ""
+		if i == 0 {
+			properties = ` properties="cover-image"`
+		}
+		fmt.Fprintf(&b, "    <item id=\"img%04d\" href=\"%s\" media-type=\"%s\"%s/>\n", page.Number, page.Image, epubMediaTypes[filepath.Ext(page.Image)], properties)
+		fmt.Fprintf(&b, "    <item id=\"page%04d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", page.Number, page.XHTML)
+	}
+	fmt.Fprintf(&b, "  </manifest>\n")
+
+	fmt.Fprintf(&b, "  <spine>\n")
+	for _, page := range pages {
+		fmt.Fprintf(&b, "    <itemref idref=\"page%04d\"/>\n", page.Number)
+	}
+	fmt.Fprintf(&b, "  </spine>\n")
+	fmt.Fprintf(&b, "</package>\n")
+	return b.String()
+}
+
+// epubXHTMLHeader XHTML文档的开头，到 <body> 为止
+func epubXHTMLHeader(b *strings.Builder, comicInfo ComicInfo, title, stylesheet string) {
+	lang := html.EscapeString(epubLanguage(comicInfo))
+	fmt.Fprintf(b, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<!DOCTYPE html>\n")
+	fmt.Fprintf(b, "<html xmlns=\"http://www.w3.org/1999/xhtml\" xmlns:epub=\"http://www.idpf.org/2007/ops\" lang=\"%s\" xml:lang=\"%s\">\n", lang, lang)
+	fmt.Fprintf(b, "<head>\n  <meta charset=\"UTF-8\"/>\n  <title>%s</title>\n", html.EscapeString(title))
+	if stylesheet != "" {
+		fmt.Fprintf(b, "  <link rel=\"stylesheet\" type=\"text/css\" href=\"%s\"/>\n", stylesheet)
+	}
+	fmt.Fprintf(b, "</head>\n<body>\n")
+}
+
+// epubNav 生成导航文档 nav.xhtml：章节目录、页码列表和地标
+// 页码列表指向每页的分页标记，地标标出封面、目录和正文的开始
+func epubNav(comicInfo ComicInfo, pages []epubPage, chapterPages []string) string {
+	var b strings.Builder
+	epubXHTMLHeader(&b, comicInfo, comicInfo.Title, "")
+
+	fmt.Fprintf(&b, "<nav epub:type=\"toc\" id=\"toc\" role=\"doc-toc\">\n  <h1>%s</h1>\n  <ol>\n", html.EscapeString(comicInfo.Title))
+	for i, chapter := range comicInfo.Chapters {
+		fmt.Fprintf(&b, "    <li><a href=\"%s\">%s</a></li>\n", chapterPages[i], html.EscapeString(chapter.Title))
+	}
+	fmt.Fprintf(&b, "  </ol>\n</nav>\n")
+
+	fmt.Fprintf(&b, "<nav epub:type=\"page-list\" id=\"page-list\" role=\"doc-pagelist\" hidden=\"hidden\">\n  <h2>页码</h2>\n  <ol>\n")
+	for _, page := range pages {
+		fmt.Fprintf(&b, "    <li><a href=\"%s#page%d\">%d</a></li>\n", page.XHTML, page.Number, page.Number)
+	}
+	fmt.Fprintf(&b, "  </ol>\n</nav>\n")
+
+	fmt.Fprintf(&b, "<nav epub:type=\"landmarks\" id=\"landmarks\" hidden=\"hidden\">\n  <h2>地标</h2>\n  <ol>\n")
+	fmt.Fprintf(&b, "    <li><a epub:type=\"cover\" href=\"%s\">封面</a></li>\n", pages[0].XHTML)
+	fmt.Fprintf(&b, "    <li><a epub:type=\"toc\" href=\"nav.xhtml#toc\">目录</a></li>\n")
+	fmt.Fprintf(&b, "    <li><a epub:type=\"bodymatter\" href=\"%s\">正文</a></li>\n", pages[0].XHTML)
+	fmt.Fprintf(&b, "  </ol>\n</nav>\n")
+
+	fmt.Fprintf(&b, "</body>\n</html>\n")
+	return b.String()
+}
+
+// epubPageXHTML 生成显示一张图片的页面，带分页标记和替代文字
+func epubPageXHTML(comicInfo ComicInfo, page epubPage) string {
+	var b strings.Builder
+	epubXHTMLHeader(&b, comicInfo, page.Alt, "../style.css")
+	fmt.Fprintf(&b, "<div>\n  <span epub:type=\"pagebreak\" role=\"doc-pagebreak\" id=\"page%d\" aria-label=\"%d\"></span>\n", page.Number, page.Number)
+	fmt.Fprintf(&b, "  <img src=\"../%s\" alt=\"%s\"/>\n</div>\n", page.Image, html.EscapeString(page.Alt))
+	fmt.Fprintf(&b, "</body>\n</html>\n")
+	return b.String()
+}
@@ -2,12 +2,31 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
+	"runtime/debug"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
 func main() {
@@ -16,47 +35,285 @@ func main() {
 		fmt.Println("  打包单个章节: pack chapter_16124")
 		fmt.Println("  批量打包章节: pack chapter_*")
 		fmt.Println("  打包并指定输出目录: pack -o /path/to/output chapter_*")
+		fmt.Println("  打包漫画库中的章节: pack --out /path/to/library '秘密教学/*'")
+		fmt.Println("  指定并发数: pack -j 8 chapter_*")
+		fmt.Println("  跳过已打包的章节: pack --skip-existing chapter_*")
+		fmt.Println("  加密打包: pack --encrypt --password <密码> chapter_*")
+		fmt.Println("  校验压缩包: pack --verify [--password <密码>] *.cbz")
+		fmt.Println("  指定元数据: pack --language zh --writer <作者> --publisher <出版社> --age-rating <分级> chapter_*")
+		fmt.Println("  密码也可以通过环境变量 COMICBOX_PASSWORD 提供，漫画库根目录可以通过 COMICBOX_OUT 提供")
 		return
 	}
 
+	loadTemplateConfig()
+
 	// 解析命令行参数
-	outputDir := "."
+	outputDir := ""
+	libraryRoot := ""
+	workers := runtime.NumCPU()
+	skipExisting := false
+	encrypt := false
+	verify := false
+	password := ""
+	var patterns []string
 	args := os.Args[1:]
-	
-	if args[0] == "-o" && len(args) >= 3 {
-		outputDir = args[1]
-		args = args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-o":
+			if i+1 < len(args) {
+				outputDir = args[i+1]
+				i++
+			}
+		case "-j", "--workers":
+			if i+1 < len(args) {
+				n, err := strconv.Atoi(args[i+1])
+				if err != nil || n < 1 {
+					fmt.Printf("无效的并发数: %s\n", args[i+1])
+					return
+				}
+				workers = n
+				i++
+			}
+		case "--out":
+			if i+1 < len(args) {
+				libraryRoot = args[i+1]
+				i++
+			}
+		case "--skip-existing":
+			skipExisting = true
+		case "--encrypt":
+			encrypt = true
+		case "--password":
+			if i+1 < len(args) {
+				password = args[i+1]
+				i++
+			}
+		case "--verify":
+			verify = true
+		case "--language", "--writer", "--publisher", "--age-rating":
+			if i+1 < len(args) {
+				setMetadataFlag(args[i], args[i+1])
+				i++
+			}
+		default:
+			patterns = append(patterns, args[i])
+		}
+	}
+	if len(patterns) == 0 {
+		fmt.Println("请指定要打包的章节目录")
+		return
 	}
 
-	// 处理通配符模式
-	pattern := args[0]
-	if strings.Contains(pattern, "*") || strings.Contains(pattern, "?") {
-		// 批量处理模式
-		matches, err := filepath.Glob(pattern)
+	// 指定漫画库根目录时，相对路径按根目录解析，未指定 -o 时压缩包放在章节目录旁边
+	if libraryRoot == "" {
+		libraryRoot = os.Getenv("COMICBOX_OUT")
+	}
+	if libraryRoot != "" {
+		for i, pattern := range patterns {
+			if !filepath.IsAbs(pattern) {
+				patterns[i] = filepath.Join(libraryRoot, pattern)
+			}
+		}
+	} else if outputDir == "" {
+		outputDir = "."
+	}
+
+	if password == "" {
+		password = os.Getenv("COMICBOX_PASSWORD")
+	}
+	if verify {
+		archivePassword = password
+		verifyArchives(patterns)
+		return
+	}
+	if encrypt {
+		if password == "" {
+			fmt.Println("加密打包需要通过 --password 或环境变量 COMICBOX_PASSWORD 指定密码")
+			return
+		}
+		archivePassword = password
+	}
+
+	// 单个章节模式
+	if len(patterns) == 1 && !strings.ContainsAny(patterns[0], "*?") {
+		chapterDir := patterns[0]
+		if skipExisting && isUpToDate(chapterDir, outputDir) {
+			fmt.Printf("章节 %s 已打包，跳过\n", chapterDir)
+			return
+		}
+		err := packChapter(chapterDir, outputDir)
 		if err != nil {
-			fmt.Printf("解析模式失败: %v\n", err)
+			fmt.Printf("打包章节失败: %v\n", err)
 			return
 		}
-		
+		fmt.Printf("成功打包章节 %s\n", chapterDir)
+		return
+	}
+
+	// 批量处理模式：展开通配符，shell 已展开的多个目录也一并处理
+	var chapterDirs []string
+	for _, pattern := range patterns {
+		matches := []string{pattern}
+		if strings.ContainsAny(pattern, "*?") {
+			var err error
+			matches, err = filepath.Glob(pattern)
+			if err != nil {
+				fmt.Printf("解析模式失败: %v\n", err)
+				return
+			}
+		}
 		for _, match := range matches {
 			if isDirectory(match) {
-				err := packChapter(match, outputDir)
-				if err != nil {
-					fmt.Printf("打包章节 %s 失败: %v\n", match, err)
-				} else {
-					fmt.Printf("成功打包章节 %s\n", match)
-				}
+				chapterDirs = append(chapterDirs, match)
 			}
 		}
-	} else {
-		// 单个章节模式
-		err := packChapter(pattern, outputDir)
+	}
+
+	packChapters(chapterDirs, outputDir, workers, skipExisting)
+}
+
+// packChapters 使用多个 worker 并发打包章节，逐个输出进度并在结束时打印汇总
+func packChapters(chapterDirs []string, outputDir string, workers int, skipExisting bool) {
+	total := len(chapterDirs)
+	if workers > total {
+		workers = total
+	}
+
+	var (
+		mu                      sync.Mutex
+		done                    int
+		packed, skipped, failed int
+	)
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chapterDir := range jobs {
+				skip := skipExisting && isUpToDate(chapterDir, outputDir)
+				var err error
+				if !skip {
+					err = packChapter(chapterDir, outputDir)
+				}
+
+				mu.Lock()
+				done++
+				switch {
+				case skip:
+					skipped++
+					fmt.Printf("[%d/%d] 章节 %s 已打包，跳过\n", done, total, chapterDir)
+				case err != nil:
+					failed++
+					fmt.Printf("[%d/%d] 打包章节 %s 失败: %v\n", done, total, chapterDir, err)
+				default:
+					packed++
+					fmt.Printf("[%d/%d] 成功打包章节 %s\n", done, total, chapterDir)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, chapterDir := range chapterDirs {
+		jobs <- chapterDir
+	}
+	close(jobs)
+	wg.Wait()
+
+	fmt.Printf("打包完成: 共 %d 个章节，成功 %d，跳过 %d，失败 %d\n", total, packed, skipped, failed)
+}
+
+// verifyArchives 校验压缩包中每个文件的数据是否完整，加密的文件会先解密
+func verifyArchives(patterns []string) {
+	var archives []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
 		if err != nil {
-			fmt.Printf("打包章节失败: %v\n", err)
+			fmt.Printf("解析模式失败: %v\n", err)
 			return
 		}
-		fmt.Printf("成功打包章节 %s\n", pattern)
+		archives = append(archives, matches...)
+	}
+
+	failed := 0
+	for _, archive := range archives {
+		count, err := verifyArchive(archive)
+		if err != nil {
+			failed++
+			fmt.Printf("[失败] %s: %v\n", archive, err)
+			continue
+		}
+		fmt.Printf("[正常] %s (%d 个文件)\n", archive, count)
+	}
+	fmt.Printf("校验完成: 共 %d 个压缩包，失败 %d\n", len(archives), failed)
+}
+
+// verifyArchive 逐个读取压缩包中的文件，返回文件数量
+// 有 provenance.json 时同时按其中的 SHA-256 校验每页（AES 加密的 AE-2 格式没有 CRC，只能这样发现损坏）
+func verifyArchive(path string) (int, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+
+	sums := map[string]string{}
+	var provenance *packProvenance
+	for _, f := range reader.File {
+		data, err := readZipEntry(f)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", f.Name, err)
+		}
+		if f.Name == provenanceName {
+			provenance = &packProvenance{}
+			if err := json.Unmarshal(data, provenance); err != nil {
+				return 0, fmt.Errorf("%s: %v", f.Name, err)
+			}
+			continue
+		}
+		sum := sha256.Sum256(data)
+		sums[f.Name] = hex.EncodeToString(sum[:])
+	}
+	if provenance != nil {
+		for _, file := range provenance.Files {
+			sum, ok := sums[file.Name]
+			switch {
+			case !ok:
+				return 0, fmt.Errorf("缺少 %s 中记录的 %s", provenanceName, file.Name)
+			case sum != file.SHA256:
+				return 0, fmt.Errorf("%s: SHA-256 与 %s 中的记录不一致", file.Name, provenanceName)
+			}
+		}
+	}
+	return len(reader.File), nil
+}
+
+// isUpToDate 检查章节的CBZ文件是否已存在且比章节目录中的所有文件都新
+func isUpToDate(chapterDir, outputDir string) bool {
+	if outputDir == "" {
+		outputDir = filepath.Dir(chapterDir)
+	}
+	outputFile := filepath.Join(outputDir, filepath.Base(chapterDir)+".cbz")
+	archive, err := os.Stat(outputFile)
+	if err != nil {
+		return false
+	}
+
+	dirInfo, err := os.Stat(chapterDir)
+	if err != nil || dirInfo.ModTime().After(archive.ModTime()) {
+		return false
+	}
+	entries, err := os.ReadDir(chapterDir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(archive.ModTime()) {
+			return false
+		}
 	}
+	return true
 }
 
 // packChapter 将单个章节打包成CBZ文件
@@ -66,6 +323,11 @@ func packChapter(chapterDir, outputDir string) error {
 		return fmt.Errorf("章节目录不存在: %s", chapterDir)
 	}
 
+	// 未指定输出目录时放在章节目录旁边
+	if outputDir == "" {
+		outputDir = filepath.Dir(chapterDir)
+	}
+
 	// 检查输出目录是否存在，如果不存在则创建
 	if !isDirectory(outputDir) {
 		err := os.MkdirAll(outputDir, 0755)
@@ -95,17 +357,330 @@ func packChapter(chapterDir, outputDir string) error {
 		return fmt.Errorf("获取图片文件失败: %v", err)
 	}
 
-	// 按顺序添加文件到zip
+	// 有 chapter.json 或 series.json 时写入 ComicInfo.xml，供漫画阅读器和书库软件识别
+	comicInfo, ok, err := buildComicInfo(chapterDir, len(files))
+	if err != nil {
+		return fmt.Errorf("生成 ComicInfo.xml 失败: %v", err)
+	}
+	if ok {
+		if err := addDataToZip(zipWriter, "ComicInfo.xml", comicInfo); err != nil {
+			return fmt.Errorf("添加 ComicInfo.xml 失败: %v", err)
+		}
+	}
+
+	// 按顺序添加文件到zip，同时记录每页的校验和
+	provenance := newProvenance(chapterDir)
 	for _, fileInfo := range files {
-		err := addFileToZip(zipWriter, filepath.Join(chapterDir, fileInfo.Name()), fileInfo.Name())
+		sum, err := addFileToZip(zipWriter, filepath.Join(chapterDir, fileInfo.Name()), fileInfo.Name())
 		if err != nil {
 			return fmt.Errorf("添加文件到zip失败: %v", err)
 		}
+		provenance.Files = append(provenance.Files, provenanceFile{Name: fileInfo.Name(), Size: fileInfo.Size(), SHA256: sum})
+	}
+
+	// 来源记录写入 provenance.json，摘要写入zip注释，压缩包离开漫画库后仍能知道来源并校验内容
+	data, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addDataToZip(zipWriter, provenanceName, data); err != nil {
+		return fmt.Errorf("添加 %s 失败: %v", provenanceName, err)
+	}
+	// 加密的压缩包中注释不加密，不写入来源链接
+	if archivePassword == "" {
+		if err := zipWriter.SetComment(provenance.comment()); err != nil {
+			return fmt.Errorf("写入zip注释失败: %v", err)
+		}
 	}
 
 	return nil
 }
 
+// provenanceName 压缩包中来源记录的文件名
+const provenanceName = "provenance.json"
+
+// provenanceFormat 来源记录的格式版本，也是zip注释的前缀
+const provenanceFormat = "comicbox-provenance/1"
+
+// packProvenance 压缩包的来源记录：来源链接、下载时间、打包工具的版本和每页的校验和
+type packProvenance struct {
+	Format      string           `json:"format"`
+	SourceURL   string           `json:"source_url,omitempty"`
+	SeriesURL   string           `json:"series_url,omitempty"`
+	ChapterID   string           `json:"chapter_id,omitempty"`
+	Title       string           `json:"title,omitempty"`
+	SeriesTitle string           `json:"series_title,omitempty"`
+	ScrapedAt   time.Time        `json:"scraped_at,omitzero"`
+	PackedAt    time.Time        `json:"packed_at"`
+	Tool        string           `json:"tool"`
+	Files       []provenanceFile `json:"files"`
+}
+
+// provenanceFile 压缩包中一个文件的大小和 SHA-256
+type provenanceFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// newProvenance 根据 chapter.json 和 series.json 创建来源记录，文件列表在打包时补充
+func newProvenance(chapterDir string) *packProvenance {
+	var chapter chapterMeta
+	var series seriesMeta
+	readJSONFile(filepath.Join(chapterDir, "chapter.json"), &chapter)
+	readJSONFile(filepath.Join(filepath.Dir(chapterDir), "series.json"), &series)
+	p := &packProvenance{
+		Format:      provenanceFormat,
+		SourceURL:   chapter.SourceURL,
+		SeriesURL:   series.URL,
+		ChapterID:   chapter.ID,
+		Title:       chapter.Title,
+		SeriesTitle: series.Title,
+		ScrapedAt:   chapter.ScrapedAt,
+		PackedAt:    time.Now().UTC().Truncate(time.Second),
+		Tool:        toolVersion(),
+	}
+	if p.SeriesTitle == "" {
+		p.SeriesTitle = chapter.SeriesTitle
+	}
+	return p
+}
+
+// comment zip注释：格式前缀加一行 JSON 摘要（不含文件列表），文件列表的 SHA-256 用于确认 provenance.json 未被修改
+func (p *packProvenance) comment() string {
+	files, _ := json.Marshal(p.Files)
+	sum := sha256.Sum256(files)
+	summary, _ := json.Marshal(struct {
+		SourceURL string    `json:"source_url,omitempty"`
+		ScrapedAt time.Time `json:"scraped_at,omitzero"`
+		PackedAt  time.Time `json:"packed_at"`
+		Tool      string    `json:"tool"`
+		Pages     int       `json:"pages"`
+		Manifest  string    `json:"manifest_sha256"`
+	}{p.SourceURL, p.ScrapedAt, p.PackedAt, p.Tool, len(p.Files), hex.EncodeToString(sum[:])})
+	return provenanceFormat + " " + string(summary)
+}
+
+// toolVersion 打包工具的版本，来自构建信息中的模块版本和提交
+func toolVersion() string {
+	version := "comicbox pack"
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return version
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version += " " + info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			version += " (" + setting.Value[:12] + ")"
+		}
+	}
+	return version
+}
+
+// chapterMeta 下载器写入章节目录的 chapter.json 中打包时用到的字段
+type chapterMeta struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Number      int       `json:"number"`
+	SeriesTitle string    `json:"series_title"`
+	SourceURL   string    `json:"source_url"`
+	ScrapedAt   time.Time `json:"scraped_at"`
+	Published   string    `json:"published"` // 页面上的更新日期，如 2023-05-01，下载时指定了 --extras 才有
+	Notes       string    `json:"notes"`     // 页面上的作者的话，下载时指定了 --extras 才有
+}
+
+// seriesMeta 下载器写入漫画目录的 series.json 中打包时用到的字段
+type seriesMeta struct {
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	bookMetadata
+}
+
+// bookMetadata 语言、作者等出版信息
+type bookMetadata struct {
+	Language  string `json:"language,omitempty"`
+	Writer    string `json:"writer,omitempty"`
+	Publisher string `json:"publisher,omitempty"`
+	AgeRating string `json:"age_rating,omitempty"`
+}
+
+// metadataFlags 命令行指定的出版信息，覆盖 series.json 中的值
+var metadataFlags bookMetadata
+
+// setMetadataFlag 根据参数名设置出版信息
+func setMetadataFlag(flag, value string) {
+	switch flag {
+	case "--language":
+		metadataFlags.Language = value
+	case "--writer":
+		metadataFlags.Writer = value
+	case "--publisher":
+		metadataFlags.Publisher = value
+	case "--age-rating":
+		metadataFlags.AgeRating = value
+	}
+}
+
+// withFlags 返回用命令行参数覆盖后的出版信息
+func (m bookMetadata) withFlags() bookMetadata {
+	if metadataFlags.Language != "" {
+		m.Language = metadataFlags.Language
+	}
+	if metadataFlags.Writer != "" {
+		m.Writer = metadataFlags.Writer
+	}
+	if metadataFlags.Publisher != "" {
+		m.Publisher = metadataFlags.Publisher
+	}
+	if metadataFlags.AgeRating != "" {
+		m.AgeRating = metadataFlags.AgeRating
+	}
+	return m
+}
+
+// comicInfoXML ComicInfo.xml 的内容，元素顺序与 ComicRack 的架构一致
+type comicInfoXML struct {
+	XMLName         xml.Name `xml:"ComicInfo"`
+	XSI             string   `xml:"xmlns:xsi,attr"`
+	XSD             string   `xml:"xmlns:xsd,attr"`
+	Title           string   `xml:"Title,omitempty"`
+	Series          string   `xml:"Series,omitempty"`
+	Number          string   `xml:"Number,omitempty"`
+	Summary         string   `xml:"Summary,omitempty"`
+	Year            int      `xml:"Year,omitempty"`
+	Month           int      `xml:"Month,omitempty"`
+	Day             int      `xml:"Day,omitempty"`
+	Writer          string   `xml:"Writer,omitempty"`
+	Publisher       string   `xml:"Publisher,omitempty"`
+	Web             string   `xml:"Web,omitempty"`
+	PageCount       int      `xml:"PageCount,omitempty"`
+	LanguageISO     string   `xml:"LanguageISO,omitempty"`
+	ScanInformation string   `xml:"ScanInformation,omitempty"`
+	AgeRating       string   `xml:"AgeRating,omitempty"`
+}
+
+// templateConfig 配置文件 .comicbox/config.json 的 templates 中打包时用到的字段：代替内置输出格式的 Go 模板文件
+type templateConfig struct {
+	ComicInfo string `json:"comic_info"` // ComicInfo.xml 的模板
+}
+
+// templates 从配置文件读取的模板设置，没有配置文件时使用内置格式
+var templates templateConfig
+
+// loadTemplateConfig 读取当前目录下 .comicbox/config.json 中的模板设置
+func loadTemplateConfig() {
+	var cfg struct {
+		Templates templateConfig `json:"templates"`
+	}
+	if readJSONFile(filepath.Join(".comicbox", "config.json"), &cfg) {
+		templates = cfg.Templates
+	}
+}
+
+// comicInfoTemplateData 自定义 ComicInfo.xml 模板的数据：内置格式中的各字段，以及 chapter.json 和 series.json 的内容
+type comicInfoTemplateData struct {
+	comicInfoXML
+	ChapterMeta chapterMeta
+	SeriesMeta  seriesMeta
+}
+
+// renderComicInfoTemplate 用配置的模板文件生成 ComicInfo.xml，模板中可以用 xml 函数转义文字
+func renderComicInfoTemplate(file string, data comicInfoTemplateData) ([]byte, error) {
+	tmpl, err := template.New(filepath.Base(file)).Funcs(template.FuncMap{
+		"xml": func(s string) string {
+			var buf bytes.Buffer
+			xml.EscapeText(&buf, []byte(s))
+			return buf.String()
+		},
+	}).ParseFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// buildComicInfo 根据章节目录中的 chapter.json、漫画目录中的 series.json 和命令行指定的出版信息生成 ComicInfo.xml，
+// 都没有时返回false；配置了 ComicInfo.xml 的模板时按模板生成
+func buildComicInfo(chapterDir string, pageCount int) ([]byte, bool, error) {
+	var chapter chapterMeta
+	var series seriesMeta
+	hasChapter := readJSONFile(filepath.Join(chapterDir, "chapter.json"), &chapter)
+	hasSeries := readJSONFile(filepath.Join(filepath.Dir(chapterDir), "series.json"), &series)
+	if !hasChapter && !hasSeries && metadataFlags == (bookMetadata{}) {
+		return nil, false, nil
+	}
+	book := series.bookMetadata.withFlags()
+
+	info := comicInfoXML{
+		XSI:         "http://www.w3.org/2001/XMLSchema-instance",
+		XSD:         "http://www.w3.org/2001/XMLSchema",
+		Title:       chapter.Title,
+		Series:      series.Title,
+		Writer:      book.Writer,
+		Publisher:   book.Publisher,
+		PageCount:   pageCount,
+		LanguageISO: book.Language,
+		AgeRating:   book.AgeRating,
+	}
+	if info.Series == "" {
+		info.Series = chapter.SeriesTitle
+	}
+	if chapter.Number > 0 {
+		info.Number = strconv.Itoa(chapter.Number)
+	}
+	if strings.HasPrefix(chapter.SourceURL, "http://") || strings.HasPrefix(chapter.SourceURL, "https://") {
+		info.Web = chapter.SourceURL
+	} else {
+		info.Web = series.URL
+	}
+	if !chapter.ScrapedAt.IsZero() {
+		info.ScanInformation = "comicbox " + chapter.ScrapedAt.Format("2006-01-02")
+	}
+	// 作者的话作为简介，更新日期作为出版日期
+	info.Summary = chapter.Notes
+	if published, err := time.Parse("2006-01-02", chapter.Published); err == nil {
+		info.Year, info.Month, info.Day = published.Year(), int(published.Month()), published.Day()
+	}
+
+	if templates.ComicInfo != "" {
+		data, err := renderComicInfoTemplate(templates.ComicInfo, comicInfoTemplateData{comicInfoXML: info, ChapterMeta: chapter, SeriesMeta: series})
+		return data, err == nil, err
+	}
+	data, err := xml.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, false, err
+	}
+	return append([]byte(xml.Header), data...), true, nil
+}
+
+// readJSONFile 读取并解析 JSON 文件，文件不存在或格式错误时返回false
+func readJSONFile(path string, v interface{}) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// addDataToZip 将内存中的数据作为文件添加到zip归档
+func addDataToZip(zipWriter *zip.Writer, name string, data []byte) error {
+	if archivePassword != "" {
+		return addEncryptedData(zipWriter, name, data, time.Now())
+	}
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(data)
+	return err
+}
+
 // getImageFiles 获取目录中的所有图片文件并排序
 func getImageFiles(dir string) ([]os.FileInfo, error) {
 	entries, err := os.ReadDir(dir)
@@ -127,50 +702,72 @@ func getImageFiles(dir string) ([]os.FileInfo, error) {
 		// 检查是否为图片文件
 		name := strings.ToLower(entry.Name())
 		if strings.HasSuffix(name, ".jpg") || strings.HasSuffix(name, ".jpeg") ||
-		   strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".gif") {
+		   strings.HasSuffix(name, ".png") || strings.HasSuffix(name, ".gif") ||
+		   strings.HasSuffix(name, ".webp") {
 			files = append(files, info)
 		}
 	}
 
-	// 按文件名排序
+	// 按文件名自然排序，兼容不同的页码位数和起始页码
 	sort.Slice(files, func(i, j int) bool {
-		return files[i].Name() < files[j].Name()
+		return naturalLess(files[i].Name(), files[j].Name())
 	})
 
 	return files, nil
 }
 
-// addFileToZip 将文件添加到zip归档
-func addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) error {
+// addFileToZip 将文件添加到zip归档，返回文件内容的 SHA-256
+func addFileToZip(zipWriter *zip.Writer, filePath, zipPath string) (string, error) {
+	if archivePassword != "" {
+		return addEncryptedFileToZip(zipWriter, filePath, zipPath)
+	}
+
 	// 打开要添加的文件
 	file, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer file.Close()
 
 	// 获取文件信息
 	info, err := file.Stat()
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// 创建zip文件头
 	header, err := zip.FileInfoHeader(info)
 	if err != nil {
-		return err
+		return "", err
 	}
 	header.Name = zipPath
 
 	// 创建zip文件写入器
 	writer, err := zipWriter.CreateHeader(header)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	// 复制文件内容
-	_, err = io.Copy(writer, file)
-	return err
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(writer, hash), file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// addEncryptedFileToZip 将文件加密后添加到zip归档，返回文件内容的 SHA-256
+func addEncryptedFileToZip(zipWriter *zip.Writer, filePath, zipPath string) (string, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), addEncryptedData(zipWriter, zipPath, data, info.ModTime())
 }
 
 // isDirectory 检查路径是否为目录
@@ -180,4 +777,238 @@ func isDirectory(path string) bool {
 		return false
 	}
 	return fileInfo.IsDir()
-}
\ No newline at end of file
+}
+
+// naturalLess 按自然顺序比较文件名，数字部分按数值比较（如 2.jpg 排在 10.jpg 之前）
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			i, j := 0, 0
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			na, nb := strings.TrimLeft(a[:i], "0"), strings.TrimLeft(b[:j], "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[i:], b[j:]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+// isDigit 检查字节是否为数字
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// WinZip AES 加密（AE-2，AES-256），7-Zip、WinRAR、WinZip 等均可解压
+const (
+	aesMethod     = 99
+	aesStrength   = 3
+	aesIterations = 1000
+	aesMACSize    = 10
+)
+
+// archivePassword 加密压缩包使用的密码，为空时不加密
+var archivePassword string
+
+// addEncryptedData 压缩并加密数据后写入zip
+func addEncryptedData(zipWriter *zip.Writer, name string, data []byte, modified time.Time) error {
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(data); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+
+	encrypted, err := encryptAES(compressed.Bytes(), archivePassword)
+	if err != nil {
+		return err
+	}
+
+	header := &zip.FileHeader{
+		Name:               name,
+		Method:             aesMethod,
+		CreatorVersion:     51,
+		ReaderVersion:      51,
+		Flags:              0x1,
+		UncompressedSize64: uint64(len(data)),
+		CompressedSize64:   uint64(len(encrypted)),
+		// AES 扩展字段：厂商版本 AE-2、"AE"、密钥强度、实际压缩方法
+		Extra: []byte{0x01, 0x99, 7, 0, 2, 0, 'A', 'E', aesStrength, byte(zip.Deflate), 0},
+	}
+	if !isASCII(name) {
+		header.Flags |= 0x800
+	}
+	header.SetModTime(modified)
+
+	writer, err := zipWriter.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(encrypted)
+	return err
+}
+
+// encryptAES 按 WinZip AES 格式加密：盐值 + 密码校验值 + 密文 + HMAC
+func encryptAES(data []byte, password string) ([]byte, error) {
+	keySize := 8 * (aesStrength + 1)
+	salt := make([]byte, keySize/2)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := pbkdf2.Key(sha1.New, password, salt, aesIterations, 2*keySize+2)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := winzipCTR(key[:keySize], data)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha1.New, key[keySize:2*keySize])
+	mac.Write(body)
+
+	out := append(salt, key[2*keySize:]...)
+	out = append(out, body...)
+	return append(out, mac.Sum(nil)[:aesMACSize]...), nil
+}
+
+// decryptAES 解密 WinZip AES 数据，并校验密码和 HMAC
+func decryptAES(data []byte, password string, strength byte) ([]byte, error) {
+	keySize := 8 * (int(strength) + 1)
+	saltSize := keySize / 2
+	if strength < 1 || strength > 3 || len(data) < saltSize+2+aesMACSize {
+		return nil, fmt.Errorf("加密数据不完整")
+	}
+	key, err := pbkdf2.Key(sha1.New, password, data[:saltSize], aesIterations, 2*keySize+2)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(key[2*keySize:], data[saltSize:saltSize+2]) {
+		return nil, fmt.Errorf("密码错误")
+	}
+
+	body := data[saltSize+2 : len(data)-aesMACSize]
+	mac := hmac.New(sha1.New, key[keySize:2*keySize])
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil)[:aesMACSize], data[len(data)-aesMACSize:]) {
+		return nil, fmt.Errorf("数据校验失败")
+	}
+	return winzipCTR(key[:keySize], body)
+}
+
+// winzipCTR AES-CTR 加解密，WinZip 的计数器为小端序且从 1 开始
+func winzipCTR(key, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	var counter, stream [aes.BlockSize]byte
+	for i := 0; i < len(data); i += aes.BlockSize {
+		for j := range counter {
+			counter[j]++
+			if counter[j] != 0 {
+				break
+			}
+		}
+		block.Encrypt(stream[:], counter[:])
+		for j := i; j < len(data) && j < i+aes.BlockSize; j++ {
+			out[j] = data[j] ^ stream[j-i]
+		}
+	}
+	return out, nil
+}
+
+// readZipEntry 读取zip中的文件内容，AES 加密的文件使用 archivePassword 解密
+func readZipEntry(f *zip.File) ([]byte, error) {
+	if f.Method != aesMethod {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+
+	if archivePassword == "" {
+		return nil, fmt.Errorf("文件已加密，需要密码")
+	}
+	strength, method, ok := parseAESExtra(f.Extra)
+	if !ok {
+		return nil, fmt.Errorf("无效的 AES 扩展字段")
+	}
+	raw, err := f.OpenRaw()
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(raw)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptAES(data, archivePassword, strength)
+	if err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case zip.Store:
+	case zip.Deflate:
+		plain, err = io.ReadAll(flate.NewReader(bytes.NewReader(plain)))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的压缩方法: %d", method)
+	}
+
+	// AE-1 格式保留了 CRC，AE-2 的 CRC 为 0
+	if f.CRC32 != 0 && crc32.ChecksumIEEE(plain) != f.CRC32 {
+		return nil, fmt.Errorf("CRC 校验失败")
+	}
+	return plain, nil
+}
+
+// parseAESExtra 从扩展字段中解析 AES 密钥强度和实际压缩方法
+func parseAESExtra(extra []byte) (byte, uint16, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+		if id == 0x9901 && size >= 7 {
+			return extra[8], binary.LittleEndian.Uint16(extra[9:]), true
+		}
+		extra = extra[4+size:]
+	}
+	return 0, 0, false
+}
+
+// isASCII 检查字符串是否只包含 ASCII 字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
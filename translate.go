@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// translateConfig 配置文件的 translate：用翻译接口把漫画和章节标题翻译为目标语言，用于目录名和元数据
+// 接口与 LibreTranslate 的 /translate 兼容：POST {"q": [...], "source", "target", "format", "api_key"}，返回 {"translatedText": [...]}
+type translateConfig struct {
+	Endpoint string `json:"endpoint"` // 翻译接口地址，如 https://libretranslate.com/translate
+	Key      string `json:"key"`      // 接口的 API key，不需要时留空
+	Source   string `json:"source"`   // 原文语言，默认 auto
+	Target   string `json:"target"`   // 目标语言，如 en，设置后开启翻译，与 --translate 相同
+}
+
+// translateSettings 翻译设置，由配置文件的 translate 和 --translate 设置
+var translateSettings translateConfig
+
+// translateBatchSize 每次请求最多翻译的标题数
+const translateBatchSize = 50
+
+// translateWarning 接口不可用时只提示一次，之后使用原标题
+var translateWarning sync.Once
+
+// translateEnabled 是否设置了目标语言和接口地址
+func translateEnabled() bool {
+	return translateSettings.Target != "" && translateSettings.Endpoint != ""
+}
+
+// translateTitles 翻译一组标题，返回 原文 -> 译文；漫画库中缓存过的直接使用，其余分批请求翻译接口
+// 接口失败时输出提示，缺少的标题不在返回结果中，调用方使用原标题
+func (db *libraryDB) translateTitles(ctx context.Context, titles []string) map[string]string {
+	result := make(map[string]string)
+	if !translateEnabled() {
+		return result
+	}
+	target := translateSettings.Target
+	if db.Translations == nil {
+		db.Translations = make(map[string]map[string]string)
+	}
+	cache := db.Translations[target]
+	if cache == nil {
+		cache = make(map[string]string)
+		db.Translations[target] = cache
+	}
+
+	var todo []string
+	seen := make(map[string]bool)
+	for _, title := range titles {
+		if title == "" || seen[title] {
+			continue
+		}
+		seen[title] = true
+		if t, ok := cache[title]; ok {
+			result[title] = t
+			continue
+		}
+		todo = append(todo, title)
+	}
+	for start := 0; start < len(todo); start += translateBatchSize {
+		batch := todo[start:min(start+translateBatchSize, len(todo))]
+		translated, err := requestTranslation(ctx, batch)
+		if err != nil {
+			translateWarning.Do(func() {
+				fmt.Printf("翻译标题失败，使用原标题: %v\n", err)
+			})
+			break
+		}
+		for i, title := range batch {
+			if t := sanitizeFileName(translated[i]); t != "" {
+				cache[title] = t
+				result[title] = t
+			}
+		}
+	}
+	return result
+}
+
+// requestTranslation 请求翻译接口翻译一批文字，返回与 texts 一一对应的译文
+func requestTranslation(ctx context.Context, texts []string) ([]string, error) {
+	source := translateSettings.Source
+	if source == "" {
+		source = "auto"
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"q":       texts,
+		"source":  source,
+		"target":  translateSettings.Target,
+		"format":  "text",
+		"api_key": translateSettings.Key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", translateSettings.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "comicbox/"+version)
+	resp, err := (&http.Client{Transport: sharedTransport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, newStatusError(resp, string(msg))
+	}
+	var out struct {
+		TranslatedText []string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("解析翻译结果失败: %v", err)
+	}
+	if len(out.TranslatedText) != len(texts) {
+		return nil, fmt.Errorf("翻译接口返回了 %d 条结果，请求了 %d 条", len(out.TranslatedText), len(texts))
+	}
+	return out.TranslatedText, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// version 发布版本号，发布时用 -ldflags "-X main.version=v1.2.3" 设置，自行编译时为 dev
+var version = "dev"
+
+// buildDetails 构建信息：版本、提交、提交时间、是否有未提交的修改、Go 版本和平台
+type buildDetails struct {
+	Version  string
+	Revision string
+	Time     string
+	Modified bool
+	Go       string
+	Platform string
+}
+
+// readBuildDetails 读取编译时嵌入的构建信息，go install 安装时模块版本作为版本号
+func readBuildDetails() buildDetails {
+	d := buildDetails{Version: version, Go: runtime.Version(), Platform: runtime.GOOS + "/" + runtime.GOARCH}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return d
+	}
+	if d.Version == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		d.Version = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			d.Revision = setting.Value
+		case "vcs.time":
+			d.Time = setting.Value
+		case "vcs.modified":
+			d.Modified = setting.Value == "true"
+		}
+	}
+	return d
+}
+
+// runVersionCommand 输出版本和构建信息
+func runVersionCommand(args []string) {
+	d := readBuildDetails()
+	fmt.Printf("comicbox %s\n", d.Version)
+	if d.Revision != "" {
+		revision := d.Revision
+		if d.Modified {
+			revision += "（有未提交的修改）"
+		}
+		fmt.Printf("提交: %s\n", revision)
+	}
+	if d.Time != "" {
+		fmt.Printf("提交时间: %s\n", d.Time)
+	}
+	fmt.Printf("Go: %s，平台: %s\n", d.Go, d.Platform)
+}
+
+// compareVersions 比较 v1.2.3 形式的版本号，a 较新时返回正数；无法解析的部分按 0 处理，预发布后缀忽略
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < 3; i++ {
+		if pa[i] != pb[i] {
+			return pa[i] - pb[i]
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) [3]int {
+	var parts [3]int
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	for i, field := range strings.SplitN(v, ".", 3) {
+		parts[i], _ = strconv.Atoi(field)
+	}
+	return parts
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imageBackend 图片后处理的实现: auto（默认，安装了 vips 时使用）、vips、go
+// vips（libvips 的命令行程序）处理大量页面时比纯 Go 实现快得多，也支持 WebP
+var imageBackend = "auto"
+
+var vipsLookup struct {
+	once sync.Once
+	path string
+}
+
+// findVips 在 PATH 中查找 vips 程序，只查找一次，未安装时返回空字符串
+func findVips() string {
+	vipsLookup.once.Do(func() {
+		if path, err := exec.LookPath("vips"); err == nil {
+			vipsLookup.path = path
+		} else if imageBackend == "vips" {
+			fmt.Println("警告: 未找到 vips 程序，改用 Go 处理图片")
+		}
+	})
+	return vipsLookup.path
+}
+
+// parseImageBackend 解析 --image-backend 的值
+func parseImageBackend(s string) (string, error) {
+	switch s {
+	case "auto", "vips", "go":
+		return s, nil
+	}
+	return "", fmt.Errorf("图片处理方式只能是 auto、vips 或 go: %s", s)
+}
+
+// vipsProcessor 可以用 vips 命令完成的处理步骤，vips 逐块读写图片，处理长条漫等大图时不需要把整张图片读入内存
+// vipsOps 根据输入图片的宽高返回要执行的操作，每个操作输出一张图片；返回nil时原样保留
+type vipsProcessor interface {
+	vipsOps(width, height int) []vipsOp
+}
+
+// vipsOp 一个 vips 操作及其参数，执行时在操作名之后插入输入和输出文件，如 crop in out 0 0 800 1200
+type vipsOp []string
+
+// vipsCapable 流水线中的所有步骤是否都能用 vips 完成
+func (p *postPipeline) vipsCapable() bool {
+	for _, step := range p.steps {
+		if _, ok := step.(vipsProcessor); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// vipsBackend 返回本次处理应使用的 vips 程序路径
+func (p *postPipeline) vipsBackend() (string, bool) {
+	if imageBackend == "go" || !p.vipsCapable() {
+		return "", false
+	}
+	vips := findVips()
+	return vips, vips != ""
+}
+
+// applyVips 用 vips 依次执行所有步骤，中间结果保存为临时的 .v 文件，最后按输出格式保存
+func (p *postPipeline) applyVips(vips, file string) ([]string, error) {
+	// 临时目录与图片在同一目录下，处理完成后可以直接改名
+	tmpDir, err := os.MkdirTemp(filepath.Dir(file), ".vips-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	current := []string{file}
+	n := 0
+	for _, step := range p.steps {
+		var next []string
+		for _, in := range current {
+			width, height, err := vipsImageSize(vips, in)
+			if err != nil {
+				return nil, err
+			}
+			ops := step.(vipsProcessor).vipsOps(width, height)
+			if ops == nil {
+				next = append(next, in)
+				continue
+			}
+			for _, op := range ops {
+				n++
+				out := filepath.Join(tmpDir, fmt.Sprintf("%d.v", n))
+				if err := runVips(vips, op[0], in, out, op[1:]...); err != nil {
+					return nil, fmt.Errorf("%s: %v", step.(postProcessor).name(), err)
+				}
+				next = append(next, out)
+			}
+		}
+		current = next
+	}
+
+	ext := strings.ToLower(filepath.Ext(file))
+	switch p.format {
+	case "jpeg":
+		ext = ".jpg"
+	case "png":
+		ext = ".png"
+	}
+	main := strings.TrimSuffix(file, filepath.Ext(file)) + ext
+	files := make([]string, len(current))
+	for i, in := range current {
+		files[i] = main
+		if i > 0 {
+			files[i] = pagePartName(main, i+1)
+		}
+		// vips 按扩展名决定输出格式，先写入同扩展名的临时文件
+		tmp := filepath.Join(tmpDir, fmt.Sprintf("out%d%s", i, ext))
+		out := tmp
+		if ext == ".jpg" || ext == ".jpeg" {
+			out += fmt.Sprintf("[Q=%d]", p.quality)
+		}
+		if err := runVips(vips, "copy", in, out); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(tmp, files[i]); err != nil {
+			return nil, err
+		}
+	}
+	if main != file {
+		os.Remove(file)
+	}
+	return files, nil
+}
+
+// runVips 执行 vips 操作，失败时错误中包含 vips 的输出
+func runVips(vips, op, in, out string, args ...string) error {
+	cmd := exec.Command(vips, append([]string{op, longPath(in), longPath(out)}, args...)...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("vips %s 失败: %v: %s", op, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// vipsHeaderPattern vipsheader 输出中的宽高，如 "0001.jpg: 800x12000 uchar, 3 bands, srgb, jpegload"
+var vipsHeaderPattern = regexp.MustCompile(`: (\d+)x(\d+) `)
+
+// vipsImageSize 用 vipsheader 读取图片（包括中间结果 .v 文件）的宽高
+func vipsImageSize(vips, file string) (int, int, error) {
+	header := filepath.Join(filepath.Dir(vips), "vipsheader")
+	if _, err := os.Stat(header); err != nil {
+		if header, err = exec.LookPath("vipsheader"); err != nil {
+			return 0, 0, fmt.Errorf("未找到 vipsheader 程序")
+		}
+	}
+	output, err := exec.Command(header, longPath(file)).Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("vipsheader 失败: %v", err)
+	}
+	m := vipsHeaderPattern.FindSubmatch(output)
+	if m == nil {
+		return 0, 0, fmt.Errorf("无法解析 vipsheader 的输出: %s", strings.TrimSpace(string(output)))
+	}
+	width, _ := strconv.Atoi(string(m[1]))
+	height, _ := strconv.Atoi(string(m[2]))
+	return width, height, nil
+}
+
+// cropOp 裁剪出矩形区域的 vips 操作，区域为空时返回nil
+func cropOp(left, top, width, height int) vipsOp {
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+	return vipsOp{"crop", strconv.Itoa(left), strconv.Itoa(top), strconv.Itoa(width), strconv.Itoa(height)}
+}
+
+func (s cropStep) vipsOps(width, height int) []vipsOp {
+	op := cropOp(s.left, s.top, width-s.left-s.right, height-s.top-s.bottom)
+	if op == nil {
+		return nil
+	}
+	return []vipsOp{op}
+}
+
+func (s resizeStep) vipsOps(width, height int) []vipsOp {
+	if width <= s.width {
+		return nil
+	}
+	return []vipsOp{{"thumbnail", strconv.Itoa(s.width), "--size", "down"}}
+}
+
+func (s splitStep) vipsOps(width, height int) []vipsOp {
+	if width <= height {
+		return nil
+	}
+	mid := width / 2
+	left, right := cropOp(0, 0, mid, height), cropOp(mid, 0, width-mid, height)
+	if s.rtl {
+		return []vipsOp{right, left}
+	}
+	return []vipsOp{left, right}
+}
+
+func (s watermarkStep) vipsOps(width, height int) []vipsOp {
+	if height <= s.height*2 {
+		return nil
+	}
+	if s.top {
+		return []vipsOp{cropOp(0, s.height, width, height-s.height)}
+	}
+	return []vipsOp{cropOp(0, 0, width, height-s.height)}
+}
+
+// runImageBenchCommand 用目录中的图片分别测试 Go 和 vips 两种实现处理同一流水线的耗时，原图不会被修改
+func runImageBenchCommand(args []string) {
+	pipeline := &postPipeline{quality: 90}
+	dir := ""
+	limit := 50
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--post" && i+1 < len(args):
+			if err := pipeline.parsePostStep(args[i+1]); err != nil {
+				fmt.Printf("%v\n", err)
+				return
+			}
+			i++
+		case args[i] == "--limit" && i+1 < len(args):
+			fmt.Sscan(args[i+1], &limit)
+			i++
+		default:
+			dir = args[i]
+		}
+	}
+	if dir == "" {
+		fmt.Println("用法: ./comicbox imagebench <图片目录> [--post <步骤>]... [--limit 50]")
+		return
+	}
+	if !pipeline.enabled() {
+		pipeline.parsePostStep("resize:1200")
+		pipeline.parsePostStep("convert:jpeg:85")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Printf("读取目录失败: %v\n", err)
+		return
+	}
+	var images []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isImageFile(entry.Name()) {
+			images = append(images, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(images)
+	if len(images) > limit {
+		images = images[:limit]
+	}
+	if len(images) == 0 {
+		fmt.Println("目录中没有图片")
+		return
+	}
+
+	fmt.Printf("测试 %d 张图片\n", len(images))
+	fmt.Printf("Go: %s\n", benchBackend(images, pipeline.applyGo))
+	vips := findVips()
+	switch {
+	case vips == "":
+		fmt.Println("vips: 未安装")
+	case !pipeline.vipsCapable():
+		fmt.Println("vips: 流水线中有 vips 不支持的步骤")
+	default:
+		fmt.Printf("vips: %s\n", benchBackend(images, func(file string) ([]string, error) {
+			return pipeline.applyVips(vips, file)
+		}))
+	}
+}
+
+// benchBackend 将图片复制到临时目录后逐张处理，返回耗时、失败数和输出大小的说明
+func benchBackend(images []string, apply func(string) ([]string, error)) string {
+	tmpDir, err := os.MkdirTemp("", "comicbox-bench-")
+	if err != nil {
+		return err.Error()
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var copies []string
+	for _, img := range images {
+		dst := filepath.Join(tmpDir, filepath.Base(img))
+		if err := copyFile(img, dst); err != nil {
+			return err.Error()
+		}
+		copies = append(copies, dst)
+	}
+
+	failed := 0
+	var size int64
+	start := time.Now()
+	for _, file := range copies {
+		files, err := apply(file)
+		if err != nil {
+			failed++
+		}
+		for _, f := range files {
+			size += fileSize(f)
+		}
+	}
+	elapsed := time.Since(start)
+	return fmt.Sprintf("%v（每张 %v），失败 %d 张，输出 %s", elapsed.Round(time.Millisecond),
+		(elapsed / time.Duration(len(copies))).Round(time.Microsecond), failed, formatBytes(size))
+}
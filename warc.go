@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warcRecorder 将所有页面、接口和图片请求及其响应写入 WARC 文件，
+// 保存原始网页供以后重新提取内容；文件名以 .gz 结尾时每条记录单独压缩（.warc.gz）
+type warcRecorder struct {
+	mu   sync.Mutex
+	file *os.File
+	gzip bool
+	next http.RoundTripper
+}
+
+// warc 当前的 WARC 记录器，为nil时不记录，由 --warc 设置
+var warc *warcRecorder
+
+// openWarc 打开（追加）WARC 文件，新文件先写入 warcinfo 记录
+func openWarc(path string) (*warcRecorder, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开 WARC 文件失败: %v", err)
+	}
+	w := &warcRecorder{file: file, gzip: strings.HasSuffix(path, ".gz"), next: meteredTransport}
+
+	if info, err := file.Stat(); err == nil && info.Size() == 0 {
+		fields := fmt.Sprintf("software: comicbox\r\nformat: WARC File Format 1.0\r\nisPartOf: %s\r\n",
+			strings.Join(os.Args[1:], " "))
+		err = w.writeRecord(map[string]string{
+			"WARC-Type":     "warcinfo",
+			"WARC-Filename": file.Name(),
+			"Content-Type":  "application/warc-fields",
+		}, []byte(fields))
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("写入 WARC 文件失败: %v", err)
+		}
+	}
+	return w, nil
+}
+
+// pageTransport 页面和图片请求使用的 Transport，设置了 --warc 时记录请求和响应，设置了 --har 时先经过 HAR 记录器，
+// 最终都经过 meteredTransport 按主机统计
+func pageTransport() http.RoundTripper {
+	if har != nil {
+		return har
+	}
+	if warc != nil {
+		return warc
+	}
+	return meteredTransport
+}
+
+// RoundTrip 发送请求并记录请求和完整的响应，响应体读入内存后交还给调用方
+// 重定向由 http.Client 逐个发送，每一跳都会记录
+func (w *warcRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := w.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	// 响应体已完整读出，按实际长度记录，不再使用分块传输
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+
+	if err := w.record(req, resp, body); err != nil {
+		fmt.Printf("写入 WARC 文件失败: %v\n", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// record 写入一对 request 和 response 记录
+func (w *warcRecorder) record(req *http.Request, resp *http.Response, body []byte) error {
+	reqBlock, err := httputil.DumpRequest(req, false)
+	if err != nil {
+		return err
+	}
+	// DumpResponse 会读取响应体，RoundTrip 在记录后重新设置响应体
+	respBlock, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+
+	uri := req.URL.String()
+	date := time.Now().UTC().Format(time.RFC3339)
+	respID := newWarcRecordID()
+	err = w.writeRecord(map[string]string{
+		"WARC-Type":          "request",
+		"WARC-Target-URI":    uri,
+		"WARC-Date":          date,
+		"WARC-Concurrent-To": respID,
+		"Content-Type":       "application/http; msgtype=request",
+	}, reqBlock)
+	if err != nil {
+		return err
+	}
+	return w.writeRecord(map[string]string{
+		"WARC-Type":           "response",
+		"WARC-Record-ID":      respID,
+		"WARC-Target-URI":     uri,
+		"WARC-Date":           date,
+		"WARC-Payload-Digest": warcDigest(body),
+		"Content-Type":        "application/http; msgtype=response",
+	}, respBlock)
+}
+
+// warcHeaderOrder WARC 记录头的输出顺序，其余字段按字母顺序输出在后面
+var warcHeaderOrder = []string{"WARC-Type", "WARC-Record-ID", "WARC-Date", "WARC-Target-URI"}
+
+// writeRecord 写入一条 WARC 记录，自动补充记录ID、日期、长度和块摘要
+func (w *warcRecorder) writeRecord(headers map[string]string, block []byte) error {
+	if headers["WARC-Record-ID"] == "" {
+		headers["WARC-Record-ID"] = newWarcRecordID()
+	}
+	if headers["WARC-Date"] == "" {
+		headers["WARC-Date"] = time.Now().UTC().Format(time.RFC3339)
+	}
+	headers["WARC-Block-Digest"] = warcDigest(block)
+	headers["Content-Length"] = fmt.Sprint(len(block))
+
+	var buf bytes.Buffer
+	buf.WriteString("WARC/1.0\r\n")
+	for _, key := range warcHeaderOrder {
+		if value := headers[key]; value != "" {
+			fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+		}
+		delete(headers, key)
+	}
+	rest := make([]string, 0, len(headers))
+	for key := range headers {
+		rest = append(rest, key)
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, headers[key])
+	}
+	buf.WriteString("\r\n")
+	buf.Write(block)
+	buf.WriteString("\r\n\r\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.gzip {
+		_, err := w.file.Write(buf.Bytes())
+		return err
+	}
+	// 每条记录单独作为一个 gzip 成员，便于按偏移量读取单条记录
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(buf.Bytes())
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	_, err := w.file.Write(gz.Bytes())
+	return err
+}
+
+// close 关闭 WARC 文件
+func (w *warcRecorder) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// newWarcRecordID 生成 <urn:uuid:...> 形式的记录ID
+func newWarcRecordID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// warcDigest 计算 WARC 使用的 sha1 摘要（base32 编码）
+func warcDigest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
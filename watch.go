@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// runFollowCommand 订阅漫画，可选指定 cron 检查计划
+func runFollowCommand(args []string) {
+	input := ""
+	schedule := ""
+	var alternates []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--cron" && i+1 < len(args) {
+			schedule = args[i+1]
+			i++
+		} else if args[i] == "--alt" && i+1 < len(args) {
+			if t, err := parseTarget(args[i+1]); err != nil || t.kind != targetSeries {
+				fmt.Printf("备用来源必须是目录页链接: %s\n", args[i+1])
+				return
+			}
+			alternates = append(alternates, args[i+1])
+			i++
+		} else if input == "" {
+			input = args[i]
+		}
+	}
+
+	t, err := parseTarget(input)
+	if err != nil {
+		fmt.Printf("解析输入失败: %v\n", err)
+		return
+	}
+	if !t.fromURL {
+		// 订阅时纯数字视为漫画ID
+		t.kind = targetSeries
+	}
+	if t.kind != targetSeries {
+		fmt.Println("只能订阅漫画目录页，请传入漫画ID或 /book/ 链接")
+		return
+	}
+
+	if schedule != "" {
+		if _, err := parseCron(schedule); err != nil {
+			fmt.Printf("检查计划无效: %v\n", err)
+			return
+		}
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	record := db.ensureSeries(t.id)
+	record.Followed = true
+	record.BaseURL = t.baseURL
+	record.Schedule = schedule
+	if len(alternates) > 0 {
+		record.Sources = alternates
+	}
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+		return
+	}
+
+	if schedule != "" {
+		cron, _ := parseCron(schedule)
+		fmt.Printf("已订阅漫画 %s，检查计划: %s（下次检查: %s）\n",
+			t.id, schedule, cron.next(time.Now()).Format("2006-01-02 15:04"))
+	} else {
+		fmt.Printf("已订阅漫画 %s，按全局间隔检查更新\n", t.id)
+	}
+}
+
+// runUnfollowCommand 取消订阅漫画，已下载的内容保留
+func runUnfollowCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Println("请指定要取消订阅的漫画ID")
+		return
+	}
+
+	t, err := parseTarget(args[0])
+	if err != nil {
+		fmt.Printf("解析输入失败: %v\n", err)
+		return
+	}
+
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	record := db.findSeries(t.id)
+	if record == nil || !record.Followed {
+		fmt.Printf("未订阅漫画 %s\n", t.id)
+		return
+	}
+	record.Followed = false
+	if err := db.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+		return
+	}
+	fmt.Printf("已取消订阅漫画 %s\n", t.id)
+}
+
+// runWatchCommand 持续运行，按各漫画的检查计划下载新章节
+func runWatchCommand(args []string) {
+	interval := 6 * time.Hour
+	var policy retentionPolicy
+	for i := 0; i < len(args); i++ {
+		n, err := parseGlobalFlag(args, i)
+		if err == nil && n == 0 {
+			n, err = parseRetentionFlag(args, i, &policy)
+		}
+		if err != nil {
+			fmt.Printf("参数错误: %v\n", err)
+			return
+		}
+		if n > 0 {
+			i += n - 1
+			continue
+		}
+
+		if args[i] == "--interval" && i+1 < len(args) {
+			d, err := time.ParseDuration(args[i+1])
+			if err != nil || d < time.Minute {
+				fmt.Printf("无效的检查间隔: %s\n", args[i+1])
+				return
+			}
+			interval = d
+			i++
+		}
+	}
+
+	fmt.Printf("监视模式已启动，未设置检查计划的漫画每 %v 检查一次，按 Ctrl+C 退出\n", interval)
+
+	for {
+		if checkDueSeries(time.Now(), interval) > 0 && policy.enabled() {
+			// 有漫画检查过更新后执行保留策略
+			if db, err := loadLibrary(); err == nil {
+				pruneLibrary(db, policy, false)
+			}
+		}
+
+		// 对齐到下一分钟，保证 cron 计划按分钟触发
+		now := time.Now()
+		if sleepContext(runContext, now.Truncate(time.Minute).Add(time.Minute).Sub(now)) != nil {
+			fmt.Println("监视模式已退出")
+			return
+		}
+	}
+}
+
+// checkDueSeries 检查所有到期的订阅漫画并下载新章节，返回检查的漫画数
+func checkDueSeries(now time.Time, interval time.Duration) int {
+	due := dueSeries(now, interval)
+	for _, record := range due {
+		checkSeries(record.ID, record.BaseURL, now)
+	}
+	return len(due)
+}
+
+// dueSeries 返回到期需要检查更新的订阅漫画
+func dueSeries(now time.Time, interval time.Duration) []*seriesRecord {
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return nil
+	}
+	var due []*seriesRecord
+	for _, record := range db.Series {
+		if record.Followed && seriesDue(record, now, interval) {
+			due = append(due, record)
+		}
+	}
+	return due
+}
+
+// checkSeries 下载一部漫画的新章节，并将检查时间记录为 now
+func checkSeries(id, baseURL string, now time.Time) {
+	db, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	title := ""
+	if record := db.findSeries(id); record != nil {
+		title = record.Title
+	}
+	fmt.Printf("\n[%s] 检查漫画更新: %s %s\n", now.Format("2006-01-02 15:04"), id, title)
+	siteBaseURL = baseURL
+	downloadSeries(runContext, id, "")
+
+	// downloadSeries 会更新漫画库，重新读取后再记录检查时间
+	latest, err := loadLibrary()
+	if err != nil {
+		fmt.Printf("读取漫画库失败: %v\n", err)
+		return
+	}
+	updated := latest.ensureSeries(id)
+	updated.LastChecked = now
+	if unread := updated.unreadCount(); unread > 0 {
+		fmt.Printf("《%s》有 %d 个未读章节\n", updated.Title, unread)
+	}
+	if err := latest.save(); err != nil {
+		fmt.Printf("保存漫画库失败: %v\n", err)
+	}
+}
+
+// seriesDue 判断漫画当前是否需要检查更新
+func seriesDue(record *seriesRecord, now time.Time, interval time.Duration) bool {
+	if record.Schedule == "" {
+		return now.Sub(record.LastChecked) >= interval
+	}
+	// 从未检查过的漫画立即检查，不从公元1年开始查找计划时间
+	if record.LastChecked.IsZero() {
+		return true
+	}
+
+	schedule, err := parseCron(record.Schedule)
+	if err != nil {
+		fmt.Printf("漫画 %s 的检查计划无效: %v\n", record.ID, err)
+		return false
+	}
+	// 上次检查之后的计划时间已经到了就检查，计划时间在下载或休眠期间过去时也会补上一次
+	next := schedule.next(record.LastChecked)
+	return !next.IsZero() && !next.After(now)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// downloadWindow 允许下载的时间段（本地时间），可以附带该时间段的带宽上限，如 01:00-07:00 或 08:00-23:00@200K
+// 结束时间早于开始时间表示跨过午夜，如 23:00-07:00
+type downloadWindow struct {
+	start, end int   // 一天中的分钟数
+	rate       int64 // 每秒字节数，0 表示使用 --limit-rate 的上限
+}
+
+// parseDownloadWindow 解析 HH:MM-HH:MM[@速率] 格式的时间段
+func parseDownloadWindow(s string) (downloadWindow, error) {
+	var w downloadWindow
+	span, rate, hasRate := strings.Cut(strings.TrimSpace(s), "@")
+	from, to, ok := strings.Cut(span, "-")
+	if !ok {
+		return w, fmt.Errorf("时间段格式应为 HH:MM-HH:MM[@速率]: %s", s)
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return w, err
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return w, err
+	}
+	if hasRate {
+		if w.rate, err = parseByteSize(rate); err != nil || w.rate == 0 {
+			return w, fmt.Errorf("无效的带宽上限: %s", rate)
+		}
+	}
+	return w, nil
+}
+
+// parseClock 解析 HH:MM，返回一天中的分钟数，24:00 表示午夜
+func parseClock(s string) (int, error) {
+	var hour, minute int
+	if n, err := fmt.Sscanf(strings.TrimSpace(s), "%d:%d", &hour, &minute); err != nil || n != 2 ||
+		hour < 0 || minute < 0 || minute > 59 || hour*60+minute > 24*60 {
+		return 0, fmt.Errorf("无效的时间: %s", s)
+	}
+	return (hour*60 + minute) % (24 * 60), nil
+}
+
+// contains 时间是否在时间段内，开始和结束相同时表示全天
+func (w downloadWindow) contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	switch {
+	case w.start == w.end:
+		return true
+	case w.start < w.end:
+		return m >= w.start && m < w.end
+	default:
+		return m >= w.start || m < w.end
+	}
+}
+
+// nextStart 时间段在 t 之后最近一次开始的时间
+func (w downloadWindow) nextStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	start := day.Add(time.Duration(w.start) * time.Minute)
+	if !start.After(t) {
+		start = start.AddDate(0, 0, 1)
+	}
+	return start
+}
+
+// downloadSchedule 下载时间段和带宽上限：设置了时间段时只在时间段内下载
+type downloadSchedule struct {
+	windows []downloadWindow
+	rate    int64 // 默认的带宽上限（每秒字节数），0 表示不限制
+}
+
+// parseWindows 解析多个时间段
+func parseWindows(list []string) ([]downloadWindow, error) {
+	var windows []downloadWindow
+	for _, s := range list {
+		w, err := parseDownloadWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// at 返回 t 时是否允许下载，以及此时的带宽上限
+func (s downloadSchedule) at(t time.Time) (bool, int64) {
+	if len(s.windows) == 0 {
+		return true, s.rate
+	}
+	for _, w := range s.windows {
+		if w.contains(t) {
+			if w.rate > 0 {
+				return true, w.rate
+			}
+			return true, s.rate
+		}
+	}
+	return false, 0
+}
+
+// nextOpen 下一次允许下载的时间
+func (s downloadSchedule) nextOpen(t time.Time) time.Time {
+	if ok, _ := s.at(t); ok {
+		return t
+	}
+	var next time.Time
+	for _, w := range s.windows {
+		if start := w.nextStart(t); next.IsZero() || start.Before(next) {
+			next = start
+		}
+	}
+	return next
+}
+
+// windowsFromFlags 命令行中已经指定了 --window，第一次出现时替换配置文件中的时间段
+var windowsFromFlags bool
+
+// bandwidthLimiter 所有页面和图片下载共用的限速器：不在时间段内时等待，在时间段内按当前的带宽上限限速
+type bandwidthLimiter struct {
+	mu       sync.Mutex
+	schedule downloadSchedule
+	next     time.Time // 已预约的流量全部发送完的时间
+	waiting  bool      // 已输出等待提示
+}
+
+// bandwidth 全局限速器，时间段由 --window 或配置文件的 windows 设置，默认上限由 --limit-rate 或 limit_rate 设置
+var bandwidth = &bandwidthLimiter{}
+
+// setWindows 设置时间段，保留默认的带宽上限
+func (l *bandwidthLimiter) setWindows(windows []downloadWindow) {
+	l.mu.Lock()
+	l.schedule.windows = windows
+	l.mu.Unlock()
+}
+
+// setRate 设置默认的带宽上限
+func (l *bandwidthLimiter) setRate(rate int64) {
+	l.mu.Lock()
+	l.schedule.rate = rate
+	l.mu.Unlock()
+}
+
+// setSchedule 设置时间段和带宽上限，daemon 在执行设置了时间段的任务时临时替换
+func (l *bandwidthLimiter) setSchedule(s downloadSchedule) {
+	l.mu.Lock()
+	l.schedule = s
+	l.mu.Unlock()
+}
+
+// current 当前的时间段设置
+func (l *bandwidthLimiter) current() downloadSchedule {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.schedule
+}
+
+// waitWindow 不在下载时间段内时等待到下一个时间段开始，在发送请求前调用，避免连接长时间空闲
+func (l *bandwidthLimiter) waitWindow() {
+	for {
+		now := time.Now()
+		l.mu.Lock()
+		next := l.schedule.nextOpen(now)
+		if !next.After(now) {
+			l.waiting = false
+			l.mu.Unlock()
+			return
+		}
+		if !l.waiting {
+			fmt.Printf("不在下载时间段内，等待到 %s\n", next.Format("01-02 15:04"))
+			l.waiting = true
+		}
+		l.mu.Unlock()
+		// 每分钟重新检查一次，设置可能被 daemon 修改
+		wait := time.Until(next)
+		if wait > time.Minute {
+			wait = time.Minute
+		}
+		// 中断时不再等待，之后的请求会因为根上下文已取消而立即结束
+		if sleepContext(runContext, wait) != nil {
+			return
+		}
+	}
+}
+
+// take 预约 n 个字节的流量，超过当前的带宽上限时等待
+func (l *bandwidthLimiter) take(n int) {
+	if n <= 0 {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	_, rate := l.schedule.at(now)
+	if rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	at := now
+	if l.next.After(at) {
+		at = l.next
+	}
+	l.next = at.Add(time.Duration(int64(n) * int64(time.Second) / rate))
+	l.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+// reader 返回限速的 Reader，每次最多读取带宽上限的四分之一，使速度比较平稳
+func (l *bandwidthLimiter) reader(r io.Reader) io.Reader {
+	return &limitedReader{r: r, l: l}
+}
+
+type limitedReader struct {
+	r io.Reader
+	l *bandwidthLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if _, rate := lr.l.current().at(time.Now()); rate > 0 {
+		if chunk := int(rate / 4); chunk > 0 && len(p) > chunk {
+			p = p[:chunk]
+		}
+	}
+	n, err := lr.r.Read(p)
+	lr.l.take(n)
+	return n, err
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// windowsMaxPath Windows 传统 API 的路径长度上限（MAX_PATH 为 260，目录还要留出 8.3 文件名的位置）
+const windowsMaxPath = 248
+
+// longPath Windows 上把较长的路径转为 \\?\ 形式的绝对路径，中文标题加上多层章节目录很容易超过 260 个字符
+// Go 的 os 包对绝对路径会自动处理，这里用于传给 vips 等外部程序的路径；其他系统原样返回
+func longPath(path string) string {
+	if runtime.GOOS != "windows" || len(path) < windowsMaxPath || strings.HasPrefix(path, `\\?\`) {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// 网络路径 \\server\share 对应 \\?\UNC\server\share
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
+
+// windowsReservedNames Windows 上不能用作文件名的设备名，带扩展名也不行
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// windowsSafeName Windows 上去掉文件名末尾的点和空格（会被系统静默删掉，导致找不到文件），设备名后加下划线
+func windowsSafeName(name string) string {
+	if runtime.GOOS != "windows" {
+		return name
+	}
+	name = strings.TrimRight(name, ". ")
+	base := name
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if windowsReservedNames[strings.ToUpper(base)] {
+		name = base + "_" + name[len(base):]
+	}
+	return name
+}